@@ -0,0 +1,148 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// parseAnalyticsRange reads the required RFC3339 from/to query params shared by all
+// analytics endpoints. It writes the error response and returns false when invalid.
+func parseAnalyticsRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+    q := r.URL.Query()
+    fromS, toS := q.Get("from"), q.Get("to")
+    if fromS == "" || toS == "" {
+        writeError(w, http.StatusBadRequest, "from and to query params are required (RFC3339 date or datetime)")
+        return time.Time{}, time.Time{}, false
+    }
+    from, err1 := time.Parse(time.RFC3339, fromS)
+    to, err2 := time.Parse(time.RFC3339, toS)
+    if err1 != nil || err2 != nil || !to.After(from) {
+        writeError(w, http.StatusBadRequest, "invalid from/to range")
+        return time.Time{}, time.Time{}, false
+    }
+    return from, to, true
+}
+
+// analyticsPatientScope returns the patient filter for the caller's analytics:
+// own-scoped patients see only their own data, unrestricted callers see unscoped
+// analytics (nil patient id). Analytics can only be narrowed by patient, so any other
+// own-scoped grant is refused. Unrestricted callers may narrow with ?patient_id=;
+// physicians only to linked patients who consented to analytics access.
+func (s *Server) analyticsPatientScope(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+    p, scope, ok := s.permit(w, r, ActAnalyticsRead)
+    if !ok { return nil, false }
+    if scope == ScopeAll {
+        v := r.URL.Query().Get("patient_id")
+        if v == "" { return nil, true }
+        id, err := strconv.ParseInt(v, 10, 64)
+        if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid patient_id"); return nil, false }
+        switch p.Owns {
+        case "":
+        case OwnsPhysician:
+            if !s.authorizePhysicianAccess(w, r, p.UserID, id, ConsentAnalytics) { return nil, false }
+        default:
+            writeError(w, http.StatusForbidden, "analytics cannot be narrowed to a patient by "+p.Owns)
+            return nil, false
+        }
+        return &id, true
+    }
+    if p.Owns != OwnsPatient {
+        writeError(w, http.StatusForbidden, "analytics cannot be limited to "+p.Owns)
+        return nil, false
+    }
+    id := p.UserID
+    return &id, true
+}
+
+func (s *Server) handlePrescriptionsOverTime(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    patientID, ok := s.analyticsPatientScope(w, r)
+    if !ok { return }
+
+    from, to, ok := parseAnalyticsRange(w, r)
+    if !ok { return }
+    bucket := r.URL.Query().Get("bucket")
+    if bucket == "" { bucket = "day" }
+    switch bucket {
+    case "day", "week", "month":
+    default:
+        writeError(w, http.StatusBadRequest, "bucket must be day, week, or month")
+        return
+    }
+
+    results, err := s.repo.PrescriptionsOverTime(r.Context(), from, to, bucket, patientID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to fetch analytics")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "from": from, "to": to, "bucket": bucket, "items": results,
+    })
+}
+
+func (s *Server) handlePhysicianVolume(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    patientID, ok := s.analyticsPatientScope(w, r)
+    if !ok { return }
+
+    from, to, ok := parseAnalyticsRange(w, r)
+    if !ok { return }
+    limit := 10
+    if ls := r.URL.Query().Get("limit"); ls != "" {
+        if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 100 {
+            limit = n
+        } else {
+            writeError(w, http.StatusBadRequest, "limit must be 1..100")
+            return
+        }
+    }
+
+    results, err := s.repo.PhysicianVolume(r.Context(), from, to, limit, patientID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to fetch analytics")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "from": from, "to": to, "limit": limit, "items": results,
+    })
+}
+
+// handleAdminStats serves GET /admin/stats?limit=5, the admin dashboard in one call:
+// patient, physician, and prescription counts, the month's top prescribers, and
+// database health
+func (s *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if _, ok := s.can(w, r, ActStatsRead, Resource{}); !ok { return }
+    limit := 5
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 || n > 50 { writeError(w, http.StatusBadRequest, "limit must be 1..50"); return }
+        limit = n
+    }
+    now := time.Now()
+    health := s.dbHealth(r.Context())
+    stats, err := s.repo.Stats(r.Context(), now, limit)
+    if err != nil {
+        if health.Status == "down" { writeError(w, http.StatusServiceUnavailable, "database unavailable"); return }
+        writeError(w, http.StatusInternalServerError, "failed to compute stats")
+        return
+    }
+    writeJSON(w, http.StatusOK, struct {
+        *AdminStats
+        DB          DBHealth  `json:"db"`
+        GeneratedAt time.Time `json:"generated_at"`
+    }{stats, health, now.UTC()})
+}
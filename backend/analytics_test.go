@@ -0,0 +1,111 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+func TestTruncateTime(t *testing.T) {
+    ts := time.Date(2025, 3, 13, 15, 4, 5, 0, time.UTC) // Thursday
+    cases := map[string]time.Time{
+        "day":   time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC),
+        "week":  time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+        "month": time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+    }
+    for bucket, want := range cases {
+        if got := truncateTime(ts, bucket); !got.Equal(want) {
+            t.Errorf("truncateTime(%s) = %v, want %v", bucket, got, want)
+        }
+    }
+}
+
+func TestAnalyticsEndpoints(t *testing.T) {
+    now := time.Now().UTC()
+    rng := "from=" + now.Add(-30*24*time.Hour).Format(time.RFC3339) + "&to=" + now.Add(time.Hour).Format(time.RFC3339)
+
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        userID       string
+        expectStatus int
+        expectCount  int64 // summed prescription count across returned items
+    }{
+        {name: "over time admin", path: "/analytics/prescriptions-over-time?bucket=month&" + rng, role: "admin", userID: "1", expectStatus: http.StatusOK, expectCount: 4},
+        {name: "over time patient scoped", path: "/analytics/prescriptions-over-time?" + rng, role: "patient", userID: "1", expectStatus: http.StatusOK, expectCount: 2},
+        {name: "over time bad bucket", path: "/analytics/prescriptions-over-time?bucket=year&" + rng, role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "volume admin", path: "/analytics/physician-volume?" + rng, role: "admin", userID: "1", expectStatus: http.StatusOK, expectCount: 4},
+        {name: "volume patient scoped", path: "/analytics/physician-volume?" + rng, role: "patient", userID: "2", expectStatus: http.StatusOK, expectCount: 1},
+        {name: "volume missing range", path: "/analytics/physician-volume", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusOK { return }
+
+            var resp struct {
+                Items []struct {
+                    Count         int64 `json:"count"`
+                    Prescriptions int64 `json:"prescription_count"`
+                } `json:"items"`
+            }
+            if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+            var total int64
+            for _, it := range resp.Items { total += it.Count + it.Prescriptions }
+            if total != tc.expectCount {
+                t.Fatalf("total count = %d, want %d", total, tc.expectCount)
+            }
+        })
+    }
+}
+
+func TestAdminStats(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(3)
+    f.NewPatient("Bob").WithPhysician("Dr. Jones").WithPrescriptions(1)
+    f.NewPatient("Carol")
+    m, ids := fixtureMemory(f)
+    // One of Alice's prescriptions is from last year, and Carol is deleted
+    p := m.prescriptions[1]
+    p.PrescribedAt = p.PrescribedAt.AddDate(-1, 0, 0)
+    m.prescriptions[1] = p
+    m.deleted[memoryRef{"patients", ids.Patients["Carol"]}] = time.Now()
+    srv := NewServer(m, defaultConfig())
+
+    if rr := consentRequest(srv, http.MethodGet, "/admin/stats", "", "physician", "1"); rr.Code != http.StatusForbidden { t.Fatalf("physician status = %d", rr.Code) }
+    if rr := consentRequest(srv, http.MethodGet, "/admin/stats?limit=0", "", "admin", "1"); rr.Code != http.StatusBadRequest { t.Fatalf("limit=0 status = %d", rr.Code) }
+    rr := consentRequest(srv, http.MethodGet, "/v1/admin/stats?limit=1", "", "admin", "1")
+    var resp struct {
+        AdminStats
+        DB DBHealth `json:"db"`
+    }
+    if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK { t.Fatalf("GET /admin/stats = %d %s", rr.Code, rr.Body.String()) }
+    // Fixture prescriptions are an hour apart ending now, so the remaining three may straddle a week or month start
+    week, month := truncateTime(time.Now(), "week"), truncateTime(time.Now(), "month")
+    var inWeek, inMonth int64
+    for id, p := range m.prescriptions {
+        if id == 1 { continue }
+        if !p.PrescribedAt.Before(week) { inWeek++ }
+        if !p.PrescribedAt.Before(month) { inMonth++ }
+    }
+    if resp.Patients != 2 || resp.Physicians != 2 || resp.Prescriptions != 4 || resp.AvgPrescriptionsPerPatient != 2 ||
+        resp.PrescriptionsThisWeek != inWeek || resp.PrescriptionsThisMonth != inMonth || resp.DB.Status != "unknown" {
+        t.Fatalf("stats = %s", rr.Body.String())
+    }
+    if inMonth == 3 && (len(resp.TopPrescribers) != 1 || resp.TopPrescribers[0].PhysicianName != "Dr. Smith" || resp.TopPrescribers[0].Prescriptions != 2) {
+        t.Fatalf("top prescribers = %+v", resp.TopPrescribers)
+    }
+}
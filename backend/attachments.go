@@ -0,0 +1,241 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io"
+    "log"
+    "mime"
+    "net/http"
+    "path"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// defaultAttachmentMaxBytes bounds uploaded files unless ATTACHMENT_MAX_BYTES says otherwise
+const defaultAttachmentMaxBytes = 10 << 20
+
+// attachmentFormOverhead is room for the multipart framing and form fields around the file
+const attachmentFormOverhead = 64 << 10
+
+// attachmentUploadPath matches the upload endpoint, whose body limit and Content-Type
+// differ from the JSON endpoints (see limitBody)
+var attachmentUploadPath = regexp.MustCompile(`^(/v1)?/prescriptions/[0-9]+/attachments$`)
+
+// attachmentTypes are the accepted file types, as sniffed from the content rather than
+// taken from the client
+var attachmentTypes = map[string]bool{
+    "application/pdf": true, "image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true,
+}
+
+// Attachment kinds
+const (
+    AttachmentLabResult = "lab_result"
+    AttachmentImage     = "image"
+    AttachmentOther     = "other"
+)
+
+// PrescriptionAttachment describes a file attached to a prescription; the content is in
+// the BlobStore under StorageKey
+type PrescriptionAttachment struct {
+    ID             int64     `json:"id"`
+    PrescriptionID int64     `json:"prescription_id"`
+    Kind           string    `json:"kind"`
+    Filename       string    `json:"filename"`
+    ContentType    string    `json:"content_type"`
+    SizeBytes      int64     `json:"size_bytes"`
+    SHA256         string    `json:"sha256"`
+    StorageKey     string    `json:"-"`
+    UploadedByRole Role      `json:"uploaded_by_role"`
+    UploadedByID   int64     `json:"uploaded_by_id"`
+    CreatedAt      time.Time `json:"created_at"`
+}
+
+// attachmentKey names a new blob. It carries no patient data or client-supplied names,
+// since object keys show up in storage listings and access logs.
+func attachmentKey(prescriptionID int64) string {
+    return "prescriptions/" + strconv.FormatInt(prescriptionID, 10) + "/" + newRandomID("att_")
+}
+
+// cleanFilename keeps the base name of a client-supplied filename, without control
+// characters, capped at 255 bytes
+func cleanFilename(name string) string {
+    name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+    name = strings.Map(func(r rune) rune {
+        if unicode.IsControl(r) { return -1 }
+        return r
+    }, name)
+    if name == "." || name == "/" { return "" }
+    if len(name) > 255 { name = name[:255] }
+    return strings.ToValidUTF8(name, "")
+}
+
+// authorizePrescriptionAccess checks that a caller granted a prescription action at scope
+// may use p, by the rules of GET /prescriptions: unrestricted callers, the prescriber while
+// the patient consents to it (see physicianCanRead), the drafting nurse, and, once it is no
+// longer a pending draft, the patient and the routed pharmacy. It writes the error response
+// and returns false when access is denied.
+func (s *Server) authorizePrescriptionAccess(w http.ResponseWriter, r *http.Request, caller Principal, scope Scope, p *Prescription) bool {
+    if scope == ScopeAll { return true }
+    res := Resource{PatientID: p.PatientID, PhysicianID: p.PhysicianID}
+    if p.PharmacyID != nil { res.PharmacyID = *p.PharmacyID }
+    if p.DraftedBy != nil { res.NurseID = *p.DraftedBy }
+    hiddenDraft := p.Status == PrescriptionPendingSignature && (caller.Owns == OwnsPatient || caller.Owns == OwnsPharmacy)
+    ok := res.ownedBy(caller) && !hiddenDraft
+    if ok && caller.Owns == OwnsPhysician {
+        var err error
+        ok, err = s.physicianCanRead(r.Context(), caller.UserID, p.PatientID)
+        if err != nil { writeError(w, http.StatusInternalServerError, "consent check failed"); return false }
+    }
+    if ok { return true }
+    // Prescriptions the caller can't list are indistinguishable from missing ones
+    writeError(w, http.StatusNotFound, "prescription not found")
+    return false
+}
+
+// handlePrescriptionAttachments serves the files attached to a prescription:
+//   GET  /prescriptions/{id}/attachments        metadata, oldest first
+//   POST /prescriptions/{id}/attachments        multipart/form-data: file, optional kind
+//   GET  /prescriptions/{id}/attachments/{aid}  the file itself
+func (s *Server) handlePrescriptionAttachments(w http.ResponseWriter, r *http.Request, id int64, tail string) {
+    var attachmentID int64
+    if rest := strings.TrimPrefix(tail, "attachments"); rest != "" {
+        n, err := strconv.ParseInt(strings.TrimPrefix(rest, "/"), 10, 64)
+        if err != nil || n <= 0 || !strings.HasPrefix(rest, "/") { writeError(w, http.StatusNotFound, "not found"); return }
+        attachmentID = n
+    }
+    allow := http.MethodGet
+    if attachmentID == 0 { allow += ", " + http.MethodPost }
+    if r.Method != http.MethodGet && (attachmentID != 0 || r.Method != http.MethodPost) {
+        w.Header().Set("Allow", allow)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    action := ActAttachmentRead
+    if r.Method == http.MethodPost { action = ActAttachmentWrite }
+    // Reject callers without the permission before revealing whether the prescription exists
+    caller, scope, ok := s.permit(w, r, action)
+    if !ok { return }
+    if s.blobs == nil { writeError(w, http.StatusServiceUnavailable, "attachment storage is not configured"); return }
+    p, err := s.repo.GetPrescription(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "prescription not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch prescription")
+        return
+    }
+    if !s.authorizePrescriptionAccess(w, r, caller, scope, p) { return }
+
+    switch {
+    case r.Method == http.MethodPost:
+        s.uploadAttachment(w, r, caller, id)
+    case attachmentID != 0:
+        s.downloadAttachment(w, r, id, attachmentID)
+    default:
+        items, err := s.repo.ListPrescriptionAttachments(r.Context(), id)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list attachments"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    }
+}
+
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request, caller Principal, id int64) {
+    mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil || mt != "multipart/form-data" {
+        writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be multipart/form-data")
+        return
+    }
+    mr, err := r.MultipartReader()
+    if err != nil { writeError(w, http.StatusBadRequest, "invalid multipart body"); return }
+    a := &PrescriptionAttachment{PrescriptionID: id, UploadedByRole: caller.Role, UploadedByID: caller.UserID}
+    var data []byte
+    var seenFile bool
+    for {
+        part, err := mr.NextPart()
+        if errors.Is(err, io.EOF) { break }
+        if err != nil { writeBodyError(w, err); return }
+        switch part.FormName() {
+        case "file":
+            if seenFile { writeError(w, http.StatusBadRequest, "only one file may be uploaded per request"); return }
+            seenFile = true
+            a.Filename = cleanFilename(part.FileName())
+            // One byte past the limit tells an oversized file from one exactly at it
+            data, err = io.ReadAll(io.LimitReader(part, int64(s.cfg.AttachmentMaxBytes)+1))
+            if err != nil { writeBodyError(w, err); return }
+            if len(data) > s.cfg.AttachmentMaxBytes {
+                writeError(w, http.StatusRequestEntityTooLarge, "file exceeds "+strconv.Itoa(s.cfg.AttachmentMaxBytes)+" bytes")
+                return
+            }
+        case "kind":
+            b, err := io.ReadAll(io.LimitReader(part, 64))
+            if err != nil { writeBodyError(w, err); return }
+            a.Kind = strings.TrimSpace(string(b))
+        default:
+            writeError(w, http.StatusBadRequest, "unknown form field "+strconv.Quote(part.FormName()))
+            return
+        }
+    }
+    if !seenFile || len(data) == 0 { writeError(w, http.StatusBadRequest, "file is required"); return }
+    if a.Filename == "" { writeError(w, http.StatusBadRequest, "file must have a filename"); return }
+    a.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+    if !attachmentTypes[a.ContentType] {
+        writeError(w, http.StatusUnsupportedMediaType, "file must be a PDF or a PNG, JPEG, GIF, or WebP image")
+        return
+    }
+    switch a.Kind {
+    case "":
+        a.Kind = AttachmentOther
+        if strings.HasPrefix(a.ContentType, "image/") { a.Kind = AttachmentImage }
+    case AttachmentLabResult, AttachmentImage, AttachmentOther:
+    default:
+        writeError(w, http.StatusBadRequest, "kind must be lab_result, image, or other")
+        return
+    }
+    sum := sha256.Sum256(data)
+    a.SHA256, a.SizeBytes, a.StorageKey = hex.EncodeToString(sum[:]), int64(len(data)), attachmentKey(id)
+
+    if err := s.blobs.Put(r.Context(), a.StorageKey, a.ContentType, data); err != nil {
+        log.Printf("attachments: storing %s failed: %v", a.StorageKey, err)
+        writeError(w, http.StatusBadGateway, "failed to store attachment")
+        return
+    }
+    created, err := s.repo.CreatePrescriptionAttachment(r.Context(), a)
+    if err != nil {
+        // Don't leave an unreferenced blob behind
+        if derr := s.blobs.Delete(context.WithoutCancel(r.Context()), a.StorageKey); derr != nil {
+            log.Printf("attachments: removing orphaned %s failed: %v", a.StorageKey, derr)
+        }
+        if errors.Is(err, ErrInvalidReference) { writeError(w, http.StatusNotFound, "prescription not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to save attachment")
+        return
+    }
+    s.audit(r, AuditAttach, "prescription_attachment", created.ID)
+    writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) downloadAttachment(w http.ResponseWriter, r *http.Request, prescriptionID, id int64) {
+    a, err := s.repo.GetPrescriptionAttachment(r.Context(), prescriptionID, id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "attachment not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch attachment")
+        return
+    }
+    body, err := s.blobs.Get(r.Context(), a.StorageKey)
+    if err != nil {
+        log.Printf("attachments: reading %s failed: %v", a.StorageKey, err)
+        writeError(w, http.StatusBadGateway, "failed to read attachment")
+        return
+    }
+    defer body.Close()
+    w.Header().Set("Content-Type", a.ContentType)
+    w.Header().Set("Content-Length", strconv.FormatInt(a.SizeBytes, 10))
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusOK)
+    if _, err := io.Copy(w, body); err != nil {
+        log.Printf("attachments: sending %s failed: %v", a.StorageKey, err)
+    }
+}
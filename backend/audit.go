@@ -0,0 +1,59 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "time"
+)
+
+// Audit actions recorded in audit_log
+const (
+    AuditDelete    = "delete"
+    AuditAnonymize = "anonymize"
+    // Bulk prescription status changes (see bulk.go)
+    AuditCancel = "cancel"
+    AuditExpire = "expire"
+    // AuditSign records a physician signing a delegated draft
+    AuditSign = "sign"
+    // Patients granting and revoking physician access (see consent.go)
+    AuditConsentGrant  = "consent_grant"
+    AuditConsentRevoke = "consent_revoke"
+    // AuditOrgCreate records a new organization (tenant)
+    AuditOrgCreate = "org_create"
+    // AuditPatientRegister records a patient created from an HL7 ADT feed
+    AuditPatientRegister = "patient_register"
+    // AuditAttach records a file uploaded to a prescription (see attachments.go)
+    AuditAttach = "attach"
+    // AuditTransfer records a patient moved between physicians, and each prescription
+    // moved with them (see transfer.go)
+    AuditTransfer = "transfer"
+)
+
+// auditActorRetention identifies the background retention job as the actor
+const auditActorRetention = "system:retention"
+
+// AuditEntry is one row of the append-only audit log. Actor is "role:user_id" for
+// API callers or "system:<job>" for background jobs.
+type AuditEntry struct {
+    ID        int64     `json:"id"`
+    Actor     string    `json:"actor"`
+    Action    string    `json:"action"`
+    Entity    string    `json:"entity"`
+    EntityID  int64     `json:"entity_id"`
+    Detail    string    `json:"detail,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// auditActor names the caller of r for audit entries
+func auditActor(r *http.Request) string {
+    return r.Header.Get("X-Role") + ":" + r.Header.Get("X-User-ID")
+}
+
+// audit records an action taken by the caller of r. The action already happened, so a
+// failure to record it is logged rather than failing the request.
+func (s *Server) audit(r *http.Request, action, entity string, id int64) {
+    e := AuditEntry{Actor: auditActor(r), Action: action, Entity: entity, EntityID: id}
+    if err := s.repo.RecordAudit(r.Context(), e); err != nil {
+        log.Printf("audit: recording %s %s %d failed: %v", action, entity, id, err)
+    }
+}
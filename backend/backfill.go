@@ -0,0 +1,319 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// backfillTask is one kind of data backfill. Tasks walk their rows in id order from a
+// cursor, so a job can stop after any batch and later resume where it left off; rows that
+// were already backfilled no longer match, which makes re-running a task safe.
+type backfillTask struct {
+    // unavailable explains why the task can't run in this deployment, or returns ""
+    unavailable func(s *Server) string
+    // remaining counts rows with id > after that still need the backfill
+    remaining func(ctx context.Context, s *Server, after int64) (int, error)
+    // batch processes up to limit rows with id > after. It returns the id of the last row
+    // it finished (even when it fails part-way), how many rows it looked at, and how many
+    // it changed.
+    batch func(ctx context.Context, s *Server, after int64, limit int) (last int64, processed, updated int, err error)
+}
+
+// backfillTasks are the backfills admins can run without a maintenance window
+var backfillTasks = map[string]backfillTask{
+    // drug_rxnorm normalizes catalog entries created before the RxNorm integration was enabled
+    "drug_rxnorm": {
+        unavailable: func(s *Server) string {
+            if s.rxnorm == nil { return "drug_rxnorm requires RXNORM_ENABLED=1" }
+            return ""
+        },
+        remaining: func(ctx context.Context, s *Server, after int64) (int, error) {
+            return s.repo.CountDrugsMissingRxNorm(ctx, after)
+        },
+        batch: func(ctx context.Context, s *Server, after int64, limit int) (int64, int, int, error) {
+            drugs, err := s.repo.ListDrugsMissingRxNorm(ctx, after, limit)
+            if err != nil { return after, 0, 0, err }
+            last, updated := after, 0
+            for i, d := range drugs {
+                c, err := s.rxnorm.Resolve(ctx, d.Name)
+                if err != nil { return last, i, updated, err }
+                if c != nil {
+                    if err := s.repo.SetDrugRxNorm(ctx, d.ID, *c); err != nil { return last, i, updated, err }
+                    updated++
+                }
+                last = d.ID
+            }
+            return last, len(drugs), updated, nil
+        },
+    },
+}
+
+// Backfill job states; queued, running, and paused jobs are still in progress
+const (
+    BackfillQueued    = "queued"
+    BackfillRunning   = "running"
+    BackfillPaused    = "paused"
+    BackfillSucceeded = "succeeded"
+    BackfillFailed    = "failed"
+)
+
+const (
+    defaultBackfillBatchSize = 100
+    maxBackfillBatchSize     = 1000
+    // defaultBackfillDelay throttles a job between batches so it doesn't compete with traffic
+    defaultBackfillDelay = 200 * time.Millisecond
+    maxBackfillDelay     = time.Minute
+)
+
+// BackfillJob is a long-running backfill. Cursor is the last row id finished; pausing, or
+// resuming a failed job, continues from there. Total is the number of rows still needing
+// the backfill when the job (or its latest resume) started.
+type BackfillJob struct {
+    ID         int64      `json:"id"`
+    Task       string     `json:"task"`
+    Status     string     `json:"status"`
+    BatchSize  int        `json:"batch_size"`
+    DelayMS    int        `json:"delay_ms"`
+    Cursor     int64      `json:"cursor"`
+    Total      int        `json:"total"`
+    Processed  int        `json:"processed"`
+    Updated    int        `json:"updated"`
+    Error      string     `json:"error,omitempty"`
+    CreatedBy  string     `json:"created_by"`
+    CreatedAt  time.Time  `json:"created_at"`
+    UpdatedAt  time.Time  `json:"updated_at"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+    pauseRequested bool
+}
+
+var (
+    errBackfillConflict = errors.New("a job for this task is already in progress")
+    errBackfillState    = errors.New("job is not in a state that allows this")
+)
+
+// backfillJobs is the in-process job registry. Like bulk jobs, job state is not persisted;
+// after a restart a new job with after_id set to the last reported cursor picks up the rest.
+type backfillJobs struct {
+    mu   sync.Mutex
+    seq  int64
+    jobs map[int64]*BackfillJob
+}
+
+func newBackfillJobs() *backfillJobs {
+    return &backfillJobs{jobs: map[int64]*BackfillJob{}}
+}
+
+// add registers j unless another job for the same task is still in progress
+func (b *backfillJobs) add(j BackfillJob) (BackfillJob, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for _, other := range b.jobs {
+        if other.Task == j.Task && backfillInProgress(other.Status) { return BackfillJob{}, errBackfillConflict }
+    }
+    b.seq++
+    j.ID = b.seq
+    b.jobs[j.ID] = &j
+    return j, nil
+}
+
+func backfillInProgress(status string) bool {
+    return status == BackfillQueued || status == BackfillRunning || status == BackfillPaused
+}
+
+func (b *backfillJobs) get(id int64) (BackfillJob, bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    j, ok := b.jobs[id]
+    if !ok { return BackfillJob{}, false }
+    return *j, true
+}
+
+// list returns all jobs, newest first
+func (b *backfillJobs) list() []BackfillJob {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    out := make([]BackfillJob, 0, len(b.jobs))
+    for _, j := range b.jobs { out = append(out, *j) }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+    return out
+}
+
+func (b *backfillJobs) update(id int64, fn func(*BackfillJob)) BackfillJob {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    j, ok := b.jobs[id]
+    if !ok { return BackfillJob{} }
+    fn(j)
+    j.UpdatedAt = time.Now().UTC()
+    return *j
+}
+
+// pause asks a queued or running job to stop after its current batch
+func (b *backfillJobs) pause(id int64) (BackfillJob, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    j, ok := b.jobs[id]
+    if !ok { return BackfillJob{}, ErrNotFound }
+    if j.Status != BackfillQueued && j.Status != BackfillRunning { return BackfillJob{}, errBackfillState }
+    j.pauseRequested = true
+    return *j, nil
+}
+
+// resume requeues a paused or failed job from its cursor. It fails while another job for
+// the same task is in progress, so two runners never share a cursor.
+func (b *backfillJobs) resume(id int64) (BackfillJob, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    j, ok := b.jobs[id]
+    if !ok { return BackfillJob{}, ErrNotFound }
+    if j.Status != BackfillPaused && j.Status != BackfillFailed { return BackfillJob{}, errBackfillState }
+    for _, other := range b.jobs {
+        if other.ID != id && other.Task == j.Task && backfillInProgress(other.Status) { return BackfillJob{}, errBackfillConflict }
+    }
+    j.Status, j.Error, j.FinishedAt, j.pauseRequested = BackfillQueued, "", nil, false
+    j.UpdatedAt = time.Now().UTC()
+    return *j, nil
+}
+
+// runBackfillJob processes a queued job batch by batch, sleeping DelayMS between batches
+// and checking for a pause request before each one.
+func (s *Server) runBackfillJob(id int64) {
+    ctx := context.Background()
+    job, ok := s.backfills.get(id)
+    if !ok { return }
+    task := backfillTasks[job.Task]
+    finish := func(status string, err error) {
+        s.backfills.update(id, func(j *BackfillJob) {
+            j.Status = status
+            if status != BackfillPaused {
+                now := time.Now().UTC()
+                j.FinishedAt = &now
+            }
+            if err != nil { j.Error = err.Error() }
+        })
+        if err != nil { log.Printf("backfill: job %d (%s) failed at cursor %d: %v", id, job.Task, job.Cursor, err) }
+    }
+
+    total, err := task.remaining(ctx, s, job.Cursor)
+    if err != nil { finish(BackfillFailed, err); return }
+    job = s.backfills.update(id, func(j *BackfillJob) { j.Status, j.Total = BackfillRunning, total })
+    delay := time.Duration(job.DelayMS) * time.Millisecond
+    for {
+        if j, _ := s.backfills.get(id); j.pauseRequested {
+            log.Printf("backfill: job %d (%s) paused at cursor %d", id, job.Task, job.Cursor)
+            finish(BackfillPaused, nil)
+            return
+        }
+        last, processed, updated, err := task.batch(ctx, s, job.Cursor, job.BatchSize)
+        job = s.backfills.update(id, func(j *BackfillJob) {
+            j.Cursor = last
+            j.Processed += processed
+            j.Updated += updated
+        })
+        if err != nil { finish(BackfillFailed, err); return }
+        if processed < job.BatchSize { finish(BackfillSucceeded, nil); return }
+        time.Sleep(delay)
+    }
+}
+
+// handleBackfillJobs serves admin backfills:
+//   GET  /backfill-jobs  list jobs, newest first
+//   POST /backfill-jobs  {"task":"drug_rxnorm","batch_size":100,"delay_ms":200,"after_id":0}
+// The job runs in the background; 202 points at its status.
+func (s *Server) handleBackfillJobs(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActBackfillRun, Resource{}); !ok { return }
+    switch r.Method {
+    case http.MethodGet:
+        writeJSON(w, http.StatusOK, map[string]any{"items": s.backfills.list()})
+    case http.MethodPost:
+        var req struct {
+            Task      string `json:"task"`
+            BatchSize *int   `json:"batch_size"`
+            DelayMS   *int   `json:"delay_ms"`
+            AfterID   int64  `json:"after_id"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        task, ok := backfillTasks[req.Task]
+        if !ok { writeError(w, http.StatusBadRequest, "unknown task"); return }
+        if msg := task.unavailable(s); msg != "" { writeError(w, http.StatusBadRequest, msg); return }
+        batchSize := defaultBackfillBatchSize
+        if req.BatchSize != nil {
+            if *req.BatchSize < 1 || *req.BatchSize > maxBackfillBatchSize {
+                writeError(w, http.StatusBadRequest, "batch_size must be 1.."+strconv.Itoa(maxBackfillBatchSize))
+                return
+            }
+            batchSize = *req.BatchSize
+        }
+        delayMS := int(defaultBackfillDelay / time.Millisecond)
+        if req.DelayMS != nil {
+            if *req.DelayMS < 0 || *req.DelayMS > int(maxBackfillDelay/time.Millisecond) {
+                writeError(w, http.StatusBadRequest, "delay_ms must be 0.."+strconv.Itoa(int(maxBackfillDelay/time.Millisecond)))
+                return
+            }
+            delayMS = *req.DelayMS
+        }
+        if req.AfterID < 0 { writeError(w, http.StatusBadRequest, "after_id must be >= 0"); return }
+
+        now := time.Now().UTC()
+        job, err := s.backfills.add(BackfillJob{
+            Task: req.Task, Status: BackfillQueued, BatchSize: batchSize, DelayMS: delayMS, Cursor: req.AfterID,
+            CreatedBy: auditActor(r), CreatedAt: now, UpdatedAt: now,
+        })
+        if err != nil { writeError(w, http.StatusConflict, err.Error()); return }
+        go s.runBackfillJob(job.ID)
+        w.Header().Set("Location", "/v1/backfill-jobs/"+strconv.FormatInt(job.ID, 10))
+        writeJSON(w, http.StatusAccepted, job)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// handleBackfillJob serves a single job (admin):
+//   GET  /backfill-jobs/{id}         status and progress
+//   POST /backfill-jobs/{id}/pause   stop after the current batch
+//   POST /backfill-jobs/{id}/resume  continue a paused or failed job from its cursor
+func (s *Server) handleBackfillJob(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActBackfillRun, Resource{}); !ok { return }
+    idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/backfill-jobs/"), "/")
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusNotFound, "not found"); return }
+    switch {
+    case action == "" && r.Method == http.MethodGet:
+        job, ok := s.backfills.get(id)
+        if !ok { writeError(w, http.StatusNotFound, "backfill job not found"); return }
+        writeJSON(w, http.StatusOK, job)
+    case (action == "pause" || action == "resume") && r.Method == http.MethodPost:
+        var job BackfillJob
+        if action == "pause" {
+            job, err = s.backfills.pause(id)
+        } else {
+            job, err = s.backfills.resume(id)
+        }
+        switch {
+        case errors.Is(err, ErrNotFound):
+            writeRepoError(w, err, "backfill job not found")
+        case err != nil:
+            writeError(w, http.StatusConflict, err.Error())
+        default:
+            if action == "resume" { go s.runBackfillJob(id) }
+            writeJSON(w, http.StatusAccepted, job)
+        }
+    case action == "":
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    case action == "pause" || action == "resume":
+        w.Header().Set("Allow", http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    default:
+        writeError(w, http.StatusNotFound, "not found")
+    }
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeNormalizer resolves names from a fixed table and fails for failName
+type fakeNormalizer struct {
+    mu       sync.Mutex
+    concepts map[string]RxNormConcept
+    failName string
+}
+
+func (f *fakeNormalizer) Resolve(ctx context.Context, name string) (*RxNormConcept, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if name == f.failName { return nil, errors.New("rxnav unavailable") }
+    c, ok := f.concepts[name]
+    if !ok { return nil, nil }
+    return &c, nil
+}
+
+func TestBackfillJobValidation(t *testing.T) {
+    cases := []struct {
+        name         string
+        role         string
+        rxnorm       bool
+        body         string
+        expectStatus int
+    }{
+        {name: "physician forbidden", role: "physician", rxnorm: true, body: `{"task":"drug_rxnorm"}`, expectStatus: http.StatusForbidden},
+        {name: "unknown task", role: "admin", rxnorm: true, body: `{"task":"adherence"}`, expectStatus: http.StatusBadRequest},
+        {name: "rxnorm disabled", role: "admin", body: `{"task":"drug_rxnorm"}`, expectStatus: http.StatusBadRequest},
+        {name: "batch too large", role: "admin", rxnorm: true, body: `{"task":"drug_rxnorm","batch_size":5000}`, expectStatus: http.StatusBadRequest},
+        {name: "negative delay", role: "admin", rxnorm: true, body: `{"task":"drug_rxnorm","delay_ms":-1}`, expectStatus: http.StatusBadRequest},
+        {name: "accepted", role: "admin", rxnorm: true, body: `{"task":"drug_rxnorm","delay_ms":0}`, expectStatus: http.StatusAccepted},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            srv.rxnorm = nil
+            if tc.rxnorm { srv.rxnorm = &fakeNormalizer{} }
+            req := httptest.NewRequest(http.MethodPost, "/v1/backfill-jobs", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestBackfillJobResumesAfterFailure(t *testing.T) {
+    // Demo drugs: Amoxicillin 1, Ibuprofen 2, Metformin 3, Lisinopril 4, Oxycodone 5
+    repo := newDemoMemoryRepo()
+    norm := &fakeNormalizer{
+        concepts: map[string]RxNormConcept{
+            "Ibuprofen":  {RxCUI: "5640", NormalizedName: "ibuprofen"},
+            "Metformin":  {RxCUI: "6809", NormalizedName: "metformin"},
+            "Lisinopril": {RxCUI: "29046", NormalizedName: "lisinopril"},
+        },
+        failName: "Lisinopril",
+    }
+    srv := NewServer(repo, defaultConfig())
+    srv.rxnorm = norm
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-Role", "admin")
+        req.Header.Set("X-User-ID", "7")
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+    wait := func() BackfillJob {
+        var job BackfillJob
+        deadline := time.Now().Add(2 * time.Second)
+        for {
+            rr := do(http.MethodGet, "/v1/backfill-jobs/1", "")
+            if rr.Code != http.StatusOK { t.Fatalf("job status = %d", rr.Code) }
+            _ = json.NewDecoder(rr.Body).Decode(&job)
+            if (job.Status != BackfillQueued && job.Status != BackfillRunning) || time.Now().After(deadline) { return job }
+            time.Sleep(5 * time.Millisecond)
+        }
+    }
+
+    rr := do(http.MethodPost, "/v1/backfill-jobs", `{"task":"drug_rxnorm","batch_size":2,"delay_ms":0}`)
+    if rr.Code != http.StatusAccepted { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    if loc := rr.Header().Get("Location"); loc != "/v1/backfill-jobs/1" { t.Fatalf("Location = %q", loc) }
+
+    // The RxNav failure on Lisinopril stops the job with the cursor on the last finished drug
+    job := wait()
+    if job.Status != BackfillFailed || job.Cursor != 3 || job.Total != 5 || job.Processed != 3 || job.Updated != 2 {
+        t.Fatalf("failed job = %+v", job)
+    }
+
+    norm.mu.Lock()
+    norm.failName = ""
+    norm.mu.Unlock()
+    if rr := do(http.MethodPost, "/v1/backfill-jobs/1/resume", ""); rr.Code != http.StatusAccepted {
+        t.Fatalf("resume status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    job = wait()
+    if job.Status != BackfillSucceeded || job.Cursor != 5 || job.Total != 2 || job.Processed != 5 || job.Updated != 3 || job.FinishedAt == nil {
+        t.Fatalf("resumed job = %+v", job)
+    }
+    if d := repo.drugs[4]; d.RxCUI != "29046" { t.Fatalf("lisinopril not backfilled: %+v", d) }
+    if rr := do(http.MethodPost, "/v1/backfill-jobs/1/pause", ""); rr.Code != http.StatusConflict {
+        t.Fatalf("pause finished job status = %d, want 409", rr.Code)
+    }
+}
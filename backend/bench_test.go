@@ -0,0 +1,106 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+// Benchmarks for the request hot paths; run with make bench (see the Makefile)
+
+// discardWriter is an http.ResponseWriter that keeps headers but drops the body, so
+// benchmarks measure encoding rather than buffer growth
+type discardWriter struct{ h http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.h }
+func (d *discardWriter) Write(b []byte) (int, error) { return io.Discard.Write(b) }
+func (d *discardWriter) WriteHeader(int)             {}
+
+func benchPrescriptions(n int) []Prescription {
+    now := time.Now().UTC()
+    pharmacy := int64(1)
+    out := make([]Prescription, n)
+    for i := range out {
+        d := syntheticDrugs[i%len(syntheticDrugs)]
+        out[i] = Prescription{
+            ID: int64(i + 1), PatientID: int64(i%50 + 1), PatientName: "Patient " + strconv.Itoa(i%50),
+            PhysicianID: int64(i%5 + 1), PhysicianName: "Dr. " + strconv.Itoa(i%5),
+            DrugID: int64(i%len(syntheticDrugs) + 1), DrugName: d.Name,
+            Quantity: d.Quantities[0], Sig: d.Sigs[0], PrescribedAt: now.Add(-time.Duration(i) * time.Hour),
+            Dosage: &Dosage{Amount: 500, Unit: "mg", Route: "oral", Frequency: "BID", DurationDays: 10},
+            PharmacyID: &pharmacy, PharmacyName: "Main Street Pharmacy", Status: PrescriptionActive,
+        }
+    }
+    return out
+}
+
+func BenchmarkWriteJSONPrescriptions(b *testing.B) {
+    for _, n := range []int{50, 200, 1000} {
+        items := benchPrescriptions(n)
+        b.Run(strconv.Itoa(n), func(b *testing.B) {
+            b.ReportAllocs()
+            w := &discardWriter{h: http.Header{}}
+            for i := 0; i < b.N; i++ {
+                writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": n})
+            }
+        })
+    }
+}
+
+// BenchmarkServeHTTP runs whole requests through CORS, request ids, stats, RBAC, and the mux
+func BenchmarkServeHTTP(b *testing.B) {
+    f := fixtures.New()
+    for i := 0; i < 40; i++ {
+        f.NewPatient("Patient "+strconv.Itoa(i)).WithPhysician("Dr. "+strconv.Itoa(i%4)).WithPrescriptions(5)
+    }
+    repo, _ := fixtureMemory(f)
+    cfg := defaultConfig()
+    cfg.WebOrigin = "http://localhost:5173,https://portal.example.com"
+    srv := NewServer(repo, cfg)
+
+    cases := []struct {
+        name, method, path, role string
+    }{
+        {"preflight", http.MethodOptions, "/v1/prescriptions", ""},
+        {"healthz", http.MethodGet, "/healthz", ""},
+        {"list admin", http.MethodGet, "/v1/prescriptions?limit=200", "admin"},
+        {"list physician", http.MethodGet, "/v1/prescriptions?sort=quantity:asc&include_total=true", "physician"},
+        {"forbidden", http.MethodGet, "/v1/backfill-jobs", "patient"},
+    }
+    for _, tc := range cases {
+        b.Run(tc.name, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                req := httptest.NewRequest(tc.method, tc.path, nil)
+                req.Header.Set("Origin", "https://portal.example.com")
+                if tc.role != "" {
+                    req.Header.Set("X-Role", tc.role)
+                    req.Header.Set("X-User-ID", "1")
+                }
+                srv.ServeHTTP(&discardWriter{h: http.Header{}}, req)
+            }
+        })
+    }
+}
+
+func BenchmarkPrescriptionQuery(b *testing.B) {
+    patient, physician := int64(7), int64(3)
+    filters := map[string]ListPrescriptionsFilter{
+        "unfiltered": {},
+        "scoped":     {PatientID: &patient, PhysicianID: &physician, ExcludePending: true, Sort: "drug_name", Ascending: true},
+    }
+    for name, filter := range filters {
+        b.Run(name, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                q, _ := prescriptionQuery(filter)
+                _ = q + prescriptionOrder(filter) + " LIMIT 50"
+            }
+        })
+    }
+}
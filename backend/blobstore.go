@@ -0,0 +1,224 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// BlobStore keeps the contents of prescription attachments; their metadata lives in the
+// repository. Keys are generated by the server (see attachmentKey) and are slash-separated.
+type BlobStore interface {
+    Put(ctx context.Context, key, contentType string, data []byte) error
+    // Get returns ErrNotFound when nothing is stored under key
+    Get(ctx context.Context, key string) (io.ReadCloser, error)
+    // Delete removes key; deleting a missing key is not an error
+    Delete(ctx context.Context, key string) error
+}
+
+// blobStoreFromConfig builds the store ATTACHMENT_STORE names, or nil when attachments
+// are disabled
+func blobStoreFromConfig(c Config) BlobStore {
+    switch c.AttachmentStore {
+    case "disk":
+        return &diskBlobStore{root: c.AttachmentDir}
+    case "s3":
+        endpoint := c.S3Endpoint
+        if endpoint == "" { endpoint = "https://s3." + c.S3Region + ".amazonaws.com" }
+        u, _ := url.Parse(endpoint)
+        return &s3BlobStore{
+            endpoint: u, region: c.S3Region, bucket: c.S3Bucket, pathStyle: c.S3PathStyle,
+            accessKeyID: c.S3AccessKeyID, secretAccessKey: c.S3SecretAccessKey,
+            client: &http.Client{Timeout: time.Minute}, now: time.Now,
+        }
+    case "memory":
+        return newMemoryBlobStore()
+    }
+    return nil
+}
+
+// diskBlobStore keeps blobs as files under root, readable only by the server's user
+type diskBlobStore struct {
+    root string
+}
+
+func (d *diskBlobStore) path(key string) (string, error) {
+    if key == "" || strings.Contains(key, "..") || strings.HasPrefix(key, "/") { return "", fmt.Errorf("invalid blob key %q", key) }
+    return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file and renames it into place, so a crash never leaves a
+// truncated blob under the key
+func (d *diskBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+    path, err := d.path(key)
+    if err != nil { return err }
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { return err }
+    f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+    if err != nil { return err }
+    defer os.Remove(f.Name())
+    if _, err := f.Write(data); err != nil { f.Close(); return err }
+    if err := f.Sync(); err != nil { f.Close(); return err }
+    if err := f.Close(); err != nil { return err }
+    return os.Rename(f.Name(), path)
+}
+
+func (d *diskBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    path, err := d.path(key)
+    if err != nil { return nil, err }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) { return nil, ErrNotFound }
+    return f, err
+}
+
+func (d *diskBlobStore) Delete(ctx context.Context, key string) error {
+    path, err := d.path(key)
+    if err != nil { return err }
+    if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) { return err }
+    return nil
+}
+
+// s3BlobStore keeps blobs in an S3 bucket, or one of an S3-compatible service (MinIO,
+// Ceph) at endpoint. Requests are signed with AWS Signature Version 4.
+type s3BlobStore struct {
+    endpoint        *url.URL
+    region, bucket  string
+    // pathStyle addresses objects as endpoint/bucket/key rather than bucket.endpoint/key
+    pathStyle       bool
+    accessKeyID     string
+    secretAccessKey string
+    client          *http.Client
+    now             func() time.Time
+}
+
+func (s *s3BlobStore) objectURL(key string) *url.URL {
+    u := *s.endpoint
+    if s.pathStyle {
+        u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+    } else {
+        u.Host = s.bucket + "." + u.Host
+        u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+    }
+    return &u
+}
+
+// do signs and sends one object request. A 404 is ErrNotFound; other non-2xx answers
+// carry S3's error code.
+func (s *s3BlobStore) do(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+    if err != nil { return nil, err }
+    for k, v := range header { req.Header[k] = v }
+    sum := sha256.Sum256(body)
+    s.sign(req, hex.EncodeToString(sum[:]))
+    resp, err := s.client.Do(req)
+    if err != nil { return nil, err }
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 { return resp, nil }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound { return nil, ErrNotFound }
+    var apiErr struct {
+        Code string `xml:"Code"`
+    }
+    _ = xml.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apiErr)
+    return nil, fmt.Errorf("s3 %s returned %d %s", method, resp.StatusCode, apiErr.Code)
+}
+
+// sign adds the Signature Version 4 Authorization header. Every header already set on
+// req is signed, along with Host.
+func (s *s3BlobStore) sign(req *http.Request, payloadHash string) {
+    t := s.now().UTC()
+    amzDate, day := t.Format("20060102T150405Z"), t.Format("20060102")
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    canonical := map[string]string{"host": req.URL.Host}
+    for k, v := range req.Header { canonical[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ",")) }
+    names := make([]string, 0, len(canonical))
+    for k := range canonical { names = append(names, k) }
+    sort.Strings(names)
+    var headers strings.Builder
+    for _, k := range names { headers.WriteString(k + ":" + canonical[k] + "\n") }
+    signedHeaders := strings.Join(names, ";")
+
+    request := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers.String(), signedHeaders, payloadHash}, "\n")
+    requestHash := sha256.Sum256([]byte(request))
+    scope := day + "/" + s.region + "/s3/aws4_request"
+    toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+    key := []byte("AWS4" + s.secretAccessKey)
+    for _, part := range []string{day, s.region, "s3", "aws4_request"} { key = hmacSHA256(key, part) }
+    req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/"+scope+
+        ", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+    resp, err := s.do(ctx, http.MethodPut, key, data, http.Header{"Content-Type": {contentType}})
+    if err != nil { return err }
+    resp.Body.Close()
+    return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+    if err != nil { return nil, err }
+    return resp.Body, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+    // S3 answers 204 for missing keys too
+    resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+    if errors.Is(err, ErrNotFound) { return nil }
+    if err != nil { return err }
+    resp.Body.Close()
+    return nil
+}
+
+// memoryBlobStore keeps blobs in process memory, for in-memory repositories and tests
+type memoryBlobStore struct {
+    mu    sync.RWMutex
+    blobs map[string][]byte
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+    return &memoryBlobStore{blobs: map[string][]byte{}}
+}
+
+func (m *memoryBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.blobs[key] = bytes.Clone(data)
+    return nil
+}
+
+func (m *memoryBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    b, ok := m.blobs[key]
+    if !ok { return nil, ErrNotFound }
+    return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memoryBlobStore) Delete(ctx context.Context, key string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.blobs, key)
+    return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "strings"
+)
+
+// defaultMaxBodyBytes bounds request bodies unless MAX_BODY_BYTES says otherwise
+const defaultMaxBodyBytes = 1 << 20
+
+// rawBodyPaths take bodies that aren't JSON and skip the Content-Type check
+var rawBodyPaths = map[string]bool{"/hl7": true}
+
+// limitBody caps the body of r at MAX_BODY_BYTES and, for writes, rejects Content-Types
+// other than JSON with 415. Requests without a Content-Type are read as JSON.
+// Attachment uploads are multipart instead, capped at ATTACHMENT_MAX_BYTES plus the form.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) bool {
+    if r.Body == nil || r.Body == http.NoBody { return true }
+    if r.Method == http.MethodPost && attachmentUploadPath.MatchString(r.URL.Path) {
+        r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.AttachmentMaxBytes)+attachmentFormOverhead)
+        return true
+    }
+    if s.cfg.MaxBodyBytes > 0 { r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.MaxBodyBytes)) }
+    switch r.Method {
+    case http.MethodPost, http.MethodPut, http.MethodPatch:
+    default:
+        return true
+    }
+    if rawBodyPaths[strings.TrimPrefix(r.URL.Path, "/v1")] { return true }
+    ct := r.Header.Get("Content-Type")
+    if ct == "" { return true }
+    mt, _, err := mime.ParseMediaType(ct)
+    if err != nil || !(mt == "application/json" || strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json")) {
+        writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+        return false
+    }
+    return true
+}
+
+// decodeJSON decodes the body of r into v, rejecting unknown fields and trailing data. On
+// failure it writes a 400 naming the offending field (413 past the body limit) and
+// returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+    dec := json.NewDecoder(r.Body)
+    dec.DisallowUnknownFields()
+    err := dec.Decode(v)
+    if err == nil && dec.More() { err = errors.New("body must contain a single JSON value") }
+    if err == nil { return true }
+
+    var tooLarge *http.MaxBytesError
+    var syntax *json.SyntaxError
+    var typ *json.UnmarshalTypeError
+    switch {
+    case errors.As(err, &tooLarge):
+        writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+    case errors.Is(err, io.EOF):
+        writeError(w, http.StatusBadRequest, "request body is required")
+    case errors.Is(err, io.ErrUnexpectedEOF):
+        writeError(w, http.StatusBadRequest, "invalid JSON body: unexpected end of input")
+    case errors.As(err, &syntax):
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body at offset %d: %s", syntax.Offset, syntax.Error()))
+    case errors.As(err, &typ) && typ.Field != "":
+        writeError(w, http.StatusBadRequest, fmt.Sprintf("field %q must be %s, got %s", typ.Field, typ.Type, typ.Value))
+    case errors.As(err, &typ):
+        writeError(w, http.StatusBadRequest, "body must be a JSON object, got "+typ.Value)
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        // encoding/json has no typed error for this one
+        writeError(w, http.StatusBadRequest, strings.TrimPrefix(err.Error(), "json: "))
+    default:
+        writeError(w, http.StatusBadRequest, "invalid JSON body: "+strings.TrimPrefix(err.Error(), "json: "))
+    }
+    return false
+}
+
+// writeBodyError is for handlers reading the raw body: 413 past the body limit, else 400
+func writeBodyError(w http.ResponseWriter, err error) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+        return
+    }
+    writeError(w, http.StatusBadRequest, "invalid request body")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestRequestBodies(t *testing.T) {
+    valid := `{"patient_id":1,"physician_id":1,"drug_name":"Ibuprofen","quantity":10,"sig":"PRN"}`
+    cases := []struct {
+        name          string
+        path          string
+        body          string
+        contentType   string
+        idemKey       string
+        expectStatus  int
+        expectMessage string
+    }{
+        {name: "valid", path: "/prescriptions", body: valid, contentType: "application/json; charset=utf-8", expectStatus: http.StatusCreated},
+        {name: "no content type", path: "/prescriptions", body: valid, expectStatus: http.StatusCreated},
+        {name: "unknown field", path: "/prescriptions", body: `{"patient_id":1,"colour":"red"}`, expectStatus: http.StatusBadRequest, expectMessage: `unknown field \"colour\"`},
+        {name: "wrong type", path: "/prescriptions", body: `{"patient_id":1,"quantity":"ten"}`, expectStatus: http.StatusBadRequest, expectMessage: `field \"quantity\" must be int, got string`},
+        {name: "not an object", path: "/prescriptions", body: `[1,2]`, expectStatus: http.StatusBadRequest, expectMessage: "body must be a JSON object, got array"},
+        {name: "syntax error", path: "/prescriptions", body: `{"patient_id":1,}`, expectStatus: http.StatusBadRequest, expectMessage: "invalid JSON body at offset"},
+        {name: "trailing data", path: "/prescriptions", body: valid + `{}`, expectStatus: http.StatusBadRequest, expectMessage: "single JSON value"},
+        {name: "empty body", path: "/prescriptions", expectStatus: http.StatusBadRequest, expectMessage: "request body is required"},
+        {name: "too large", path: "/prescriptions", body: `{"sig":"` + strings.Repeat("x", 2048) + `"}`, expectStatus: http.StatusRequestEntityTooLarge, expectMessage: "exceeds 1024 bytes"},
+        {name: "too large with idempotency key", path: "/prescriptions", body: `{"sig":"` + strings.Repeat("x", 2048) + `"}`, idemKey: "k1", expectStatus: http.StatusRequestEntityTooLarge},
+        {name: "form body", path: "/v1/prescriptions", body: "patient_id=1", contentType: "application/x-www-form-urlencoded", expectStatus: http.StatusUnsupportedMediaType},
+        {name: "json suffix", path: "/drugs", body: `{"name":"Zinc"}`, contentType: "application/vnd.portal+json", expectStatus: http.StatusCreated},
+        {name: "hl7 is not json", path: "/v1/hl7", body: hl7A04, contentType: "x-application/hl7-v2+er7", expectStatus: http.StatusOK},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            cfg := defaultConfig()
+            cfg.MaxBodyBytes = 1024
+            srv := NewServer(newDemoMemoryRepo(), cfg)
+            req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+            role := "physician"
+            if tc.path != "/prescriptions" && tc.path != "/v1/prescriptions" { role = "admin" }
+            req.Header.Set("X-Role", role)
+            req.Header.Set("X-User-ID", "1")
+            if tc.contentType != "" { req.Header.Set("Content-Type", tc.contentType) }
+            if tc.idemKey != "" { req.Header.Set("Idempotency-Key", tc.idemKey) }
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if !strings.Contains(rr.Body.String(), tc.expectMessage) { t.Fatalf("body = %s, want %s", rr.Body.String(), tc.expectMessage) }
+        })
+    }
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// bulkOperations maps each bulk operation to the status it moves active prescriptions to.
+// The operation name doubles as the audit_log action.
+var bulkOperations = map[string]string{
+    AuditCancel: PrescriptionCancelled,
+    AuditExpire: PrescriptionExpired,
+}
+
+// BulkFilter selects the active prescriptions a bulk operation applies to. At least one
+// of DrugID or PhysicianID is required; From/To bound prescribed_at as [from, to), e.g.
+// to the window in which a recalled lot was in circulation.
+type BulkFilter struct {
+    DrugID      *int64     `json:"drug_id,omitempty"`
+    PhysicianID *int64     `json:"physician_id,omitempty"`
+    From        *time.Time `json:"from,omitempty"`
+    To          *time.Time `json:"to,omitempty"`
+}
+
+// Bulk job states
+const (
+    BulkQueued    = "queued"
+    BulkRunning   = "running"
+    BulkSucceeded = "succeeded"
+    BulkFailed    = "failed"
+)
+
+// BulkJob is an asynchronous bulk status change. Matched is counted when the job starts,
+// so it can differ from the dry-run preview if prescriptions changed in between.
+type BulkJob struct {
+    ID         int64      `json:"id"`
+    Operation  string     `json:"operation"`
+    Filter     BulkFilter `json:"filter"`
+    // OrgID is the organization the job was created in (X-Org-ID); nil runs across all
+    OrgID      *int64     `json:"org_id,omitempty"`
+    Reason     string     `json:"reason"`
+    Status     string     `json:"status"`
+    Matched    int        `json:"matched"`
+    Updated    int        `json:"updated"`
+    Error      string     `json:"error,omitempty"`
+    CreatedBy  string     `json:"created_by"`
+    CreatedAt  time.Time  `json:"created_at"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+const (
+    // bulkBatchSize bounds each status UPDATE so row locks are held briefly
+    bulkBatchSize = 500
+    // bulkPreviewSize caps the prescription ids returned by a dry run
+    bulkPreviewSize = 100
+)
+
+// bulkJobs is the in-process job registry. Job state is not persisted; the audit log is
+// the durable record of what a job changed.
+type bulkJobs struct {
+    mu   sync.Mutex
+    seq  int64
+    jobs map[int64]*BulkJob
+}
+
+func newBulkJobs() *bulkJobs {
+    return &bulkJobs{jobs: map[int64]*BulkJob{}}
+}
+
+func (b *bulkJobs) add(j BulkJob) BulkJob {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.seq++
+    j.ID = b.seq
+    b.jobs[j.ID] = &j
+    return j
+}
+
+func (b *bulkJobs) get(id int64) (BulkJob, bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    j, ok := b.jobs[id]
+    if !ok { return BulkJob{}, false }
+    return *j, true
+}
+
+// list returns all jobs, newest first
+func (b *bulkJobs) list() []BulkJob {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    out := make([]BulkJob, 0, len(b.jobs))
+    for _, j := range b.jobs { out = append(out, *j) }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+    return out
+}
+
+func (b *bulkJobs) update(id int64, fn func(*BulkJob)) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if j, ok := b.jobs[id]; ok { fn(j) }
+}
+
+// runBulkJob applies a queued job in batches. Each batch changes only prescriptions that
+// are still active, so a job can be retried safely after a failure.
+func (s *Server) runBulkJob(job BulkJob) {
+    ctx := context.Background()
+    if job.OrgID != nil { ctx = withOrg(ctx, *job.OrgID) }
+    finish := func(status string, err error) {
+        s.bulk.update(job.ID, func(j *BulkJob) {
+            now := time.Now().UTC()
+            j.Status, j.FinishedAt = status, &now
+            if err != nil { j.Error = err.Error() }
+        })
+        if err != nil { log.Printf("bulk: job %d (%s) failed: %v", job.ID, job.Operation, err) }
+    }
+    s.bulk.update(job.ID, func(j *BulkJob) { j.Status = BulkRunning })
+    ids, err := s.repo.MatchBulkPrescriptions(ctx, job.Filter)
+    if err != nil { finish(BulkFailed, err); return }
+    s.bulk.update(job.ID, func(j *BulkJob) { j.Matched = len(ids) })
+
+    entry := AuditEntry{
+        Actor: job.CreatedBy, Action: job.Operation,
+        Detail: "bulk job " + strconv.FormatInt(job.ID, 10) + ": " + job.Reason,
+    }
+    for start := 0; start < len(ids); start += bulkBatchSize {
+        end := start + bulkBatchSize
+        if end > len(ids) { end = len(ids) }
+        changed, err := s.repo.TransitionPrescriptions(ctx, ids[start:end], bulkOperations[job.Operation], entry)
+        if err != nil { finish(BulkFailed, err); return }
+        s.bulk.update(job.ID, func(j *BulkJob) { j.Updated += len(changed) })
+    }
+    finish(BulkSucceeded, nil)
+}
+
+// handleBulkJobs serves admin bulk status operations:
+//   GET  /bulk-jobs  list jobs, newest first
+//   POST /bulk-jobs  {"operation":"cancel|expire","drug_id":N,"physician_id":N,"from":..,"to":..,
+//                     "reason":"...","dry_run":true}
+// A dry run returns the matching prescriptions without changing anything; otherwise the
+// job is queued and 202 points at its status.
+func (s *Server) handleBulkJobs(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActPrescriptionBulk, Resource{}); !ok { return }
+    switch r.Method {
+    case http.MethodGet:
+        writeJSON(w, http.StatusOK, map[string]any{"items": s.bulk.list()})
+    case http.MethodPost:
+        var req struct {
+            Operation string `json:"operation"`
+            BulkFilter
+            Reason    string `json:"reason"`
+            DryRun    bool   `json:"dry_run"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        if _, ok := bulkOperations[req.Operation]; !ok { writeError(w, http.StatusBadRequest, "operation must be cancel or expire"); return }
+        f := req.BulkFilter
+        if f.DrugID == nil && f.PhysicianID == nil { writeError(w, http.StatusBadRequest, "drug_id or physician_id is required"); return }
+        if (f.DrugID != nil && *f.DrugID <= 0) || (f.PhysicianID != nil && *f.PhysicianID <= 0) {
+            writeError(w, http.StatusBadRequest, "drug_id and physician_id must be > 0")
+            return
+        }
+        if f.From != nil && f.To != nil && !f.To.After(*f.From) { writeError(w, http.StatusBadRequest, "invalid from/to range"); return }
+        reason := strings.TrimSpace(req.Reason)
+        if reason == "" { writeError(w, http.StatusBadRequest, "reason is required"); return }
+        if len(reason) > 500 { writeError(w, http.StatusBadRequest, "reason too long"); return }
+
+        if req.DryRun {
+            ids, err := s.repo.MatchBulkPrescriptions(r.Context(), f)
+            if err != nil { writeError(w, http.StatusInternalServerError, "failed to match prescriptions"); return }
+            preview := ids
+            if len(preview) > bulkPreviewSize { preview = preview[:bulkPreviewSize] }
+            writeJSON(w, http.StatusOK, map[string]any{
+                "dry_run": true, "operation": req.Operation, "filter": f, "matched": len(ids), "prescription_ids": preview,
+            })
+            return
+        }
+        job := s.bulk.add(BulkJob{
+            Operation: req.Operation, Filter: f, OrgID: orgArg(r.Context()), Reason: reason, Status: BulkQueued,
+            CreatedBy: auditActor(r), CreatedAt: time.Now().UTC(),
+        })
+        go s.runBulkJob(job)
+        w.Header().Set("Location", "/v1/bulk-jobs/"+strconv.FormatInt(job.ID, 10))
+        writeJSON(w, http.StatusAccepted, job)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// handleBulkJob serves GET /bulk-jobs/{id} (admin)
+func (s *Server) handleBulkJob(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActPrescriptionBulk, Resource{}); !ok { return }
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/bulk-jobs/"), 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusNotFound, "not found"); return }
+    job, ok := s.bulk.get(id)
+    if !ok { writeError(w, http.StatusNotFound, "bulk job not found"); return }
+    writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBulkJobValidation(t *testing.T) {
+    cases := []struct {
+        name         string
+        role         string
+        body         string
+        expectStatus int
+        expectMatch  int
+    }{
+        {name: "physician forbidden", role: "physician", body: `{"operation":"cancel","drug_id":1,"reason":"recall","dry_run":true}`, expectStatus: http.StatusForbidden},
+        {name: "unknown operation", role: "admin", body: `{"operation":"delete","drug_id":1,"reason":"recall"}`, expectStatus: http.StatusBadRequest},
+        {name: "no filter", role: "admin", body: `{"operation":"cancel","reason":"recall"}`, expectStatus: http.StatusBadRequest},
+        {name: "missing reason", role: "admin", body: `{"operation":"cancel","drug_id":1}`, expectStatus: http.StatusBadRequest},
+        {name: "bad range", role: "admin", body: `{"operation":"cancel","drug_id":1,"reason":"x","from":"2025-02-01T00:00:00Z","to":"2025-01-01T00:00:00Z"}`, expectStatus: http.StatusBadRequest},
+        {name: "dry run by physician", role: "admin", body: `{"operation":"expire","physician_id":2,"reason":"left practice","dry_run":true}`, expectStatus: http.StatusOK, expectMatch: 2},
+        {name: "dry run outside window", role: "admin", body: `{"operation":"cancel","drug_id":1,"reason":"lot 42","from":"2020-01-01T00:00:00Z","to":"2020-02-01T00:00:00Z","dry_run":true}`, expectStatus: http.StatusOK},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodPost, "/v1/bulk-jobs", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusOK { return }
+            var resp struct{ Matched int `json:"matched"` }
+            _ = json.NewDecoder(rr.Body).Decode(&resp)
+            if resp.Matched != tc.expectMatch { t.Fatalf("matched = %d, want %d", resp.Matched, tc.expectMatch) }
+        })
+    }
+}
+
+func TestBulkCancelJob(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    pharmacy := int64(1)
+    // Route Alice's amoxicillin (prescription 1) so the cancellation can be seen at the counter
+    p := repo.prescriptions[1]
+    p.PharmacyID = &pharmacy
+    repo.prescriptions[1] = p
+    srv := NewServer(repo, defaultConfig())
+
+    req := httptest.NewRequest(http.MethodPost, "/v1/bulk-jobs", strings.NewReader(`{"operation":"cancel","drug_id":1,"reason":"lot 42 recall"}`))
+    req.Header.Set("X-Role", "admin")
+    req.Header.Set("X-User-ID", "7")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    if rr.Code != http.StatusAccepted { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    if loc := rr.Header().Get("Location"); loc != "/v1/bulk-jobs/1" { t.Fatalf("Location = %q", loc) }
+
+    var job BulkJob
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        get := httptest.NewRequest(http.MethodGet, "/v1/bulk-jobs/1", nil)
+        get.Header.Set("X-Role", "admin")
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, get)
+        if rr.Code != http.StatusOK { t.Fatalf("job status = %d", rr.Code) }
+        _ = json.NewDecoder(rr.Body).Decode(&job)
+        if job.Status == BulkSucceeded || job.Status == BulkFailed || time.Now().After(deadline) { break }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if job.Status != BulkSucceeded || job.Matched != 1 || job.Updated != 1 { t.Fatalf("job = %+v", job) }
+
+    got, _ := repo.GetPrescription(context.Background(), 1)
+    if got.Status != PrescriptionCancelled { t.Fatalf("status = %q, want cancelled", got.Status) }
+    if len(repo.audit) != 1 || repo.audit[0].Action != AuditCancel || repo.audit[0].Actor != "admin:7" || repo.audit[0].EntityID != 1 {
+        t.Fatalf("audit = %+v", repo.audit)
+    }
+
+    dispense := httptest.NewRequest(http.MethodPost, "/v1/prescriptions/1/dispense", strings.NewReader(`{"dispensed_quantity":20}`))
+    dispense.Header.Set("X-Role", "pharmacist")
+    dispense.Header.Set("X-User-ID", "1")
+    rr = httptest.NewRecorder()
+    srv.ServeHTTP(rr, dispense)
+    if rr.Code != http.StatusConflict { t.Fatalf("dispense status = %d, want 409", rr.Code) }
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// EventCommentMentioned is published (via webhooks) once per comment that mentions anyone
+const EventCommentMentioned = "prescription.comment.mentioned"
+
+// Mention is a care-team member referenced in a comment as @role:id (e.g., @physician:2)
+type Mention struct {
+    Role Role  `json:"role"`
+    ID   int64 `json:"id"`
+}
+
+// PrescriptionComment is an internal care-team note on a prescription; patients never see them
+type PrescriptionComment struct {
+    ID             int64     `json:"id"`
+    PrescriptionID int64     `json:"prescription_id"`
+    AuthorRole     Role      `json:"author_role"`
+    AuthorID       int64     `json:"author_id"`
+    Body           string    `json:"body"`
+    Mentions       []Mention `json:"mentions"`
+    CreatedAt      time.Time `json:"created_at"`
+}
+
+const maxCommentLength = 4000
+
+var mentionPattern = regexp.MustCompile(`@(physician|pharmacist):([0-9]+)\b`)
+
+// parseMentions extracts distinct @role:id mentions in order of first appearance
+func parseMentions(body string) []Mention {
+    out := []Mention{}
+    seen := map[Mention]bool{}
+    for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+        id, err := strconv.ParseInt(m[2], 10, 64)
+        if err != nil || id <= 0 { continue }
+        mention := Mention{Role: Role(m[1]), ID: id}
+        if !seen[mention] {
+            seen[mention] = true
+            out = append(out, mention)
+        }
+    }
+    return out
+}
+
+// authorizeCareTeam checks that a caller granted a comment action at scope may use the
+// internal notes of p: unrestricted callers (admins), the routed pharmacy, and physicians
+// who may read the patient's chart (see physicianCanRead), prescriber or not.
+// It writes the error response and returns false when access is denied.
+func (s *Server) authorizeCareTeam(w http.ResponseWriter, r *http.Request, caller Principal, scope Scope, p *Prescription) bool {
+    if scope == ScopeAll { return true }
+    res := Resource{PatientID: p.PatientID, PhysicianID: p.PhysicianID}
+    if p.PharmacyID != nil { res.PharmacyID = *p.PharmacyID }
+    if caller.Owns == OwnsPhysician {
+        ok, err := s.physicianCanRead(r.Context(), caller.UserID, p.PatientID)
+        if err != nil { writeError(w, http.StatusInternalServerError, "consent check failed"); return false }
+        if ok { return true }
+    } else if res.ownedBy(caller) {
+        return true
+    }
+    // Outside the care team the prescription is indistinguishable from a missing one
+    writeError(w, http.StatusNotFound, "prescription not found")
+    return false
+}
+
+// handlePrescriptionComments serves the internal comment thread of a prescription:
+//   GET  /prescriptions/{id}/comments  oldest first
+//   POST /prescriptions/{id}/comments  {"body":"... @pharmacist:1 ..."}
+func (s *Server) handlePrescriptionComments(w http.ResponseWriter, r *http.Request, id int64) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    action := ActCommentRead
+    if r.Method == http.MethodPost { action = ActCommentWrite }
+    // Reject callers without the permission before revealing whether the prescription exists
+    caller, scope, ok := s.permit(w, r, action)
+    if !ok { return }
+    p, err := s.repo.GetPrescription(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "prescription not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch prescription")
+        return
+    }
+    if !s.authorizeCareTeam(w, r, caller, scope, p) { return }
+
+    if r.Method == http.MethodGet {
+        items, err := s.repo.ListPrescriptionComments(r.Context(), id)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list comments"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+        return
+    }
+
+    var req struct {
+        Body string `json:"body"`
+    }
+    if !decodeJSON(w, r, &req) { return }
+    body := strings.TrimSpace(req.Body)
+    if body == "" { writeError(w, http.StatusBadRequest, "body is required"); return }
+    if len(body) > maxCommentLength { writeError(w, http.StatusBadRequest, "body too long"); return }
+
+    c, err := s.repo.CreatePrescriptionComment(r.Context(), &PrescriptionComment{
+        PrescriptionID: id, AuthorRole: caller.Role, AuthorID: caller.UserID, Body: body, Mentions: parseMentions(body),
+    })
+    if err != nil { writeError(w, http.StatusInternalServerError, "failed to create comment"); return }
+    if len(c.Mentions) > 0 {
+        s.webhooks.Publish(r.Context(), EventCommentMentioned, c)
+    }
+    writeJSON(w, http.StatusCreated, c)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseMentions(t *testing.T) {
+    got := parseMentions("@pharmacist:1 please confirm strength with @physician:2, cc @physician:2 and @patient:3")
+    want := []Mention{{Role: RolePharmacist, ID: 1}, {Role: RolePhysician, ID: 2}}
+    if !reflect.DeepEqual(got, want) { t.Fatalf("parseMentions = %+v, want %+v", got, want) }
+}
+
+func TestPrescriptionComments(t *testing.T) {
+    // Demo prescription 1: Alice (patient 1) by Dr. Smith (physician 1), not routed to a pharmacy
+    cases := []struct {
+        name         string
+        method       string
+        role, userID string
+        body         string
+        expectStatus int
+    }{
+        {name: "prescriber comments", method: http.MethodPost, role: "physician", userID: "1", body: `{"body":"Check with @physician:2"}`, expectStatus: http.StatusCreated},
+        {name: "admin lists", method: http.MethodGet, role: "admin", userID: "1", expectStatus: http.StatusOK},
+        {name: "unlinked physician", method: http.MethodGet, role: "physician", userID: "2", expectStatus: http.StatusNotFound},
+        {name: "patient forbidden", method: http.MethodGet, role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "pharmacy not routed", method: http.MethodGet, role: "pharmacist", userID: "1", expectStatus: http.StatusNotFound},
+        {name: "empty body", method: http.MethodPost, role: "physician", userID: "1", body: `{"body":"  "}`, expectStatus: http.StatusBadRequest},
+        {name: "missing prescription", method: http.MethodGet, role: "admin", userID: "1", expectStatus: http.StatusNotFound},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            path := "/v1/prescriptions/1/comments"
+            if tc.name == "missing prescription" { path = "/v1/prescriptions/99/comments" }
+            req := httptest.NewRequest(tc.method, path, strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusCreated { return }
+            var c PrescriptionComment
+            _ = json.NewDecoder(rr.Body).Decode(&c)
+            if c.AuthorRole != RolePhysician || c.AuthorID != 1 || len(c.Mentions) != 1 || c.Mentions[0].ID != 2 {
+                t.Fatalf("comment = %+v", c)
+            }
+        })
+    }
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "reflect"
+    "regexp"
+    "strconv"
+    "time"
+)
+
+// Duration is a time.Duration that reads and writes Go duration strings ("3s", "24h") in
+// JSON config files and /debug/config output
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err != nil { return fmt.Errorf("duration must be a string such as \"3s\": %w", err) }
+    v, err := time.ParseDuration(s)
+    if err != nil { return err }
+    *d = Duration(v)
+    return nil
+}
+
+// Config is the process configuration, loaded once at startup by LoadConfig. Each field is
+// read from its env variable; a JSON file named by CONFIG_FILE (keys as in the json tags)
+// may set any of them, and env variables override the file. Fields tagged secret are
+// redacted by /debug/config: "dsn" masks the password, "token" the whole value.
+type Config struct {
+    Addr             string   `json:"addr" env:"ADDR"`
+    DatabaseURL      string   `json:"database_url" env:"DATABASE_URL" secret:"dsn"`
+    // DBConnectTimeout bounds each startup connection attempt; DBStartupWait is how long
+    // startup keeps retrying before giving up
+    DBConnectTimeout Duration `json:"db_connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+    DBStartupWait    Duration `json:"db_startup_wait" env:"DB_STARTUP_WAIT"`
+    // Pool sizing; 0 keeps the pgx default (MaxConns is max(4, CPUs), lifetime 1h, idle 30m)
+    DBMaxConns        int      `json:"db_max_conns" env:"DB_MAX_CONNS"`
+    DBMinConns        int      `json:"db_min_conns" env:"DB_MIN_CONNS"`
+    DBMaxConnLifetime Duration `json:"db_max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+    DBMaxConnIdleTime Duration `json:"db_max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+    // DBStatementTimeout is the server-side statement_timeout of each connection. The
+    // query timeouts are client-side deadlines per call: analytics covers the aggregate
+    // reports, export the streaming downloads (which get their own statement_timeout).
+    // DBSlowQueryThreshold logs slower statements with redacted parameters. 0 disables any.
+    DBStatementTimeout      Duration `json:"db_statement_timeout" env:"DB_STATEMENT_TIMEOUT"`
+    DBQueryTimeout          Duration `json:"db_query_timeout" env:"DB_QUERY_TIMEOUT"`
+    DBAnalyticsQueryTimeout Duration `json:"db_analytics_query_timeout" env:"DB_ANALYTICS_QUERY_TIMEOUT"`
+    DBExportQueryTimeout    Duration `json:"db_export_query_timeout" env:"DB_EXPORT_QUERY_TIMEOUT"`
+    DBSlowQueryThreshold    Duration `json:"db_slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+    // DatabaseReplicaURL optionally names a read-only replica for analytics, exports, and
+    // prescription lists (see replica.go). It is checked every DBReplicaCheckInterval, and
+    // reads go to the primary while it is down or further behind than DBReplicaMaxLag.
+    DatabaseReplicaURL     string   `json:"database_replica_url" env:"DATABASE_REPLICA_URL" secret:"dsn"`
+    DBReplicaMaxLag        Duration `json:"db_replica_max_lag" env:"DB_REPLICA_MAX_LAG"`
+    DBReplicaCheckInterval Duration `json:"db_replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+    // WebOrigin is the CORS allow-list: one origin, a comma-separated list, or "*"
+    WebOrigin        string   `json:"web_origin" env:"WEB_ORIGIN"`
+    // RBACPolicyFile replaces the default role-permission matrix (see permissions.go)
+    RBACPolicyFile   string   `json:"rbac_policy_file" env:"RBAC_POLICY_FILE"`
+    // ScalingToken, when set, is the bearer token /scaling requires
+    ScalingToken     string   `json:"scaling_token" env:"SCALING_TOKEN" secret:"token"`
+
+    // HTTP server timeouts; 0 disables one. The write timeout bounds whole responses,
+    // including large exports.
+    HTTPReadHeaderTimeout Duration `json:"http_read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+    HTTPReadTimeout       Duration `json:"http_read_timeout" env:"HTTP_READ_TIMEOUT"`
+    HTTPWriteTimeout      Duration `json:"http_write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+    HTTPIdleTimeout       Duration `json:"http_idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+    // MaxBodyBytes caps request bodies (413 beyond it); 0 disables the cap
+    MaxBodyBytes          int      `json:"max_body_bytes" env:"MAX_BODY_BYTES"`
+    // TLS (see tls.go): a certificate and key file, or domains to obtain certificates for
+    // from Let's Encrypt, cached in TLSAutocertCacheDir. Neither serves plain HTTP.
+    TLSCertFile           string   `json:"tls_cert_file" env:"TLS_CERT_FILE"`
+    TLSKeyFile            string   `json:"tls_key_file" env:"TLS_KEY_FILE"`
+    TLSAutocertDomains    string   `json:"tls_autocert_domains" env:"TLS_AUTOCERT_DOMAINS"`
+    TLSAutocertCacheDir   string   `json:"tls_autocert_cache_dir" env:"TLS_AUTOCERT_CACHE_DIR"`
+    TLSAutocertEmail      string   `json:"tls_autocert_email" env:"TLS_AUTOCERT_EMAIL"`
+    // TLSRedirectAddr, with TLS, serves plain HTTP there only to redirect to HTTPS (and to
+    // answer Let's Encrypt HTTP-01 challenges)
+    TLSRedirectAddr       string   `json:"tls_redirect_addr" env:"TLS_REDIRECT_ADDR"`
+    // HSTSMaxAge is the Strict-Transport-Security max-age sent over TLS; 0 omits the header
+    HSTSMaxAge            Duration `json:"hsts_max_age" env:"HSTS_MAX_AGE"`
+
+    // Feature flags
+    DemoMode              bool   `json:"demo_mode" env:"DEMO_MODE"`
+    DemoSyntheticPatients int    `json:"demo_synthetic_patients" env:"DEMO_SYNTHETIC_PATIENTS"`
+    RxNormEnabled         bool   `json:"rxnorm_enabled" env:"RXNORM_ENABLED"`
+    RxNormBaseURL         string `json:"rxnorm_base_url" env:"RXNORM_BASE_URL"`
+    RxNormTimeout       Duration `json:"rxnorm_timeout" env:"RXNORM_TIMEOUT"`
+    // Prescription attachments (see blobstore.go): AttachmentStore is disk (files under
+    // AttachmentDir), s3, or memory; unset disables uploads outside in-memory repositories.
+    // S3Endpoint defaults to AWS for S3Region; S3PathStyle suits MinIO and similar.
+    AttachmentStore       string `json:"attachment_store" env:"ATTACHMENT_STORE"`
+    AttachmentDir         string `json:"attachment_dir" env:"ATTACHMENT_DIR"`
+    AttachmentMaxBytes    int    `json:"attachment_max_bytes" env:"ATTACHMENT_MAX_BYTES"`
+    S3Endpoint            string `json:"s3_endpoint" env:"S3_ENDPOINT"`
+    S3Region              string `json:"s3_region" env:"S3_REGION"`
+    S3Bucket              string `json:"s3_bucket" env:"S3_BUCKET"`
+    S3PathStyle           bool   `json:"s3_path_style" env:"S3_PATH_STYLE"`
+    S3AccessKeyID         string `json:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+    S3SecretAccessKey     string `json:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"token"`
+    // PDFLetterhead heads printed documents; "|" separates lines, the first is the clinic name
+    PDFLetterhead         string `json:"pdf_letterhead" env:"PDF_LETTERHEAD"`
+    // PrescriptionSigningKey derives the physicians' e-signature keys; unset stores prescriptions unsigned
+    PrescriptionSigningKey string `json:"prescription_signing_key" env:"PRESCRIPTION_SIGNING_KEY" secret:"token"`
+    // LegacyErrorFormat answers errors with the pre-RFC 7807 {"error": "..."} body
+    LegacyErrorFormat     bool   `json:"legacy_error_format" env:"LEGACY_ERROR_FORMAT"`
+    // RetentionDays is how long deleted or inactive patients keep their PII; 0 disables anonymization
+    RetentionDays         int      `json:"retention_days" env:"RETENTION_DAYS"`
+    RetentionInterval     Duration `json:"retention_interval" env:"RETENTION_INTERVAL"`
+
+    // Background jobs (see jobs.go). AuditRetentionDays is how long audit_log entries are
+    // kept; 0 keeps them forever.
+    JobExpiryInterval  Duration `json:"job_expiry_interval" env:"JOB_EXPIRY_INTERVAL"`
+    JobPurgeInterval   Duration `json:"job_purge_interval" env:"JOB_PURGE_INTERVAL"`
+    AuditRetentionDays int      `json:"audit_retention_days" env:"AUDIT_RETENTION_DAYS"`
+    // SummaryEmailTo (comma-separated) enables the top-drugs summary email every SummaryInterval
+    SummaryEmailTo     string   `json:"summary_email_to" env:"SUMMARY_EMAIL_TO"`
+    SummaryInterval    Duration `json:"summary_interval" env:"SUMMARY_INTERVAL"`
+    // SMTP relay (host:port) for outgoing email; PLAIN auth when a username is set
+    SMTPAddr           string   `json:"smtp_addr" env:"SMTP_ADDR"`
+    SMTPFrom           string   `json:"smtp_from" env:"SMTP_FROM"`
+    SMTPUsername       string   `json:"smtp_username" env:"SMTP_USERNAME"`
+    SMTPPassword       string   `json:"smtp_password" env:"SMTP_PASSWORD" secret:"token"`
+    // Notifiers (comma-separated: smtp, twilio) enables patient prescription notifications
+    Notifiers          string   `json:"notifiers" env:"NOTIFIERS"`
+    TwilioBaseURL      string   `json:"twilio_base_url" env:"TWILIO_BASE_URL"`
+    TwilioAccountSID   string   `json:"twilio_account_sid" env:"TWILIO_ACCOUNT_SID"`
+    TwilioAuthToken    string   `json:"twilio_auth_token" env:"TWILIO_AUTH_TOKEN" secret:"token"`
+    TwilioFrom         string   `json:"twilio_from" env:"TWILIO_FROM"`
+}
+
+// defaultConfig is the configuration used when nothing is set
+func defaultConfig() Config {
+    return Config{
+        Addr:                  ":8080",
+        DBConnectTimeout:      Duration(5 * time.Second),
+        DBStartupWait:         Duration(time.Minute),
+        DBStatementTimeout:    Duration(time.Minute),
+        DBQueryTimeout:        Duration(10 * time.Second),
+        DBAnalyticsQueryTimeout: Duration(30 * time.Second),
+        DBExportQueryTimeout:  Duration(10 * time.Minute),
+        DBSlowQueryThreshold:  Duration(500 * time.Millisecond),
+        DBReplicaMaxLag:       Duration(30 * time.Second),
+        DBReplicaCheckInterval: Duration(5 * time.Second),
+        // Sensible default for local dev (the Vite dev server)
+        WebOrigin:             "http://localhost:5173",
+        HTTPReadHeaderTimeout: Duration(10 * time.Second),
+        HTTPReadTimeout:       Duration(time.Minute),
+        HTTPWriteTimeout:      Duration(10 * time.Minute),
+        HTTPIdleTimeout:       Duration(2 * time.Minute),
+        MaxBodyBytes:          defaultMaxBodyBytes,
+        HSTSMaxAge:            Duration(365 * 24 * time.Hour),
+        RxNormBaseURL:         defaultRxNormBaseURL,
+        RxNormTimeout:         Duration(defaultRxNormTimeout),
+        RetentionInterval:     Duration(24 * time.Hour),
+        JobExpiryInterval:     Duration(time.Hour),
+        JobPurgeInterval:      Duration(time.Hour),
+        SummaryInterval:       Duration(24 * time.Hour),
+        TwilioBaseURL:         defaultTwilioBaseURL,
+        PDFLetterhead:         defaultLetterhead,
+        AttachmentMaxBytes:    defaultAttachmentMaxBytes,
+        S3Region:              "us-east-1",
+    }
+}
+
+// LoadConfig builds the configuration from defaults, CONFIG_FILE, and the environment
+func LoadConfig() (Config, error) {
+    return loadConfig(os.Getenv)
+}
+
+func loadConfig(getenv func(string) string) (Config, error) {
+    cfg := defaultConfig()
+    if path := getenv("CONFIG_FILE"); path != "" {
+        b, err := os.ReadFile(path)
+        if err != nil { return Config{}, fmt.Errorf("CONFIG_FILE: %w", err) }
+        dec := json.NewDecoder(bytes.NewReader(b))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(&cfg); err != nil { return Config{}, fmt.Errorf("CONFIG_FILE %s: %w", path, err) }
+    }
+    v := reflect.ValueOf(&cfg).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        f := v.Type().Field(i)
+        name := f.Tag.Get("env")
+        raw := getenv(name)
+        if name == "" || raw == "" { continue }
+        if err := setField(v.Field(i), raw); err != nil { return Config{}, fmt.Errorf("%s: %w", name, err) }
+    }
+    if err := cfg.validate(); err != nil { return Config{}, err }
+    return cfg, nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setField(f reflect.Value, raw string) error {
+    switch {
+    case f.Type() == durationType:
+        d, err := time.ParseDuration(raw)
+        if err != nil { return fmt.Errorf("must be a duration such as \"3s\", got %q", raw) }
+        f.SetInt(int64(d))
+    case f.Kind() == reflect.String:
+        f.SetString(raw)
+    case f.Kind() == reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil { return fmt.Errorf("must be 1/0 or true/false, got %q", raw) }
+        f.SetBool(b)
+    case f.Kind() == reflect.Int:
+        n, err := strconv.Atoi(raw)
+        if err != nil { return fmt.Errorf("must be an integer, got %q", raw) }
+        f.SetInt(int64(n))
+    default:
+        return fmt.Errorf("unsupported config type %s", f.Type())
+    }
+    return nil
+}
+
+func (c Config) validate() error {
+    var errs []error
+    if c.Addr == "" { errs = append(errs, errors.New("addr is required")) }
+    if c.DBConnectTimeout <= 0 { errs = append(errs, errors.New("db_connect_timeout must be positive")) }
+    if c.DBStartupWait <= 0 { errs = append(errs, errors.New("db_startup_wait must be positive")) }
+    if c.DBMaxConns < 0 || c.DBMaxConns > math.MaxInt32 { errs = append(errs, errors.New("db_max_conns must be 0..2147483647")) }
+    if c.DBMinConns < 0 || (c.DBMaxConns > 0 && c.DBMinConns > c.DBMaxConns) {
+        errs = append(errs, errors.New("db_min_conns must be 0..db_max_conns"))
+    }
+    if c.DBMaxConnLifetime < 0 || c.DBMaxConnIdleTime < 0 {
+        errs = append(errs, errors.New("db_max_conn_lifetime and db_max_conn_idle_time must not be negative"))
+    }
+    for _, t := range []struct {
+        name string
+        d    Duration
+    }{
+        {"http_read_header_timeout", c.HTTPReadHeaderTimeout}, {"http_read_timeout", c.HTTPReadTimeout},
+        {"http_write_timeout", c.HTTPWriteTimeout}, {"http_idle_timeout", c.HTTPIdleTimeout},
+        {"db_statement_timeout", c.DBStatementTimeout}, {"db_query_timeout", c.DBQueryTimeout},
+        {"db_analytics_query_timeout", c.DBAnalyticsQueryTimeout}, {"db_export_query_timeout", c.DBExportQueryTimeout},
+        {"db_slow_query_threshold", c.DBSlowQueryThreshold}, {"db_replica_max_lag", c.DBReplicaMaxLag},
+    } {
+        if t.d < 0 { errs = append(errs, fmt.Errorf("%s must not be negative", t.name)) }
+    }
+    if c.DatabaseReplicaURL != "" {
+        if c.DatabaseURL == "" { errs = append(errs, errors.New("database_replica_url requires database_url")) }
+        if c.DBReplicaCheckInterval <= 0 { errs = append(errs, errors.New("db_replica_check_interval must be positive")) }
+    }
+    if c.MaxBodyBytes < 0 { errs = append(errs, errors.New("max_body_bytes must not be negative")) }
+    if (c.TLSCertFile == "") != (c.TLSKeyFile == "") { errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together")) }
+    if domains := splitList(c.TLSAutocertDomains); len(domains) > 0 {
+        if c.TLSCertFile != "" { errs = append(errs, errors.New("tls_autocert_domains and tls_cert_file are mutually exclusive")) }
+        if c.TLSAutocertCacheDir == "" { errs = append(errs, errors.New("tls_autocert_domains requires tls_autocert_cache_dir")) }
+        for _, d := range domains {
+            if !autocertDomainPattern.MatchString(d) { errs = append(errs, fmt.Errorf("tls_autocert_domains must be host names, got %q", d)) }
+        }
+    }
+    if c.TLSRedirectAddr != "" {
+        if !c.tlsEnabled() { errs = append(errs, errors.New("tls_redirect_addr requires tls_cert_file or tls_autocert_domains")) }
+        if _, _, err := net.SplitHostPort(c.TLSRedirectAddr); err != nil { errs = append(errs, fmt.Errorf("tls_redirect_addr must be host:port, got %q", c.TLSRedirectAddr)) }
+    }
+    if c.HSTSMaxAge < 0 { errs = append(errs, errors.New("hsts_max_age must not be negative")) }
+    if c.DemoSyntheticPatients < 0 { errs = append(errs, errors.New("demo_synthetic_patients must not be negative")) }
+    if c.RxNormEnabled {
+        if u, err := url.Parse(c.RxNormBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+            errs = append(errs, fmt.Errorf("rxnorm_base_url must be an absolute URL, got %q", c.RxNormBaseURL))
+        }
+        if c.RxNormTimeout <= 0 { errs = append(errs, errors.New("rxnorm_timeout must be positive")) }
+    }
+    switch c.AttachmentStore {
+    case "", "memory":
+    case "disk":
+        if c.AttachmentDir == "" { errs = append(errs, errors.New("attachment_store disk requires attachment_dir")) }
+    case "s3":
+        if c.S3Bucket == "" || c.S3Region == "" || c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" {
+            errs = append(errs, errors.New("attachment_store s3 requires s3_bucket, s3_region, s3_access_key_id, and s3_secret_access_key"))
+        }
+        if c.S3Endpoint != "" {
+            if u, err := url.Parse(c.S3Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+                errs = append(errs, fmt.Errorf("s3_endpoint must be an absolute URL, got %q", c.S3Endpoint))
+            }
+        }
+    default:
+        errs = append(errs, fmt.Errorf("attachment_store must be disk, s3, or memory, got %q", c.AttachmentStore))
+    }
+    if c.AttachmentMaxBytes <= 0 { errs = append(errs, errors.New("attachment_max_bytes must be positive")) }
+    if k := c.PrescriptionSigningKey; k != "" && len(k) < minSigningKeyLen {
+        errs = append(errs, fmt.Errorf("prescription_signing_key must be at least %d characters", minSigningKeyLen))
+    }
+    if c.RetentionDays < 0 { errs = append(errs, errors.New("retention_days must not be negative")) }
+    if c.RetentionInterval <= 0 { errs = append(errs, errors.New("retention_interval must be positive")) }
+    if c.JobExpiryInterval <= 0 || c.JobPurgeInterval <= 0 || c.SummaryInterval <= 0 {
+        errs = append(errs, errors.New("job_expiry_interval, job_purge_interval, and summary_interval must be positive"))
+    }
+    if c.AuditRetentionDays < 0 { errs = append(errs, errors.New("audit_retention_days must not be negative")) }
+    if c.SummaryEmailTo != "" && (c.SMTPAddr == "" || c.SMTPFrom == "") {
+        errs = append(errs, errors.New("summary_email_to requires smtp_addr and smtp_from"))
+    }
+    for _, n := range splitList(c.Notifiers) {
+        switch n {
+        case "smtp":
+            if c.SMTPAddr == "" || c.SMTPFrom == "" { errs = append(errs, errors.New("notifiers smtp requires smtp_addr and smtp_from")) }
+        case "twilio":
+            if c.TwilioAccountSID == "" || c.TwilioAuthToken == "" || c.TwilioFrom == "" {
+                errs = append(errs, errors.New("notifiers twilio requires twilio_account_sid, twilio_auth_token, and twilio_from"))
+            }
+            if u, err := url.Parse(c.TwilioBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+                errs = append(errs, fmt.Errorf("twilio_base_url must be an absolute URL, got %q", c.TwilioBaseURL))
+            }
+        default:
+            errs = append(errs, fmt.Errorf("notifiers must be smtp or twilio, got %q", n))
+        }
+    }
+    if c.SMTPAddr != "" {
+        if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil { errs = append(errs, fmt.Errorf("smtp_addr must be host:port, got %q", c.SMTPAddr)) }
+    }
+    return errors.Join(errs...)
+}
+
+// poolConfig is the pgx pool tuning for NewPGRepo
+func (c Config) poolConfig() PoolConfig {
+    return PoolConfig{
+        MaxConns:        int32(c.DBMaxConns),
+        MinConns:        int32(c.DBMinConns),
+        MaxConnLifetime: time.Duration(c.DBMaxConnLifetime),
+        MaxConnIdleTime: time.Duration(c.DBMaxConnIdleTime),
+        StatementTimeout: time.Duration(c.DBStatementTimeout),
+        QueryTimeouts: QueryTimeouts{
+            Default:   time.Duration(c.DBQueryTimeout),
+            Analytics: time.Duration(c.DBAnalyticsQueryTimeout),
+            Export:    time.Duration(c.DBExportQueryTimeout),
+        },
+        SlowQueryThreshold: time.Duration(c.DBSlowQueryThreshold),
+        ReplicaDSN:           c.DatabaseReplicaURL,
+        ReplicaMaxLag:        time.Duration(c.DBReplicaMaxLag),
+        ReplicaCheckInterval: time.Duration(c.DBReplicaCheckInterval),
+    }
+}
+
+// dsnPassword matches the password in a key=value connection string
+var dsnPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// redact masks credentials in a URL or key=value connection string
+func redact(s string) string {
+    if s == "" { return "" }
+    if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+        if _, ok := u.User.Password(); ok { u.User = url.UserPassword(u.User.Username(), "xxxxx") }
+        q := u.Query()
+        if q.Has("password") {
+            q.Set("password", "xxxxx")
+            u.RawQuery = q.Encode()
+        }
+        return u.String()
+    }
+    return dsnPassword.ReplaceAllString(s, "${1}xxxxx")
+}
+
+// Redacted returns a copy of c that is safe to show: secret fields have their
+// credentials masked
+func (c Config) Redacted() Config {
+    v := reflect.ValueOf(&c).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        f := v.Field(i)
+        switch v.Type().Field(i).Tag.Get("secret") {
+        case "dsn":
+            f.SetString(redact(f.String()))
+        case "token":
+            if f.String() != "" { f.SetString("xxxxx") }
+        }
+    }
+    return c
+}
+
+// handleDebugConfig serves GET /debug/config (admin): the effective configuration with
+// secrets redacted
+func (s *Server) handleDebugConfig(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActConfigRead, Resource{}); !ok { return }
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    writeJSON(w, http.StatusOK, s.cfg.Redacted())
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLoadConfig(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "config.json")
+    if err := os.WriteFile(file, []byte(`{"addr":":9000","retention_days":30,"rxnorm_timeout":"1s"}`), 0o600); err != nil { t.Fatal(err) }
+    badFile := filepath.Join(t.TempDir(), "bad.json")
+    if err := os.WriteFile(badFile, []byte(`{"adress":":9000"}`), 0o600); err != nil { t.Fatal(err) }
+
+    cases := []struct {
+        name      string
+        env       map[string]string
+        check     func(Config) bool
+        expectErr string
+    }{
+        {name: "defaults", check: func(c Config) bool {
+            return c.Addr == ":8080" && c.WebOrigin == "http://localhost:5173" && time.Duration(c.RetentionInterval) == 24*time.Hour && !c.RxNormEnabled
+        }},
+        {name: "env", env: map[string]string{"ADDR": ":7000", "DEMO_MODE": "1", "RXNORM_ENABLED": "true", "RXNORM_TIMEOUT": "500ms"}, check: func(c Config) bool {
+            return c.Addr == ":7000" && c.DemoMode && c.RxNormEnabled && time.Duration(c.RxNormTimeout) == 500*time.Millisecond
+        }},
+        {name: "file", env: map[string]string{"CONFIG_FILE": file}, check: func(c Config) bool {
+            return c.Addr == ":9000" && c.RetentionDays == 30 && time.Duration(c.RxNormTimeout) == time.Second
+        }},
+        {name: "env overrides file", env: map[string]string{"CONFIG_FILE": file, "ADDR": ":7000"}, check: func(c Config) bool {
+            return c.Addr == ":7000" && c.RetentionDays == 30
+        }},
+        {name: "unknown file key", env: map[string]string{"CONFIG_FILE": badFile}, expectErr: `unknown field "adress"`},
+        {name: "bad duration", env: map[string]string{"RETENTION_INTERVAL": "daily"}, expectErr: "RETENTION_INTERVAL"},
+        {name: "bad bool", env: map[string]string{"DEMO_MODE": "yes"}, expectErr: "DEMO_MODE"},
+        {name: "min above max conns", env: map[string]string{"DB_MAX_CONNS": "4", "DB_MIN_CONNS": "8"}, expectErr: "db_min_conns"},
+        {name: "replica without primary", env: map[string]string{"DATABASE_REPLICA_URL": "postgres://app@replica/rx"}, expectErr: "database_replica_url requires database_url"},
+        {name: "negative replica lag", env: map[string]string{"DATABASE_URL": "postgres://app@db/rx", "DATABASE_REPLICA_URL": "postgres://app@replica/rx", "DB_REPLICA_MAX_LAG": "-1s"}, expectErr: "db_replica_max_lag"},
+        {name: "negative query timeout", env: map[string]string{"DB_QUERY_TIMEOUT": "-1s"}, expectErr: "db_query_timeout"},
+        {name: "negative retention", env: map[string]string{"RETENTION_DAYS": "-1"}, expectErr: "retention_days"},
+        {name: "summary without smtp", env: map[string]string{"SUMMARY_EMAIL_TO": "ops@example.com"}, expectErr: "smtp_addr"},
+        {name: "zero job interval", env: map[string]string{"JOB_PURGE_INTERVAL": "0s"}, expectErr: "job_purge_interval"},
+        {name: "short signing key", env: map[string]string{"PRESCRIPTION_SIGNING_KEY": "too-short"}, expectErr: "prescription_signing_key"},
+        {name: "tls cert without key", env: map[string]string{"TLS_CERT_FILE": "/etc/tls/cert.pem"}, expectErr: "tls_key_file"},
+        {name: "autocert without cache", env: map[string]string{"TLS_AUTOCERT_DOMAINS": "portal.clinic.example"}, expectErr: "tls_autocert_cache_dir"},
+        {name: "autocert url", env: map[string]string{"TLS_AUTOCERT_DOMAINS": "https://portal.clinic.example", "TLS_AUTOCERT_CACHE_DIR": "/var/cache/autocert"}, expectErr: "host names"},
+        {name: "redirect without tls", env: map[string]string{"TLS_REDIRECT_ADDR": ":80"}, expectErr: "tls_redirect_addr"},
+        {name: "s3 without bucket", env: map[string]string{"ATTACHMENT_STORE": "s3", "S3_ACCESS_KEY_ID": "id", "S3_SECRET_ACCESS_KEY": "secret"}, expectErr: "s3_bucket"},
+        {name: "unknown attachment store", env: map[string]string{"ATTACHMENT_STORE": "ftp"}, expectErr: "attachment_store"},
+        {name: "relative rxnorm url", env: map[string]string{"RXNORM_ENABLED": "1", "RXNORM_BASE_URL": "rxnav/REST"}, expectErr: "rxnorm_base_url"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            cfg, err := loadConfig(func(k string) string { return tc.env[k] })
+            if tc.expectErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tc.expectErr) { t.Fatalf("err = %v, want %q", err, tc.expectErr) }
+                return
+            }
+            if err != nil { t.Fatalf("unexpected error: %v", err) }
+            if !tc.check(cfg) { t.Fatalf("config = %+v", cfg) }
+        })
+    }
+}
+
+func TestRedact(t *testing.T) {
+    cases := []struct{ in, want string }{
+        {"postgres://app:s3cret@db:5432/rx?sslmode=disable", "postgres://app:xxxxx@db:5432/rx?sslmode=disable"},
+        {"postgres://db/rx?password=s3cret", "postgres://db/rx?password=xxxxx"},
+        {"host=db user=app password=s3cret dbname=rx", "host=db user=app password=xxxxx dbname=rx"},
+        {"host=db password='s3 cret' dbname=rx", "host=db password=xxxxx dbname=rx"},
+        {"postgres://app@db/rx", "postgres://app@db/rx"},
+    }
+    for _, tc := range cases {
+        if got := redact(tc.in); got != tc.want { t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want) }
+    }
+}
+
+func TestDebugConfig(t *testing.T) {
+    cfg := defaultConfig()
+    cfg.DatabaseURL = "postgres://app:s3cret@db/rx"
+    cfg.ScalingToken = "s3cret-token"
+    srv := NewServer(newDemoMemoryRepo(), cfg)
+    for _, tc := range []struct {
+        role         string
+        expectStatus int
+    }{{"admin", http.StatusOK}, {"physician", http.StatusForbidden}} {
+        req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+        req.Header.Set("X-Role", tc.role)
+        req.Header.Set("X-User-ID", "1")
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        if rr.Code != tc.expectStatus { t.Fatalf("%s status = %d, want %d", tc.role, rr.Code, tc.expectStatus) }
+        if rr.Code != http.StatusOK { continue }
+        if strings.Contains(rr.Body.String(), "s3cret") { t.Fatalf("secret leaked: %s", rr.Body.String()) }
+        var got map[string]any
+        _ = json.NewDecoder(rr.Body).Decode(&got)
+        if got["database_url"] != "postgres://app:xxxxx@db/rx" || got["http_write_timeout"] != "10m0s" || got["scaling_token"] != "xxxxx" { t.Fatalf("config = %v", got) }
+    }
+}
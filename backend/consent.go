@@ -0,0 +1,154 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// Consent scopes: what a linked physician may access for a patient. A panel link alone
+// grants nothing; each scope needs an active consent.
+const (
+    // ConsentPrescriptions covers prescribing for the patient and reading their chart
+    // (patient detail, care-team comments)
+    ConsentPrescriptions = "prescriptions"
+    // ConsentAllergies is reserved for allergy records
+    ConsentAllergies = "allergies"
+    // ConsentAnalytics covers analytics narrowed to the patient (?patient_id=)
+    ConsentAnalytics = "analytics"
+)
+
+var consentScopes = map[string]bool{ConsentPrescriptions: true, ConsentAllergies: true, ConsentAnalytics: true}
+
+// Consent is a patient's grant of one scope to one physician, optionally expiring. Revoked
+// and expired consents are kept as history.
+type Consent struct {
+    ID          int64      `json:"id"`
+    PatientID   int64      `json:"patient_id"`
+    PhysicianID int64      `json:"physician_id"`
+    Scope       string     `json:"scope"`
+    GrantedAt   time.Time  `json:"granted_at"`
+    ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+    RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+    // Active is computed when the consent is served
+    Active      bool       `json:"active"`
+}
+
+func (c Consent) activeAt(t time.Time) bool {
+    return c.RevokedAt == nil && (c.ExpiresAt == nil || c.ExpiresAt.After(t))
+}
+
+// PatientAccess is what a physician may do with one patient's records: Linked when the
+// patient is on their panel, Consented when the patient also consented to the scope asked about
+type PatientAccess struct {
+    Linked    bool
+    Consented bool
+}
+
+// physicianAccess reports whether physicianID is linked to patientID and, if so, whether
+// the patient has an active consent for scope
+func (s *Server) physicianAccess(ctx context.Context, physicianID, patientID int64, scope string) (linked, consented bool, err error) {
+    linked, err = s.repo.IsPhysicianPatientLinked(ctx, physicianID, patientID)
+    if err != nil || !linked { return linked, false, err }
+    consented, err = s.repo.HasActiveConsent(ctx, patientID, physicianID, scope)
+    return linked, consented, err
+}
+
+// physicianCanRead reports whether physicianID may read patientID's chart and prescriptions:
+// linked, with consent to prescriptions access. Every physician read checks it, directly or,
+// for lists, as ListPrescriptionsFilter.ConsentScope (see ownPrescriptionFilter).
+func (s *Server) physicianCanRead(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    linked, consented, err := s.physicianAccess(ctx, physicianID, patientID, ConsentPrescriptions)
+    return linked && consented, err
+}
+
+// hasAnyConsent reports whether the patient has an active consent of any scope for
+// physicianID, which physicians need before adding the patient to a panel
+func (s *Server) hasAnyConsent(ctx context.Context, patientID, physicianID int64) (bool, error) {
+    for scope := range consentScopes {
+        ok, err := s.repo.HasActiveConsent(ctx, patientID, physicianID, scope)
+        if err != nil || ok { return ok, err }
+    }
+    return false, nil
+}
+
+// authorizePhysicianAccess is physicianAccess for handlers: it writes a 403 naming what is
+// missing and returns false unless the physician is linked and has consent for scope
+func (s *Server) authorizePhysicianAccess(w http.ResponseWriter, r *http.Request, physicianID, patientID int64, scope string) bool {
+    linked, consented, err := s.physicianAccess(r.Context(), physicianID, patientID, scope)
+    if err != nil { writeError(w, http.StatusInternalServerError, "consent check failed"); return false }
+    if !linked { writeErrorCode(w, http.StatusForbidden, CodePhysicianNotLinked, "physician not linked to patient"); return false }
+    if !consented {
+        writeErrorCode(w, http.StatusForbidden, CodeConsentRequired, "patient has not consented to "+scope+" access by this physician")
+        return false
+    }
+    return true
+}
+
+type grantConsentReq struct {
+    PhysicianID int64      `json:"physician_id"`
+    Scope       string     `json:"scope"`
+    ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// handlePatientConsents serves a patient's consents (tail is what follows
+// /patients/{id}/consents):
+//   GET    /patients/{id}/consents              all consents, newest first, with "active"
+//   POST   /patients/{id}/consents              {"physician_id":N,"scope":"prescriptions","expires_at":"..."}
+//   DELETE /patients/{id}/consents/{consentID}  revoke; 204 also when already revoked
+// Granting a scope the physician already holds replaces the earlier consent.
+func (s *Server) handlePatientConsents(w http.ResponseWriter, r *http.Request, patientID int64, tail string) {
+    switch {
+    case tail == "" && r.Method == http.MethodGet:
+        if _, ok := s.can(w, r, ActConsentRead, Resource{PatientID: patientID}); !ok { return }
+        items, err := s.repo.ListConsents(r.Context(), patientID)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list consents"); return }
+        now := time.Now()
+        for i := range items { items[i].Active = items[i].activeAt(now) }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    case tail == "" && r.Method == http.MethodPost:
+        if _, ok := s.can(w, r, ActConsentWrite, Resource{PatientID: patientID}); !ok { return }
+        var req grantConsentReq
+        if !decodeJSON(w, r, &req) { return }
+        if req.PhysicianID <= 0 { writeError(w, http.StatusBadRequest, "physician_id must be > 0"); return }
+        if !consentScopes[req.Scope] {
+            writeError(w, http.StatusBadRequest, "scope must be prescriptions, allergies, or analytics")
+            return
+        }
+        if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+            writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+            return
+        }
+        c, err := s.repo.GrantConsent(r.Context(), &Consent{PatientID: patientID, PhysicianID: req.PhysicianID, Scope: req.Scope, ExpiresAt: req.ExpiresAt})
+        if err != nil {
+            if errors.Is(err, ErrInvalidReference) { writeRepoError(w, err, "invalid patient or physician_id"); return }
+            writeError(w, http.StatusInternalServerError, "failed to grant consent")
+            return
+        }
+        s.audit(r, AuditConsentGrant, "consent", c.ID)
+        c.Active = true
+        writeJSON(w, http.StatusCreated, c)
+    case len(tail) > 1 && tail[0] == '/' && r.Method == http.MethodDelete:
+        if _, ok := s.can(w, r, ActConsentWrite, Resource{PatientID: patientID}); !ok { return }
+        id, err := strconv.ParseInt(tail[1:], 10, 64)
+        if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid consent id in path"); return }
+        revoked, err := s.repo.RevokeConsent(r.Context(), patientID, id)
+        if err != nil {
+            if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "consent not found"); return }
+            writeError(w, http.StatusInternalServerError, "failed to revoke consent")
+            return
+        }
+        if revoked { s.audit(r, AuditConsentRevoke, "consent", id) }
+        w.WriteHeader(http.StatusNoContent)
+    case tail == "":
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    case len(tail) > 1 && tail[0] == '/':
+        w.Header().Set("Allow", http.MethodDelete)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    default:
+        writeError(w, http.StatusNotFound, "not found")
+    }
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+func consentRequest(srv *Server, method, path, body, role, userID string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("X-Role", role)
+    req.Header.Set("X-User-ID", userID)
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    return rr
+}
+
+// consentID finds the active consent of patient 1 (Alice) for Dr. Smith and scope
+func consentID(t *testing.T, srv *Server, scope string) int64 {
+    rr := consentRequest(srv, http.MethodGet, "/patients/1/consents", "", "patient", "1")
+    var resp struct{ Items []Consent `json:"items"` }
+    if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+    for _, c := range resp.Items {
+        if c.PhysicianID == 1 && c.Scope == scope && c.Active { return c.ID }
+    }
+    t.Fatalf("no active %s consent in %+v", scope, resp.Items)
+    return 0
+}
+
+func TestConsentEndpoints(t *testing.T) {
+    future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        userID       string
+        expectStatus int
+    }{
+        {name: "patient lists own", method: http.MethodGet, path: "/patients/1/consents", role: "patient", userID: "1", expectStatus: http.StatusOK},
+        {name: "patient lists other", method: http.MethodGet, path: "/patients/2/consents", role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "physician cannot list", method: http.MethodGet, path: "/patients/1/consents", role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "patient grants with expiry", method: http.MethodPost, path: "/patients/3/consents", body: `{"physician_id":1,"scope":"analytics","expires_at":"` + future + `"}`, role: "patient", userID: "3", expectStatus: http.StatusCreated},
+        {name: "admin grants", method: http.MethodPost, path: "/patients/3/consents", body: `{"physician_id":2,"scope":"allergies"}`, role: "admin", userID: "1", expectStatus: http.StatusCreated},
+        {name: "physician cannot grant", method: http.MethodPost, path: "/patients/1/consents", body: `{"physician_id":1,"scope":"analytics"}`, role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "unknown scope", method: http.MethodPost, path: "/patients/1/consents", body: `{"physician_id":1,"scope":"everything"}`, role: "patient", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "expiry in the past", method: http.MethodPost, path: "/patients/1/consents", body: `{"physician_id":1,"scope":"analytics","expires_at":"2020-01-01T00:00:00Z"}`, role: "patient", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "unknown physician", method: http.MethodPost, path: "/patients/1/consents", body: `{"physician_id":99,"scope":"analytics"}`, role: "patient", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "revoke missing", method: http.MethodDelete, path: "/patients/1/consents/999", role: "patient", userID: "1", expectStatus: http.StatusNotFound},
+        {name: "bad method", method: http.MethodPatch, path: "/patients/1/consents", role: "patient", userID: "1", expectStatus: http.StatusMethodNotAllowed},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, tc.method, tc.path, tc.body, tc.role, tc.userID)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestConsentGatesPhysicianAccess(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    prescribe := func() int {
+        return consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab BID"}`, "physician", "1").Code
+    }
+    viewPatient := func() int { return consentRequest(srv, http.MethodGet, "/patients/1", "", "physician", "1").Code }
+    if got := prescribe(); got != http.StatusCreated { t.Fatalf("prescribe with consent = %d", got) }
+
+    id := consentID(t, srv, ConsentPrescriptions)
+    other := consentRequest(srv, http.MethodDelete, "/patients/2/consents/"+strconv.FormatInt(id, 10), "", "patient", "2")
+    if other.Code != http.StatusNotFound { t.Fatalf("revoking another patient's consent = %d", other.Code) }
+    for i := 0; i < 2; i++ { // revoking twice is a no-op
+        rr := consentRequest(srv, http.MethodDelete, "/patients/1/consents/"+strconv.FormatInt(id, 10), "", "patient", "1")
+        if rr.Code != http.StatusNoContent { t.Fatalf("revoke = %d, body=%s", rr.Code, rr.Body.String()) }
+    }
+    if got := prescribe(); got != http.StatusForbidden { t.Fatalf("prescribe after revoke = %d", got) }
+    if got := viewPatient(); got != http.StatusForbidden { t.Fatalf("view patient after revoke = %d", got) }
+    // Revocation doesn't touch other scopes
+    analytics := "/analytics/top-drugs?from=2020-01-01T00:00:00Z&to=2099-01-01T00:00:00Z&patient_id=1"
+    if rr := consentRequest(srv, http.MethodGet, analytics, "", "physician", "1"); rr.Code != http.StatusOK {
+        t.Fatalf("analytics with consent = %d, body=%s", rr.Code, rr.Body.String())
+    }
+
+    rr := consentRequest(srv, http.MethodPost, "/patients/1/consents", `{"physician_id":1,"scope":"prescriptions"}`, "patient", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("re-grant = %d, body=%s", rr.Code, rr.Body.String()) }
+    if got := prescribe(); got != http.StatusCreated { t.Fatalf("prescribe after re-grant = %d", got) }
+    if got := viewPatient(); got != http.StatusOK { t.Fatalf("view patient after re-grant = %d", got) }
+}
+
+// Revoking prescriptions consent cuts off every physician read of the patient's
+// prescriptions, not just prescribing and the patient record
+func TestConsentGatesPhysicianReads(t *testing.T) {
+    srv := newAttachmentServer()
+    if rr := attachmentRequest(srv, "/prescriptions/1/attachments", "cbc.pdf", "lab_result", testPDF, "physician", "1"); rr.Code != http.StatusCreated {
+        t.Fatalf("upload status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    // listed reports whether Alice's prescriptions show up for Dr. Smith in path
+    listed := func(path string) bool {
+        rr := consentRequest(srv, http.MethodGet, path, "", "physician", "1")
+        if rr.Code != http.StatusOK { t.Fatalf("%s status = %d, body=%s", path, rr.Code, rr.Body.String()) }
+        return strings.Contains(rr.Body.String(), `"patient_id":1,`)
+    }
+    if !listed("/prescriptions") || !listed("/prescriptions/export?format=ndjson") { t.Fatal("Alice's prescriptions missing before revoke") }
+
+    id := consentID(t, srv, ConsentPrescriptions)
+    if rr := consentRequest(srv, http.MethodDelete, "/patients/1/consents/"+strconv.FormatInt(id, 10), "", "patient", "1"); rr.Code != http.StatusNoContent {
+        t.Fatalf("revoke = %d", rr.Code)
+    }
+    if listed("/prescriptions") || listed("/prescriptions/export?format=ndjson") { t.Fatal("Alice's prescriptions listed after revoke") }
+    for path, want := range map[string]int{
+        "/patients/1/prescriptions.pdf":   http.StatusForbidden,
+        "/prescriptions/1/attachments":    http.StatusNotFound,
+        "/prescriptions/1/attachments/1":  http.StatusNotFound,
+        "/prescriptions/1/comments":       http.StatusNotFound,
+    } {
+        if rr := consentRequest(srv, http.MethodGet, path, "", "physician", "1"); rr.Code != want {
+            t.Fatalf("%s status = %d, want %d", path, rr.Code, want)
+        }
+    }
+}
+
+func TestConsentExpiry(t *testing.T) {
+    ctx := context.Background()
+    m := newDemoMemoryRepo()
+    past := time.Now().Add(-time.Minute)
+    m.consents[m.nextID("consents")] = Consent{PatientID: 3, PhysicianID: 1, Scope: ConsentPrescriptions, GrantedAt: past.Add(-time.Hour), ExpiresAt: &past}
+    if ok, _ := m.HasActiveConsent(ctx, 3, 1, ConsentPrescriptions); ok { t.Fatal("expired consent counted as active") }
+    if ok, _ := m.HasActiveConsent(ctx, 3, 2, ConsentPrescriptions); !ok { t.Fatal("demo link consent missing") }
+}
+
+func TestAnalyticsPatientNarrowing(t *testing.T) {
+    window := "/analytics/top-drugs?from=2020-01-01T00:00:00Z&to=2099-01-01T00:00:00Z"
+    cases := []struct {
+        name         string
+        query        string
+        role         string
+        userID       string
+        expectStatus int
+    }{
+        {name: "admin any patient", query: "&patient_id=3", role: "admin", userID: "1", expectStatus: http.StatusOK},
+        {name: "physician consented patient", query: "&patient_id=1", role: "physician", userID: "1", expectStatus: http.StatusOK},
+        {name: "physician unlinked patient", query: "&patient_id=3", role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "invalid patient_id", query: "&patient_id=x", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, http.MethodGet, window+tc.query, "", tc.role, tc.userID)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
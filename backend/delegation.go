@@ -0,0 +1,102 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+)
+
+// authorizeDraft checks that caller may draft a prescription for physicianID: unrestricted
+// grants may draft for anyone, own-scoped nurses only for physicians who delegated to them.
+// It writes the error response and returns false when drafting is not allowed.
+func (s *Server) authorizeDraft(w http.ResponseWriter, r *http.Request, caller Principal, scope Scope, physicianID int64) bool {
+    if scope == ScopeAll { return true }
+    if caller.Owns != OwnsNurse {
+        writeError(w, http.StatusForbidden, "drafting requires a nurse identity")
+        return false
+    }
+    ok, err := s.repo.IsNurseDelegate(r.Context(), caller.UserID, physicianID)
+    if err != nil { writeError(w, http.StatusInternalServerError, "delegation check failed"); return false }
+    if !ok { writeErrorCode(w, http.StatusForbidden, CodeDelegationRequired, "physician has not delegated drafting to this nurse"); return false }
+    return true
+}
+
+// handleSignPrescription serves POST /prescriptions/{id}/sign: the prescribing physician
+// activates a nurse-drafted prescription (only then is prescription.created published) or
+// re-authorizes one moved to them by a patient transfer (see transfer.go).
+func (s *Server) handleSignPrescription(w http.ResponseWriter, r *http.Request, id int64) {
+    caller, scope, ok := s.permit(w, r, ActPrescriptionSign)
+    if !ok { return }
+    p, err := s.repo.GetPrescription(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "prescription not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch prescription")
+        return
+    }
+    // Other physicians' prescriptions are indistinguishable from missing ones
+    if scope == ScopeOwn && !(Resource{PhysicianID: p.PhysicianID}).ownedBy(caller) {
+        writeError(w, http.StatusNotFound, "prescription not found")
+        return
+    }
+    // Signing needs consent as creating does: a draft may predate the patient revoking it,
+    // and a physician new to the patient after a transfer may not have it yet
+    if !s.authorizePhysicianAccess(w, r, p.PhysicianID, p.PatientID, ConsentPrescriptions) { return }
+    signed, err := s.repo.SignPrescription(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotPending) { writeRepoError(w, err, "prescription is not pending signature"); return }
+        writeError(w, http.StatusInternalServerError, "failed to sign prescription")
+        return
+    }
+    s.signPrescription(r.Context(), signed)
+    s.audit(r, AuditSign, "prescription", id)
+    if p.Status == PrescriptionPendingSignature { s.webhooks.Publish(r.Context(), EventPrescriptionCreated, signed) }
+    writeJSON(w, http.StatusOK, signed)
+}
+
+// handlePhysicianNurses serves a physician's drafting delegations (tail is what follows
+// /physicians/{id}/nurses):
+//   GET    /physicians/{id}/nurses            nurses who may draft for the physician
+//   POST   /physicians/{id}/nurses            {"nurse_id":N} delegate drafting
+//   DELETE /physicians/{id}/nurses/{nurseID}  revoke; 204 whether or not it existed
+func (s *Server) handlePhysicianNurses(w http.ResponseWriter, r *http.Request, idStr, tail string) {
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid physician id in path"); return }
+    switch {
+    case tail == "" && r.Method == http.MethodGet:
+        if _, ok := s.can(w, r, ActDelegationRead, Resource{PhysicianID: id}); !ok { return }
+        items, err := s.repo.ListNursesForPhysician(r.Context(), id)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list nurses"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    case tail == "" && r.Method == http.MethodPost:
+        if _, ok := s.can(w, r, ActDelegationWrite, Resource{PhysicianID: id}); !ok { return }
+        var req struct {
+            NurseID int64 `json:"nurse_id"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        if req.NurseID <= 0 { writeError(w, http.StatusBadRequest, "nurse_id must be > 0"); return }
+        created, err := s.repo.AddNurseDelegation(r.Context(), id, req.NurseID)
+        if err != nil {
+            if errors.Is(err, ErrInvalidReference) { writeRepoError(w, err, "invalid physician or nurse_id"); return }
+            writeError(w, http.StatusInternalServerError, "failed to delegate")
+            return
+        }
+        status := http.StatusOK
+        if created { status = http.StatusCreated }
+        writeJSON(w, status, map[string]any{"physician_id": id, "nurse_id": req.NurseID, "created": created})
+    case tail != "" && r.Method == http.MethodDelete:
+        nurseID, err := strconv.ParseInt(tail[1:], 10, 64)
+        if err != nil || nurseID <= 0 { writeError(w, http.StatusBadRequest, "invalid nurse id in path"); return }
+        if _, ok := s.can(w, r, ActDelegationWrite, Resource{PhysicianID: id}); !ok { return }
+        if err := s.repo.RemoveNurseDelegation(r.Context(), id, nurseID); err != nil {
+            writeError(w, http.StatusInternalServerError, "failed to revoke delegation")
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    case tail == "":
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    default:
+        w.Header().Set("Allow", http.MethodDelete)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestNurseDraftAndSign(t *testing.T) {
+    // Demo data: Nurse Taylor (nurse 1) is delegated by Dr. Smith (physician 1), who is linked to Alice and Bob
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    do := func(method, path, role, userID, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-Role", role)
+        req.Header.Set("X-User-ID", userID)
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+
+    if rr := do(http.MethodPost, "/v1/prescriptions", "nurse", "1", `{"patient_id":3,"physician_id":2,"drug_id":2,"quantity":10,"sig":"PRN"}`); rr.Code != http.StatusForbidden {
+        t.Fatalf("undelegated physician status = %d, want 403", rr.Code)
+    }
+    rr := do(http.MethodPost, "/v1/prescriptions", "nurse", "1", `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":10,"sig":"PRN"}`)
+    if rr.Code != http.StatusCreated { t.Fatalf("draft status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var draft Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&draft)
+    if draft.Status != PrescriptionPendingSignature || draft.DraftedBy == nil || *draft.DraftedBy != 1 {
+        t.Fatalf("draft = %+v", draft)
+    }
+
+    // Unsigned drafts are hidden from the patient and can't be signed by another physician
+    rr = do(http.MethodGet, "/v1/prescriptions", "patient", "1", "")
+    if strings.Contains(rr.Body.String(), `"pending_signature"`) { t.Fatalf("patient sees draft: %s", rr.Body.String()) }
+    rr = do(http.MethodGet, "/v1/prescriptions", "nurse", "1", "")
+    if !strings.Contains(rr.Body.String(), `"pending_signature"`) { t.Fatalf("nurse does not see own draft: %s", rr.Body.String()) }
+    path := "/v1/prescriptions/" + strconv.FormatInt(draft.ID, 10) + "/sign"
+    if rr := do(http.MethodPost, path, "physician", "2", ""); rr.Code != http.StatusNotFound { t.Fatalf("other physician sign status = %d", rr.Code) }
+    if rr := do(http.MethodPost, path, "nurse", "1", ""); rr.Code != http.StatusForbidden { t.Fatalf("nurse sign status = %d", rr.Code) }
+
+    rr = do(http.MethodPost, path, "physician", "1", "")
+    if rr.Code != http.StatusOK { t.Fatalf("sign status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var signed Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&signed)
+    if signed.Status != PrescriptionActive || signed.SignedAt == nil { t.Fatalf("signed = %+v", signed) }
+    if len(repo.audit) != 1 || repo.audit[0].Action != AuditSign { t.Fatalf("audit = %+v", repo.audit) }
+    if rr := do(http.MethodPost, path, "physician", "1", ""); rr.Code != http.StatusConflict { t.Fatalf("re-sign status = %d, want 409", rr.Code) }
+}
+
+func TestSignDraftRequiresConsent(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    rr := consentRequest(srv, http.MethodPost, "/v1/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":10,"sig":"PRN"}`, "nurse", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("draft status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var draft Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&draft)
+    path := "/v1/prescriptions/" + strconv.FormatInt(draft.ID, 10) + "/sign"
+
+    // Alice revokes consent after the draft was written
+    revoke := "/patients/1/consents/" + strconv.FormatInt(consentID(t, srv, ConsentPrescriptions), 10)
+    if rr := consentRequest(srv, http.MethodDelete, revoke, "", "patient", "1"); rr.Code != http.StatusNoContent { t.Fatalf("revoke = %d", rr.Code) }
+    rr = consentRequest(srv, http.MethodPost, path, "", "physician", "1")
+    if rr.Code != http.StatusForbidden { t.Fatalf("sign without consent status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var body Problem
+    if err := json.NewDecoder(rr.Body).Decode(&body); err != nil { t.Fatalf("invalid json: %v", err) }
+    if body.Code != CodeConsentRequired { t.Fatalf("code = %q, want %q", body.Code, CodeConsentRequired) }
+
+    if rr := consentRequest(srv, http.MethodPost, "/patients/1/consents", `{"physician_id":1,"scope":"prescriptions"}`, "patient", "1"); rr.Code != http.StatusCreated {
+        t.Fatalf("re-grant = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    if rr := consentRequest(srv, http.MethodPost, path, "", "physician", "1"); rr.Code != http.StatusOK { t.Fatalf("sign status = %d, body=%s", rr.Code, rr.Body.String()) }
+}
+
+func TestPhysicianNurseDelegations(t *testing.T) {
+    cases := []struct {
+        name         string
+        method, path string
+        role, userID string
+        body         string
+        expectStatus int
+    }{
+        {name: "physician lists own", method: http.MethodGet, path: "/v1/physicians/1/nurses", role: "physician", userID: "1", expectStatus: http.StatusOK},
+        {name: "physician lists other", method: http.MethodGet, path: "/v1/physicians/2/nurses", role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "physician delegates", method: http.MethodPost, path: "/v1/physicians/2/nurses", role: "physician", userID: "2", body: `{"nurse_id":1}`, expectStatus: http.StatusCreated},
+        {name: "existing delegation", method: http.MethodPost, path: "/v1/physicians/1/nurses", role: "admin", userID: "1", body: `{"nurse_id":1}`, expectStatus: http.StatusOK},
+        {name: "unknown nurse", method: http.MethodPost, path: "/v1/physicians/1/nurses", role: "admin", userID: "1", body: `{"nurse_id":99}`, expectStatus: http.StatusBadRequest},
+        {name: "nurse cannot delegate", method: http.MethodPost, path: "/v1/physicians/1/nurses", role: "nurse", userID: "1", body: `{"nurse_id":1}`, expectStatus: http.StatusForbidden},
+        {name: "physician revokes", method: http.MethodDelete, path: "/v1/physicians/1/nurses/1", role: "physician", userID: "1", expectStatus: http.StatusNoContent},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// Dosage is the optional structured form of a prescription's directions. When present
+// it is stored alongside the free-text sig.
+type Dosage struct {
+    Amount       float64 `json:"amount"`
+    Unit         string  `json:"unit"`
+    Route        string  `json:"route"`
+    Frequency    string  `json:"frequency"`
+    DurationDays int     `json:"duration_days,omitempty"`
+}
+
+// allowedDoseUnits is the UCUM unit whitelist for structured dosing (aliases such as
+// "mcg" or "tablet" are accepted and stored as their UCUM code)
+var allowedDoseUnits = map[string]bool{
+    "mg": true, "ug": true, "g": true, "mL": true, "[iU]": true,
+    "{tablet}": true, "{capsule}": true, "{puff}": true, "{drop}": true, "{patch}": true,
+}
+
+var allowedRoutes = map[string]bool{
+    "oral": true, "sublingual": true, "topical": true, "transdermal": true, "inhaled": true,
+    "nasal": true, "ophthalmic": true, "otic": true, "rectal": true, "vaginal": true,
+    "subcutaneous": true, "intramuscular": true, "intravenous": true,
+}
+
+// doseFrequencies maps accepted frequency codes to administrations per day (0 for PRN)
+var doseFrequencies = map[string]float64{
+    "once": 0, "PRN": 0,
+    "daily": 1, "qHS": 1, "BID": 2, "TID": 3, "QID": 4,
+    "q4h": 6, "q6h": 4, "q8h": 3, "q12h": 2,
+    "weekly": 1.0 / 7,
+}
+
+const maxDurationDays = 365
+
+// validate checks the dosage and canonicalizes Unit to its UCUM code
+func (d *Dosage) validate() error {
+    if d.Amount <= 0 { return fmt.Errorf("dosage.amount must be > 0") }
+    code, err := canonicalUnit(d.Unit)
+    if err != nil || !allowedDoseUnits[code] { return fmt.Errorf("dosage.unit %q is not an allowed unit", d.Unit) }
+    d.Unit = code
+    if !allowedRoutes[d.Route] { return fmt.Errorf("dosage.route %q is not an allowed route", d.Route) }
+    if _, ok := doseFrequencies[d.Frequency]; !ok { return fmt.Errorf("dosage.frequency %q is not an allowed frequency", d.Frequency) }
+    if d.DurationDays < 0 || d.DurationDays > maxDurationDays {
+        return fmt.Errorf("dosage.duration_days must be 0..%d", maxDurationDays)
+    }
+    return nil
+}
+
+// sig renders the structured dosage as directions, used when the client sends no sig
+func (d *Dosage) sig() string {
+    s := strconv.FormatFloat(d.Amount, 'f', -1, 64) + " " + unitDisplay(d.Unit) + " " + d.Route + " " + d.Frequency
+    if d.DurationDays > 0 {
+        s += " for " + strconv.Itoa(d.DurationDays) + " days"
+    }
+    return s
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestCreatePrescriptionStructuredDosage(t *testing.T) {
+    cases := []struct {
+        name         string
+        body         string
+        expectStatus int
+        expectSig    string
+        expectExpiry bool
+        expectUnit   string
+    }{
+        {name: "plain sig still accepted", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab BID"}`, expectStatus: http.StatusCreated, expectSig: "1 tab BID"},
+        {name: "structured with duration", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"dosage":{"amount":500,"unit":"mg","route":"oral","frequency":"TID","duration_days":10}}`, expectStatus: http.StatusCreated, expectSig: "500 mg oral TID for 10 days", expectExpiry: true},
+        {name: "structured keeps explicit sig", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"take with food","dosage":{"amount":0.5,"unit":"tablet","route":"oral","frequency":"daily"}}`, expectStatus: http.StatusCreated, expectSig: "take with food"},
+        {name: "alias stored as UCUM code", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"dosage":{"amount":50,"unit":"mcg","route":"oral","frequency":"daily"}}`, expectStatus: http.StatusCreated, expectSig: "50 mcg oral daily", expectUnit: "ug"},
+        {name: "unit not whitelisted", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"dosage":{"amount":5,"unit":"spoonful","route":"oral","frequency":"daily"}}`, expectStatus: http.StatusBadRequest},
+        {name: "bad frequency", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"dosage":{"amount":5,"unit":"mg","route":"oral","frequency":"sometimes"}}`, expectStatus: http.StatusBadRequest},
+        {name: "missing sig and dosage", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30}`, expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", "physician")
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusCreated { return }
+            var p Prescription
+            if err := json.NewDecoder(rr.Body).Decode(&p); err != nil { t.Fatalf("invalid json: %v", err) }
+            if p.Sig != tc.expectSig { t.Fatalf("sig = %q, want %q", p.Sig, tc.expectSig) }
+            if tc.expectUnit != "" && (p.Dosage == nil || p.Dosage.Unit != tc.expectUnit) { t.Fatalf("dosage = %+v, want unit %q", p.Dosage, tc.expectUnit) }
+            if tc.expectExpiry {
+                if p.ExpiresAt == nil || p.ExpiresAt.Sub(p.PrescribedAt).Hours() != 240 {
+                    t.Fatalf("expires_at = %v, prescribed_at = %v", p.ExpiresAt, p.PrescribedAt)
+                }
+            } else if p.ExpiresAt != nil {
+                t.Fatalf("unexpected expires_at %v", p.ExpiresAt)
+            }
+        })
+    }
+}
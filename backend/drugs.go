@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// handleDrugs serves the drug catalog collection:
+//   GET  /drugs?q=ibu&limit=20  search/autocomplete (any role)
+//   POST /drugs                 create a catalog entry, optionally with a schedule and
+//                               dispensing_rules (admin)
+func (s *Server) handleDrugs(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        if _, ok := s.can(w, r, ActDrugRead, Resource{}); !ok { return }
+        limit := 20
+        if ls := r.URL.Query().Get("limit"); ls != "" {
+            if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 100 { limit = n } else {
+                writeError(w, http.StatusBadRequest, "limit must be 1..100"); return
+            }
+        }
+        q := strings.TrimSpace(r.URL.Query().Get("q"))
+        if len(q) > 200 { writeError(w, http.StatusBadRequest, "q too long"); return }
+        items, err := s.repo.SearchDrugs(r.Context(), q, limit)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to search drugs"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit})
+    case http.MethodPost:
+        if _, ok := s.can(w, r, ActDrugWrite, Resource{}); !ok { return }
+        var req struct {
+            Name     string           `json:"name"`
+            Schedule string           `json:"schedule"`
+            Rules    *DispensingRules `json:"dispensing_rules"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        name := strings.TrimSpace(req.Name)
+        if name == "" { writeError(w, http.StatusBadRequest, "name is required"); return }
+        if len(name) > 200 { writeError(w, http.StatusBadRequest, "name too long"); return }
+        if strings.ContainsFunc(name, unicode.IsControl) { writeError(w, http.StatusBadRequest, "name must not contain control characters"); return }
+        if !validSchedule(req.Schedule) { writeError(w, http.StatusBadRequest, "schedule must be one of CII, CIII, CIV, CV"); return }
+        if req.Rules != nil {
+            if err := req.Rules.validate(); err != nil { writeError(w, http.StatusBadRequest, err.Error()); return }
+        }
+        d, err := s.repo.CreateDrug(r.Context(), &Drug{Name: name, Schedule: req.Schedule, Rules: req.Rules})
+        if err != nil {
+            if errors.Is(err, ErrDuplicate) { writeRepoError(w, err, "a drug with this name already exists"); return }
+            writeError(w, http.StatusInternalServerError, "failed to create drug")
+            return
+        }
+        writeJSON(w, http.StatusCreated, d)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// handleDrugSubroutes serves:
+//   GET   /drugs/{id}   single catalog entry (any role)
+//   PATCH /drugs/{id}   {"schedule":"CII"} set or clear ("") the controlled substance schedule,
+//                       {"dispensing_rules":{..}} replace or clear (null) the dispensing rules (admin)
+//   POST /drugs/merge   {"source_id":..,"target_id":..} fold a duplicate into another entry (admin)
+func (s *Server) handleDrugSubroutes(w http.ResponseWriter, r *http.Request) {
+    rest := strings.TrimPrefix(r.URL.Path, "/drugs/")
+    if rest == "merge" {
+        if r.Method != http.MethodPost {
+            w.Header().Set("Allow", http.MethodPost)
+            writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        s.handleMergeDrugs(w, r)
+        return
+    }
+    id, err := strconv.ParseInt(rest, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusNotFound, "not found"); return }
+    switch r.Method {
+    case http.MethodGet:
+        if _, ok := s.can(w, r, ActDrugRead, Resource{}); !ok { return }
+    case http.MethodPatch:
+        s.handleUpdateDrug(w, r, id)
+        return
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPatch)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    d, err := s.repo.GetDrug(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "drug not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch drug")
+        return
+    }
+    writeJSON(w, http.StatusOK, d)
+}
+
+// handleUpdateDrug applies a PATCH carrying schedule, dispensing_rules, or both. Fields
+// that are absent are left alone.
+func (s *Server) handleUpdateDrug(w http.ResponseWriter, r *http.Request, id int64) {
+    if _, ok := s.can(w, r, ActDrugWrite, Resource{}); !ok { return }
+    var req struct {
+        Schedule *string `json:"schedule"`
+        // Raw, so an explicit null (clear) differs from an absent field
+        Rules json.RawMessage `json:"dispensing_rules"`
+    }
+    if !decodeJSON(w, r, &req) { return }
+    if req.Schedule == nil && req.Rules == nil {
+        writeError(w, http.StatusBadRequest, "schedule or dispensing_rules is required")
+        return
+    }
+    if req.Schedule != nil && !validSchedule(*req.Schedule) {
+        writeError(w, http.StatusBadRequest, "schedule must be one of CII, CIII, CIV, CV, or empty")
+        return
+    }
+    var rules *DispensingRules
+    if req.Rules != nil {
+        dec := json.NewDecoder(bytes.NewReader(req.Rules))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(&rules); err != nil { writeError(w, http.StatusBadRequest, "dispensing_rules: "+err.Error()); return }
+        if rules != nil {
+            if err := rules.validate(); err != nil { writeError(w, http.StatusBadRequest, err.Error()); return }
+        }
+    }
+    var err error
+    if req.Schedule != nil { err = s.repo.SetDrugSchedule(r.Context(), id, *req.Schedule) }
+    if err == nil && req.Rules != nil { err = s.repo.SetDrugRules(r.Context(), id, rules) }
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "drug not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to update drug")
+        return
+    }
+    d, err := s.repo.GetDrug(r.Context(), id)
+    if err != nil { writeError(w, http.StatusInternalServerError, "failed to fetch drug"); return }
+    writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Server) handleMergeDrugs(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActDrugWrite, Resource{}); !ok { return }
+    var req struct {
+        SourceID int64 `json:"source_id"`
+        TargetID int64 `json:"target_id"`
+    }
+    if !decodeJSON(w, r, &req) { return }
+    if req.SourceID <= 0 || req.TargetID <= 0 { writeError(w, http.StatusBadRequest, "source_id and target_id must be > 0"); return }
+    if req.SourceID == req.TargetID { writeError(w, http.StatusBadRequest, "source_id and target_id must differ"); return }
+    // Signatures cover the drug id, so the moved prescriptions are re-signed with the merge
+    var moved []int64
+    err := s.repo.InTx(r.Context(), func(ctx context.Context) error {
+        var err error
+        if moved, err = s.repo.MergeDrugs(ctx, req.SourceID, req.TargetID); err != nil { return err }
+        return s.resignMergedPrescriptions(ctx, moved, req.SourceID)
+    })
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "source or target drug not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to merge drugs")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "source_id": req.SourceID, "target_id": req.TargetID, "prescriptions_moved": len(moved),
+    })
+}
+
+// resolveDrug maps a free-text drug name to a catalog id. With RxNorm enabled, names
+// resolving to the same rxcui share one catalog entry and new entries are stored with
+// their normalization. Any RxNorm failure falls back to local name matching.
+func (s *Server) resolveDrug(ctx context.Context, name string) (int64, error) {
+    var concept *RxNormConcept
+    if s.rxnorm != nil {
+        c, err := s.rxnorm.Resolve(ctx, name)
+        if err != nil {
+            log.Printf("rxnorm: resolving %q failed, using local catalog: %v", name, err)
+        }
+        concept = c
+    }
+    if concept != nil {
+        id, err := s.repo.FindDrugByRxCUI(ctx, concept.RxCUI)
+        if err == nil { return id, nil }
+        if !errors.Is(err, ErrNotFound) { return 0, err }
+    }
+    id, err := s.repo.FindOrCreateDrug(ctx, name)
+    if err != nil { return 0, err }
+    if concept != nil {
+        if err := s.repo.SetDrugRxNorm(ctx, id, *concept); err != nil {
+            log.Printf("rxnorm: storing normalization for drug %d failed: %v", id, err)
+        }
+    }
+    return id, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestDrugCatalogEndpoints(t *testing.T) {
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        expectStatus int
+        expectFirst  string // first item name for searches
+    }{
+        {name: "prefix search", method: http.MethodGet, path: "/drugs?q=ibu", role: "physician", expectStatus: http.StatusOK, expectFirst: "Ibuprofen"},
+        {name: "fuzzy search", method: http.MethodGet, path: "/drugs?q=metformn", role: "physician", expectStatus: http.StatusOK, expectFirst: "Metformin"},
+        {name: "get by id", method: http.MethodGet, path: "/drugs/2", role: "patient", expectStatus: http.StatusOK},
+        {name: "get missing", method: http.MethodGet, path: "/drugs/999", role: "admin", expectStatus: http.StatusNotFound},
+        {name: "admin create", method: http.MethodPost, path: "/drugs", body: `{"name":"Atorvastatin"}`, role: "admin", expectStatus: http.StatusCreated},
+        {name: "create with line break", method: http.MethodPost, path: "/drugs", body: `{"name":"Atorvastatin\r\nBcc: x@example.com"}`, role: "admin", expectStatus: http.StatusBadRequest},
+        {name: "create duplicate ignores case", method: http.MethodPost, path: "/drugs", body: `{"name":"ibuprofen"}`, role: "admin", expectStatus: http.StatusConflict},
+        {name: "physician cannot create", method: http.MethodPost, path: "/drugs", body: `{"name":"Atorvastatin"}`, role: "physician", expectStatus: http.StatusForbidden},
+        {name: "admin merge", method: http.MethodPost, path: "/drugs/merge", body: `{"source_id":2,"target_id":3}`, role: "admin", expectStatus: http.StatusOK},
+        {name: "merge same id", method: http.MethodPost, path: "/drugs/merge", body: `{"source_id":2,"target_id":2}`, role: "admin", expectStatus: http.StatusBadRequest},
+        {name: "physician cannot merge", method: http.MethodPost, path: "/drugs/merge", body: `{"source_id":2,"target_id":3}`, role: "physician", expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            repo := newDemoMemoryRepo()
+            srv := NewServer(repo, defaultConfig())
+            req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if tc.expectFirst != "" {
+                var resp struct{ Items []Drug `json:"items"` }
+                if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+                if len(resp.Items) == 0 || resp.Items[0].Name != tc.expectFirst {
+                    t.Fatalf("items = %+v, want first %q", resp.Items, tc.expectFirst)
+                }
+            }
+            if tc.path == "/drugs/merge" && rr.Code == http.StatusOK {
+                if _, ok := repo.drugs[2]; ok { t.Fatalf("merged source drug still present") }
+                for _, p := range repo.prescriptions {
+                    if p.DrugID == 2 { t.Fatalf("prescription %d still references merged drug", p.ID) }
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// minSigningKeyLen is the shortest PRESCRIPTION_SIGNING_KEY accepted
+const minSigningKeyLen = 32
+
+// prescriptionSigner signs prescriptions on behalf of their physicians. Each physician's
+// key is derived from the server key, so a signature binds the prescription to the
+// physician as well as to its content, and no per-physician secret has to be stored.
+type prescriptionSigner struct {
+    key []byte
+}
+
+// signerFromConfig returns nil when PRESCRIPTION_SIGNING_KEY is unset; prescriptions are
+// then stored unsigned
+func signerFromConfig(c Config) *prescriptionSigner {
+    if c.PrescriptionSigningKey == "" { return nil }
+    return &prescriptionSigner{key: []byte(c.PrescriptionSigningKey)}
+}
+
+// ephemeralSigningKey is a random key for in-memory repositories, whose prescriptions
+// are gone after a restart anyway
+func ephemeralSigningKey() (string, error) {
+    b := make([]byte, minSigningKeyLen)
+    if _, err := rand.Read(b); err != nil { return "", fmt.Errorf("generating signing key: %w", err) }
+    return hex.EncodeToString(b), nil
+}
+
+// signedPrescription is the canonical form a signature covers: what the physician
+// prescribed, not the fields that legitimately change later (status, dispensing)
+type signedPrescription struct {
+    V             int     `json:"v"`
+    ID            int64   `json:"id"`
+    PatientID     int64   `json:"patient_id"`
+    PhysicianID   int64   `json:"physician_id"`
+    DrugID        int64   `json:"drug_id"`
+    Quantity      int     `json:"quantity"`
+    // Omitted when empty, so signatures from before these fields existed still verify
+    QuantityUnit  string  `json:"quantity_unit,omitempty"`
+    DaysSupply    int     `json:"days_supply,omitempty"`
+    Sig           string  `json:"sig"`
+    Dosage        *Dosage `json:"dosage"`
+    Refills       int     `json:"refills"`
+    Reason        string  `json:"reason"`
+    DiagnosisCode string  `json:"diagnosis_code"`
+    PharmacyID    *int64  `json:"pharmacy_id"`
+    // PrescribedAt is in microseconds, the precision Postgres keeps
+    PrescribedAt  int64   `json:"prescribed_at"`
+}
+
+func (s *prescriptionSigner) physicianKey(physicianID int64) []byte {
+    mac := hmac.New(sha256.New, s.key)
+    mac.Write([]byte("physician:" + strconv.FormatInt(physicianID, 10)))
+    return mac.Sum(nil)
+}
+
+// sign returns the hex HMAC-SHA256 of p's canonical form under its physician's key
+func (s *prescriptionSigner) sign(p Prescription) string {
+    body, _ := json.Marshal(signedPrescription{
+        V: 1, ID: p.ID, PatientID: p.PatientID, PhysicianID: p.PhysicianID, DrugID: p.DrugID,
+        Quantity: p.Quantity, QuantityUnit: p.QuantityUnit, DaysSupply: p.DaysSupply, Sig: p.Sig, Dosage: p.Dosage, Refills: p.Refills, Reason: p.Reason,
+        DiagnosisCode: p.DiagnosisCode, PharmacyID: p.PharmacyID, PrescribedAt: p.PrescribedAt.UnixMicro(),
+    })
+    mac := hmac.New(sha256.New, s.physicianKey(p.PhysicianID))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify reports whether p carries a signature that matches its current content
+func (s *prescriptionSigner) verify(p Prescription) bool {
+    return p.Signature != "" && hmac.Equal([]byte(p.Signature), []byte(s.sign(p)))
+}
+
+// signPrescription signs an active prescription and stores the signature. It signs the
+// stored row, since the database may round what was written (dose amounts, timestamps).
+// The prescription already exists, so a failure leaves it unsigned rather than failing
+// the request.
+func (s *Server) signPrescription(ctx context.Context, p *Prescription) {
+    if s.signer == nil || p.Status != PrescriptionActive { return }
+    ctx = context.WithoutCancel(ctx)
+    stored, err := s.repo.GetPrescription(ctx, p.ID)
+    if err != nil {
+        log.Printf("esign: reading prescription %d to sign failed: %v", p.ID, err)
+        return
+    }
+    sig := s.signer.sign(*stored)
+    if err := s.repo.SetPrescriptionSignature(ctx, p.ID, sig); err != nil {
+        log.Printf("esign: storing signature of prescription %d failed: %v", p.ID, err)
+        return
+    }
+    p.Signature = sig
+}
+
+// resignMergedPrescriptions re-signs the prescriptions MergeDrugs moved off sourceID.
+// Only signatures that held before the merge are renewed, so a merge can't make a tampered
+// prescription verify; deleted prescriptions are left alone.
+func (s *Server) resignMergedPrescriptions(ctx context.Context, ids []int64, sourceID int64) error {
+    if s.signer == nil { return nil }
+    ctx = withoutOrg(ctx)
+    for _, id := range ids {
+        p, err := s.repo.GetPrescription(ctx, id)
+        if errors.Is(err, ErrNotFound) { continue }
+        if err != nil { return err }
+        before := *p
+        before.DrugID = sourceID
+        if !s.signer.verify(before) { continue }
+        if err := s.repo.SetPrescriptionSignature(ctx, id, s.signer.sign(*p)); err != nil { return err }
+    }
+    return nil
+}
+
+// PrescriptionVerification is the result of GET /prescriptions/{id}/verify
+type PrescriptionVerification struct {
+    PrescriptionID int64     `json:"prescription_id"`
+    Valid          bool      `json:"valid"`
+    // Reason explains an invalid result: unsigned, tampered, or signature_mismatch
+    Reason         string    `json:"reason,omitempty"`
+    Status         string    `json:"status"`
+    PhysicianID    int64     `json:"physician_id"`
+    PrescribedAt   time.Time `json:"prescribed_at"`
+    CheckedAt      time.Time `json:"checked_at"`
+}
+
+// handleVerifyPrescription serves GET /prescriptions/{id}/verify?signature=: whether the
+// prescription still matches the signature stored when it was written (or signed, for
+// nurse drafts). With signature, the copy a pharmacy holds must also carry that signature.
+// Physicians and pharmacists verify the prescriptions they could read through GET
+// /prescriptions; others get 404.
+func (s *Server) handleVerifyPrescription(w http.ResponseWriter, r *http.Request, id int64) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    caller, scope, ok := s.permit(w, r, ActPrescriptionVerify)
+    if !ok { return }
+    if s.signer == nil { writeError(w, http.StatusServiceUnavailable, "prescription signing is not configured"); return }
+    p, err := s.repo.GetPrescription(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "prescription not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch prescription")
+        return
+    }
+    if !s.authorizePrescriptionAccess(w, r, caller, scope, p) { return }
+    v := PrescriptionVerification{
+        PrescriptionID: p.ID, Status: p.Status, PhysicianID: p.PhysicianID,
+        PrescribedAt: p.PrescribedAt, CheckedAt: time.Now().UTC(),
+    }
+    presented := r.URL.Query().Get("signature")
+    switch {
+    case p.Signature == "":
+        v.Reason = "unsigned"
+    case !s.signer.verify(*p):
+        v.Reason = "tampered"
+    case presented != "" && !hmac.Equal([]byte(presented), []byte(p.Signature)):
+        v.Reason = "signature_mismatch"
+    default:
+        v.Valid = true
+    }
+    if v.Reason == "tampered" { log.Printf("esign: prescription %d does not match its signature", p.ID) }
+    writeJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestPrescriptionSignature(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    cfg := defaultConfig()
+    cfg.PrescriptionSigningKey = strings.Repeat("k", minSigningKeyLen)
+    srv := NewServer(repo, cfg)
+    verify := func(id int64, query, role string) PrescriptionVerification {
+        t.Helper()
+        rr := consentRequest(srv, http.MethodGet, "/prescriptions/"+strconv.FormatInt(id, 10)+"/verify"+query, "", role, "1")
+        if rr.Code != http.StatusOK { t.Fatalf("verify status = %d, body=%s", rr.Code, rr.Body.String()) }
+        var v PrescriptionVerification
+        if err := json.NewDecoder(rr.Body).Decode(&v); err != nil { t.Fatalf("invalid json: %v", err) }
+        return v
+    }
+
+    rr := consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_name":"Amoxicillin","quantity":20,"sig":"1 tab TID","pharmacy_id":1}`, "physician", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("create status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var created Prescription
+    if err := json.NewDecoder(rr.Body).Decode(&created); err != nil { t.Fatalf("invalid json: %v", err) }
+    if len(created.Signature) != 64 || repo.prescriptions[created.ID].Signature != created.Signature { t.Fatalf("signature = %q", created.Signature) }
+
+    if v := verify(created.ID, "", "pharmacist"); !v.Valid || v.PhysicianID != 1 { t.Fatalf("verification = %+v", v) }
+    if v := verify(created.ID, "?signature="+created.Signature, "physician"); !v.Valid { t.Fatalf("presented verification = %+v", v) }
+    if v := verify(created.ID, "?signature=deadbeef", "admin"); v.Valid || v.Reason != "signature_mismatch" { t.Fatalf("wrong signature verification = %+v", v) }
+    // Seed data predates signing
+    if v := verify(1, "", "admin"); v.Valid || v.Reason != "unsigned" { t.Fatalf("seed verification = %+v", v) }
+    if rr := consentRequest(srv, http.MethodGet, "/prescriptions/1/verify", "", "patient", "1"); rr.Code != http.StatusForbidden {
+        t.Fatalf("patient verify status = %d", rr.Code)
+    }
+    if rr := consentRequest(srv, http.MethodGet, "/prescriptions/99/verify", "", "admin", "1"); rr.Code != http.StatusNotFound {
+        t.Fatalf("missing verify status = %d", rr.Code)
+    }
+    // Physicians and pharmacies verify only the prescriptions they could read
+    if rr := consentRequest(srv, http.MethodGet, "/prescriptions/"+strconv.FormatInt(created.ID, 10)+"/verify", "", "physician", "2"); rr.Code != http.StatusNotFound {
+        t.Fatalf("other physician verify status = %d", rr.Code)
+    }
+    if rr := consentRequest(srv, http.MethodGet, "/prescriptions/1/verify", "", "pharmacist", "1"); rr.Code != http.StatusNotFound {
+        t.Fatalf("unrouted pharmacy verify status = %d", rr.Code)
+    }
+
+    // An edit behind the API's back breaks the signature, and the script isn't dispensed
+    p := repo.prescriptions[created.ID]
+    p.Quantity = 200
+    repo.prescriptions[created.ID] = p
+    if v := verify(created.ID, "", "pharmacist"); v.Valid || v.Reason != "tampered" { t.Fatalf("tampered verification = %+v", v) }
+    rr = consentRequest(srv, http.MethodPost, "/prescriptions/"+strconv.FormatInt(created.ID, 10)+"/dispense", `{"dispensed_quantity":20}`, "pharmacist", "1")
+    if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), `"code":"SIGNATURE_INVALID"`) {
+        t.Fatalf("dispense status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+
+    // Nurse drafts are signed when their physician signs them
+    rr = consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":10,"sig":"PRN"}`, "nurse", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("draft status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var draft Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&draft)
+    if draft.Signature != "" { t.Fatalf("draft signed: %q", draft.Signature) }
+    if rr := consentRequest(srv, http.MethodPost, "/prescriptions/"+strconv.FormatInt(draft.ID, 10)+"/sign", "", "physician", "1"); rr.Code != http.StatusOK {
+        t.Fatalf("sign status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    if v := verify(draft.ID, "", "admin"); !v.Valid { t.Fatalf("signed draft verification = %+v", v) }
+}
+
+func TestVerifyWithoutSigningKey(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    if rr := consentRequest(srv, http.MethodGet, "/prescriptions/1/verify", "", "admin", "1"); rr.Code != http.StatusServiceUnavailable {
+        t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+}
+
+func TestDrugMergeKeepsSignatures(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    cfg := defaultConfig()
+    cfg.PrescriptionSigningKey = strings.Repeat("k", minSigningKeyLen)
+    srv := NewServer(repo, cfg)
+    var ids []int64
+    for i := 0; i < 2; i++ {
+        rr := consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":20,"sig":"1 tab TID"}`, "physician", "1")
+        if rr.Code != http.StatusCreated { t.Fatalf("create status = %d, body=%s", rr.Code, rr.Body.String()) }
+        var p Prescription
+        _ = json.NewDecoder(rr.Body).Decode(&p)
+        ids = append(ids, p.ID)
+    }
+    // The second is edited behind the API's back before the merge
+    p := repo.prescriptions[ids[1]]
+    p.Quantity = 200
+    repo.prescriptions[ids[1]] = p
+
+    // Amoxicillin (1) is merged into Metformin (3), with the seed's two unsigned prescriptions
+    rr := consentRequest(srv, http.MethodPost, "/drugs/merge", `{"source_id":1,"target_id":3}`, "admin", "1")
+    if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"prescriptions_moved":3`) { t.Fatalf("merge = %d %s", rr.Code, rr.Body.String()) }
+    for i, want := range []string{"", "tampered"} {
+        rr := consentRequest(srv, http.MethodGet, "/prescriptions/"+strconv.FormatInt(ids[i], 10)+"/verify", "", "admin", "1")
+        var v PrescriptionVerification
+        if err := json.NewDecoder(rr.Body).Decode(&v); err != nil { t.Fatalf("invalid json: %v", err) }
+        if v.Valid != (want == "") || v.Reason != want || repo.prescriptions[ids[i]].DrugID != 3 { t.Fatalf("prescription %d verification = %+v", ids[i], v) }
+    }
+    if v := repo.prescriptions[1]; v.DrugID != 3 || v.Signature != "" { t.Fatalf("seed prescription = %+v", v) }
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // exportDefaultMaxRows caps every export; admins may raise it with ?max_rows= up to exportAdminMaxRows
+    exportDefaultMaxRows = 10000
+    exportAdminMaxRows   = 1000000
+    // exportFlushEvery controls how often buffered rows are pushed to the client
+    exportFlushEvery = 500
+)
+
+var prescriptionCSVHeader = []string{
+    "id", "patient_id", "patient_name", "physician_id", "physician_name",
+    "drug_id", "drug_name", "quantity", "sig", "prescribed_at",
+    "dose_amount", "dose_unit", "route", "frequency", "duration_days", "expires_at",
+    "refills", "reason", "pharmacy_id", "dispensed_at", "dispensed_quantity", "status",
+}
+
+// csvText neutralizes user-entered text for spreadsheets: a cell starting with =, +, -, @,
+// tab, or CR would be read as a formula, so it gets a leading apostrophe
+func csvText(s string) string {
+    if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) { return "'" + s }
+    return s
+}
+
+func prescriptionCSVRow(p Prescription) []string {
+    row := []string{
+        strconv.FormatInt(p.ID, 10),
+        strconv.FormatInt(p.PatientID, 10), csvText(p.PatientName),
+        strconv.FormatInt(p.PhysicianID, 10), csvText(p.PhysicianName),
+        strconv.FormatInt(p.DrugID, 10), csvText(p.DrugName),
+        strconv.Itoa(p.Quantity), csvText(p.Sig),
+        p.PrescribedAt.UTC().Format(time.RFC3339),
+    }
+    if d := p.Dosage; d != nil {
+        duration := ""
+        if d.DurationDays > 0 { duration = strconv.Itoa(d.DurationDays) }
+        row = append(row, strconv.FormatFloat(d.Amount, 'f', -1, 64), csvText(d.Unit), csvText(d.Route), csvText(d.Frequency), duration)
+    } else {
+        row = append(row, "", "", "", "", "")
+    }
+    expires := ""
+    if p.ExpiresAt != nil { expires = p.ExpiresAt.UTC().Format(time.RFC3339) }
+    pharmacy, dispensedAt, dispensedQty := "", "", ""
+    if p.PharmacyID != nil { pharmacy = strconv.FormatInt(*p.PharmacyID, 10) }
+    if p.DispensedAt != nil { dispensedAt = p.DispensedAt.UTC().Format(time.RFC3339) }
+    if p.DispensedQuantity != nil { dispensedQty = strconv.Itoa(*p.DispensedQuantity) }
+    return append(row, expires, strconv.Itoa(p.Refills), csvText(p.Reason), pharmacy, dispensedAt, dispensedQty, p.Status)
+}
+
+// handleExportPrescriptions streams prescriptions as CSV or NDJSON. It applies the same
+// RBAC scoping and filters as GET /prescriptions; rows are written as they are read.
+// A complete export ends with a provenance footer line (document id, request id, row
+// count, and the SHA-256 of everything before the footer) that is also recorded for
+// GET /provenance.
+func (s *Server) handleExportPrescriptions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    p, scope, ok := s.permit(w, r, ActPrescriptionExport)
+    if !ok { return }
+
+    q := r.URL.Query()
+    format := q.Get("format")
+    if format == "" { format = "csv" }
+    if format != "csv" && format != "ndjson" {
+        writeError(w, http.StatusBadRequest, "format must be csv or ndjson")
+        return
+    }
+    maxRows := exportDefaultMaxRows
+    if v := q.Get("max_rows"); v != "" {
+        if _, ok := s.can(w, r, ActPrescriptionExportUnbounded, Resource{}); !ok { return }
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 || n > exportAdminMaxRows {
+            writeError(w, http.StatusBadRequest, "max_rows must be 1.."+strconv.Itoa(exportAdminMaxRows))
+            return
+        }
+        maxRows = n
+    }
+    filter, ok := prescriptionFilterFor(w, r, p, scope)
+    if !ok { return }
+
+    filename := "prescriptions-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+    docID := newRandomID("doc_")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("X-Document-ID", docID)
+    flusher, _ := w.(http.Flusher)
+
+    hash := sha256.New()
+    out := io.MultiWriter(w, hash)
+    var n int
+    var emit func(Prescription) error
+    var flush func()
+    var cw *csv.Writer
+    if format == "csv" {
+        cw = csv.NewWriter(out)
+        emit = func(p Prescription) error { return cw.Write(prescriptionCSVRow(p)) }
+        flush = cw.Flush
+    } else {
+        enc := json.NewEncoder(out)
+        emit = func(p Prescription) error { return enc.Encode(p) }
+        flush = func() {}
+    }
+    // Headers are committed lazily so a query that fails up front still gets a proper 500
+    started := false
+    start := func() error {
+        started = true
+        if format == "csv" {
+            w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+            w.WriteHeader(http.StatusOK)
+            return cw.Write(prescriptionCSVHeader)
+        }
+        w.Header().Set("Content-Type", "application/x-ndjson")
+        w.WriteHeader(http.StatusOK)
+        return nil
+    }
+    err := s.repo.StreamPrescriptions(r.Context(), filter, maxRows, func(p Prescription) error {
+        if !started {
+            if err := start(); err != nil { return err }
+        }
+        if err := emit(p); err != nil { return err }
+        n++
+        if n%exportFlushEvery == 0 {
+            flush()
+            if flusher != nil { flusher.Flush() }
+        }
+        return nil
+    })
+    if err != nil && !started {
+        w.Header().Del("Content-Disposition")
+        writeError(w, http.StatusInternalServerError, "failed to export prescriptions")
+        return
+    }
+    if !started { _ = start() }
+    flush()
+    if err != nil {
+        // Headers are already sent; the truncated body (no footer) is the only signal left to the client
+        log.Printf("export: %s aborted after %d rows: %v", requestID(r.Context()), n, err)
+        return
+    }
+
+    doc := &DocumentProvenance{
+        DocumentID: docID, Kind: "prescription_export", Format: format, RequestID: requestID(r.Context()),
+        Actor: auditActor(r), Params: r.URL.RawQuery, Rows: n, SHA256: hex.EncodeToString(hash.Sum(nil)),
+    }
+    if format == "csv" {
+        fmt.Fprintf(w, "%sdocument_id=%s request_id=%s rows=%d sha256=%s\n", provenanceCSVPrefix, doc.DocumentID, doc.RequestID, doc.Rows, doc.SHA256)
+    } else {
+        _ = json.NewEncoder(w).Encode(map[string]any{provenanceJSONKey: map[string]any{
+            "document_id": doc.DocumentID, "request_id": doc.RequestID, "rows": doc.Rows, "sha256": doc.SHA256,
+        }})
+    }
+    // The download is complete even if the client went away, so record it regardless
+    if err := s.repo.RecordProvenance(context.WithoutCancel(r.Context()), doc); err != nil {
+        log.Printf("export: recording provenance of %s failed: %v", docID, err)
+    }
+}
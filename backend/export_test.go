@@ -0,0 +1,78 @@
+package main
+
+import (
+    "encoding/csv"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestExportPrescriptions(t *testing.T) {
+    cases := []struct {
+        name         string
+        query        string
+        role         string
+        userID       string
+        expectStatus int
+        expectRows   int // data rows, excluding the CSV header
+        expectType   string
+    }{
+        {name: "admin csv", query: "format=csv", role: "admin", userID: "1", expectStatus: http.StatusOK, expectRows: 4, expectType: "text/csv"},
+        {name: "physician scoped ndjson", query: "format=ndjson", role: "physician", userID: "1", expectStatus: http.StatusOK, expectRows: 2, expectType: "application/x-ndjson"},
+        {name: "patient scoped", query: "", role: "patient", userID: "2", expectStatus: http.StatusOK, expectRows: 1, expectType: "text/csv"},
+        {name: "admin filter and cap", query: "format=csv&physician_id=2&max_rows=1", role: "admin", userID: "1", expectStatus: http.StatusOK, expectRows: 1, expectType: "text/csv"},
+        {name: "cap override admin only", query: "max_rows=5", role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "bad format", query: "format=xml", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodGet, "/prescriptions/export?"+tc.query, nil)
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusOK { return }
+            if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.expectType) {
+                t.Fatalf("content type = %q, want %q", ct, tc.expectType)
+            }
+            if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+                t.Fatalf("content disposition = %q", cd)
+            }
+            var rows int
+            if tc.expectType == "text/csv" {
+                // The provenance footer is a # comment line
+                cr := csv.NewReader(rr.Body)
+                cr.Comment = '#'
+                recs, err := cr.ReadAll()
+                if err != nil { t.Fatalf("invalid csv: %v", err) }
+                if len(recs) == 0 || recs[0][0] != "id" { t.Fatalf("missing header: %v", recs) }
+                rows = len(recs) - 1
+            } else {
+                rows = strings.Count(rr.Body.String(), "\n") - 1 // provenance footer
+            }
+            if rows != tc.expectRows {
+                t.Fatalf("rows = %d, want %d\n%s", rows, tc.expectRows, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestExportNeutralizesFormulas(t *testing.T) {
+    row := prescriptionCSVRow(Prescription{
+        PatientName: "=HYPERLINK(\"http://x\")", PhysicianName: "Dr. Smith", DrugName: "+Ibuprofen", Sig: "-1 tab",
+        Reason: "@SUM(A1)", Dosage: &Dosage{Amount: 1, Unit: "mg", Route: "\tPO", Frequency: "BID"},
+    })
+    want := map[string]string{
+        "patient_name": `'=HYPERLINK("http://x")`, "physician_name": "Dr. Smith", "drug_name": "'+Ibuprofen", "sig": "'-1 tab",
+        "reason": "'@SUM(A1)", "route": "'\tPO", "frequency": "BID",
+    }
+    for i, col := range prescriptionCSVHeader {
+        if w, ok := want[col]; ok && row[i] != w { t.Errorf("%s = %q, want %q", col, row[i], w) }
+    }
+}
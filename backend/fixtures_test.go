@@ -0,0 +1,94 @@
+package main
+
+import (
+    "context"
+    "os"
+    "testing"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+// fixtureMemory loads f into a fresh memoryRepo (see internal/fixtures):
+//
+//   f := fixtures.New()
+//   f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(10)
+//   repo, ids := fixtureMemory(f)
+func fixtureMemory(f *fixtures.Fixture) (*memoryRepo, fixtures.IDs) {
+    ds := f.Dataset()
+    synthetic := SyntheticDataset{Patients: ds.Patients, Physicians: ds.Physicians, Drugs: ds.Drugs, Links: ds.Links}
+    for _, p := range ds.Prescriptions {
+        synthetic.Prescriptions = append(synthetic.Prescriptions, SyntheticPrescription(p))
+    }
+    m := newMemoryRepo()
+    loaded := m.loadSynthetic(synthetic)
+    return m, f.IDs(loaded.Patients, loaded.Physicians, loaded.Drugs)
+}
+
+// builtFixture is the fixture TestFixtureBuilders loads into each repository
+func builtFixture() *fixtures.Fixture {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(3)
+    f.NewPatient("Bob").WithPhysician("Dr. Jones").WithPhysician("Dr. Smith").WithPrescription("Oxycodone", 10, "5mg q6h PRN")
+    f.NewPatient("Carol").WithPrescriptions(1)
+    return f
+}
+
+// checkBuiltFixture checks that repo holds builtFixture's links and prescriptions
+func checkBuiltFixture(t *testing.T, ctx context.Context, repo Repository, ids fixtures.IDs) {
+    t.Helper()
+    for _, tc := range []struct {
+        physician, patient string
+        linked             bool
+    }{{"Dr. Smith", "Alice", true}, {"Dr. Smith", "Bob", true}, {"Dr. Jones", "Bob", true}, {"Dr. Jones", "Alice", false}, {"Dr. Fixture", "Carol", true}} {
+        got, _ := repo.IsPhysicianPatientLinked(ctx, ids.Physicians[tc.physician], ids.Patients[tc.patient])
+        if got != tc.linked { t.Fatalf("%s linked to %s = %v, want %v", tc.physician, tc.patient, got, tc.linked) }
+    }
+    if ok, _ := repo.HasActiveConsent(ctx, ids.Patients["Alice"], ids.Physicians["Dr. Smith"], ConsentPrescriptions); !ok {
+        t.Fatal("link came without consent")
+    }
+
+    alice := ids.Patients["Alice"]
+    items, _ := repo.ListPrescriptions(ctx, ListPrescriptionsFilter{PatientID: &alice})
+    if len(items) != 3 || items[0].DrugName != fixtures.Drugs[0].Name || items[2].DrugName != fixtures.Drugs[2].Name {
+        t.Fatalf("alice's prescriptions = %+v", items)
+    }
+    bob := ids.Patients["Bob"]
+    items, _ = repo.ListPrescriptions(ctx, ListPrescriptionsFilter{PatientID: &bob})
+    if len(items) != 1 || items[0].DrugName != "Oxycodone" || items[0].PhysicianName != "Dr. Smith" {
+        t.Fatalf("bob's prescriptions = %+v", items)
+    }
+}
+
+func TestFixtureBuilders(t *testing.T) {
+    m, ids := fixtureMemory(builtFixture())
+    if ids.Physicians["Dr. Smith"] != 1 || ids.Physicians["Dr. Jones"] != 2 || ids.Physicians["Dr. Fixture"] != 3 {
+        t.Fatalf("physician ids = %v", ids.Physicians)
+    }
+    checkBuiltFixture(t, context.Background(), m, ids)
+}
+
+// TestFixturesLoadPostgres runs against TEST_DATABASE_URL, a database with db/schema.sql
+// applied, loading into a new organization each run
+func TestFixturesLoadPostgres(t *testing.T) {
+    dsn := os.Getenv("TEST_DATABASE_URL")
+    if dsn == "" { t.Skip("TEST_DATABASE_URL not set") }
+    ctx := context.Background()
+    pg, err := NewPGRepo(ctx, dsn, PoolConfig{})
+    if err != nil { t.Fatalf("NewPGRepo: %v", err) }
+    defer pg.pool.Close()
+    org, err := pg.CreateOrganization(ctx, &Organization{Name: "fixtures " + newRandomID("org_")})
+    if err != nil { t.Fatalf("CreateOrganization: %v", err) }
+
+    ids, err := builtFixture().LoadPostgres(ctx, pg.pool, org.ID)
+    if err != nil { t.Fatalf("LoadPostgres: %v", err) }
+    checkBuiltFixture(t, withOrg(ctx, org.ID), pg, ids)
+}
+
+// Fixture prescriptions use the drugs and orders the synthetic generator does
+func TestFixtureDrugsMatchSynthetic(t *testing.T) {
+    if len(fixtures.Drugs) != len(syntheticDrugs) { t.Fatalf("%d fixture drugs, %d synthetic", len(fixtures.Drugs), len(syntheticDrugs)) }
+    for i, d := range fixtures.Drugs {
+        s := syntheticDrugs[i]
+        if d.Name != s.Name || d.Quantity != s.Quantities[0] || d.Sig != s.Sigs[0] { t.Fatalf("fixture drug %d = %+v, synthetic %+v", i, d, s) }
+    }
+}
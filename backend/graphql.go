@@ -0,0 +1,692 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphqlSchema is the schema served at /graphql. Each field is authorized like the REST
+// endpoint serving the same data, so a denied field resolves to null with an error (whose
+// extensions carry the REST error code) while the rest of the query still resolves.
+// It is served by graph-gophers/graphql-go rather than gqlgen: resolvers bind to this
+// schema at runtime, so there is no generated code or go generate step to keep in sync.
+const graphqlSchema = `
+    scalar Time
+
+    schema {
+        query: Query
+    }
+
+    type Query {
+        # The patient detail record (GET /patients/{id})
+        patient(id: ID!): Patient
+        # A physician; patients may look up only their care team
+        physician(id: ID!): Physician
+        # Prescriptions visible to the caller (GET /prescriptions), newest first
+        prescriptions(patientId: ID, physicianId: ID, limit: Int = 50): [Prescription!]!
+        # Analytics over [from, to) (GET /analytics/...)
+        analytics(from: Time!, to: Time!, patientId: ID): Analytics
+    }
+
+    type Patient {
+        id: ID!
+        name: String!
+        birthDate: String
+        sex: String
+        phone: String
+        email: String
+        address: String
+        physicians: [Physician!]
+        activePrescriptionCount: Int
+        lastVisitAt: Time
+    }
+
+    type Physician {
+        id: ID!
+        name: String!
+        # The physician's panel (GET /physicians/{id}/patients)
+        patients: [Patient!]
+    }
+
+    type Drug {
+        id: ID!
+        name: String!
+        rxcui: String
+        schedule: String
+    }
+
+    type Dosage {
+        amount: Float!
+        unit: String!
+        route: String!
+        frequency: String!
+        durationDays: Int
+    }
+
+    type Prescription {
+        id: ID!
+        patient: Patient!
+        physician: Physician!
+        drug: Drug
+        quantity: Int!
+        quantityUnit: String
+        daysSupply: Int
+        sig: String!
+        dosage: Dosage
+        refills: Int!
+        reason: String
+        diagnosisCode: String
+        diagnosisDescription: String
+        status: String!
+        prescribedAt: Time!
+        expiresAt: Time
+        pharmacyName: String
+        dispensedAt: Time
+        dispensedQuantity: Int
+    }
+
+    # Totals are Float because GraphQL's Int is 32-bit
+    type Analytics {
+        topDrugs(limit: Int = 10): [TopDrug!]!
+        prescriptionsOverTime(bucket: String = "day"): [TimeBucket!]!
+        physicianVolume(limit: Int = 10): [PhysicianVolume!]!
+    }
+
+    type TopDrug {
+        drug: Drug
+        totalQuantity: Float!
+    }
+
+    type TimeBucket {
+        bucketStart: Time!
+        count: Float!
+        totalQuantity: Float!
+    }
+
+    type PhysicianVolume {
+        physician: Physician!
+        prescriptionCount: Float!
+        distinctPatients: Float!
+    }
+`
+
+// graphqlMaxDepth bounds query nesting; it leaves room for the introspection query
+// that GraphQL tooling sends
+const graphqlMaxDepth = 15
+
+// gqlLoaderWait is how long a loader collects keys before fetching them together
+const gqlLoaderWait = time.Millisecond
+
+func newGraphQLSchema(s *Server) *graphql.Schema {
+    return graphql.MustParseSchema(graphqlSchema, &gqlQuery{s: s}, graphql.MaxDepth(graphqlMaxDepth))
+}
+
+type graphqlRequest struct {
+    Query         string         `json:"query"`
+    OperationName string         `json:"operationName"`
+    Variables     map[string]any `json:"variables"`
+}
+
+// handleGraphQL serves POST /graphql {"query": "...", "operationName": "...", "variables": {...}}.
+// Field errors come back in "errors" next to the data with 200, as GraphQL clients
+// expect; only a caller without a valid identity is refused up front.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    caller, err := principalOf(r.Context())
+    if err != nil { writeAuthError(w, err); return }
+    var req graphqlRequest
+    if !decodeJSON(w, r, &req) { return }
+    if req.Query == "" { writeError(w, http.StatusBadRequest, "query is required"); return }
+    ctx := withGQLLoaders(r.Context(), newGQLLoaders(s.repo, caller))
+    writeJSON(w, http.StatusOK, s.gql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// gqlError is a resolver error; its extensions carry the code the REST API would answer with
+type gqlError struct {
+    code string
+    msg  string
+}
+
+func (e *gqlError) Error() string { return e.msg }
+
+func (e *gqlError) Extensions() map[string]any { return map[string]any{"code": e.code} }
+
+// gqlAuthError converts an authorize/scopeFor error
+func gqlAuthError(err error) error {
+    _, code := problemFor(err)
+    return &gqlError{code, err.Error()}
+}
+
+func gqlID(id graphql.ID) (int64, error) {
+    n, err := strconv.ParseInt(string(id), 10, 64)
+    if err != nil || n <= 0 { return 0, &gqlError{CodeBadRequest, "invalid id " + strconv.Quote(string(id))} }
+    return n, nil
+}
+
+func gqlOptID(id *graphql.ID) (*int64, error) {
+    if id == nil { return nil, nil }
+    n, err := gqlID(*id)
+    return &n, err
+}
+
+func toGQLID(id int64) graphql.ID { return graphql.ID(strconv.FormatInt(id, 10)) }
+
+// Optional scalars are null when empty, as omitempty leaves them out of REST responses
+func optString(s string) *string {
+    if s == "" { return nil }
+    return &s
+}
+
+func optInt(n int) *int32 {
+    if n == 0 { return nil }
+    v := int32(n)
+    return &v
+}
+
+func optTime(t *time.Time) *graphql.Time {
+    if t == nil { return nil }
+    return &graphql.Time{Time: *t}
+}
+
+// batchLoader fetches what resolvers running in parallel ask for in one repository call
+// per gqlLoaderWait instead of one per item, and remembers the results for the request
+type batchLoader[V any] struct {
+    fetch func(ctx context.Context, ids []int64) (map[int64]V, error)
+
+    mu      sync.Mutex
+    results map[int64]*loaderResult[V]
+    pending []int64
+}
+
+type loaderResult[V any] struct {
+    done  chan struct{}
+    value V
+    found bool
+    err   error
+}
+
+func newBatchLoader[V any](fetch func(ctx context.Context, ids []int64) (map[int64]V, error)) *batchLoader[V] {
+    return &batchLoader[V]{fetch: fetch, results: map[int64]*loaderResult[V]{}}
+}
+
+// load returns the value for id, which found is false for when the repository has none.
+// siblings are queued with id: items of a list pass the ids of the whole list, so the
+// first of them to resolve fetches all, even though the executor runs only a few
+// resolvers at a time.
+func (l *batchLoader[V]) load(ctx context.Context, id int64, siblings []int64) (V, bool, error) {
+    l.mu.Lock()
+    for _, k := range append([]int64{id}, siblings...) {
+        if _, ok := l.results[k]; ok { continue }
+        l.results[k] = &loaderResult[V]{done: make(chan struct{})}
+        if len(l.pending) == 0 { time.AfterFunc(gqlLoaderWait, func() { l.dispatch(ctx) }) }
+        l.pending = append(l.pending, k)
+    }
+    res := l.results[id]
+    l.mu.Unlock()
+    select {
+    case <-res.done:
+        return res.value, res.found, res.err
+    case <-ctx.Done():
+        var zero V
+        return zero, false, ctx.Err()
+    }
+}
+
+func (l *batchLoader[V]) dispatch(ctx context.Context) {
+    l.mu.Lock()
+    ids := l.pending
+    l.pending = nil
+    batch := make([]*loaderResult[V], len(ids))
+    for i, id := range ids { batch[i] = l.results[id] }
+    l.mu.Unlock()
+    values, err := l.fetch(ctx, ids)
+    for i, id := range ids {
+        batch[i].value, batch[i].found = values[id]
+        batch[i].err = err
+        close(batch[i].done)
+    }
+}
+
+// byID indexes items by the id key returns
+func byID[V any](items []V, key func(V) int64) map[int64]V {
+    out := make(map[int64]V, len(items))
+    for _, it := range items { out[key(it)] = it }
+    return out
+}
+
+// gqlLoaders are the batch loaders of one GraphQL request
+type gqlLoaders struct {
+    drugs      *batchLoader[Drug]
+    physicians *batchLoader[Physician]
+    details    *batchLoader[PatientDetail]
+    panels     *batchLoader[[]Patient]
+    // access is the calling physician's link to, and prescriptions consent from, each patient
+    access     *batchLoader[PatientAccess]
+}
+
+func newGQLLoaders(repo Repository, caller Principal) *gqlLoaders {
+    return &gqlLoaders{
+        drugs: newBatchLoader(func(ctx context.Context, ids []int64) (map[int64]Drug, error) {
+            items, err := repo.GetDrugs(ctx, ids)
+            return byID(items, func(d Drug) int64 { return d.ID }), err
+        }),
+        physicians: newBatchLoader(func(ctx context.Context, ids []int64) (map[int64]Physician, error) {
+            items, err := repo.GetPhysicians(ctx, ids)
+            return byID(items, func(p Physician) int64 { return p.ID }), err
+        }),
+        details: newBatchLoader(func(ctx context.Context, ids []int64) (map[int64]PatientDetail, error) {
+            items, err := repo.GetPatientDetails(ctx, ids)
+            return byID(items, func(d PatientDetail) int64 { return d.ID }), err
+        }),
+        panels: newBatchLoader(repo.ListPatientsForPhysicians),
+        access: newBatchLoader(func(ctx context.Context, ids []int64) (map[int64]PatientAccess, error) {
+            return repo.PhysicianPatientAccess(ctx, caller.UserID, ids, ConsentPrescriptions)
+        }),
+    }
+}
+
+type gqlLoadersKey struct{}
+
+func withGQLLoaders(ctx context.Context, l *gqlLoaders) context.Context {
+    return context.WithValue(ctx, gqlLoadersKey{}, l)
+}
+
+func loadersOf(ctx context.Context) *gqlLoaders {
+    l, _ := ctx.Value(gqlLoadersKey{}).(*gqlLoaders)
+    return l
+}
+
+// gqlQuery resolves the Query type
+type gqlQuery struct{ s *Server }
+
+func (q *gqlQuery) Patient(ctx context.Context, args struct{ ID graphql.ID }) (*gqlPatient, error) {
+    id, err := gqlID(args.ID)
+    if err != nil { return nil, err }
+    p := &gqlPatient{s: q.s, id: id}
+    d, err := p.detail(ctx)
+    if err != nil { return nil, err }
+    p.name = d.Name
+    return p, nil
+}
+
+func (q *gqlQuery) Physician(ctx context.Context, args struct{ ID graphql.ID }) (*gqlPhysician, error) {
+    id, err := gqlID(args.ID)
+    if err != nil { return nil, err }
+    caller, scope, err := q.s.scopeFor(ctx, ActPhysicianRead)
+    if err != nil { return nil, gqlAuthError(err) }
+    notFound := &gqlError{CodeNotFound, "physician not found"}
+    // Own-scoped patients find only their care team, like GET /search
+    if scope == ScopeOwn {
+        if caller.Owns != OwnsPatient { return nil, &gqlError{CodeForbidden, "physician lookup cannot be limited to " + caller.Owns} }
+        linked, err := q.s.repo.IsPhysicianPatientLinked(ctx, id, caller.UserID)
+        if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch physician"} }
+        if !linked { return nil, notFound }
+    }
+    ph, found, err := loadersOf(ctx).physicians.load(ctx, id, nil)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch physician"} }
+    if !found { return nil, notFound }
+    return &gqlPhysician{s: q.s, id: ph.ID, name: ph.Name}, nil
+}
+
+type prescriptionsArgs struct {
+    PatientID   *graphql.ID
+    PhysicianID *graphql.ID
+    Limit       int32
+}
+
+// Prescriptions lists like GET /prescriptions: own-scoped callers see only their own,
+// which patientId and physicianId can narrow further but not widen
+func (q *gqlQuery) Prescriptions(ctx context.Context, args prescriptionsArgs) ([]*gqlPrescription, error) {
+    caller, scope, err := q.s.scopeFor(ctx, ActPrescriptionList)
+    if err != nil { return nil, gqlAuthError(err) }
+    if args.Limit <= 0 || args.Limit > 200 { return nil, &gqlError{CodeBadRequest, "limit must be 1..200"} }
+    patientID, err := gqlOptID(args.PatientID)
+    if err != nil { return nil, err }
+    physicianID, err := gqlOptID(args.PhysicianID)
+    if err != nil { return nil, err }
+
+    var filter ListPrescriptionsFilter
+    if scope == ScopeOwn { filter = ownPrescriptionFilter(caller) }
+    filter.Limit = int(args.Limit)
+    // Asking an own-scoped caller for someone else's prescriptions finds none
+    if patientID != nil {
+        if filter.PatientID != nil && *filter.PatientID != *patientID { return []*gqlPrescription{}, nil }
+        filter.PatientID = patientID
+    }
+    if physicianID != nil {
+        if filter.PhysicianID != nil && *filter.PhysicianID != *physicianID { return []*gqlPrescription{}, nil }
+        filter.PhysicianID = physicianID
+    }
+    items, err := q.s.repo.ListPrescriptions(ctx, filter)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to list prescriptions"} }
+
+    list := &gqlPrescriptionList{}
+    for _, p := range items {
+        list.drugs = append(list.drugs, p.DrugID)
+        list.patients = append(list.patients, p.PatientID)
+        list.physicians = append(list.physicians, p.PhysicianID)
+    }
+    out := make([]*gqlPrescription, len(items))
+    for i := range items { out[i] = &gqlPrescription{s: q.s, p: items[i], list: list} }
+    return out, nil
+}
+
+type analyticsArgs struct {
+    From      graphql.Time
+    To        graphql.Time
+    PatientID *graphql.ID
+}
+
+// Analytics is scoped like the /analytics endpoints (see analyticsPatientScope)
+func (q *gqlQuery) Analytics(ctx context.Context, args analyticsArgs) (*gqlAnalytics, error) {
+    if !args.To.After(args.From.Time) { return nil, &gqlError{CodeBadRequest, "invalid from/to range"} }
+    requested, err := gqlOptID(args.PatientID)
+    if err != nil { return nil, err }
+    p, scope, err := q.s.scopeFor(ctx, ActAnalyticsRead)
+    if err != nil { return nil, gqlAuthError(err) }
+    a := &gqlAnalytics{s: q.s, from: args.From.Time, to: args.To.Time}
+    switch {
+    case scope == ScopeAll && requested == nil:
+    case scope == ScopeAll && p.Owns == "":
+        a.patientID = requested
+    case scope == ScopeAll && p.Owns == OwnsPhysician:
+        linked, consented, err := q.s.physicianAccess(ctx, p.UserID, *requested, ConsentAnalytics)
+        if err != nil { return nil, &gqlError{CodeInternal, "consent check failed"} }
+        if !linked { return nil, &gqlError{CodePhysicianNotLinked, "physician not linked to patient"} }
+        if !consented { return nil, &gqlError{CodeConsentRequired, "patient has not consented to analytics access by this physician"} }
+        a.patientID = requested
+    case scope == ScopeAll:
+        return nil, &gqlError{CodeForbidden, "analytics cannot be narrowed to a patient by " + p.Owns}
+    case p.Owns == OwnsPatient:
+        id := p.UserID
+        a.patientID = &id
+    default:
+        return nil, &gqlError{CodeForbidden, "analytics cannot be limited to " + p.Owns}
+    }
+    return a, nil
+}
+
+// gqlPatient resolves Patient. id and name are known from whatever led to the patient;
+// the rest is the detail record, authorized like GET /patients/{id}.
+type gqlPatient struct {
+    s    *Server
+    id   int64
+    name string
+    // siblings are the patients of the list this one is in, loaded along with it
+    siblings []int64
+}
+
+// detail checks that the caller may read the patient's record and loads it
+func (p *gqlPatient) detail(ctx context.Context) (*PatientDetail, error) {
+    caller, scope, err := p.s.scopeFor(ctx, ActPatientRead)
+    if err != nil { return nil, gqlAuthError(err) }
+    l := loadersOf(ctx)
+    if scope == ScopeOwn && !(Resource{PatientID: p.id}).ownedBy(caller) {
+        if caller.Owns != OwnsPhysician { return nil, &gqlError{CodeForbidden, "patients may only view themselves"} }
+        a, _, err := l.access.load(ctx, p.id, p.siblings)
+        if err != nil { return nil, &gqlError{CodeInternal, "consent check failed"} }
+        if !a.Linked { return nil, &gqlError{CodePhysicianNotLinked, "physician not linked to patient"} }
+        if !a.Consented { return nil, &gqlError{CodeConsentRequired, "patient has not consented to prescriptions access by this physician"} }
+    }
+    d, found, err := l.details.load(ctx, p.id, p.siblings)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch patient"} }
+    if !found { return nil, &gqlError{CodeNotFound, "patient not found"} }
+    return &d, nil
+}
+
+func (p *gqlPatient) ID() graphql.ID { return toGQLID(p.id) }
+
+func (p *gqlPatient) Name() string { return p.name }
+
+// demographic resolves one optional detail field
+func (p *gqlPatient) demographic(ctx context.Context, field func(*PatientDetail) string) (*string, error) {
+    d, err := p.detail(ctx)
+    if err != nil { return nil, err }
+    return optString(field(d)), nil
+}
+
+func (p *gqlPatient) BirthDate(ctx context.Context) (*string, error) {
+    return p.demographic(ctx, func(d *PatientDetail) string { return d.BirthDate })
+}
+
+func (p *gqlPatient) Sex(ctx context.Context) (*string, error) {
+    return p.demographic(ctx, func(d *PatientDetail) string { return d.Sex })
+}
+
+func (p *gqlPatient) Phone(ctx context.Context) (*string, error) {
+    return p.demographic(ctx, func(d *PatientDetail) string { return d.Phone })
+}
+
+func (p *gqlPatient) Email(ctx context.Context) (*string, error) {
+    return p.demographic(ctx, func(d *PatientDetail) string { return d.Email })
+}
+
+func (p *gqlPatient) Address(ctx context.Context) (*string, error) {
+    return p.demographic(ctx, func(d *PatientDetail) string { return d.Address })
+}
+
+func (p *gqlPatient) Physicians(ctx context.Context) (*[]*gqlPhysician, error) {
+    d, err := p.detail(ctx)
+    if err != nil { return nil, err }
+    ids := make([]int64, len(d.Physicians))
+    for i, ph := range d.Physicians { ids[i] = ph.ID }
+    out := make([]*gqlPhysician, len(d.Physicians))
+    for i, ph := range d.Physicians { out[i] = &gqlPhysician{s: p.s, id: ph.ID, name: ph.Name, siblings: ids} }
+    return &out, nil
+}
+
+func (p *gqlPatient) ActivePrescriptionCount(ctx context.Context) (*int32, error) {
+    d, err := p.detail(ctx)
+    if err != nil { return nil, err }
+    n := int32(d.ActivePrescriptions)
+    return &n, nil
+}
+
+func (p *gqlPatient) LastVisitAt(ctx context.Context) (*graphql.Time, error) {
+    d, err := p.detail(ctx)
+    if err != nil { return nil, err }
+    return optTime(d.LastVisitAt), nil
+}
+
+// gqlPhysician resolves Physician
+type gqlPhysician struct {
+    s        *Server
+    id       int64
+    name     string
+    siblings []int64
+}
+
+func (p *gqlPhysician) ID() graphql.ID { return toGQLID(p.id) }
+
+func (p *gqlPhysician) Name() string { return p.name }
+
+// Patients is authorized like GET /physicians/{id}/patients
+func (p *gqlPhysician) Patients(ctx context.Context) (*[]*gqlPatient, error) {
+    if _, err := p.s.authorize(ctx, ActPanelRead, Resource{PhysicianID: p.id}); err != nil { return nil, gqlAuthError(err) }
+    panel, _, err := loadersOf(ctx).panels.load(ctx, p.id, p.siblings)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to list patients"} }
+    ids := make([]int64, len(panel))
+    for i, pt := range panel { ids[i] = pt.ID }
+    out := make([]*gqlPatient, len(panel))
+    for i, pt := range panel { out[i] = &gqlPatient{s: p.s, id: pt.ID, name: pt.Name, siblings: ids} }
+    return &out, nil
+}
+
+// gqlDrug resolves Drug
+type gqlDrug struct{ d Drug }
+
+// loadDrug authorizes drug:read and loads id with siblings
+func (s *Server) loadDrug(ctx context.Context, id int64, siblings []int64) (*gqlDrug, error) {
+    if _, err := s.authorize(ctx, ActDrugRead, Resource{}); err != nil { return nil, gqlAuthError(err) }
+    d, found, err := loadersOf(ctx).drugs.load(ctx, id, siblings)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch drug"} }
+    if !found { return nil, nil }
+    return &gqlDrug{d}, nil
+}
+
+func (d *gqlDrug) ID() graphql.ID { return toGQLID(d.d.ID) }
+
+func (d *gqlDrug) Name() string { return d.d.Name }
+
+func (d *gqlDrug) Rxcui() *string { return optString(d.d.RxCUI) }
+
+func (d *gqlDrug) Schedule() *string { return optString(d.d.Schedule) }
+
+// gqlPrescriptionList holds the ids referenced by one list of prescriptions, so their
+// drugs, patients, and physicians load in one batch each
+type gqlPrescriptionList struct {
+    drugs, patients, physicians []int64
+}
+
+// gqlPrescription resolves Prescription
+type gqlPrescription struct {
+    s    *Server
+    p    Prescription
+    list *gqlPrescriptionList
+}
+
+func (r *gqlPrescription) ID() graphql.ID { return toGQLID(r.p.ID) }
+
+func (r *gqlPrescription) Patient() *gqlPatient {
+    return &gqlPatient{s: r.s, id: r.p.PatientID, name: r.p.PatientName, siblings: r.list.patients}
+}
+
+func (r *gqlPrescription) Physician() *gqlPhysician {
+    return &gqlPhysician{s: r.s, id: r.p.PhysicianID, name: r.p.PhysicianName, siblings: r.list.physicians}
+}
+
+func (r *gqlPrescription) Drug(ctx context.Context) (*gqlDrug, error) {
+    return r.s.loadDrug(ctx, r.p.DrugID, r.list.drugs)
+}
+
+func (r *gqlPrescription) Quantity() int32 { return int32(r.p.Quantity) }
+
+func (r *gqlPrescription) QuantityUnit() *string { return optString(r.p.QuantityUnit) }
+
+func (r *gqlPrescription) DaysSupply() *int32 { return optInt(r.p.DaysSupply) }
+
+func (r *gqlPrescription) Sig() string { return r.p.Sig }
+
+func (r *gqlPrescription) Dosage() *gqlDosage {
+    if r.p.Dosage == nil { return nil }
+    return &gqlDosage{*r.p.Dosage}
+}
+
+func (r *gqlPrescription) Refills() int32 { return int32(r.p.Refills) }
+
+func (r *gqlPrescription) Reason() *string { return optString(r.p.Reason) }
+
+func (r *gqlPrescription) DiagnosisCode() *string { return optString(r.p.DiagnosisCode) }
+
+func (r *gqlPrescription) DiagnosisDescription() *string { return optString(r.p.DiagnosisDescription) }
+
+func (r *gqlPrescription) Status() string { return r.p.Status }
+
+func (r *gqlPrescription) PrescribedAt() graphql.Time { return graphql.Time{Time: r.p.PrescribedAt} }
+
+func (r *gqlPrescription) ExpiresAt() *graphql.Time { return optTime(r.p.ExpiresAt) }
+
+func (r *gqlPrescription) PharmacyName() *string { return optString(r.p.PharmacyName) }
+
+func (r *gqlPrescription) DispensedAt() *graphql.Time { return optTime(r.p.DispensedAt) }
+
+func (r *gqlPrescription) DispensedQuantity() *int32 {
+    if r.p.DispensedQuantity == nil { return nil }
+    n := int32(*r.p.DispensedQuantity)
+    return &n
+}
+
+// gqlDosage resolves Dosage
+type gqlDosage struct{ d Dosage }
+
+func (d *gqlDosage) Amount() float64 { return d.d.Amount }
+
+func (d *gqlDosage) Unit() string { return d.d.Unit }
+
+func (d *gqlDosage) Route() string { return d.d.Route }
+
+func (d *gqlDosage) Frequency() string { return d.d.Frequency }
+
+func (d *gqlDosage) DurationDays() *int32 { return optInt(d.d.DurationDays) }
+
+// gqlAnalytics resolves Analytics for an authorized range and patient scope
+type gqlAnalytics struct {
+    s         *Server
+    from, to  time.Time
+    patientID *int64
+}
+
+func (a *gqlAnalytics) TopDrugs(ctx context.Context, args struct{ Limit int32 }) ([]*gqlTopDrug, error) {
+    if args.Limit <= 0 || args.Limit > 100 { return nil, &gqlError{CodeBadRequest, "limit must be 1..100"} }
+    items, err := a.s.repo.TopDrugs(ctx, a.from, a.to, int(args.Limit), a.patientID)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch analytics"} }
+    ids := make([]int64, len(items))
+    for i, it := range items { ids[i] = it.DrugID }
+    out := make([]*gqlTopDrug, len(items))
+    for i, it := range items { out[i] = &gqlTopDrug{s: a.s, t: it, siblings: ids} }
+    return out, nil
+}
+
+func (a *gqlAnalytics) PrescriptionsOverTime(ctx context.Context, args struct{ Bucket string }) ([]*gqlTimeBucket, error) {
+    switch args.Bucket {
+    case "day", "week", "month":
+    default:
+        return nil, &gqlError{CodeBadRequest, "bucket must be day, week, or month"}
+    }
+    items, err := a.s.repo.PrescriptionsOverTime(ctx, a.from, a.to, args.Bucket, a.patientID)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch analytics"} }
+    out := make([]*gqlTimeBucket, len(items))
+    for i, it := range items { out[i] = &gqlTimeBucket{it} }
+    return out, nil
+}
+
+func (a *gqlAnalytics) PhysicianVolume(ctx context.Context, args struct{ Limit int32 }) ([]*gqlPhysicianVolume, error) {
+    if args.Limit <= 0 || args.Limit > 100 { return nil, &gqlError{CodeBadRequest, "limit must be 1..100"} }
+    items, err := a.s.repo.PhysicianVolume(ctx, a.from, a.to, int(args.Limit), a.patientID)
+    if err != nil { return nil, &gqlError{CodeInternal, "failed to fetch analytics"} }
+    ids := make([]int64, len(items))
+    for i, it := range items { ids[i] = it.PhysicianID }
+    out := make([]*gqlPhysicianVolume, len(items))
+    for i, it := range items {
+        out[i] = &gqlPhysicianVolume{v: it, physician: &gqlPhysician{s: a.s, id: it.PhysicianID, name: it.PhysicianName, siblings: ids}}
+    }
+    return out, nil
+}
+
+type gqlTopDrug struct {
+    s        *Server
+    t        TopDrug
+    siblings []int64
+}
+
+func (t *gqlTopDrug) Drug(ctx context.Context) (*gqlDrug, error) { return t.s.loadDrug(ctx, t.t.DrugID, t.siblings) }
+
+func (t *gqlTopDrug) TotalQuantity() float64 { return float64(t.t.TotalQty) }
+
+type gqlTimeBucket struct{ b TimeBucket }
+
+func (b *gqlTimeBucket) BucketStart() graphql.Time { return graphql.Time{Time: b.b.BucketStart} }
+
+func (b *gqlTimeBucket) Count() float64 { return float64(b.b.Count) }
+
+func (b *gqlTimeBucket) TotalQuantity() float64 { return float64(b.b.TotalQty) }
+
+type gqlPhysicianVolume struct {
+    v         PhysicianVolume
+    physician *gqlPhysician
+}
+
+func (v *gqlPhysicianVolume) Physician() *gqlPhysician { return v.physician }
+
+func (v *gqlPhysicianVolume) PrescriptionCount() float64 { return float64(v.v.Prescriptions) }
+
+func (v *gqlPhysicianVolume) DistinctPatients() float64 { return float64(v.v.DistinctPatients) }
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// graphqlResponse decodes a /graphql response, keeping data raw for comparison
+type graphqlResponse struct {
+    Data   json.RawMessage `json:"data"`
+    Errors []struct {
+        Message    string         `json:"message"`
+        Path       []any          `json:"path"`
+        Extensions map[string]any `json:"extensions"`
+    } `json:"errors"`
+}
+
+func graphqlPost(t *testing.T, srv *Server, query, role, userID string) graphqlResponse {
+    t.Helper()
+    body, _ := json.Marshal(map[string]string{"query": query})
+    rr := consentRequest(srv, http.MethodPost, "/graphql", string(body), role, userID)
+    if rr.Code != http.StatusOK { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var resp graphqlResponse
+    if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+    return resp
+}
+
+func TestGraphQLAuthorization(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    cases := []struct {
+        name       string
+        role       string
+        userID     string
+        query      string
+        expectData string
+        // expectCodes are the error codes expected, in order
+        expectCodes []string
+    }{
+        {name: "admin reads a patient with care team", role: "admin", query: `{ patient(id: 2) { name sex physicians { name } } }`,
+            expectData: `{"patient":{"name":"Bob","sex":"male","physicians":[{"name":"Dr. Jones"},{"name":"Dr. Smith"}]}}`},
+        {name: "patient reads themselves", role: "patient", userID: "1", query: `{ patient(id: 1) { name email } }`,
+            expectData: `{"patient":{"name":"Alice","email":"alice@example.com"}}`},
+        {name: "patient may not read another patient", role: "patient", userID: "1", query: `{ patient(id: 2) { name } }`,
+            expectData: `{"patient":null}`, expectCodes: []string{CodeForbidden}},
+        {name: "physician reads an unlinked patient", role: "physician", userID: "1", query: `{ patient(id: 3) { name } }`,
+            expectData: `{"patient":null}`, expectCodes: []string{CodePhysicianNotLinked}},
+        {name: "own prescriptions only", role: "patient", userID: "1", query: `{ prescriptions { drug { name } physician { name } } }`,
+            expectData: `{"prescriptions":[{"drug":{"name":"Ibuprofen"},"physician":{"name":"Dr. Smith"}},{"drug":{"name":"Amoxicillin"},"physician":{"name":"Dr. Smith"}}]}`},
+        {name: "narrowing to someone else finds nothing", role: "patient", userID: "1", query: `{ prescriptions(patientId: 2) { id } }`,
+            expectData: `{"prescriptions":[]}`},
+        // Pharmacists may look physicians up but not read their panels
+        {name: "denied fields are null next to allowed ones", role: "pharmacist", userID: "1", query: `{ physician(id: 1) { name patients { name } } }`,
+            expectData: `{"physician":{"name":"Dr. Smith","patients":null}}`, expectCodes: []string{CodeForbidden}},
+        {name: "patients find only their care team", role: "patient", userID: "3", query: `{ physician(id: 1) { name } }`,
+            expectData: `{"physician":null}`, expectCodes: []string{CodeNotFound}},
+        {name: "physician reads own panel", role: "physician", userID: "2", query: `{ physician(id: 2) { patients { name birthDate } } }`,
+            expectData: `{"physician":{"patients":[{"name":"Bob","birthDate":"1972-11-30"},{"name":"Carol","birthDate":null}]}}`},
+        {name: "analytics narrowed to an unlinked patient", role: "physician", userID: "1", query: `{ analytics(from: "2000-01-01T00:00:00Z", to: "2100-01-01T00:00:00Z", patientId: 3) { topDrugs { totalQuantity } } }`,
+            expectData: `{"analytics":null}`, expectCodes: []string{CodePhysicianNotLinked}},
+        {name: "patient analytics are their own", role: "patient", userID: "3", query: `{ analytics(from: "2000-01-01T00:00:00Z", to: "2100-01-01T00:00:00Z") { topDrugs { drug { name } totalQuantity } } }`,
+            expectData: `{"analytics":{"topDrugs":[{"drug":{"name":"Lisinopril"},"totalQuantity":30}]}}`},
+        {name: "invalid argument", role: "admin", query: `{ prescriptions(limit: 500) { id } }`,
+            expectCodes: []string{CodeBadRequest}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            resp := graphqlPost(t, srv, tc.query, tc.role, tc.userID)
+            if tc.expectData != "" && string(resp.Data) != tc.expectData {
+                t.Fatalf("data = %s, want %s (errors %+v)", resp.Data, tc.expectData, resp.Errors)
+            }
+            var codes []string
+            for _, e := range resp.Errors { codes = append(codes, e.Extensions["code"].(string)) }
+            if strings.Join(codes, ",") != strings.Join(tc.expectCodes, ",") { t.Fatalf("error codes = %v, want %v (%+v)", codes, tc.expectCodes, resp.Errors) }
+        })
+    }
+
+    // Callers without an identity are refused before the query runs
+    rr := consentRequest(srv, http.MethodPost, "/graphql", `{"query":"{ prescriptions { id } }"}`, "", "")
+    if rr.Code != http.StatusUnauthorized { t.Fatalf("status = %d, want 401", rr.Code) }
+    rr = consentRequest(srv, http.MethodGet, "/graphql", "", "admin", "1")
+    if rr.Code != http.StatusMethodNotAllowed { t.Fatalf("status = %d, want 405", rr.Code) }
+}
+
+// countingRepo counts the batch reads the GraphQL loaders make
+type countingRepo struct {
+    *memoryRepo
+    mu    sync.Mutex
+    calls map[string]int
+}
+
+func (c *countingRepo) count(name string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.calls[name]++
+}
+
+func (c *countingRepo) GetDrugs(ctx context.Context, ids []int64) ([]Drug, error) {
+    c.count("GetDrugs")
+    return c.memoryRepo.GetDrugs(ctx, ids)
+}
+
+func (c *countingRepo) GetPatientDetails(ctx context.Context, ids []int64) ([]PatientDetail, error) {
+    c.count("GetPatientDetails")
+    return c.memoryRepo.GetPatientDetails(ctx, ids)
+}
+
+func (c *countingRepo) PhysicianPatientAccess(ctx context.Context, physicianID int64, patientIDs []int64, scope string) (map[int64]PatientAccess, error) {
+    c.count("PhysicianPatientAccess")
+    return c.memoryRepo.PhysicianPatientAccess(ctx, physicianID, patientIDs, scope)
+}
+
+func TestGraphQLBatching(t *testing.T) {
+    m := newDemoMemoryRepo()
+    // Dr. Jones (2) gets 40 more prescriptions across Bob and Carol and every drug
+    for i := 0; i < 40; i++ {
+        m.addPrescription(Prescription{PatientID: int64(2 + i%2), PhysicianID: 2, DrugID: int64(1 + i%5), Quantity: 10, Sig: "daily " + strconv.Itoa(i)})
+    }
+    repo := &countingRepo{memoryRepo: m, calls: map[string]int{}}
+    srv := NewServer(repo, defaultConfig())
+
+    resp := graphqlPost(t, srv, `{ prescriptions(limit: 100) { drug { name schedule } patient { name birthDate activePrescriptionCount } } }`, "physician", "2")
+    if len(resp.Errors) > 0 { t.Fatalf("errors: %+v", resp.Errors) }
+    var data struct {
+        Prescriptions []struct {
+            Drug    struct{ Name string }
+            Patient struct{ Name string }
+        }
+    }
+    if err := json.Unmarshal(resp.Data, &data); err != nil { t.Fatalf("invalid data: %v", err) }
+    if len(data.Prescriptions) != 42 { t.Fatalf("got %d prescriptions, want 42", len(data.Prescriptions)) }
+    for _, p := range data.Prescriptions {
+        if p.Drug.Name == "" || p.Patient.Name == "" { t.Fatalf("unresolved prescription %+v", p) }
+    }
+    // Each list loads its drugs, patient records, and consent checks in one call
+    for _, name := range []string{"GetDrugs", "GetPatientDetails", "PhysicianPatientAccess"} {
+        if repo.calls[name] != 1 { t.Fatalf("%s called %d times, want 1 (%v)", name, repo.calls[name], repo.calls) }
+    }
+}
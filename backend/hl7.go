@@ -0,0 +1,442 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// HL7 v2 ingestion: hospital interface engines POST pipe-delimited (ER7) messages to /hl7
+// and get an HL7 ACK back. ADT^A04 registers or updates a patient by MRN; RDE^O11 creates
+// a prescription under the same rules as POST /prescriptions. Rejected (AR) messages are
+// quarantined for review.
+
+// hl7MaxMessageBytes bounds one message; real ADT/RDE messages are a few KB
+const hl7MaxMessageBytes = 1 << 20
+
+// hl7ContentType is the ER7 media type interface engines send and expect back
+const hl7ContentType = "x-application/hl7-v2+er7"
+
+// ACK codes (MSA-1)
+const (
+    hl7AckAccept = "AA"
+    // hl7AckError means the message was valid but could not be applied; the sender may retry
+    hl7AckError = "AE"
+    // hl7AckReject means the message is malformed or unsupported and is quarantined
+    hl7AckReject = "AR"
+)
+
+// Error conditions from HL7 table 0357, sent in ERR-3
+var hl7ErrorCodes = map[string]string{
+    "100": "Segment sequence error",
+    "101": "Required field missing",
+    "102": "Data type error",
+    "103": "Table value not found",
+    "200": "Unsupported message type",
+    "201": "Unsupported event code",
+    "203": "Unsupported version id",
+    "204": "Unknown key identifier",
+    "205": "Duplicate key identifier",
+    "206": "Application record locked",
+    "207": "Application internal error",
+}
+
+// hl7Encoding holds the delimiters a message declares in MSH-1 and MSH-2
+type hl7Encoding struct {
+    field, component, repetition, escape, subcomponent byte
+}
+
+// hl7Segment is one segment's fields by HL7 field number: [0] is the segment name and,
+// for MSH, [1] is the field separator itself
+type hl7Segment []string
+
+type hl7Message struct {
+    enc      hl7Encoding
+    segments []hl7Segment
+}
+
+// parseHL7 splits an ER7 message into segments. Segments may end in CR, LF, or CRLF, and
+// MLLP framing bytes around the message are ignored.
+func parseHL7(raw string) (*hl7Message, error) {
+    raw = strings.Trim(raw, "\x0b\x1c\r\n ")
+    raw = strings.ReplaceAll(strings.ReplaceAll(raw, "\r\n", "\r"), "\n", "\r")
+    lines := strings.Split(raw, "\r")
+    head := lines[0]
+    if !strings.HasPrefix(head, "MSH") || len(head) < 4 { return nil, errors.New("message does not start with an MSH segment") }
+    // MSH-2 holds the component, repetition, escape, and subcomponent characters, plus a
+    // truncation character from v2.7 on
+    chars, _, _ := strings.Cut(head[4:], head[3:4])
+    if len(chars) != 4 && len(chars) != 5 { return nil, errors.New("MSH-2 encoding characters are invalid") }
+    m := &hl7Message{enc: hl7Encoding{head[3], chars[0], chars[1], chars[2], chars[3]}}
+    for i, line := range lines {
+        if line == "" { continue }
+        if len(line) < 3 { return nil, fmt.Errorf("segment %d is too short", i+1) }
+        seg := hl7Segment(strings.Split(line, string(m.enc.field)))
+        if seg[0] == "MSH" {
+            if i != 0 { return nil, fmt.Errorf("segment %d: unexpected MSH", i+1) }
+            seg = append(hl7Segment{"MSH", string(m.enc.field)}, seg[1:]...)
+        }
+        if !hl7SegmentName(seg[0]) { return nil, fmt.Errorf("segment %d: invalid segment name %q", i+1, seg[0]) }
+        m.segments = append(m.segments, seg)
+    }
+    return m, nil
+}
+
+func hl7SegmentName(s string) bool {
+    if len(s) != 3 { return false }
+    for i := 0; i < 3; i++ {
+        if !(s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9') { return false }
+    }
+    return true
+}
+
+// segment returns the first segment named name, or nil
+func (m *hl7Message) segment(name string) hl7Segment {
+    if m == nil { return nil }
+    for _, seg := range m.segments {
+        if seg[0] == name { return seg }
+    }
+    return nil
+}
+
+// value returns component comp (1-based) of the first repetition of field n in seg,
+// unescaped; "" when absent
+func (m *hl7Message) value(seg hl7Segment, n, comp int) string {
+    if n >= len(seg) { return "" }
+    f := seg[n]
+    if seg[0] == "MSH" && n <= 2 { return f }
+    if i := strings.IndexByte(f, m.enc.repetition); i >= 0 { f = f[:i] }
+    parts := strings.Split(f, string(m.enc.component))
+    if comp > len(parts) { return "" }
+    c := parts[comp-1]
+    if i := strings.IndexByte(c, m.enc.subcomponent); i >= 0 { c = c[:i] }
+    return strings.TrimSpace(m.unescape(c))
+}
+
+// unescape resolves the delimiter escapes (\F\ \S\ \T\ \R\ \E\); other escape sequences
+// are kept as sent
+func (m *hl7Message) unescape(s string) string {
+    esc := m.enc.escape
+    if strings.IndexByte(s, esc) < 0 { return s }
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        if s[i] == esc && i+2 < len(s) && s[i+2] == esc {
+            var r byte
+            switch s[i+1] {
+            case 'F':
+                r = m.enc.field
+            case 'S':
+                r = m.enc.component
+            case 'T':
+                r = m.enc.subcomponent
+            case 'R':
+                r = m.enc.repetition
+            case 'E':
+                r = esc
+            }
+            if r != 0 {
+                b.WriteByte(r)
+                i += 2
+                continue
+            }
+        }
+        b.WriteByte(s[i])
+    }
+    return b.String()
+}
+
+// hl7Escape escapes text for a field of a message in the standard encoding
+func hl7Escape(s string) string {
+    return strings.NewReplacer(`\`, `\E\`, "|", `\F\`, "^", `\S\`, "&", `\T\`, "~", `\R\`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// hl7Ack is the outcome of processing one message
+type hl7Ack struct {
+    code string
+    // errCode is an HL7 table 0357 code; location is the ERR-2 segment^sequence^field
+    errCode  string
+    location string
+    text     string
+}
+
+func hl7Reject(errCode, location, text string) hl7Ack { return hl7Ack{hl7AckReject, errCode, location, text} }
+
+func hl7Fail(errCode, text string) hl7Ack { return hl7Ack{code: hl7AckError, errCode: errCode, text: text} }
+
+// buildHL7Ack renders the ACK for msg, which may be nil when its MSH could not be parsed
+func buildHL7Ack(msg *hl7Message, ack hl7Ack, now time.Time) string {
+    msh := msg.segment("MSH")
+    get := func(n int) string { return hl7Escape(msg.value(msh, n, 1)) }
+    trigger, processing, version := hl7Escape(msg.value(msh, 9, 2)), get(11), get(12)
+    if processing == "" { processing = "P" }
+    if version == "" { version = "2.5.1" }
+    segs := []string{
+        strings.Join([]string{"MSH", `^~\&`, get(5), get(6), get(3), get(4), now.UTC().Format("20060102150405"), "",
+            "ACK^" + trigger + "^ACK", strconv.FormatInt(now.UnixNano(), 10), processing, version}, "|"),
+        strings.Join([]string{"MSA", ack.code, get(10), hl7Escape(ack.text)}, "|"),
+    }
+    if ack.code != hl7AckAccept && ack.errCode != "" {
+        segs = append(segs, strings.Join([]string{"ERR", "", ack.location,
+            ack.errCode + "^" + hl7ErrorCodes[ack.errCode] + "^HL70357", "E", "", "", "", hl7Escape(ack.text)}, "|"))
+    }
+    return strings.Join(segs, "\r") + "\r"
+}
+
+// HL7QuarantinedMessage is a rejected message kept for review
+type HL7QuarantinedMessage struct {
+    ID          int64     `json:"id"`
+    ReceivedAt  time.Time `json:"received_at"`
+    RequestID   string    `json:"request_id"`
+    ControlID   string    `json:"control_id,omitempty"`
+    MessageType string    `json:"message_type,omitempty"`
+    Reason      string    `json:"reason"`
+    Raw         string    `json:"raw"`
+    // orgID is the organization the message was received for (0 when unscoped)
+    orgID int64
+}
+
+// PatientRegistration is a patient as an ADT feed identifies them, by MRN within an organization
+type PatientRegistration struct {
+    MRN  string
+    Name string
+    PatientDemographics
+}
+
+// handleHL7 serves POST /hl7 (admin, org_admin). The body is one ER7 message; the response
+// is always 200 with an ACK whose MSA-1 is AA, AE, or AR. A retransmitted message (same
+// sender and MSH-10) replays the original ACK once it was accepted.
+func (s *Server) handleHL7(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if _, ok := s.can(w, r, ActHL7Ingest, Resource{}); !ok { return }
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, hl7MaxMessageBytes))
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) { writeError(w, http.StatusRequestEntityTooLarge, "HL7 message too large"); return }
+        writeError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+    raw := string(body)
+    msg, err := parseHL7(raw)
+    if err != nil {
+        s.quarantineHL7(r, raw, nil, err.Error())
+        writeHL7Ack(w, msg, hl7Reject("100", "", err.Error()))
+        return
+    }
+    msh := msg.segment("MSH")
+    controlID := msg.value(msh, 10, 1)
+    if controlID == "" {
+        ack := hl7Reject("101", "MSH^1^10", "MSH-10 message control id is required")
+        s.quarantineHL7(r, raw, msg, ack.text)
+        writeHL7Ack(w, msg, ack)
+        return
+    }
+
+    // Control ids are unique per sending application and facility, which clinics don't
+    // coordinate; unscoped messages apply to the default organization, so they share its scope
+    org, ok := orgFromContext(r.Context())
+    if !ok { org = defaultOrgID }
+    scope := "hl7:" + strconv.FormatInt(org, 10) + ":" + msg.value(msh, 3, 1) + "^" + msg.value(msh, 4, 1)
+    sum := sha256.Sum256(body)
+    hash := hex.EncodeToString(sum[:])
+    existing, err := s.repo.ReserveIdempotencyKey(r.Context(), IdempotencyRecord{
+        Scope: scope, Key: controlID, RequestHash: hash, ExpiresAt: time.Now().Add(idempotencyTTL),
+    })
+    if err != nil { writeHL7Ack(w, msg, hl7Fail("207", "duplicate check failed")); return }
+    if existing != nil {
+        switch {
+        case existing.RequestHash != hash:
+            ack := hl7Reject("205", "MSH^1^10", "MSH-10 "+controlID+" was already used for a different message")
+            s.quarantineHL7(r, raw, msg, ack.text)
+            writeHL7Ack(w, msg, ack)
+        case existing.StatusCode == 0:
+            writeHL7Ack(w, msg, hl7Fail("206", "message "+controlID+" is still being processed"))
+        default:
+            w.Header().Set("Idempotent-Replayed", "true")
+            w.Header().Set("Content-Type", hl7ContentType)
+            w.WriteHeader(http.StatusOK)
+            _, _ = w.Write(existing.Body)
+        }
+        return
+    }
+
+    ack := s.processHL7(r, msg)
+    out := buildHL7Ack(msg, ack, time.Now())
+    if ack.code == hl7AckAccept {
+        if err := s.repo.CompleteIdempotencyKey(r.Context(), scope, controlID, http.StatusOK, []byte(out)); err != nil {
+            log.Printf("hl7: failed to store ACK for %s %s: %v", scope, controlID, err)
+        }
+    } else {
+        if err := s.repo.ReleaseIdempotencyKey(r.Context(), scope, controlID); err != nil {
+            log.Printf("hl7: failed to release %s %s: %v", scope, controlID, err)
+        }
+        if ack.code == hl7AckReject { s.quarantineHL7(r, raw, msg, ack.text) }
+    }
+    w.Header().Set("Content-Type", hl7ContentType)
+    w.WriteHeader(http.StatusOK)
+    _, _ = io.WriteString(w, out)
+}
+
+func writeHL7Ack(w http.ResponseWriter, msg *hl7Message, ack hl7Ack) {
+    w.Header().Set("Content-Type", hl7ContentType)
+    w.WriteHeader(http.StatusOK)
+    _, _ = io.WriteString(w, buildHL7Ack(msg, ack, time.Now()))
+}
+
+// quarantineHL7 keeps a rejected message; msg is nil when it could not be parsed
+func (s *Server) quarantineHL7(r *http.Request, raw string, msg *hl7Message, reason string) {
+    msh := msg.segment("MSH")
+    q := &HL7QuarantinedMessage{
+        RequestID: requestID(r.Context()), Reason: reason, Raw: raw,
+        ControlID: msg.value(msh, 10, 1), MessageType: msg.value(msh, 9, 1),
+    }
+    if t := msg.value(msh, 9, 2); t != "" { q.MessageType += "^" + t }
+    if err := s.repo.QuarantineHL7Message(r.Context(), q); err != nil {
+        log.Printf("hl7: failed to quarantine message (%s): %v", reason, err)
+    }
+}
+
+// processHL7 applies a parsed message and returns its ACK
+func (s *Server) processHL7(r *http.Request, msg *hl7Message) hl7Ack {
+    msh := msg.segment("MSH")
+    if v := msg.value(msh, 12, 1); !strings.HasPrefix(v, "2.") {
+        return hl7Reject("203", "MSH^1^12", "unsupported HL7 version "+strconv.Quote(v))
+    }
+    code, trigger := msg.value(msh, 9, 1), msg.value(msh, 9, 2)
+    switch {
+    case code == "ADT" && trigger == "A04":
+        return s.hl7RegisterPatient(r, msg)
+    case code == "RDE" && trigger == "O11":
+        return s.hl7CreatePrescription(r, msg)
+    case code == "ADT" || code == "RDE":
+        return hl7Reject("201", "MSH^1^9", "unsupported event "+code+"^"+trigger)
+    }
+    return hl7Reject("200", "MSH^1^9", "unsupported message type "+strconv.Quote(code))
+}
+
+// hl7Sexes maps PID-8 (HL7 table 0001) to patient sex
+var hl7Sexes = map[string]string{"F": "female", "M": "male", "O": "other", "U": "unknown", "A": "other", "N": "unknown"}
+
+// hl7RegisterPatient applies ADT^A04: PID-3 MRN, PID-5 name, PID-7 birth date, PID-8 sex,
+// PID-11 address, PID-13 phone and email
+func (s *Server) hl7RegisterPatient(r *http.Request, msg *hl7Message) hl7Ack {
+    pid := msg.segment("PID")
+    if pid == nil { return hl7Reject("100", "", "PID segment is required") }
+    reg := PatientRegistration{MRN: msg.value(pid, 3, 1)}
+    if reg.MRN == "" { return hl7Reject("101", "PID^1^3", "PID-3 patient identifier is required") }
+    if len(reg.MRN) > 64 { return hl7Reject("102", "PID^1^3", "PID-3 patient identifier too long") }
+    reg.Name = strings.TrimSpace(msg.value(pid, 5, 2) + " " + msg.value(pid, 5, 1))
+    if reg.Name == "" { return hl7Reject("101", "PID^1^5", "PID-5 patient name is required") }
+    if len(reg.Name) > 200 { return hl7Reject("102", "PID^1^5", "PID-5 patient name too long") }
+    if dob := msg.value(pid, 7, 1); dob != "" {
+        t, err := time.Parse("20060102", dob[:min(len(dob), 8)])
+        if err != nil { return hl7Reject("102", "PID^1^7", "PID-7 birth date must be YYYYMMDD") }
+        reg.BirthDate = t.Format("2006-01-02")
+    }
+    if sex := msg.value(pid, 8, 1); sex != "" {
+        reg.Sex = hl7Sexes[strings.ToUpper(sex)]
+        if reg.Sex == "" { return hl7Reject("103", "PID^1^8", "PID-8 administrative sex "+strconv.Quote(sex)+" is not in table 0001") }
+    }
+    var addr []string
+    for c := 1; c <= 5; c++ {
+        if v := msg.value(pid, 11, c); v != "" { addr = append(addr, v) }
+    }
+    reg.Address = strings.Join(addr, ", ")
+    reg.Phone = msg.value(pid, 13, 1)
+    if reg.Phone == "" { reg.Phone = msg.value(pid, 13, 6) + msg.value(pid, 13, 7) }
+    reg.Email = msg.value(pid, 13, 4)
+
+    id, created, err := s.repo.RegisterPatient(r.Context(), reg)
+    if errors.Is(err, ErrNotFound) { return hl7Fail("204", "MRN "+reg.MRN+" belongs to a deleted patient") }
+    if err != nil { return hl7Fail("207", "failed to register patient") }
+    if created {
+        s.audit(r, AuditPatientRegister, "patient", id)
+        return hl7Ack{code: hl7AckAccept, text: "patient " + strconv.FormatInt(id, 10) + " registered"}
+    }
+    return hl7Ack{code: hl7AckAccept, text: "patient " + strconv.FormatInt(id, 10) + " updated"}
+}
+
+// hl7CreatePrescription applies RDE^O11: PID-3 MRN, ORC-1 NW, ORC-12 ordering physician
+// id, RXE-2 drug, RXE-7 instructions (sig), RXE-10 quantity, RXE-11 dispense units (UCUM),
+// RXE-12 refills, RXE-27 reason
+func (s *Server) hl7CreatePrescription(r *http.Request, msg *hl7Message) hl7Ack {
+    pid, orc, rxe := msg.segment("PID"), msg.segment("ORC"), msg.segment("RXE")
+    if pid == nil || orc == nil || rxe == nil { return hl7Reject("100", "", "PID, ORC, and RXE segments are required") }
+    if v := msg.value(orc, 1, 1); v != "NW" {
+        return hl7Reject("103", "ORC^1^1", "ORC-1 order control "+strconv.Quote(v)+" is not supported; only NW")
+    }
+    mrn := msg.value(pid, 3, 1)
+    if mrn == "" { return hl7Reject("101", "PID^1^3", "PID-3 patient identifier is required") }
+    physicianID, err := strconv.ParseInt(msg.value(orc, 12, 1), 10, 64)
+    if err != nil || physicianID <= 0 { return hl7Reject("102", "ORC^1^12", "ORC-12 ordering provider must be a physician id") }
+    req := createPrescriptionReq{PhysicianID: physicianID}
+    if req.DrugName = msg.value(rxe, 2, 2); req.DrugName == "" { req.DrugName = msg.value(rxe, 2, 1) }
+    if req.DrugName == "" { return hl7Reject("101", "RXE^1^2", "RXE-2 give code is required") }
+    qty, err := strconv.ParseFloat(msg.value(rxe, 10, 1), 64)
+    if err != nil || qty != float64(int(qty)) { return hl7Reject("102", "RXE^1^10", "RXE-10 dispense amount must be a whole number") }
+    req.Quantity = int(qty)
+    req.QuantityUnit = msg.value(rxe, 11, 1)
+    if v := msg.value(rxe, 12, 1); v != "" {
+        if req.Refills, err = strconv.Atoi(v); err != nil { return hl7Reject("102", "RXE^1^12", "RXE-12 number of refills must be a number") }
+    }
+    if req.Sig = msg.value(rxe, 7, 2); req.Sig == "" { req.Sig = msg.value(rxe, 7, 1) }
+    if req.Sig == "" { req.Sig = strings.TrimSpace(msg.value(rxe, 3, 1) + " " + msg.value(rxe, 5, 1)) }
+    if req.Reason = msg.value(rxe, 27, 2); req.Reason == "" { req.Reason = msg.value(rxe, 27, 1) }
+
+    patientID, err := s.repo.FindPatientByMRN(r.Context(), mrn)
+    if errors.Is(err, ErrNotFound) { return hl7Fail("204", "unknown patient MRN "+mrn) }
+    if err != nil { return hl7Fail("207", "failed to look up patient") }
+    req.PatientID = patientID
+    if err := req.validate(); err != nil { return hl7Reject("102", "RXE", err.Error()) }
+
+    linked, consented, err := s.physicianAccess(r.Context(), req.PhysicianID, req.PatientID, ConsentPrescriptions)
+    if err != nil { return hl7Fail("207", "consent check failed") }
+    if !linked { return hl7Fail("204", "physician not linked to patient") }
+    if !consented { return hl7Fail("207", "patient has not consented to prescriptions access by this physician") }
+    drugID, err := s.resolveDrug(r.Context(), req.DrugName)
+    if err != nil { return hl7Fail("207", "failed to resolve drug") }
+    drug, err := s.repo.GetDrug(r.Context(), drugID)
+    if err != nil { return hl7Fail("207", "failed to resolve drug") }
+    if v := checkSchedule(drug, req.Quantity, req.Refills, req.Reason); v != nil { return hl7Fail("207", v.Message) }
+    if req.QuantityUnit == "" && drug.Rules != nil { req.QuantityUnit = drug.Rules.DispenseUnit }
+    if v := checkSupply(drug, req.Quantity, req.QuantityUnit, 0, nil); v != nil { return hl7Fail("207", v.Message) }
+
+    created, err := s.repo.CreatePrescription(r.Context(), &Prescription{
+        PatientID: req.PatientID, PhysicianID: req.PhysicianID, DrugID: drugID,
+        Quantity: req.Quantity, QuantityUnit: req.QuantityUnit, Sig: req.Sig, Refills: req.Refills, Reason: req.Reason, Status: PrescriptionActive,
+    })
+    if errors.Is(err, ErrInvalidReference) { return hl7Fail("204", "invalid patient, physician, or drug") }
+    if err != nil { return hl7Fail("207", "failed to create prescription") }
+    s.signPrescription(r.Context(), created)
+    s.webhooks.Publish(r.Context(), EventPrescriptionCreated, created)
+    return hl7Ack{code: hl7AckAccept, text: "prescription " + strconv.FormatInt(created.ID, 10) + " created"}
+}
+
+// handleHL7Quarantine serves GET /hl7/quarantine?limit=50 (admin, org_admin), newest first
+func (s *Server) handleHL7Quarantine(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if _, ok := s.can(w, r, ActHL7Quarantine, Resource{}); !ok { return }
+    limit := 50
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > 500 { writeError(w, http.StatusBadRequest, "limit must be 1..500"); return }
+        limit = n
+    }
+    items, err := s.repo.ListHL7Quarantine(r.Context(), limit)
+    if err != nil { writeError(w, http.StatusInternalServerError, "failed to list quarantined messages"); return }
+    writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+const hl7A04 = "MSH|^~\\&|EPIC|NORTH|PORTAL|CLINIC|20260101120000||ADT^A04^ADT_A01|MSG001|P|2.5.1\r" +
+    "EVN|A04|20260101120000\r" +
+    "PID|1||MRN100^^^NORTH^MR||Doe^Jane^Q||19800215|F|||1 Main St^Apt 2^Springfield^IL^62701||555-0199^PRN^PH^jane@example.com\r"
+
+func hl7Request(srv *Server, body, role, orgID string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPost, "/hl7", strings.NewReader(body))
+    req.Header.Set("X-Role", role)
+    req.Header.Set("X-User-ID", "1")
+    if orgID != "" { req.Header.Set("X-Org-ID", orgID) }
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    return rr
+}
+
+// hl7Field returns field n of the first segment named seg in an ACK
+func hl7Field(t *testing.T, ack, seg string, n int) string {
+    t.Helper()
+    msg, err := parseHL7(ack)
+    if err != nil { t.Fatalf("unparseable ACK %q: %v", ack, err) }
+    s := msg.segment(seg)
+    if s == nil { t.Fatalf("ACK has no %s segment: %q", seg, ack) }
+    return msg.value(s, n, 1)
+}
+
+func TestParseHL7(t *testing.T) {
+    msg, err := parseHL7("\x0b" + strings.ReplaceAll(hl7A04, "\r", "\n") + "\x1c\r")
+    if err != nil { t.Fatalf("parse: %v", err) }
+    if len(msg.segments) != 3 { t.Fatalf("segments = %d, want 3", len(msg.segments)) }
+    msh, pid := msg.segment("MSH"), msg.segment("PID")
+    if got := msg.value(msh, 9, 2); got != "A04" { t.Fatalf("MSH-9.2 = %q", got) }
+    if got := msg.value(msh, 10, 1); got != "MSG001" { t.Fatalf("MSH-10 = %q", got) }
+    if got := msg.value(pid, 5, 2); got != "Jane" { t.Fatalf("PID-5.2 = %q", got) }
+    if got := msg.value(pid, 13, 4); got != "jane@example.com" { t.Fatalf("PID-13.4 = %q", got) }
+    if got := msg.value(pid, 99, 1); got != "" { t.Fatalf("missing field = %q", got) }
+
+    esc, err := parseHL7("MSH|^~\\&|A|B|C|D|||ADT^A04|1|P|2.5\rNTE|1||a\\F\\b\\S\\c\\E\\d~second")
+    if err != nil { t.Fatalf("parse: %v", err) }
+    if got := esc.value(esc.segment("NTE"), 3, 1); got != `a|b^c\d` { t.Fatalf("unescaped = %q", got) }
+    if got := hl7Escape(`a|b^c\d`); got != `a\F\b\S\c\E\d` { t.Fatalf("escaped = %q", got) }
+
+    for _, bad := range []string{"", "PID|1", "MSH|^~|x", "MSH|^~\\&|A\rP|1"} {
+        if _, err := parseHL7(bad); err == nil { t.Fatalf("parseHL7(%q) succeeded", bad) }
+    }
+}
+
+func TestHL7Ingest(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith")
+    m, ids := fixtureMemory(f)
+    m.addOrgAdmin("Clinic Admin", defaultOrgID)
+    srv := NewServer(m, defaultConfig())
+
+    // ADT^A04 registers the patient; a later A04 for the same MRN updates them
+    rr := hl7Request(srv, hl7A04, "admin", "")
+    if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != hl7ContentType { t.Fatalf("status = %d, %s", rr.Code, rr.Body.String()) }
+    if got := hl7Field(t, rr.Body.String(), "MSA", 1); got != "AA" { t.Fatalf("A04 MSA-1 = %q: %q", got, rr.Body.String()) }
+    if got := hl7Field(t, rr.Body.String(), "MSA", 2); got != "MSG001" { t.Fatalf("MSA-2 = %q", got) }
+    if got := hl7Field(t, rr.Body.String(), "MSH", 5); got != "EPIC" { t.Fatalf("ACK receiving application = %q", got) }
+    jane, err := m.FindPatientByMRN(context.Background(), "MRN100")
+    if err != nil { t.Fatalf("find by MRN: %v", err) }
+    d, err := m.GetPatientDetail(context.Background(), jane)
+    if err != nil || d.Name != "Jane Doe" || d.BirthDate != "1980-02-15" || d.Sex != "female" || d.Email != "jane@example.com" ||
+        d.Address != "1 Main St, Apt 2, Springfield, IL, 62701" {
+        t.Fatalf("registered patient = %+v, %v", d, err)
+    }
+
+    update := strings.Replace(strings.Replace(hl7A04, "MSG001", "MSG002", 1), "Doe^Jane", "Roe^Jane", 1)
+    if rr := hl7Request(srv, update, "admin", ""); hl7Field(t, rr.Body.String(), "MSA", 1) != "AA" { t.Fatalf("update: %q", rr.Body.String()) }
+    if id, _ := m.FindPatientByMRN(context.Background(), "MRN100"); id != jane { t.Fatalf("update created patient %d, want %d", id, jane) }
+    if d, _ := m.GetPatientDetail(context.Background(), jane); d.Name != "Jane Roe" || d.Phone != "555-0199" { t.Fatalf("updated patient = %+v", d) }
+
+    // A retransmission replays the original ACK; reusing the control id for another message is rejected
+    replay := hl7Request(srv, hl7A04, "admin", "")
+    if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != rr.Body.String() {
+        t.Fatalf("replay = %q, want %q", replay.Body.String(), rr.Body.String())
+    }
+    if rr := hl7Request(srv, strings.Replace(update, "MSG002", "MSG001", 1), "admin", ""); hl7Field(t, rr.Body.String(), "MSA", 1) != "AR" {
+        t.Fatalf("reused control id: %q", rr.Body.String())
+    }
+
+    // The MRN is the identity, so a namesake with another MRN is a second patient
+    namesake := strings.Replace(strings.Replace(update, "MSG002", "MSG003", 1), "MRN100", "MRN101", 1)
+    if rr := hl7Request(srv, namesake, "admin", ""); hl7Field(t, rr.Body.String(), "MSA", 1) != "AA" { t.Fatalf("namesake: %q", rr.Body.String()) }
+    if id, err := m.FindPatientByMRN(context.Background(), "MRN101"); err != nil || id == jane { t.Fatalf("namesake = %d, %v; first patient %d", id, err, jane) }
+
+    rxe := make([]string, 28)
+    rxe[0], rxe[7], rxe[10], rxe[12], rxe[27] = "RXE", "^1 tab PO daily", "30", "2", "^Hypertension"
+    rde := func(control, physician, drug string) string {
+        rxe[2] = "^" + drug
+        return "MSH|^~\\&|EPIC|NORTH|PORTAL|CLINIC|20260101130000||RDE^O11^RDE_O11|" + control + "|P|2.5.1\r" +
+            "PID|1||MRN100^^^NORTH^MR||Roe^Jane\r" +
+            "ORC|NW|ORD1||||||||||" + physician + "^Smith^John\r" +
+            strings.Join(rxe, "|") + "\r"
+    }
+    // Dr. Smith isn't linked to the new patient yet
+    if rr := hl7Request(srv, rde("RX1", "1", "Lisinopril"), "admin", ""); hl7Field(t, rr.Body.String(), "MSA", 1) != "AE" {
+        t.Fatalf("unlinked RDE: %q", rr.Body.String())
+    }
+    m.mu.Lock()
+    m.addLink(ids.Physicians["Dr. Smith"], jane)
+    m.mu.Unlock()
+    rr = hl7Request(srv, rde("RX1", "1", "Lisinopril"), "admin", "")
+    if got := hl7Field(t, rr.Body.String(), "MSA", 1); got != "AA" { t.Fatalf("RDE MSA-1 = %q: %q", got, rr.Body.String()) }
+    list, _ := m.ListPrescriptions(context.Background(), ListPrescriptionsFilter{PatientID: &jane, Limit: 10})
+    if len(list) != 1 || list[0].DrugName != "Lisinopril" || list[0].Quantity != 30 || list[0].Refills != 2 || list[0].Sig != "1 tab PO daily" || list[0].Reason != "Hypertension" {
+        t.Fatalf("prescriptions = %+v", list)
+    }
+
+    // Errors (AE) may be retried and aren't quarantined; rejections (AR) are
+    cases := []struct {
+        name, body, code, errCode string
+    }{
+        {"unknown MRN", strings.Replace(rde("RX2", "1", "Lisinopril"), "MRN100", "MRN999", 1), "AE", "204"},
+        {"not a physician id", rde("RX3", "SMITHJ", "Lisinopril"), "AR", "102"},
+        {"unsupported event", strings.Replace(hl7A04, "ADT^A04", "ADT^A08", 1), "AR", "201"},
+        {"unsupported type", strings.Replace(hl7A04, "ADT^A04", "ORU^R01", 1), "AR", "200"},
+        {"unsupported version", strings.Replace(hl7A04, "|2.5.1", "|3.0", 1), "AR", "203"},
+        {"bad birth date", strings.Replace(hl7A04, "19800215", "1980-02-15", 1), "AR", "102"},
+        {"malformed", "PID|1||MRN100", "AR", "100"},
+    }
+    for i, tc := range cases {
+        rr := hl7Request(srv, strings.Replace(tc.body, "MSG001", "CASE"+strconv.Itoa(i), 1), "admin", "")
+        if rr.Code != http.StatusOK { t.Fatalf("%s: status = %d", tc.name, rr.Code) }
+        if got := hl7Field(t, rr.Body.String(), "MSA", 1); got != tc.code { t.Fatalf("%s: MSA-1 = %q, want %s: %q", tc.name, got, tc.code, rr.Body.String()) }
+        if got := hl7Field(t, rr.Body.String(), "ERR", 3); got != tc.errCode { t.Fatalf("%s: ERR-3 = %q, want %s: %q", tc.name, got, tc.errCode, rr.Body.String()) }
+    }
+    quarantined, _ := m.ListHL7Quarantine(context.Background(), 50)
+    // The reused control id plus the six AR cases
+    if len(quarantined) != 7 || quarantined[0].Raw != "PID|1||MRN100" || quarantined[1].MessageType != "ADT^A04" {
+        t.Fatalf("quarantine = %+v", quarantined)
+    }
+
+    if rr := hl7Request(srv, hl7A04, "physician", ""); rr.Code != http.StatusForbidden { t.Fatalf("physician status = %d", rr.Code) }
+    req := httptest.NewRequest(http.MethodGet, "/hl7/quarantine?limit=2", nil)
+    req.Header.Set("X-Role", "org_admin")
+    req.Header.Set("X-User-ID", "1")
+    req.Header.Set("X-Org-ID", "1")
+    rr = httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    // Messages posted by the unscoped admin aren't any one clinic's
+    if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"items":[]}` { t.Fatalf("org quarantine = %d %s", rr.Code, rr.Body.String()) }
+}
+
+func TestHL7ControlIDsPerOrg(t *testing.T) {
+    m, _ := tenantFixture(t)
+    srv := NewServer(m, defaultConfig())
+    // Two clinics whose feeds share an application, facility, and control id
+    if rr := hl7Request(srv, hl7A04, "admin", "1"); hl7Field(t, rr.Body.String(), "MSA", 1) != "AA" { t.Fatalf("org 1: %q", rr.Body.String()) }
+    other := strings.Replace(hl7A04, "Doe^Jane", "Roe^Jane", 1)
+    rr := hl7Request(srv, other, "admin", "2")
+    if hl7Field(t, rr.Body.String(), "MSA", 1) != "AA" || rr.Header().Get("Idempotent-Replayed") != "" { t.Fatalf("org 2: %q", rr.Body.String()) }
+    id, err := m.FindPatientByMRN(withOrg(context.Background(), 2), "MRN100")
+    if err != nil { t.Fatalf("org 2 patient: %v", err) }
+    if d, _ := m.GetPatientDetail(context.Background(), id); d.Name != "Jane Roe" || d.OrgID != 2 { t.Fatalf("org 2 patient = %+v", d) }
+    if q, _ := m.ListHL7Quarantine(context.Background(), 10); len(q) != 0 { t.Fatalf("quarantine = %+v", q) }
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// icdCodePattern is the shape of an ICD-10-CM code: a letter, two characters of category,
+// then up to four after the dot
+var icdCodePattern = regexp.MustCompile(`^[A-Z][0-9][0-9A-Z](\.[0-9A-Z]{1,4})?$`)
+
+// normalizeICDCode uppercases a code and restores the dot claims and EHR exports often
+// drop (E119 becomes E11.9). ok is false when the result isn't shaped like a code.
+func normalizeICDCode(s string) (code string, ok bool) {
+    code = strings.ToUpper(strings.TrimSpace(s))
+    if len(code) > 3 && !strings.Contains(code, ".") { code = code[:3] + "." + code[3:] }
+    return code, icdCodePattern.MatchString(code)
+}
+
+// starterICDCodes is the code list the in-memory repo starts with, matching db/seed.sql.
+// Production databases load the full ICD-10-CM release instead.
+func starterICDCodes() map[string]string {
+    return map[string]string{
+        "E11.9":   "Type 2 diabetes mellitus without complications",
+        "E78.5":   "Hyperlipidemia, unspecified",
+        "F32.A":   "Depression, unspecified",
+        "F41.1":   "Generalized anxiety disorder",
+        "G89.29":  "Other chronic pain",
+        "H66.90":  "Otitis media, unspecified, unspecified ear",
+        "I10":     "Essential (primary) hypertension",
+        "J02.9":   "Acute pharyngitis, unspecified",
+        "J06.9":   "Acute upper respiratory infection, unspecified",
+        "J45.909": "Unspecified asthma, uncomplicated",
+        "K21.9":   "Gastro-esophageal reflux disease without esophagitis",
+        "M54.50":  "Low back pain, unspecified",
+        "N39.0":   "Urinary tract infection, site not specified",
+        "R51.9":   "Headache, unspecified",
+    }
+}
+
+// handleICDSearch serves GET /icd?q=&limit=, ICD-10-CM codes for a diagnosis picker.
+// Codes starting with q come first (so "E11" lists the type 2 diabetes codes), then
+// codes whose description contains it.
+func (s *Server) handleICDSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if _, ok := s.can(w, r, ActDiagnosisRead, Resource{}); !ok { return }
+    limit := 20
+    if ls := r.URL.Query().Get("limit"); ls != "" {
+        if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 100 { limit = n } else {
+            writeError(w, http.StatusBadRequest, "limit must be 1..100"); return
+        }
+    }
+    q := strings.TrimSpace(r.URL.Query().Get("q"))
+    if q == "" { writeError(w, http.StatusBadRequest, "q is required"); return }
+    if len(q) > 200 { writeError(w, http.StatusBadRequest, "q too long"); return }
+    items, err := s.repo.SearchICDCodes(r.Context(), q, limit)
+    if err != nil { writeError(w, http.StatusInternalServerError, "failed to search diagnosis codes"); return }
+    writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit})
+}
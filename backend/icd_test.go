@@ -0,0 +1,99 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestICDSearch(t *testing.T) {
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        expectStatus int
+        expectCodes  string
+    }{
+        {name: "code prefix", path: "/icd?q=j0", role: "physician", expectStatus: http.StatusOK, expectCodes: "J02.9,J06.9"},
+        {name: "description", path: "/icd?q=diabetes", role: "patient", expectStatus: http.StatusOK, expectCodes: "E11.9"},
+        {name: "prefix before description", path: "/icd?q=i&limit=3", role: "nurse", expectStatus: http.StatusOK, expectCodes: "I10,E11.9,E78.5"},
+        {name: "no match", path: "/icd?q=zzz", role: "pharmacist", expectStatus: http.StatusOK, expectCodes: ""},
+        {name: "missing q", path: "/icd", role: "physician", expectStatus: http.StatusBadRequest},
+        {name: "bad limit", path: "/icd?q=e&limit=0", role: "physician", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, http.MethodGet, tc.path, "", tc.role, "1")
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if rr.Code != http.StatusOK { return }
+            var resp struct{ Items []ICDCode `json:"items"` }
+            if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+            var codes []string
+            for _, c := range resp.Items { codes = append(codes, c.Code) }
+            if got := strings.Join(codes, ","); got != tc.expectCodes { t.Fatalf("codes = %s, want %s", got, tc.expectCodes) }
+        })
+    }
+}
+
+func TestPrescriptionDiagnosisCode(t *testing.T) {
+    cases := []struct {
+        name         string
+        code         string
+        expectStatus int
+        expectBody   string
+    }{
+        {name: "known code", code: "J06.9", expectStatus: http.StatusCreated, expectBody: `"diagnosis_code":"J06.9","diagnosis_description":"Acute upper respiratory infection, unspecified"`},
+        {name: "normalized", code: "j069", expectStatus: http.StatusCreated, expectBody: `"diagnosis_code":"J06.9"`},
+        {name: "unknown code", code: "A00.0", expectStatus: http.StatusBadRequest, expectBody: `"code":"INVALID_REFERENCE"`},
+        {name: "malformed", code: "12.3", expectStatus: http.StatusBadRequest, expectBody: `"code":"VALIDATION_FAILED"`},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            body := `{"patient_id":1,"physician_id":1,"drug_name":"Amoxicillin","quantity":20,"sig":"1 tab TID","diagnosis_code":"` + tc.code + `"}`
+            rr := consentRequest(srv, http.MethodPost, "/prescriptions", body, "physician", "1")
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if !strings.Contains(rr.Body.String(), tc.expectBody) { t.Fatalf("body = %s, want %s", rr.Body.String(), tc.expectBody) }
+        })
+    }
+
+    // Listing joins the description back in
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    rr := consentRequest(srv, http.MethodGet, "/prescriptions?patient_id=2", "", "admin", "1")
+    if !strings.Contains(rr.Body.String(), `"diagnosis_code":"E11.9","diagnosis_description":"Type 2 diabetes mellitus without complications"`) {
+        t.Fatalf("list body = %s", rr.Body.String())
+    }
+}
+
+func TestTopDrugsByDiagnosis(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    // A second J02.9 prescription outranks Amoxicillin's 20 within the diagnosis
+    body := `{"patient_id":1,"physician_id":1,"drug_name":"Ibuprofen","quantity":25,"sig":"PRN pain","diagnosis_code":"J02.9"}`
+    if rr := consentRequest(srv, http.MethodPost, "/prescriptions", body, "physician", "1"); rr.Code != http.StatusCreated {
+        t.Fatalf("create status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    window := "/analytics/top-drugs?from=2020-01-01T00:00:00Z&to=2099-01-01T00:00:00Z&group_by=diagnosis"
+
+    rr := consentRequest(srv, http.MethodGet, window+"&limit=2&per_diagnosis=1", "", "admin", "1")
+    if rr.Code != http.StatusOK { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var resp struct{ Items []DiagnosisTopDrugs `json:"items"` }
+    if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+    // E11.9 60, J02.9 45, I10 30, and Ibuprofen's 30 without a diagnosis
+    if len(resp.Items) != 2 { t.Fatalf("items = %+v", resp.Items) }
+    if g := resp.Items[0]; g.DiagnosisCode != "E11.9" || g.TotalQty != 60 || len(g.Drugs) != 1 || g.Drugs[0].DrugName != "Metformin" {
+        t.Fatalf("first = %+v", g)
+    }
+    if g := resp.Items[1]; g.DiagnosisCode != "J02.9" || g.DiagnosisDescription != "Acute pharyngitis, unspecified" || g.TotalQty != 45 || len(g.Drugs) != 1 || g.Drugs[0].DrugName != "Ibuprofen" {
+        t.Fatalf("second = %+v", g)
+    }
+
+    if rr := consentRequest(srv, http.MethodGet, window+"&per_diagnosis=0", "", "admin", "1"); rr.Code != http.StatusBadRequest {
+        t.Fatalf("per_diagnosis=0 status = %d", rr.Code)
+    }
+    if rr := consentRequest(srv, http.MethodGet, "/analytics/top-drugs?from=2020-01-01T00:00:00Z&to=2099-01-01T00:00:00Z&group_by=drug", "", "admin", "1"); rr.Code != http.StatusBadRequest {
+        t.Fatalf("group_by=drug status = %d", rr.Code)
+    }
+}
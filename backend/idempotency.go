@@ -0,0 +1,116 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// idempotencyTTL is how long a stored response is replayed for a repeated Idempotency-Key
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a reservation may stay pending. A request unfinished by then
+// is presumed lost with its process, and a retry with the same key takes the key over.
+const idempotencyLease = time.Minute
+
+// IdempotencyRecord is a stored (scope, key) reservation and, once completed, its response.
+// StatusCode is 0 while the original request is still in flight; ReservedAt is when that
+// request claimed the key (see idempotencyLease).
+type IdempotencyRecord struct {
+    Scope       string
+    Key         string
+    RequestHash string
+    StatusCode  int
+    Body        []byte
+    CreatedAt   time.Time
+    ReservedAt  time.Time
+    ExpiresAt   time.Time
+}
+
+// idempotencyScope is the namespace of a caller's Idempotency-Keys: their role, user id,
+// and organization as authenticated, so differently spelled headers can't share or dodge one
+func idempotencyScope(p Principal) string {
+    return string(p.Role) + ":" + strconv.FormatInt(p.UserID, 10) + ":" + strconv.FormatInt(p.OrgID, 10)
+}
+
+// withIdempotency runs next at most once per Idempotency-Key within scope (see
+// idempotencyScope). A repeated key with the same body replays the stored 201 response; a
+// repeated key with a different body is rejected. Requests without the header run as-is.
+func (s *Server) withIdempotency(w http.ResponseWriter, r *http.Request, scope string, next http.HandlerFunc) {
+    key := r.Header.Get("Idempotency-Key")
+    if key == "" {
+        next(w, r)
+        return
+    }
+    if len(key) > 255 {
+        writeError(w, http.StatusBadRequest, "Idempotency-Key too long")
+        return
+    }
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        writeBodyError(w, err)
+        return
+    }
+    r.Body = io.NopCloser(bytes.NewReader(body))
+    sum := sha256.Sum256(body)
+    hash := hex.EncodeToString(sum[:])
+
+    existing, err := s.repo.ReserveIdempotencyKey(r.Context(), IdempotencyRecord{
+        Scope: scope, Key: key, RequestHash: hash, ExpiresAt: time.Now().Add(idempotencyTTL),
+    })
+    if err != nil { writeError(w, http.StatusInternalServerError, "idempotency check failed"); return }
+    if existing != nil {
+        switch {
+        case existing.RequestHash != hash:
+            writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+        case existing.StatusCode == 0:
+            writeError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+        default:
+            w.Header().Set("Idempotent-Replayed", "true")
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(existing.StatusCode)
+            _, _ = w.Write(existing.Body)
+        }
+        return
+    }
+
+    rec := &responseCapture{header: http.Header{}, code: http.StatusOK}
+    finished := false
+    defer func() {
+        if finished { return }
+        // next panicked: free the key now rather than after the lease, then keep unwinding
+        if err := s.repo.ReleaseIdempotencyKey(r.Context(), scope, key); err != nil {
+            log.Printf("idempotency: failed to release key %q: %v", key, err)
+        }
+    }()
+    next(rec, r)
+    finished = true
+    if rec.code == http.StatusCreated {
+        if err := s.repo.CompleteIdempotencyKey(r.Context(), scope, key, rec.code, rec.body.Bytes()); err != nil {
+            log.Printf("idempotency: failed to store response for key %q: %v", key, err)
+        }
+    } else if err := s.repo.ReleaseIdempotencyKey(r.Context(), scope, key); err != nil {
+        log.Printf("idempotency: failed to release key %q: %v", key, err)
+    }
+    for k, v := range rec.header {
+        w.Header()[k] = v
+    }
+    w.WriteHeader(rec.code)
+    _, _ = w.Write(rec.body.Bytes())
+}
+
+// responseCapture buffers a handler's response so it can be stored before being sent
+type responseCapture struct {
+    header http.Header
+    code   int
+    body   bytes.Buffer
+}
+
+func (c *responseCapture) Header() http.Header         { return c.header }
+func (c *responseCapture) WriteHeader(code int)        { c.code = code }
+func (c *responseCapture) Write(b []byte) (int, error) { return c.body.Write(b) }
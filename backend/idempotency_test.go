@@ -0,0 +1,101 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+func TestCreatePrescriptionIdempotencyKey(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith")
+    repo, _ := fixtureMemory(f)
+    srv := NewServer(repo, defaultConfig())
+
+    post := func(key, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(body))
+        req.Header.Set("X-Role", "physician")
+        req.Header.Set("X-User-ID", "1")
+        if key != "" { req.Header.Set("Idempotency-Key", key) }
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+    body := `{"patient_id":1,"physician_id":1,"drug_name":"Ibuprofen","quantity":30,"sig":"PRN"}`
+
+    first := post("abc", body)
+    if first.Code != http.StatusCreated { t.Fatalf("first status = %d, body=%s", first.Code, first.Body.String()) }
+    replay := post("abc", body)
+    if replay.Code != http.StatusCreated || replay.Header().Get("Idempotent-Replayed") != "true" {
+        t.Fatalf("replay status = %d, headers=%v", replay.Code, replay.Header())
+    }
+    if replay.Body.String() != first.Body.String() {
+        t.Fatalf("replayed body differs:\n%s\n%s", first.Body.String(), replay.Body.String())
+    }
+    if rr := post("abc", strings.Replace(body, "30", "60", 1)); rr.Code != http.StatusUnprocessableEntity {
+        t.Fatalf("mismatched body status = %d, want 422", rr.Code)
+    }
+    // A failed request must not pin the key
+    if rr := post("bad", `{"patient_id":1}`); rr.Code != http.StatusBadRequest { t.Fatalf("status = %d", rr.Code) }
+    if rr := post("bad", body); rr.Code != http.StatusCreated { t.Fatalf("retry after failure status = %d", rr.Code) }
+
+    items, _ := repo.ListPrescriptions(context.Background(), ListPrescriptionsFilter{})
+    if len(items) != 2 { t.Fatalf("expected 2 prescriptions, got %d", len(items)) }
+}
+
+func TestIdempotencyKeyScopedToPrincipal(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    post := func(userID string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(`{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":10,"sig":"PRN"}`))
+        req.Header.Set("X-Role", "physician")
+        req.Header.Set("X-User-ID", userID)
+        req.Header.Set("Idempotency-Key", "k1")
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+    if rr := post("1"); rr.Code != http.StatusCreated { t.Fatalf("first status = %d, body=%s", rr.Code, rr.Body.String()) }
+    // The same physician spelled differently is the same caller
+    if rr := post("01"); rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "true" {
+        t.Fatalf("replay status = %d, headers=%v", rr.Code, rr.Header())
+    }
+}
+
+func TestIdempotencyKeyReleasedOnPanic(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(`{}`))
+    req.Header.Set("Idempotency-Key", "k1")
+    func() {
+        defer func() {
+            if recover() == nil { t.Fatal("handler panic was swallowed") }
+        }()
+        srv.withIdempotency(httptest.NewRecorder(), req, "physician:1:1", func(http.ResponseWriter, *http.Request) { panic("boom") })
+    }()
+    if _, ok := repo.idempotency[memoryIdemKey{"physician:1:1", "k1"}]; ok { t.Fatal("key still reserved after panic") }
+}
+
+func TestIdempotencyLeaseTakeover(t *testing.T) {
+    repo := newMemoryRepo()
+    ctx := context.Background()
+    rec := IdempotencyRecord{Scope: "s", Key: "k", RequestHash: "h", ExpiresAt: time.Now().Add(idempotencyTTL)}
+    if ex, _ := repo.ReserveIdempotencyKey(ctx, rec); ex != nil { t.Fatalf("first reserve = %+v", ex) }
+    if ex, _ := repo.ReserveIdempotencyKey(ctx, rec); ex == nil || ex.StatusCode != 0 { t.Fatalf("pending reserve = %+v", ex) }
+
+    // The first request's process died; once its lease runs out a retry takes the key over
+    k := memoryIdemKey{"s", "k"}
+    stale := repo.idempotency[k]
+    stale.ReservedAt = time.Now().Add(-idempotencyLease)
+    repo.idempotency[k] = stale
+    if ex, _ := repo.ReserveIdempotencyKey(ctx, rec); ex != nil { t.Fatalf("takeover reserve = %+v", ex) }
+    _ = repo.CompleteIdempotencyKey(ctx, "s", "k", http.StatusCreated, []byte("second"))
+    // A late completion of the lost request doesn't replace the stored response
+    _ = repo.CompleteIdempotencyKey(ctx, "s", "k", http.StatusCreated, []byte("first"))
+    if ex, _ := repo.ReserveIdempotencyKey(ctx, rec); ex == nil || string(ex.Body) != "second" { t.Fatalf("completed reserve = %+v", ex) }
+}
@@ -0,0 +1,165 @@
+// Package fixtures declares test data with builders instead of ad-hoc repository setup:
+//
+//   f := fixtures.New()
+//   f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(10)
+//
+// A Fixture builds a Dataset, which references rows by index, so the same fixture loads
+// into any repository: the in-memory one through the backend's own test helper, Postgres
+// through LoadPostgres. IDs then maps names to the ids that repository assigned.
+// Physicians and drugs are created the first time they are named, so the order of calls
+// decides id order in a fresh repository.
+package fixtures
+
+import "time"
+
+// Drug is a common outpatient order
+type Drug struct {
+    Name     string
+    Quantity int
+    Sig      string
+}
+
+// Drugs are what WithPrescriptions cycles through, in order. They are the drugs the
+// synthetic data generator draws from, each with its first sig and quantity.
+var Drugs = []Drug{
+    {"Lisinopril", 30, "10mg daily"},
+    {"Atorvastatin", 30, "20mg at bedtime"},
+    {"Levothyroxine", 30, "50mcg daily before breakfast"},
+    {"Metformin", 60, "500mg BID with meals"},
+    {"Amlodipine", 30, "5mg daily"},
+    {"Metoprolol", 60, "25mg BID"},
+    {"Omeprazole", 30, "20mg daily before breakfast"},
+    {"Losartan", 30, "50mg daily"},
+    {"Albuterol", 1, "2 puffs q4-6h PRN wheeze"},
+    {"Gabapentin", 90, "300mg TID"},
+    {"Hydrochlorothiazide", 30, "25mg daily"},
+    {"Sertraline", 30, "50mg daily"},
+    {"Amoxicillin", 30, "500mg TID x10 days"},
+    {"Ibuprofen", 20, "400mg q6h PRN pain"},
+    {"Azithromycin", 6, "500mg day 1 then 250mg daily x4 days"},
+    {"Prednisone", 10, "40mg daily x5 days"},
+}
+
+// Prescription is one prescription of a Dataset; the Idx fields index its slices
+type Prescription struct {
+    PatientIdx   int
+    PhysicianIdx int
+    DrugIdx      int
+    Quantity     int
+    Sig          string
+    PrescribedAt time.Time
+}
+
+// Dataset is the rows a Fixture declared. Names are unique within each slice; Links are
+// [physician index, patient index] pairs.
+type Dataset struct {
+    Patients      []string
+    Physicians    []string
+    Drugs         []string
+    Links         [][2]int
+    Prescriptions []Prescription
+}
+
+// Fixture collects patients with their physicians and prescriptions
+type Fixture struct {
+    ds         Dataset
+    now        time.Time
+    patients   map[string]int
+    physicians map[string]int
+    drugs      map[string]int
+    // rx counts prescriptions so each gets a distinct prescribed_at
+    rx int
+}
+
+// New returns an empty fixture whose prescriptions date back from now
+func New() *Fixture {
+    return &Fixture{
+        now:        time.Now().UTC().Truncate(time.Second),
+        patients:   map[string]int{},
+        physicians: map[string]int{},
+        drugs:      map[string]int{},
+    }
+}
+
+// Dataset returns what the fixture declared so far
+func (f *Fixture) Dataset() Dataset { return f.ds }
+
+// Physician returns the index of the named physician, adding it if needed
+func (f *Fixture) Physician(name string) int {
+    if i, ok := f.physicians[name]; ok { return i }
+    f.ds.Physicians = append(f.ds.Physicians, name)
+    f.physicians[name] = len(f.ds.Physicians) - 1
+    return f.physicians[name]
+}
+
+// Drug returns the index of the named drug, adding it if needed
+func (f *Fixture) Drug(name string) int {
+    if i, ok := f.drugs[name]; ok { return i }
+    f.ds.Drugs = append(f.ds.Drugs, name)
+    f.drugs[name] = len(f.ds.Drugs) - 1
+    return f.drugs[name]
+}
+
+// NewPatient adds a patient; names must be unique within the fixture
+func (f *Fixture) NewPatient(name string) *Patient {
+    if _, ok := f.patients[name]; ok { panic("fixtures: duplicate patient " + name) }
+    f.ds.Patients = append(f.ds.Patients, name)
+    f.patients[name] = len(f.ds.Patients) - 1
+    return &Patient{f: f, idx: f.patients[name], physician: -1}
+}
+
+// Patient adds links and prescriptions for one patient
+type Patient struct {
+    f   *Fixture
+    idx int
+    // physician is the most recently linked physician, who writes WithPrescriptions
+    physician int
+}
+
+// WithPhysician links the patient to the named physician
+func (p *Patient) WithPhysician(name string) *Patient {
+    p.physician = p.f.Physician(name)
+    p.f.ds.Links = append(p.f.ds.Links, [2]int{p.physician, p.idx})
+    return p
+}
+
+// WithPrescriptions adds n prescriptions from the patient's last linked physician (one
+// is linked if there is none), cycling through Drugs
+func (p *Patient) WithPrescriptions(n int) *Patient {
+    for i := 0; i < n; i++ {
+        d := Drugs[p.f.rx%len(Drugs)]
+        p.WithPrescription(d.Name, d.Quantity, d.Sig)
+    }
+    return p
+}
+
+// WithPrescription adds one prescription; each is an hour older than the one before, so
+// newest-first lists return them in reverse order of creation
+func (p *Patient) WithPrescription(drug string, quantity int, sig string) *Patient {
+    if p.physician < 0 { p.WithPhysician("Dr. Fixture") }
+    p.f.rx++
+    p.f.ds.Prescriptions = append(p.f.ds.Prescriptions, Prescription{
+        PatientIdx:   p.idx,
+        PhysicianIdx: p.physician,
+        DrugIdx:      p.f.Drug(drug),
+        Quantity:     quantity,
+        Sig:          sig,
+        PrescribedAt: p.f.now.Add(-time.Duration(p.f.rx) * time.Hour),
+    })
+    return p
+}
+
+// IDs maps fixture names to repository ids
+type IDs struct {
+    Patients, Physicians, Drugs map[string]int64
+}
+
+// IDs names the ids a repository assigned when loading the fixture's Dataset; each slice
+// is parallel to the Dataset's
+func (f *Fixture) IDs(patients, physicians, drugs []int64) IDs {
+    ids := IDs{Patients: map[string]int64{}, Physicians: map[string]int64{}, Drugs: map[string]int64{}}
+    for name, i := range f.patients { ids.Patients[name] = patients[i] }
+    for name, i := range f.physicians { ids.Physicians[name] = physicians[i] }
+    for name, i := range f.drugs { ids.Drugs[name] = drugs[i] }
+    return ids
+}
@@ -0,0 +1,32 @@
+package fixtures
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestBuilders(t *testing.T) {
+    f := New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(2)
+    f.NewPatient("Bob").WithPrescription("Lisinopril", 90, "20mg daily")
+    ds := f.Dataset()
+
+    if !reflect.DeepEqual(ds.Physicians, []string{"Dr. Smith", "Dr. Fixture"}) || !reflect.DeepEqual(ds.Links, [][2]int{{0, 0}, {1, 1}}) {
+        t.Fatalf("physicians = %v, links = %v", ds.Physicians, ds.Links)
+    }
+    // Naming a drug again reuses it
+    if !reflect.DeepEqual(ds.Drugs, []string{Drugs[0].Name, Drugs[1].Name}) || ds.Prescriptions[2].DrugIdx != 0 {
+        t.Fatalf("drugs = %v, prescriptions = %+v", ds.Drugs, ds.Prescriptions)
+    }
+    for i := 1; i < len(ds.Prescriptions); i++ {
+        if !ds.Prescriptions[i].PrescribedAt.Before(ds.Prescriptions[i-1].PrescribedAt) { t.Fatalf("prescription %d is not older than the one before", i) }
+    }
+
+    ids := f.IDs([]int64{10, 11}, []int64{20, 21}, []int64{30, 31})
+    if ids.Patients["Bob"] != 11 || ids.Physicians["Dr. Fixture"] != 21 || ids.Drugs[Drugs[1].Name] != 31 { t.Fatalf("ids = %+v", ids) }
+
+    defer func() {
+        if recover() == nil { t.Fatal("duplicate patient did not panic") }
+    }()
+    f.NewPatient("Alice")
+}
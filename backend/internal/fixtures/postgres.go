@@ -0,0 +1,59 @@
+package fixtures
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB is where LoadPostgres writes: a *pgxpool.Pool, *pgx.Conn, or pgx.Tx
+type DB interface {
+    Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+    QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// LoadPostgres inserts the fixture into organization orgID of a database with
+// db/schema.sql applied. Links come with consent for every scope, as in the in-memory
+// repository. Drugs and physicians that already exist by name are reused; patients are
+// always new, so load into a fresh organization (or a transaction that is rolled back)
+// to keep runs apart.
+func (f *Fixture) LoadPostgres(ctx context.Context, db DB, orgID int64) (IDs, error) {
+    drugs := make([]int64, len(f.ds.Drugs))
+    for i, name := range f.ds.Drugs {
+        err := db.QueryRow(ctx, `INSERT INTO drugs (name) VALUES ($1)
+            ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id`, name).Scan(&drugs[i])
+        if err != nil { return IDs{}, fmt.Errorf("drug %q: %w", name, err) }
+    }
+    physicians := make([]int64, len(f.ds.Physicians))
+    for i, name := range f.ds.Physicians {
+        err := db.QueryRow(ctx, `INSERT INTO physicians (name, org_id) VALUES ($1, $2)
+            ON CONFLICT (org_id, name) DO UPDATE SET name = EXCLUDED.name RETURNING id`, name, orgID).Scan(&physicians[i])
+        if err != nil { return IDs{}, fmt.Errorf("physician %q: %w", name, err) }
+    }
+    patients := make([]int64, len(f.ds.Patients))
+    for i, name := range f.ds.Patients {
+        err := db.QueryRow(ctx, `INSERT INTO patients (name, org_id) VALUES ($1, $2) RETURNING id`, name, orgID).Scan(&patients[i])
+        if err != nil { return IDs{}, fmt.Errorf("patient %q: %w", name, err) }
+    }
+    for _, l := range f.ds.Links {
+        _, err := db.Exec(ctx, `INSERT INTO physician_patients (physician_id, patient_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+            physicians[l[0]], patients[l[1]])
+        if err == nil {
+            _, err = db.Exec(ctx, `
+                INSERT INTO consents (physician_id, patient_id, scope)
+                SELECT $1, $2, s.scope FROM (VALUES ('prescriptions'),('allergies'),('analytics')) AS s(scope)
+                ON CONFLICT DO NOTHING`, physicians[l[0]], patients[l[1]])
+        }
+        if err != nil { return IDs{}, fmt.Errorf("link %s to %s: %w", f.ds.Physicians[l[0]], f.ds.Patients[l[1]], err) }
+    }
+    for _, p := range f.ds.Prescriptions {
+        _, err := db.Exec(ctx, `
+            INSERT INTO prescriptions (patient_id, physician_id, drug_id, quantity, sig, prescribed_at, org_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+            patients[p.PatientIdx], physicians[p.PhysicianIdx], drugs[p.DrugIdx], p.Quantity, p.Sig, p.PrescribedAt, orgID)
+        if err != nil { return IDs{}, fmt.Errorf("prescription for %s: %w", f.ds.Patients[p.PatientIdx], err) }
+    }
+    return f.IDs(patients, physicians, drugs), nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/smtp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Job is a periodic background task. The jobRunner runs every registered job on its own
+// ticker, and only on the replica holding the leader lock, so a job runs once per interval
+// however many API replicas are deployed.
+type Job interface {
+    // Name identifies the job in logs, metrics, and audit entries ("system:<name>")
+    Name() string
+    // Interval is how often the job runs; the first run is at startup
+    Interval() time.Duration
+    // Run does one pass as of now and returns how many rows it handled
+    Run(ctx context.Context, now time.Time) (int, error)
+}
+
+// jobBatch bounds the rows one statement of a job touches
+const jobBatch = 500
+
+// jobsLockKey is the Postgres advisory lock key held by the replica that runs jobs
+const jobsLockKey int64 = 0x48435f4a4f4253 // "HC_JOBS"
+
+// leaderLock elects one process to run background jobs
+type leaderLock interface {
+    // Acquire reports whether this process holds the lock, taking it when it is free. It is
+    // called before every run, so another replica takes over when the leader goes away.
+    Acquire(ctx context.Context) (bool, error)
+    Release()
+}
+
+// localLeader is the leader lock of a single process (the in-memory repository)
+type localLeader struct{}
+
+func (localLeader) Acquire(context.Context) (bool, error) { return true, nil }
+func (localLeader) Release()                              {}
+
+// pgLeaderLock holds a session-level advisory lock on one pooled connection. Postgres
+// drops the lock when that session ends, so a crashed leader is replaced on the next tick.
+type pgLeaderLock struct {
+    pool *pgxpool.Pool
+    key  int64
+    mu   sync.Mutex
+    // conn holds the lock; nil when this process is not the leader
+    conn *pgxpool.Conn
+}
+
+func (r *PGRepo) leaderLock(key int64) *pgLeaderLock { return &pgLeaderLock{pool: r.pool, key: key} }
+
+func (l *pgLeaderLock) Acquire(ctx context.Context) (bool, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.conn != nil {
+        if err := l.conn.Ping(ctx); err == nil { return true, nil }
+        // The session is gone and took the lock with it
+        l.conn.Conn().Close(context.Background())
+        l.conn.Release()
+        l.conn = nil
+    }
+    conn, err := l.pool.Acquire(ctx)
+    if err != nil { return false, err }
+    var ok bool
+    if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok); err != nil || !ok {
+        conn.Release()
+        return false, err
+    }
+    l.conn = conn
+    return true, nil
+}
+
+func (l *pgLeaderLock) Release() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.conn == nil { return }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+        l.conn.Conn().Close(ctx)
+    }
+    l.conn.Release()
+    l.conn = nil
+}
+
+// JobStats are one job's counters since startup, served by GET /debug/jobs
+type JobStats struct {
+    Name     string   `json:"name"`
+    Interval Duration `json:"interval"`
+    Runs     int64    `json:"runs"`
+    Failures int64    `json:"failures"`
+    // Skipped counts ticks on which another replica was the leader
+    Skipped int64 `json:"skipped"`
+    // Items is the total number of rows handled
+    Items        int64      `json:"items"`
+    LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+    LastDuration Duration   `json:"last_duration"`
+    LastError    string     `json:"last_error,omitempty"`
+}
+
+// jobRunner runs registered jobs on their intervals while this process is the leader
+type jobRunner struct {
+    leader leaderLock
+    mu     sync.Mutex
+    jobs   []Job
+    stats  map[string]*JobStats
+}
+
+func newJobRunner(leader leaderLock) *jobRunner {
+    return &jobRunner{leader: leader, stats: map[string]*JobStats{}}
+}
+
+// Register adds a job; call it before Start
+func (jr *jobRunner) Register(j Job) {
+    jr.mu.Lock()
+    defer jr.mu.Unlock()
+    if _, dup := jr.stats[j.Name()]; dup { panic("jobs: duplicate job " + j.Name()) }
+    jr.jobs = append(jr.jobs, j)
+    jr.stats[j.Name()] = &JobStats{Name: j.Name(), Interval: Duration(j.Interval())}
+}
+
+// Start runs each job now and then every Interval until ctx is done, releasing the
+// leader lock on the way out
+func (jr *jobRunner) Start(ctx context.Context) {
+    jr.mu.Lock()
+    jobs := append([]Job(nil), jr.jobs...)
+    jr.mu.Unlock()
+    var wg sync.WaitGroup
+    for _, j := range jobs {
+        wg.Add(1)
+        go func(j Job) {
+            defer wg.Done()
+            ticker := time.NewTicker(j.Interval())
+            defer ticker.Stop()
+            for {
+                jr.runOnce(ctx, j, time.Now())
+                select {
+                case <-ctx.Done():
+                    return
+                case <-ticker.C:
+                }
+            }
+        }(j)
+    }
+    go func() {
+        wg.Wait()
+        jr.leader.Release()
+    }()
+}
+
+// runOnce runs j if this process is the leader and records the outcome
+func (jr *jobRunner) runOnce(ctx context.Context, j Job, now time.Time) {
+    leader, err := jr.leader.Acquire(ctx)
+    if err != nil { log.Printf("jobs: leader election failed: %v", err) }
+    if !leader {
+        jr.record(j.Name(), func(st *JobStats) { st.Skipped++ })
+        return
+    }
+    start := time.Now()
+    n, err := j.Run(ctx, now)
+    elapsed := time.Since(start)
+    jr.record(j.Name(), func(st *JobStats) {
+        st.Runs++
+        st.Items += int64(n)
+        at := now.UTC()
+        st.LastRunAt, st.LastDuration, st.LastError = &at, Duration(elapsed), ""
+        if err != nil { st.Failures++; st.LastError = err.Error() }
+    })
+    if err != nil {
+        log.Printf("jobs: %s failed after %d rows: %v", j.Name(), n, err)
+    } else if n > 0 {
+        log.Printf("jobs: %s handled %d rows in %s", j.Name(), n, elapsed.Round(time.Millisecond))
+    }
+}
+
+func (jr *jobRunner) record(name string, fn func(*JobStats)) {
+    jr.mu.Lock()
+    defer jr.mu.Unlock()
+    fn(jr.stats[name])
+}
+
+// Stats returns a snapshot of every job's counters, by name
+func (jr *jobRunner) Stats() []JobStats {
+    out := []JobStats{}
+    if jr == nil { return out }
+    jr.mu.Lock()
+    defer jr.mu.Unlock()
+    for _, st := range jr.stats { out = append(out, *st) }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out
+}
+
+// jobsFromConfig builds the runner with every job cfg enables
+func jobsFromConfig(repo Repository, cfg Config, leader leaderLock) *jobRunner {
+    jr := newJobRunner(leader)
+    jr.Register(&expiryJob{repo: repo, interval: time.Duration(cfg.JobExpiryInterval)})
+    jr.Register(&purgeJob{repo: repo, interval: time.Duration(cfg.JobPurgeInterval),
+        auditRetention: time.Duration(cfg.AuditRetentionDays) * 24 * time.Hour})
+    if rc := retentionFromConfig(cfg); rc.Window > 0 { jr.Register(&retentionJob{repo: repo, cfg: rc}) }
+    if to := splitList(cfg.SummaryEmailTo); len(to) > 0 {
+        jr.Register(&summaryJob{repo: repo, mailer: smtpMailerFromConfig(cfg), to: to, interval: time.Duration(cfg.SummaryInterval)})
+    }
+    return jr
+}
+
+// splitList splits a comma-separated setting, dropping blanks
+func splitList(s string) []string {
+    var out []string
+    for _, v := range strings.Split(s, ",") {
+        if v = strings.TrimSpace(v); v != "" { out = append(out, v) }
+    }
+    return out
+}
+
+// expiryJob moves active prescriptions past their expires_at (prescribed_at plus the
+// dosage duration) to expired
+type expiryJob struct {
+    repo     Repository
+    interval time.Duration
+}
+
+func (j *expiryJob) Name() string            { return "prescription_expiry" }
+func (j *expiryJob) Interval() time.Duration { return j.interval }
+
+func (j *expiryJob) Run(ctx context.Context, now time.Time) (int, error) {
+    entry := AuditEntry{Actor: "system:" + j.Name(), Action: AuditExpire, Detail: "duration elapsed"}
+    total := 0
+    for {
+        ids, err := j.repo.ExpirePrescriptions(ctx, now, jobBatch, entry)
+        total += len(ids)
+        if err != nil || len(ids) < jobBatch { return total, err }
+    }
+}
+
+// purgeJob deletes expired idempotency keys and, when auditRetention is set, audit
+// entries older than it
+type purgeJob struct {
+    repo           Repository
+    interval       time.Duration
+    auditRetention time.Duration
+}
+
+func (j *purgeJob) Name() string            { return "purge" }
+func (j *purgeJob) Interval() time.Duration { return j.interval }
+
+func (j *purgeJob) Run(ctx context.Context, now time.Time) (int, error) {
+    total := 0
+    for {
+        n, err := j.repo.PurgeIdempotencyKeys(ctx, now, jobBatch)
+        total += int(n)
+        if err != nil { return total, err }
+        if n < jobBatch { break }
+    }
+    if j.auditRetention <= 0 { return total, nil }
+    for {
+        n, err := j.repo.PurgeAuditLog(ctx, now.Add(-j.auditRetention), jobBatch)
+        total += int(n)
+        if err != nil || n < jobBatch { return total, err }
+    }
+}
+
+// retentionJob anonymizes patients soft-deleted longer than the retention window
+type retentionJob struct {
+    repo Repository
+    cfg  retentionConfig
+}
+
+func (j *retentionJob) Name() string            { return "retention" }
+func (j *retentionJob) Interval() time.Duration { return j.cfg.Interval }
+
+func (j *retentionJob) Run(ctx context.Context, now time.Time) (int, error) {
+    return runRetention(ctx, j.repo, j.cfg, now)
+}
+
+// summaryTopDrugs is how many drugs the daily summary lists
+const summaryTopDrugs = 10
+
+// summaryJob emails the most prescribed drugs of the last interval, across organizations
+type summaryJob struct {
+    repo     Repository
+    mailer   Mailer
+    to       []string
+    interval time.Duration
+}
+
+func (j *summaryJob) Name() string            { return "top_drugs_summary" }
+func (j *summaryJob) Interval() time.Duration { return j.interval }
+
+func (j *summaryJob) Run(ctx context.Context, now time.Time) (int, error) {
+    from := now.Add(-j.interval)
+    top, err := j.repo.TopDrugs(ctx, from, now, summaryTopDrugs, nil)
+    if err != nil { return 0, err }
+    var b strings.Builder
+    fmt.Fprintf(&b, "Most prescribed drugs by quantity from %s to %s (UTC):\n\n", from.UTC().Format("2006-01-02 15:04"), now.UTC().Format("2006-01-02 15:04"))
+    for i, d := range top { fmt.Fprintf(&b, "%2d. %s: %d\n", i+1, d.DrugName, d.TotalQty) }
+    if len(top) == 0 { b.WriteString("No prescriptions were written.\n") }
+    subject := "Top drugs summary for " + now.UTC().Format("2006-01-02")
+    if err := j.mailer.Send(ctx, j.to, subject, b.String()); err != nil { return 0, err }
+    return len(top), nil
+}
+
+// Mailer sends plain-text email
+type Mailer interface {
+    Send(ctx context.Context, to []string, subject, body string) error
+}
+
+// smtpMailer sends through an SMTP relay, with PLAIN auth when a username is set
+type smtpMailer struct {
+    addr, from, username, password string
+}
+
+func smtpMailerFromConfig(c Config) *smtpMailer {
+    return &smtpMailer{addr: c.SMTPAddr, from: c.SMTPFrom, username: c.SMTPUsername, password: c.SMTPPassword}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, to []string, subject, body string) error {
+    var auth smtp.Auth
+    if m.username != "" {
+        host, _, _ := net.SplitHostPort(m.addr)
+        auth = smtp.PlainAuth("", m.username, m.password, host)
+    }
+    // net/smtp has no context support; the relay's own timeouts bound the call
+    return smtp.SendMail(m.addr, auth, m.from, to, []byte(m.message(to, subject, body)))
+}
+
+// headerLineBreaks are removed from header values, where they would start new headers
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// message formats an email; header values are kept to one line
+func (m *smtpMailer) message(to []string, subject, body string) string {
+    return "From: " + headerLineBreaks.Replace(m.from) + "\r\nTo: " + headerLineBreaks.Replace(strings.Join(to, ", ")) +
+        "\r\nSubject: " + headerLineBreaks.Replace(subject) +
+        "\r\nDate: " + time.Now().Format(time.RFC1123Z) + "\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" +
+        strings.ReplaceAll(body, "\n", "\r\n")
+}
+
+// handleDebugJobs serves GET /debug/jobs (admin): each background job's counters on this
+// replica
+func (s *Server) handleDebugJobs(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActConfigRead, Resource{}); !ok { return }
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"items": s.jobs.Stats()})
+}
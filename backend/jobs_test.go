@@ -0,0 +1,149 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+// fakeLeader is a leader lock whose outcome the test controls
+type fakeLeader struct{ leader bool }
+
+func (l *fakeLeader) Acquire(context.Context) (bool, error) { return l.leader, nil }
+func (l *fakeLeader) Release()                              {}
+
+// funcJob is a Job backed by a function
+type funcJob struct {
+    name string
+    run  func(ctx context.Context, now time.Time) (int, error)
+}
+
+func (j funcJob) Name() string            { return j.name }
+func (j funcJob) Interval() time.Duration { return time.Hour }
+func (j funcJob) Run(ctx context.Context, now time.Time) (int, error) { return j.run(ctx, now) }
+
+// recordingMailer keeps the messages it was asked to send
+type recordingMailer struct{ sent []string }
+
+func (m *recordingMailer) Send(_ context.Context, to []string, subject, body string) error {
+    m.sent = append(m.sent, strings.Join(to, ",")+"\n"+subject+"\n"+body)
+    return nil
+}
+
+func TestJobRunner(t *testing.T) {
+    leader := &fakeLeader{}
+    jr := newJobRunner(leader)
+    calls := 0
+    jr.Register(funcJob{name: "count", run: func(context.Context, time.Time) (int, error) { calls++; return 3, nil }})
+    jr.Register(funcJob{name: "fail", run: func(context.Context, time.Time) (int, error) { return 1, errors.New("boom") }})
+    now := time.Now()
+
+    // Another replica leads: nothing runs
+    for _, j := range jr.jobs { jr.runOnce(context.Background(), j, now) }
+    if calls != 0 { t.Fatalf("job ran without leadership") }
+    leader.leader = true
+    for i := 0; i < 2; i++ {
+        for _, j := range jr.jobs { jr.runOnce(context.Background(), j, now) }
+    }
+    stats := jr.Stats()
+    if len(stats) != 2 || calls != 2 { t.Fatalf("stats = %+v, calls = %d", stats, calls) }
+    count, fail := stats[0], stats[1]
+    if count.Name != "count" || count.Runs != 2 || count.Items != 6 || count.Skipped != 1 || count.Failures != 0 || count.LastRunAt == nil {
+        t.Fatalf("count stats = %+v", count)
+    }
+    if fail.Runs != 2 || fail.Failures != 2 || fail.LastError != "boom" { t.Fatalf("fail stats = %+v", fail) }
+
+    srv := NewServer(newMemoryRepo(), defaultConfig())
+    srv.jobs = jr
+    req := httptest.NewRequest(http.MethodGet, "/debug/jobs", nil)
+    req.Header.Set("X-Role", "admin")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    var resp struct{ Items []JobStats `json:"items"` }
+    if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK || len(resp.Items) != 2 {
+        t.Fatalf("GET /debug/jobs = %d %s", rr.Code, rr.Body.String())
+    }
+}
+
+func TestExpiryJob(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(3)
+    m, _ := fixtureMemory(f)
+    now := time.Now().UTC()
+    past, future := now.Add(-time.Hour), now.Add(time.Hour)
+    setExpiry := func(id int64, at *time.Time) {
+        p := m.prescriptions[id]
+        p.ExpiresAt = at
+        m.prescriptions[id] = p
+    }
+    setExpiry(1, &past)
+    setExpiry(2, &future)
+
+    job := &expiryJob{repo: m, interval: time.Hour}
+    n, err := job.Run(context.Background(), now)
+    if err != nil || n != 1 { t.Fatalf("Run = %d, %v", n, err) }
+    for id, want := range map[int64]string{1: PrescriptionExpired, 2: PrescriptionActive, 3: PrescriptionActive} {
+        if got := m.prescriptions[id].Status; got != want { t.Fatalf("prescription %d status = %q, want %q", id, got, want) }
+    }
+    if len(m.audit) != 1 || m.audit[0].Actor != "system:prescription_expiry" || m.audit[0].Action != AuditExpire || m.audit[0].EntityID != 1 {
+        t.Fatalf("audit = %+v", m.audit)
+    }
+    if n, _ := job.Run(context.Background(), now); n != 0 { t.Fatalf("second run expired %d", n) }
+}
+
+func TestPurgeJob(t *testing.T) {
+    m := newMemoryRepo()
+    ctx := context.Background()
+    now := time.Now().UTC()
+    m.idempotency[memoryIdemKey{"s", "old"}] = IdempotencyRecord{Scope: "s", Key: "old", ExpiresAt: now.Add(-time.Minute)}
+    m.idempotency[memoryIdemKey{"s", "new"}] = IdempotencyRecord{Scope: "s", Key: "new", ExpiresAt: now.Add(time.Minute)}
+    _ = m.RecordAudit(ctx, AuditEntry{Actor: "admin:1", Action: AuditDelete, Entity: "patient", EntityID: 1})
+    _ = m.RecordAudit(ctx, AuditEntry{Actor: "admin:1", Action: AuditDelete, Entity: "patient", EntityID: 2})
+    m.audit[0].CreatedAt = now.AddDate(0, 0, -40)
+
+    // Audit entries are kept without a retention period
+    if n, err := (&purgeJob{repo: m, interval: time.Hour}).Run(ctx, now); err != nil || n != 1 { t.Fatalf("Run = %d, %v", n, err) }
+    if _, ok := m.idempotency[memoryIdemKey{"s", "new"}]; !ok || len(m.idempotency) != 1 { t.Fatalf("idempotency = %+v", m.idempotency) }
+    if len(m.audit) != 2 { t.Fatalf("audit purged without retention: %+v", m.audit) }
+
+    job := &purgeJob{repo: m, interval: time.Hour, auditRetention: 30 * 24 * time.Hour}
+    if n, err := job.Run(ctx, now); err != nil || n != 1 { t.Fatalf("Run = %d, %v", n, err) }
+    if len(m.audit) != 1 || m.audit[0].EntityID != 2 { t.Fatalf("audit = %+v", m.audit) }
+}
+
+func TestSummaryJob(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescription("Amoxicillin", 20, "1 tab BID").WithPrescription("Ibuprofen", 30, "PRN")
+    m, _ := fixtureMemory(f)
+    mailer := &recordingMailer{}
+    job := &summaryJob{repo: m, mailer: mailer, to: []string{"ops@example.com", "cmo@example.com"}, interval: 365 * 24 * time.Hour}
+    n, err := job.Run(context.Background(), time.Now().Add(time.Minute))
+    if err != nil || n != 2 || len(mailer.sent) != 1 { t.Fatalf("Run = %d, %v, sent %d", n, err, len(mailer.sent)) }
+    msg := mailer.sent[0]
+    if !strings.HasPrefix(msg, "ops@example.com,cmo@example.com\nTop drugs summary for ") || !strings.Contains(msg, " 1. Ibuprofen: 30\n") ||
+        !strings.Contains(msg, " 2. Amoxicillin: 20\n") {
+        t.Fatalf("summary = %q", msg)
+    }
+}
+
+func TestJobsFromConfig(t *testing.T) {
+    cfg := defaultConfig()
+    names := func(jr *jobRunner) (out []string) {
+        for _, st := range jr.Stats() { out = append(out, st.Name) }
+        return out
+    }
+    if got := strings.Join(names(jobsFromConfig(newMemoryRepo(), cfg, localLeader{})), ","); got != "prescription_expiry,purge" {
+        t.Fatalf("default jobs = %s", got)
+    }
+    cfg.RetentionDays, cfg.SummaryEmailTo, cfg.SMTPAddr, cfg.SMTPFrom = 30, "ops@example.com", "localhost:25", "portal@example.com"
+    if got := strings.Join(names(jobsFromConfig(newMemoryRepo(), cfg, localLeader{})), ","); got != "prescription_expiry,purge,retention,top_drugs_summary" {
+        t.Fatalf("configured jobs = %s", got)
+    }
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestListPrescriptionsSortAndTotal(t *testing.T) {
+    cases := []struct {
+        name         string
+        query        string
+        expectStatus int
+        expectSort   string
+        expectTotal  int // -1 means total is omitted
+        // ordered reports whether a precedes b under the requested sort
+        ordered func(a, b Prescription) bool
+    }{
+        {name: "default newest first", query: "", expectStatus: http.StatusOK, expectSort: "prescribed_at:desc", expectTotal: -1,
+            ordered: func(a, b Prescription) bool { return !a.PrescribedAt.Before(b.PrescribedAt) }},
+        {name: "quantity ascending with total", query: "sort=quantity:asc&include_total=true&limit=2", expectStatus: http.StatusOK, expectSort: "quantity:asc", expectTotal: 4,
+            ordered: func(a, b Prescription) bool { return a.Quantity <= b.Quantity }},
+        {name: "drug name defaults to desc", query: "sort=drug_name", expectStatus: http.StatusOK, expectSort: "drug_name:desc", expectTotal: -1,
+            ordered: func(a, b Prescription) bool { return strings.ToLower(a.DrugName) >= strings.ToLower(b.DrugName) }},
+        {name: "total honors filters", query: "physician_id=1&include_total=1", expectStatus: http.StatusOK, expectSort: "prescribed_at:desc", expectTotal: 2,
+            ordered: func(a, b Prescription) bool { return !a.PrescribedAt.Before(b.PrescribedAt) }},
+        {name: "unknown field", query: "sort=patient_name", expectStatus: http.StatusBadRequest},
+        {name: "bad direction", query: "sort=quantity:up", expectStatus: http.StatusBadRequest},
+        {name: "bad include_total", query: "include_total=maybe", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodGet, "/prescriptions?"+tc.query, nil)
+            req.Header.Set("X-Role", "admin")
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusOK { return }
+            var resp struct {
+                Items []Prescription `json:"items"`
+                Sort  string         `json:"sort"`
+                Total *int           `json:"total"`
+            }
+            if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+            if resp.Sort != tc.expectSort { t.Fatalf("sort = %q, want %q", resp.Sort, tc.expectSort) }
+            if tc.expectTotal < 0 {
+                if resp.Total != nil { t.Fatalf("unexpected total %d", *resp.Total) }
+            } else if resp.Total == nil || *resp.Total != tc.expectTotal {
+                t.Fatalf("total = %v, want %d", resp.Total, tc.expectTotal)
+            }
+            if len(resp.Items) < 2 { t.Fatalf("too few items to check order: %d", len(resp.Items)) }
+            for i := 1; i < len(resp.Items); i++ {
+                if !tc.ordered(resp.Items[i-1], resp.Items[i]) { t.Fatalf("items %d and %d out of order: %+v", i-1, i, resp.Items) }
+            }
+        })
+    }
+}
@@ -5,35 +5,141 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
+// shutdownTimeout bounds how long a stopping server waits for requests and notifications
+const shutdownTimeout = 30 * time.Second
+
 // main only wires dependencies and starts the HTTP server.
 func main() {
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	legacyErrors.Store(cfg.LegacyErrorFormat)
+
+	// `healthcareportal seed [flags]` loads synthetic data instead of serving (see seed.go)
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		if err := runSeed(cfg, os.Args[2:], os.Stderr); err != nil {
+			log.Fatalf("seed: %v", err)
+		}
+		return
+	}
+
 	// Initialize repository
 	var repo Repository
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn != "" {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if cfg.DemoMode {
+		log.Println("DEMO_MODE=1; using in-memory repository with seeded demo data")
+		demo := newDemoMemoryRepo()
+		// Optionally bulk up the demo with synthetic (never real) patients and prescriptions
+		if n := cfg.DemoSyntheticPatients; n > 0 {
+			demo.loadSynthetic(GenerateSynthetic(SyntheticConfig{Seed: 1, Patients: n, Physicians: n/20 + 1, MeanPrescriptions: 4}))
+			log.Printf("loaded %d synthetic patients into demo data", n)
+		}
+		repo = demo
+	} else if cfg.DatabaseURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DBStartupWait))
 		defer cancel()
-		pg, err := NewPGRepo(ctx, dsn)
+		pg, err := NewPGRepo(ctx, cfg.DatabaseURL, cfg.poolConfig())
 		if err != nil {
 			log.Fatalf("failed to init db: %v", err)
 		}
+		// Postgres may still be starting (e.g., under docker compose); keep retrying for DB_STARTUP_WAIT
+		if err := pg.WaitReachable(ctx, time.Duration(cfg.DBConnectTimeout)); err != nil {
+			log.Fatalf("postgres not reachable after %s: %v", time.Duration(cfg.DBStartupWait), err)
+		}
 		repo = pg
 		log.Println("connected to Postgres")
+		go pg.MonitorReplica(context.Background())
 	} else {
-		log.Println("DATABASE_URL not set; server will start but DB-backed endpoints will fail")
-		repo = &noopRepo{}
+		log.Println("DATABASE_URL not set; using an empty in-memory repository (data is not persisted)")
+		repo = newMemoryRepo()
+	}
+	if cfg.PrescriptionSigningKey == "" {
+		if _, ok := repo.(*memoryRepo); ok {
+			// In-memory data doesn't outlive the process, so neither needs the key
+			key, err := ephemeralSigningKey()
+			if err != nil {
+				log.Fatalf("esign: %v", err)
+			}
+			cfg.PrescriptionSigningKey = key
+		} else {
+			log.Println("PRESCRIPTION_SIGNING_KEY not set; prescriptions are stored unsigned")
+		}
+	}
+
+	if cfg.AttachmentStore == "" {
+		if _, ok := repo.(*memoryRepo); ok {
+			cfg.AttachmentStore = "memory"
+		} else {
+			log.Println("ATTACHMENT_STORE not set; prescription attachments are disabled")
+		}
+	}
+
+	// Background jobs (expiry, purge, retention, summary email) run on one elected replica
+	var leader leaderLock = localLeader{}
+	if pg, ok := repo.(*PGRepo); ok {
+		leader = pg.leaderLock(jobsLockKey)
 	}
+	jobs := jobsFromConfig(repo, cfg, leader)
+	jobs.Start(context.Background())
 
-	srv := NewServer(repo)
-	addr := ":8080"
-	if v := os.Getenv("ADDR"); v != "" {
-		addr = v
+	tlsCfg, challenge, err := tlsFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
+
+	handler := NewServer(repo, cfg)
+	handler.jobs = jobs
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.HTTPReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.HTTPReadTimeout),
+		WriteTimeout:      time.Duration(cfg.HTTPWriteTimeout),
+		IdleTimeout:       time.Duration(cfg.HTTPIdleTimeout),
+		TLSConfig:         tlsCfg,
+	}
+	serve := func() error {
+		log.Printf("listening on %s (plain HTTP; set TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS unless a proxy terminates TLS)", cfg.Addr)
+		return server.ListenAndServe()
 	}
-	log.Printf("listening on %s", addr)
-	if err := http.ListenAndServe(addr, srv); err != nil {
+	if tlsCfg != nil {
+		if cfg.TLSRedirectAddr != "" {
+			go func() {
+				log.Printf("redirecting HTTP on %s to HTTPS", cfg.TLSRedirectAddr)
+				if err := redirectServer(cfg, challenge).ListenAndServe(); err != nil {
+					log.Fatal(err)
+				}
+			}()
+		}
+		serve = func() error {
+			log.Printf("listening on %s (TLS)", cfg.Addr)
+			// Certificates come from tlsCfg.GetCertificate; HTTP/2 is negotiated over TLS
+			return server.ListenAndServeTLS("", "")
+		}
+	}
+
+	// SIGINT/SIGTERM drain in-flight requests, then stop notification delivery
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- serve() }()
+	select {
+	case err := <-served:
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if err := handler.Shutdown(shutdownCtx); err != nil {
+		log.Printf("notifications shutdown: %v", err)
 	}
 }
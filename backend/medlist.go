@@ -0,0 +1,156 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// defaultLetterhead heads printed documents unless PDF_LETTERHEAD says otherwise
+const defaultLetterhead = "HealthCare Portal"
+
+// medListColumn is one column of the medication list table
+type medListColumn struct {
+    title string
+    x, w  float64
+    cell  func(Prescription) string
+}
+
+var medListColumns = []medListColumn{
+    {"Drug", 50, 108, func(p Prescription) string { return p.DrugName }},
+    {"Dose", 164, 90, medListDose},
+    {"Sig", 260, 148, func(p Prescription) string { return p.Sig }},
+    {"Prescriber", 414, 88, func(p Prescription) string { return p.PhysicianName }},
+    {"Date", 508, 54, func(p Prescription) string { return p.PrescribedAt.UTC().Format("2006-01-02") }},
+}
+
+// medListDose is the structured dose, if any, over the dispensed quantity and refills
+func medListDose(p Prescription) string {
+    var lines []string
+    if d := p.Dosage; d != nil {
+        dose := strconv.FormatFloat(d.Amount, 'f', -1, 64) + " " + d.Unit + " " + d.Route + " " + d.Frequency
+        if d.DurationDays > 0 { dose += " for " + strconv.Itoa(d.DurationDays) + " days" }
+        lines = append(lines, dose)
+    }
+    qty := "Qty " + strconv.Itoa(p.Quantity)
+    if p.Refills > 0 { qty += ", " + strconv.Itoa(p.Refills) + " refills" }
+    return strings.Join(append(lines, qty), "\n")
+}
+
+// renderMedicationList lays out a patient's medication list. Letterhead lines are
+// separated by "|"; the first is the clinic name.
+func renderMedicationList(letterhead, patient, docID string, items []Prescription, now time.Time) []byte {
+    const (
+        left, right = 50.0, 562.0
+        bottom      = 60.0
+        size        = 9.0
+        leading     = 11.0
+    )
+    doc := &pdfDoc{title: "Medication list - " + patient}
+    var y float64
+    header := func() {
+        doc.addPage()
+        y = 740
+        for i, line := range strings.Split(letterhead, "|") {
+            if i == 0 {
+                doc.text(left, y, 16, true, strings.TrimSpace(line))
+                y -= 14
+                continue
+            }
+            doc.text(left, y, 9, false, strings.TrimSpace(line))
+            y -= 11
+        }
+        y -= 4
+        doc.rule(left, right, y, 1)
+        y -= 22
+        doc.text(left, y, 13, true, "Medication list")
+        y -= 15
+        doc.text(left, y, 10, false, "Patient: "+patient)
+        y -= 12
+        doc.text(left, y, 10, false, "Active prescriptions as of "+now.UTC().Format("2006-01-02 15:04 UTC"))
+        y -= 22
+        for _, c := range medListColumns { doc.text(c.x, y, size, true, c.title) }
+        y -= 4
+        doc.rule(left, right, y, 0.5)
+        y -= leading
+    }
+    header()
+    if len(items) == 0 { doc.text(left, y, size, false, "No active prescriptions.") }
+    for _, p := range items {
+        cells := make([][]string, len(medListColumns))
+        rows := 1
+        for i, c := range medListColumns {
+            cells[i] = pdfWrap(c.cell(p), size, c.w)
+            rows = max(rows, len(cells[i]))
+        }
+        if y-float64(rows-1)*leading < bottom { header() }
+        for i, c := range medListColumns {
+            for j, line := range cells[i] { doc.text(c.x, y-float64(j)*leading, size, false, line) }
+        }
+        y -= float64(rows-1)*leading + 4
+        doc.rule(left, right, y, 0.25)
+        y -= leading
+    }
+    // Page numbers need the final page count
+    for i := range doc.pages {
+        doc.cur = i
+        doc.text(left, 36, 7, false, "Document "+docID)
+        doc.text(right-40, 36, 7, false, "Page "+strconv.Itoa(i+1)+" of "+strconv.Itoa(len(doc.pages)))
+    }
+    return doc.bytes(now)
+}
+
+// handleMedicationListPDF serves GET /patients/{id}/prescriptions.pdf, the patient's
+// active prescriptions as a printable medication list. Access follows GET /prescriptions:
+// physicians see only what they prescribed, and only with the patient's consent (403
+// otherwise), pharmacists what was routed to them, and patients only their own list.
+// Like exports, each document gets provenance.
+func (s *Server) handleMedicationListPDF(w http.ResponseWriter, r *http.Request, patientID int64) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    p, scope, ok := s.permit(w, r, ActPrescriptionList)
+    if !ok { return }
+    filter, ok := prescriptionFilterFor(w, r, p, scope)
+    if !ok { return }
+    if filter.PatientID != nil && *filter.PatientID != patientID {
+        writeError(w, http.StatusForbidden, "patients may only view themselves")
+        return
+    }
+    if scope == ScopeOwn && p.Owns == OwnsPhysician && !s.authorizePhysicianAccess(w, r, p.UserID, patientID, ConsentPrescriptions) { return }
+    filter.PatientID = &patientID
+
+    var items []Prescription
+    err := s.repo.StreamPrescriptions(r.Context(), filter, exportDefaultMaxRows, func(p Prescription) error {
+        if p.Status == PrescriptionActive { items = append(items, p) }
+        return nil
+    })
+    if err != nil { writeError(w, http.StatusInternalServerError, "failed to list prescriptions"); return }
+    // The name comes from the rows the caller may see, so an empty list reveals nothing
+    patient := "#" + strconv.FormatInt(patientID, 10)
+    if len(items) > 0 { patient = items[0].PatientName + " (" + patient + ")" }
+
+    docID := newRandomID("doc_")
+    body := renderMedicationList(s.cfg.PDFLetterhead, patient, docID, items, time.Now())
+    sum := sha256.Sum256(body)
+    doc := &DocumentProvenance{
+        DocumentID: docID, Kind: "medication_list", Format: "pdf", RequestID: requestID(r.Context()),
+        Actor: auditActor(r), Params: "patient_id=" + strconv.FormatInt(patientID, 10), Rows: len(items), SHA256: hex.EncodeToString(sum[:]),
+    }
+    if err := s.repo.RecordProvenance(context.WithoutCancel(r.Context()), doc); err != nil {
+        log.Printf("medication list: recording provenance of %s failed: %v", docID, err)
+    }
+    w.Header().Set("Content-Type", "application/pdf")
+    w.Header().Set("Content-Disposition", `inline; filename="medication-list-`+strconv.FormatInt(patientID, 10)+`.pdf"`)
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("X-Document-ID", docID)
+    w.WriteHeader(http.StatusOK)
+    _, _ = w.Write(body)
+}
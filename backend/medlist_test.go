@@ -0,0 +1,89 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+// checkPDFStructure verifies the xref table points at each object
+func checkPDFStructure(t *testing.T, b []byte) {
+    t.Helper()
+    if !bytes.HasPrefix(b, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) { t.Fatalf("not a PDF: %q", b[:min(len(b), 40)]) }
+    m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(b)
+    if m == nil { t.Fatalf("no startxref") }
+    xref, _ := strconv.Atoi(string(m[1]))
+    if !bytes.HasPrefix(b[xref:], []byte("xref\n")) { t.Fatalf("startxref %d doesn't point at the xref table", xref) }
+    entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(b[xref:], -1)
+    for i, e := range entries {
+        off, _ := strconv.Atoi(string(e[1]))
+        if want := strconv.Itoa(i+1) + " 0 obj\n"; !bytes.HasPrefix(b[off:], []byte(want)) { t.Fatalf("xref entry %d points at %q", i+1, b[off:off+10]) }
+    }
+}
+
+func TestMedicationListPDF(t *testing.T) {
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        userID       string
+        expectStatus int
+        expectText   []string
+    }{
+        {name: "patient own list", path: "/v1/patients/1/prescriptions.pdf", role: "patient", userID: "1", expectStatus: http.StatusOK, expectText: []string{`(Patient: Alice \(#1\))`, "(Dr. Smith)"}},
+        {name: "admin", path: "/patients/1/prescriptions.pdf", role: "admin", userID: "1", expectStatus: http.StatusOK, expectText: []string{"(Medication list)"}},
+        {name: "other physician", path: "/patients/1/prescriptions.pdf", role: "physician", userID: "2", expectStatus: http.StatusForbidden},
+        {name: "other patient", path: "/patients/2/prescriptions.pdf", role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "unauthenticated", path: "/patients/1/prescriptions.pdf", expectStatus: http.StatusUnauthorized},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            repo := newDemoMemoryRepo()
+            srv := NewServer(repo, defaultConfig())
+            rr := consentRequest(srv, http.MethodGet, tc.path, "", tc.role, tc.userID)
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if rr.Code != http.StatusOK { return }
+            body := rr.Body.Bytes()
+            if rr.Header().Get("Content-Type") != "application/pdf" { t.Fatalf("Content-Type = %q", rr.Header().Get("Content-Type")) }
+            checkPDFStructure(t, body)
+            for _, want := range tc.expectText {
+                if !bytes.Contains(body, []byte(want)) { t.Fatalf("PDF lacks %s", want) }
+            }
+            sum := sha256.Sum256(body)
+            doc, err := repo.FindProvenanceBySHA256(context.Background(), hex.EncodeToString(sum[:]))
+            if err != nil || doc.DocumentID != rr.Header().Get("X-Document-ID") || doc.Kind != "medication_list" { t.Fatalf("provenance = %+v, %v", doc, err) }
+        })
+    }
+}
+
+func TestRenderMedicationList(t *testing.T) {
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(60)
+    m, ids := fixtureMemory(f)
+    alice := ids.Patients["Alice"]
+    items, _ := m.ListPrescriptions(context.Background(), ListPrescriptionsFilter{PatientID: &alice, Limit: 100})
+    items[0].Sig = "Take one tablet (500 mg) by mouth every eight hours with food until the course is finished"
+
+    out := renderMedicationList("Northside Clinic|1 Main St, Springfield", "Alice (#1)", "doc_1", items, time.Now())
+    checkPDFStructure(t, out)
+    pages := bytes.Count(out, []byte("/Type /Page "))
+    if pages < 2 || !bytes.Contains(out, []byte("(Page "+strconv.Itoa(pages)+" of "+strconv.Itoa(pages)+")")) { t.Fatalf("pages = %d", pages) }
+    // The letterhead repeats on every page; the long sig wraps within its column
+    if n := bytes.Count(out, []byte("(Northside Clinic)")); n != pages { t.Fatalf("letterhead on %d of %d pages", n, pages) }
+    if !bytes.Contains(out, []byte(`(Take one tablet \(500 mg\) by mouth)`)) { t.Fatalf("sig not wrapped/escaped") }
+
+    for _, line := range pdfWrap(items[0].Sig+"\nSupercalifragilisticexpialidocious-extended", 9, 60) {
+        if pdfTextWidth(line, 9) > 60 { t.Fatalf("line %q exceeds the column", line) }
+    }
+    if got := pdfEscape("Café – ok"); got != `Caf\351 ? ok` { t.Fatalf("escape = %q", got) }
+    if strings.Contains(string(out), "\x00") { t.Fatalf("binary in content") }
+}
@@ -0,0 +1,1688 @@
+package main
+
+import (
+    "context"
+    "maps"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode"
+)
+
+// memoryRepo is a fully functional in-memory Repository used when no database
+// is configured (and for demo mode via DEMO_MODE=1). Data is lost on restart.
+type memoryRepo struct {
+    mu sync.RWMutex
+    // txMu serializes InTx calls
+    txMu sync.Mutex
+    memoryState
+}
+
+// memoryState is everything a memoryRepo stores, split out so InTx can snapshot it
+type memoryState struct {
+    patients      map[int64]Patient
+    physicians    map[int64]Physician
+    drugs         map[int64]Drug
+    links         map[memoryLink]bool
+    prescriptions map[int64]Prescription
+    idempotency   map[memoryIdemKey]IdempotencyRecord
+    pharmacies    map[int64]Pharmacy
+    webhooks      map[int64]WebhookEndpoint
+    deliveries    []WebhookDelivery
+    // deleted holds soft-delete timestamps, keyed like deleted_at columns
+    deleted       map[memoryRef]time.Time
+    anonymized    map[int64]bool
+    // patientCreated mirrors patients.created_at, which retention measures inactivity from
+    patientCreated map[int64]time.Time
+    audit         []AuditEntry
+    provenance    map[string]DocumentProvenance
+    comments      []PrescriptionComment
+    attachments   []PrescriptionAttachment
+    nurses        map[int64]Nurse
+    demographics  map[int64]PatientDemographics
+    delegations   map[memoryDelegation]bool
+    consents      map[int64]Consent
+    orgs          map[int64]Organization
+    // orgAdmins holds org admin names, keyed by id; their organization is in rowOrg
+    orgAdmins     map[int64]string
+    // rowOrg holds the org_id of rows outside the default organization
+    rowOrg        map[memoryRef]int64
+    // mrns indexes patients registered by an HL7 feed, like patients(org_id, mrn)
+    mrns          map[memoryMRN]int64
+    quarantine    []HL7QuarantinedMessage
+    notificationPrefs map[int64]NotificationPreferences
+    // icdCodes maps ICD-10-CM codes to descriptions
+    icdCodes      map[string]string
+    // seq mirrors the per-table BIGSERIAL sequences in Postgres
+    seq map[string]int64
+}
+
+// clone copies s deeply enough that changes to the copy never show through; stored values
+// are replaced rather than mutated in place, so copying the maps and slices is enough
+func (s memoryState) clone() memoryState {
+    s.patients = maps.Clone(s.patients)
+    s.physicians = maps.Clone(s.physicians)
+    s.drugs = maps.Clone(s.drugs)
+    s.links = maps.Clone(s.links)
+    s.prescriptions = maps.Clone(s.prescriptions)
+    s.idempotency = maps.Clone(s.idempotency)
+    s.pharmacies = maps.Clone(s.pharmacies)
+    s.webhooks = maps.Clone(s.webhooks)
+    s.deliveries = slices.Clone(s.deliveries)
+    s.deleted = maps.Clone(s.deleted)
+    s.anonymized = maps.Clone(s.anonymized)
+    s.patientCreated = maps.Clone(s.patientCreated)
+    s.audit = slices.Clone(s.audit)
+    s.provenance = maps.Clone(s.provenance)
+    s.comments = slices.Clone(s.comments)
+    s.attachments = slices.Clone(s.attachments)
+    s.nurses = maps.Clone(s.nurses)
+    s.demographics = maps.Clone(s.demographics)
+    s.delegations = maps.Clone(s.delegations)
+    s.consents = maps.Clone(s.consents)
+    s.orgs = maps.Clone(s.orgs)
+    s.orgAdmins = maps.Clone(s.orgAdmins)
+    s.rowOrg = maps.Clone(s.rowOrg)
+    s.mrns = maps.Clone(s.mrns)
+    s.quarantine = slices.Clone(s.quarantine)
+    s.notificationPrefs = maps.Clone(s.notificationPrefs)
+    s.icdCodes = maps.Clone(s.icdCodes)
+    s.seq = maps.Clone(s.seq)
+    return s
+}
+
+type memoryTxKey struct{}
+
+// InTx runs transactions one at a time. A failed one puts back the state from when it
+// began, which also undoes writes made meanwhile outside any transaction; that is fine
+// for the tests and demos this repository serves.
+func (m *memoryRepo) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+    if ctx.Value(memoryTxKey{}) == nil {
+        m.txMu.Lock()
+        defer m.txMu.Unlock()
+        ctx = context.WithValue(ctx, memoryTxKey{}, true)
+    }
+    m.mu.RLock()
+    snapshot := m.memoryState.clone()
+    m.mu.RUnlock()
+    committed := false
+    defer func() {
+        if committed { return }
+        m.mu.Lock()
+        m.memoryState = snapshot
+        m.mu.Unlock()
+    }()
+    if err := fn(ctx); err != nil { return err }
+    committed = true
+    return nil
+}
+
+type memoryLink struct{ physicianID, patientID int64 }
+
+type memoryDelegation struct{ physicianID, nurseID int64 }
+
+type memoryIdemKey struct{ scope, key string }
+
+type memoryMRN struct {
+    orgID int64
+    mrn   string
+}
+
+// memoryRef identifies a row by table name and id
+type memoryRef struct {
+    table string
+    id    int64
+}
+
+// isDeleted reports whether a row is soft-deleted; callers must hold mu.
+func (m *memoryRepo) isDeleted(table string, id int64) bool {
+    _, ok := m.deleted[memoryRef{table, id}]
+    return ok
+}
+
+// orgOf returns the organization of a row, or of a prescription's patient; callers must
+// hold mu.
+func (m *memoryRepo) orgOf(table string, id int64) int64 {
+    if table == "prescriptions" { table, id = "patients", m.prescriptions[id].PatientID }
+    if org, ok := m.rowOrg[memoryRef{table, id}]; ok { return org }
+    return defaultOrgID
+}
+
+// outsideOrg reports whether a row belongs to another organization than the one ctx is
+// scoped to; callers must hold mu.
+func (m *memoryRepo) outsideOrg(ctx context.Context, table string, id int64) bool {
+    org, ok := orgFromContext(ctx)
+    return ok && m.orgOf(table, id) != org
+}
+
+// hidden reports whether a row is soft-deleted or outside ctx's organization, the rows
+// Postgres filters out with deleted_at and org_id predicates; callers must hold mu.
+func (m *memoryRepo) hidden(ctx context.Context, table string, id int64) bool {
+    return m.isDeleted(table, id) || m.outsideOrg(ctx, table, id)
+}
+
+func newMemoryRepo() *memoryRepo {
+    return &memoryRepo{memoryState: memoryState{
+        patients:      map[int64]Patient{},
+        physicians:    map[int64]Physician{},
+        drugs:         map[int64]Drug{},
+        links:         map[memoryLink]bool{},
+        prescriptions: map[int64]Prescription{},
+        idempotency:   map[memoryIdemKey]IdempotencyRecord{},
+        pharmacies:    map[int64]Pharmacy{},
+        webhooks:      map[int64]WebhookEndpoint{},
+        deleted:       map[memoryRef]time.Time{},
+        anonymized:    map[int64]bool{},
+        patientCreated: map[int64]time.Time{},
+        nurses:        map[int64]Nurse{},
+        demographics:  map[int64]PatientDemographics{},
+        delegations:   map[memoryDelegation]bool{},
+        provenance:    map[string]DocumentProvenance{},
+        consents:      map[int64]Consent{},
+        orgs:          map[int64]Organization{defaultOrgID: {ID: defaultOrgID, Name: "Default clinic", CreatedAt: time.Now().UTC()}},
+        orgAdmins:     map[int64]string{},
+        rowOrg:        map[memoryRef]int64{},
+        mrns:          map[memoryMRN]int64{},
+        notificationPrefs: map[int64]NotificationPreferences{},
+        icdCodes:      starterICDCodes(),
+        seq:           map[string]int64{"organizations": defaultOrgID},
+    }}
+}
+
+// newDemoMemoryRepo returns a memoryRepo pre-seeded with the same shape of data
+// as db/seed.sql, plus a few extra records so the UI has something to show.
+func newDemoMemoryRepo() *memoryRepo {
+    m := newMemoryRepo()
+    alice := m.addPatient("Alice")
+    bob := m.addPatient("Bob")
+    carol := m.addPatient("Carol")
+    m.demographics[alice] = PatientDemographics{BirthDate: "1985-04-12", Sex: "female", Phone: "555-0101", Email: "alice@example.com", Address: "12 Oak Ave"}
+    m.demographics[bob] = PatientDemographics{BirthDate: "1972-11-30", Sex: "male", Phone: "555-0102"}
+    smith := m.addPhysician("Dr. Smith")
+    jones := m.addPhysician("Dr. Jones")
+    amox := m.addDrug("Amoxicillin")
+    ibu := m.addDrug("Ibuprofen")
+    met := m.addDrug("Metformin")
+    lis := m.addDrug("Lisinopril")
+    oxy := m.addDrug("Oxycodone")
+    m.drugs[oxy] = Drug{ID: oxy, Name: "Oxycodone", Schedule: ScheduleII}
+    m.setDrugRules(ibu, DispensingRules{DispenseUnit: "{tablet}", Strength: 200, StrengthUnit: "mg", MaxDailyDose: 3200, MaxDailyDoseUnit: "mg"})
+    m.setDrugRules(met, DispensingRules{DispenseUnit: "{tablet}", Strength: 500, StrengthUnit: "mg", MaxDailyDose: 2550, MaxDailyDoseUnit: "mg"})
+    m.setDrugRules(lis, DispensingRules{DispenseUnit: "{tablet}", Strength: 10, StrengthUnit: "mg", MaxDailyDose: 80, MaxDailyDoseUnit: "mg"})
+
+    m.addPharmacy(Pharmacy{Name: "Main Street Pharmacy", Address: "100 Main St"})
+
+    m.addLink(smith, alice)
+    m.addLink(smith, bob)
+    m.addLink(jones, bob)
+    m.addLink(jones, carol)
+
+    taylor := m.addNurse("Nurse Taylor")
+    m.delegations[memoryDelegation{smith, taylor}] = true
+    m.addOrgAdmin("Clinic Admin", defaultOrgID)
+
+    now := time.Now().UTC()
+    day := 24 * time.Hour
+    m.addPrescription(Prescription{PatientID: alice, PhysicianID: smith, DrugID: amox, Quantity: 20, Sig: "1 tab BID", PrescribedAt: now.Add(-3 * day), DiagnosisCode: "J02.9"})
+    m.addPrescription(Prescription{PatientID: alice, PhysicianID: smith, DrugID: ibu, Quantity: 30, Sig: "PRN pain", PrescribedAt: now.Add(-2 * day)})
+    m.addPrescription(Prescription{PatientID: bob, PhysicianID: jones, DrugID: met, Quantity: 60, Sig: "500mg BID", PrescribedAt: now.Add(-1 * day), DiagnosisCode: "E11.9"})
+    m.addPrescription(Prescription{PatientID: carol, PhysicianID: jones, DrugID: lis, Quantity: 30, Sig: "10mg daily", PrescribedAt: now.Add(-5 * day), DiagnosisCode: "I10"})
+    return m
+}
+
+// loadSynthetic adds a generated dataset on top of whatever the repo already holds and
+// returns the ids assigned to its rows
+func (m *memoryRepo) loadSynthetic(ds SyntheticDataset) SyntheticIDs {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    ids := SyntheticIDs{
+        Patients:   make([]int64, len(ds.Patients)),
+        Physicians: make([]int64, len(ds.Physicians)),
+        Drugs:      make([]int64, len(ds.Drugs)),
+    }
+    for i, name := range ds.Patients { ids.Patients[i] = m.addPatient(name) }
+    for i, name := range ds.Physicians { ids.Physicians[i] = m.addPhysician(name) }
+    for i, name := range ds.Drugs {
+        ids.Drugs[i] = m.findDrug(name)
+        if ids.Drugs[i] == 0 { ids.Drugs[i] = m.addDrug(name) }
+    }
+    for _, l := range ds.Links {
+        m.addLink(ids.Physicians[l[0]], ids.Patients[l[1]])
+    }
+    for _, sp := range ds.Prescriptions {
+        m.addPrescription(Prescription{
+            PatientID: ids.Patients[sp.PatientIdx], PhysicianID: ids.Physicians[sp.PhysicianIdx], DrugID: ids.Drugs[sp.DrugIdx],
+            Quantity: sp.Quantity, Sig: sp.Sig, PrescribedAt: sp.PrescribedAt,
+        })
+    }
+    return ids
+}
+
+// findDrug returns the id of a drug by exact name, or 0; callers must hold mu.
+func (m *memoryRepo) findDrug(name string) int64 {
+    for id, d := range m.drugs {
+        if d.Name == name { return id }
+    }
+    return 0
+}
+
+// nextID allocates the next identifier for a table; callers must hold mu.
+func (m *memoryRepo) nextID(table string) int64 {
+    m.seq[table]++
+    return m.seq[table]
+}
+
+func (m *memoryRepo) addPatient(name string) int64 {
+    id := m.nextID("patients")
+    m.patients[id] = Patient{ID: id, Name: name}
+    m.patientCreated[id] = time.Now().UTC()
+    return id
+}
+
+func (m *memoryRepo) addPhysician(name string) int64 {
+    id := m.nextID("physicians")
+    m.physicians[id] = Physician{ID: id, Name: name}
+    return id
+}
+
+func (m *memoryRepo) addDrug(name string) int64 {
+    id := m.nextID("drugs")
+    m.drugs[id] = Drug{ID: id, Name: name}
+    return id
+}
+
+func (m *memoryRepo) setDrugRules(id int64, rules DispensingRules) {
+    d := m.drugs[id]
+    d.Rules = &rules
+    m.drugs[id] = d
+}
+
+func (m *memoryRepo) addNurse(name string) int64 {
+    id := m.nextID("nurses")
+    m.nurses[id] = Nurse{ID: id, Name: name}
+    return id
+}
+
+func (m *memoryRepo) addPharmacy(p Pharmacy) int64 {
+    p.ID = m.nextID("pharmacies")
+    m.pharmacies[p.ID] = p
+    return p.ID
+}
+
+func (m *memoryRepo) addOrgAdmin(name string, orgID int64) int64 {
+    id := m.nextID("org_admins")
+    m.orgAdmins[id] = name
+    if orgID != defaultOrgID { m.rowOrg[memoryRef{"org_admins", id}] = orgID }
+    return id
+}
+
+func (m *memoryRepo) addPrescription(p Prescription) int64 {
+    p.ID = m.nextID("prescriptions")
+    if p.Status == "" { p.Status = PrescriptionActive }
+    m.prescriptions[p.ID] = p
+    return p.ID
+}
+
+// hydrate fills in the display names the Postgres implementation gets from joins.
+func (m *memoryRepo) hydrate(p Prescription) Prescription {
+    p.PatientName = m.patients[p.PatientID].Name
+    p.PhysicianName = m.physicians[p.PhysicianID].Name
+    p.DrugName = m.drugs[p.DrugID].Name
+    if p.PharmacyID != nil { p.PharmacyName = m.pharmacies[*p.PharmacyID].Name }
+    p.DiagnosisDescription = m.icdCodes[p.DiagnosisCode]
+    return p
+}
+
+func (m *memoryRepo) CreatePrescription(ctx context.Context, p *Prescription) (*Prescription, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, okPatient := m.patients[p.PatientID]
+    _, okPhysician := m.physicians[p.PhysicianID]
+    _, okDrug := m.drugs[p.DrugID]
+    if !okPatient || !okPhysician || !okDrug || !m.sameOrg(ctx, p.PhysicianID, p.PatientID) ||
+        m.isDeleted("patients", p.PatientID) || m.isDeleted("physicians", p.PhysicianID) {
+        return nil, ErrInvalidReference
+    }
+    // Pharmacies and nurses must share the patient's organization, like the composite FKs
+    org := m.orgOf("patients", p.PatientID)
+    if p.PharmacyID != nil {
+        if _, ok := m.pharmacies[*p.PharmacyID]; !ok || m.orgOf("pharmacies", *p.PharmacyID) != org { return nil, ErrInvalidReference }
+    }
+    if p.DraftedBy != nil {
+        if _, ok := m.nurses[*p.DraftedBy]; !ok || m.orgOf("nurses", *p.DraftedBy) != org { return nil, ErrInvalidReference }
+    }
+    if _, ok := m.icdCodes[p.DiagnosisCode]; p.DiagnosisCode != "" && !ok { return nil, ErrInvalidReference }
+    p.PrescribedAt = time.Now().UTC()
+    p.ExpiresAt = nil
+    if p.Dosage != nil && p.Dosage.DurationDays > 0 {
+        exp := p.PrescribedAt.AddDate(0, 0, p.Dosage.DurationDays)
+        p.ExpiresAt = &exp
+    }
+    if p.Status == "" { p.Status = PrescriptionActive }
+    p.ID = m.addPrescription(*p)
+    return p, nil
+}
+
+func (m *memoryRepo) TopDrugs(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]TopDrug, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    totals := map[int64]int64{}
+    for _, p := range m.prescriptions {
+        if p.PrescribedAt.Before(from) || !p.PrescribedAt.Before(to) || m.hidden(ctx, "prescriptions", p.ID) || p.Status == PrescriptionPendingSignature { continue }
+        if patientID != nil && p.PatientID != *patientID { continue }
+        totals[p.DrugID] += int64(p.Quantity)
+    }
+    out := make([]TopDrug, 0, len(totals))
+    for id, qty := range totals {
+        out = append(out, TopDrug{DrugID: id, DrugName: m.drugs[id].Name, TotalQty: qty})
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].TotalQty != out[j].TotalQty { return out[i].TotalQty > out[j].TotalQty }
+        return out[i].DrugID < out[j].DrugID
+    })
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+func (m *memoryRepo) TopDrugsByDiagnosis(ctx context.Context, from, to time.Time, limit, perDiagnosis int, patientID *int64) ([]DiagnosisTopDrugs, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    type key struct {
+        code string
+        drug int64
+    }
+    totals := map[key]int64{}
+    for _, p := range m.prescriptions {
+        if p.PrescribedAt.Before(from) || !p.PrescribedAt.Before(to) || m.hidden(ctx, "prescriptions", p.ID) || p.Status == PrescriptionPendingSignature { continue }
+        if patientID != nil && p.PatientID != *patientID { continue }
+        totals[key{p.DiagnosisCode, p.DrugID}] += int64(p.Quantity)
+    }
+    byCode := map[string]*DiagnosisTopDrugs{}
+    for k, qty := range totals {
+        g, ok := byCode[k.code]
+        if !ok {
+            g = &DiagnosisTopDrugs{DiagnosisCode: k.code, DiagnosisDescription: m.icdCodes[k.code]}
+            byCode[k.code] = g
+        }
+        g.TotalQty += qty
+        g.Drugs = append(g.Drugs, TopDrug{DrugID: k.drug, DrugName: m.drugs[k.drug].Name, TotalQty: qty})
+    }
+    out := make([]DiagnosisTopDrugs, 0, len(byCode))
+    for _, g := range byCode {
+        sort.Slice(g.Drugs, func(i, j int) bool {
+            if g.Drugs[i].TotalQty != g.Drugs[j].TotalQty { return g.Drugs[i].TotalQty > g.Drugs[j].TotalQty }
+            return g.Drugs[i].DrugID < g.Drugs[j].DrugID
+        })
+        if len(g.Drugs) > perDiagnosis { g.Drugs = g.Drugs[:perDiagnosis] }
+        out = append(out, *g)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].TotalQty != out[j].TotalQty { return out[i].TotalQty > out[j].TotalQty }
+        return out[i].DiagnosisCode < out[j].DiagnosisCode
+    })
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+// truncateTime mirrors Postgres date_trunc in UTC (weeks start on Monday)
+func truncateTime(t time.Time, bucket string) time.Time {
+    t = t.UTC()
+    y, mo, d := t.Date()
+    switch bucket {
+    case "month":
+        return time.Date(y, mo, 1, 0, 0, 0, 0, time.UTC)
+    case "week":
+        day := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+        offset := (int(day.Weekday()) + 6) % 7
+        return day.AddDate(0, 0, -offset)
+    default:
+        return time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+    }
+}
+
+func (m *memoryRepo) PrescriptionsOverTime(ctx context.Context, from, to time.Time, bucket string, patientID *int64) ([]TimeBucket, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    byStart := map[time.Time]*TimeBucket{}
+    for _, p := range m.prescriptions {
+        if p.PrescribedAt.Before(from) || !p.PrescribedAt.Before(to) || m.hidden(ctx, "prescriptions", p.ID) || p.Status == PrescriptionPendingSignature { continue }
+        if patientID != nil && p.PatientID != *patientID { continue }
+        start := truncateTime(p.PrescribedAt, bucket)
+        b, ok := byStart[start]
+        if !ok {
+            b = &TimeBucket{BucketStart: start}
+            byStart[start] = b
+        }
+        b.Count++
+        b.TotalQty += int64(p.Quantity)
+    }
+    out := make([]TimeBucket, 0, len(byStart))
+    for _, b := range byStart { out = append(out, *b) }
+    sort.Slice(out, func(i, j int) bool { return out[i].BucketStart.Before(out[j].BucketStart) })
+    return out, nil
+}
+
+func (m *memoryRepo) PhysicianVolume(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]PhysicianVolume, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    byPhysician := map[int64]*PhysicianVolume{}
+    patients := map[memoryLink]bool{}
+    for _, p := range m.prescriptions {
+        if p.PrescribedAt.Before(from) || !p.PrescribedAt.Before(to) || m.hidden(ctx, "prescriptions", p.ID) || p.Status == PrescriptionPendingSignature { continue }
+        if patientID != nil && p.PatientID != *patientID { continue }
+        v, ok := byPhysician[p.PhysicianID]
+        if !ok {
+            v = &PhysicianVolume{PhysicianID: p.PhysicianID, PhysicianName: m.physicians[p.PhysicianID].Name}
+            byPhysician[p.PhysicianID] = v
+        }
+        v.Prescriptions++
+        if l := (memoryLink{p.PhysicianID, p.PatientID}); !patients[l] {
+            patients[l] = true
+            v.DistinctPatients++
+        }
+    }
+    out := make([]PhysicianVolume, 0, len(byPhysician))
+    for _, v := range byPhysician { out = append(out, *v) }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Prescriptions != out[j].Prescriptions { return out[i].Prescriptions > out[j].Prescriptions }
+        return out[i].PhysicianID < out[j].PhysicianID
+    })
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+func (m *memoryRepo) Stats(ctx context.Context, now time.Time, topN int) (*AdminStats, error) {
+    week, month := truncateTime(now, "week"), truncateTime(now, "month")
+    m.mu.RLock()
+    st := &AdminStats{}
+    for id := range m.patients {
+        if !m.hidden(ctx, "patients", id) { st.Patients++ }
+    }
+    for id := range m.physicians {
+        if !m.hidden(ctx, "physicians", id) { st.Physicians++ }
+    }
+    for _, p := range m.prescriptions {
+        if m.hidden(ctx, "prescriptions", p.ID) || p.Status == PrescriptionPendingSignature { continue }
+        st.Prescriptions++
+        if !p.PrescribedAt.Before(week) { st.PrescriptionsThisWeek++ }
+        if !p.PrescribedAt.Before(month) { st.PrescriptionsThisMonth++ }
+    }
+    m.mu.RUnlock()
+    if st.Patients > 0 { st.AvgPrescriptionsPerPatient = float64(st.Prescriptions) / float64(st.Patients) }
+    top, err := m.PhysicianVolume(ctx, month, month.AddDate(0, 1, 0), topN, nil)
+    if err != nil { return nil, err }
+    st.TopPrescribers = top
+    return st, nil
+}
+
+func (m *memoryRepo) IsPhysicianPatientLinked(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    if m.hidden(ctx, "patients", patientID) || m.hidden(ctx, "physicians", physicianID) { return false, nil }
+    if m.orgOf("patients", patientID) != m.orgOf("physicians", physicianID) { return false, nil }
+    return m.links[memoryLink{physicianID, patientID}], nil
+}
+
+func (m *memoryRepo) ListPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) ([]Prescription, error) {
+    limit := filter.Limit
+    if limit <= 0 || limit > 200 {
+        limit = 50
+    }
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := m.matchPrescriptions(ctx, filter)
+    sortPrescriptions(out, filter)
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+func (m *memoryRepo) CountPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) (int, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return len(m.matchPrescriptions(ctx, filter)), nil
+}
+
+// sortPrescriptions orders items as prescriptionOrder does in SQL
+func sortPrescriptions(items []Prescription, filter ListPrescriptionsFilter) {
+    cmp := func(a, b Prescription) int {
+        switch filter.Sort {
+        case "quantity":
+            return a.Quantity - b.Quantity
+        case "drug_name":
+            return strings.Compare(strings.ToLower(a.DrugName), strings.ToLower(b.DrugName))
+        }
+        return a.PrescribedAt.Compare(b.PrescribedAt)
+    }
+    sort.SliceStable(items, func(i, j int) bool {
+        c := cmp(items[i], items[j])
+        if c == 0 {
+            if items[i].ID < items[j].ID { c = -1 } else if items[i].ID > items[j].ID { c = 1 }
+        }
+        if filter.Ascending { return c < 0 }
+        return c > 0
+    })
+}
+
+// matchPrescriptions returns hydrated prescriptions matching filter, newest first; callers must hold mu.
+func (m *memoryRepo) matchPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) []Prescription {
+    out := []Prescription{}
+    for _, p := range m.prescriptions {
+        if m.hidden(ctx, "prescriptions", p.ID) || m.hidden(ctx, "patients", p.PatientID) { continue }
+        if filter.PatientID != nil && p.PatientID != *filter.PatientID { continue }
+        if filter.PhysicianID != nil && p.PhysicianID != *filter.PhysicianID { continue }
+        if filter.PhysicianID != nil && filter.ConsentScope != "" && !m.consented(p.PhysicianID, p.PatientID, filter.ConsentScope) { continue }
+        if filter.PharmacyID != nil && (p.PharmacyID == nil || *p.PharmacyID != *filter.PharmacyID) { continue }
+        if filter.DraftedBy != nil && (p.DraftedBy == nil || *p.DraftedBy != *filter.DraftedBy) { continue }
+        if filter.ExcludePending && p.Status == PrescriptionPendingSignature { continue }
+        out = append(out, m.hydrate(p))
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if !out[i].PrescribedAt.Equal(out[j].PrescribedAt) { return out[i].PrescribedAt.After(out[j].PrescribedAt) }
+        return out[i].ID > out[j].ID
+    })
+    return out
+}
+
+func (m *memoryRepo) StreamPrescriptions(ctx context.Context, filter ListPrescriptionsFilter, maxRows int, fn func(Prescription) error) error {
+    m.mu.RLock()
+    items := m.matchPrescriptions(ctx, filter)
+    m.mu.RUnlock()
+    if maxRows > 0 && len(items) > maxRows { items = items[:maxRows] }
+    for _, p := range items {
+        if err := fn(p); err != nil { return err }
+    }
+    return nil
+}
+
+func (m *memoryRepo) ListPatientsForPhysician(ctx context.Context, physicianID int64) ([]Patient, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return m.patientsForPhysician(ctx, physicianID), nil
+}
+
+func (m *memoryRepo) ListPatientsForPhysicians(ctx context.Context, physicianIDs []int64) (map[int64][]Patient, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := map[int64][]Patient{}
+    for _, id := range physicianIDs {
+        if panel := m.patientsForPhysician(ctx, id); len(panel) > 0 { out[id] = panel }
+    }
+    return out, nil
+}
+
+// patientsForPhysician lists a physician's linked patients by name; callers must hold mu.
+func (m *memoryRepo) patientsForPhysician(ctx context.Context, physicianID int64) []Patient {
+    out := []Patient{}
+    for l := range m.links {
+        if l.physicianID == physicianID && !m.hidden(ctx, "patients", l.patientID) {
+            out = append(out, m.patients[l.patientID])
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Name != out[j].Name { return out[i].Name < out[j].Name }
+        return out[i].ID < out[j].ID
+    })
+    return out
+}
+
+func (m *memoryRepo) FindOrCreateDrug(ctx context.Context, name string) (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if id := m.findDrug(name); id != 0 { return id, nil }
+    if id := m.findDrugFold(name); id != 0 { return id, nil }
+    return m.addDrug(name), nil
+}
+
+// findDrugFold returns the lowest id of a drug whose name matches case-insensitively, or 0; callers must hold mu.
+func (m *memoryRepo) findDrugFold(name string) int64 {
+    var best int64
+    for id, d := range m.drugs {
+        if strings.EqualFold(d.Name, name) && (best == 0 || id < best) { best = id }
+    }
+    return best
+}
+
+// trigrams approximates pg_trgm: lowercase alphanumeric words padded with two leading
+// spaces and one trailing space, split into three-character windows.
+func trigrams(s string) map[string]bool {
+    out := map[string]bool{}
+    words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+    for _, w := range words {
+        p := []rune("  " + w + " ")
+        for i := 0; i+3 <= len(p); i++ { out[string(p[i:i+3])] = true }
+    }
+    return out
+}
+
+// trigramSimilarity mirrors pg_trgm similarity(): shared trigrams over the union
+func trigramSimilarity(a, b string) float64 {
+    ta, tb := trigrams(a), trigrams(b)
+    if len(ta) == 0 || len(tb) == 0 { return 0 }
+    shared := 0
+    for t := range ta {
+        if tb[t] { shared++ }
+    }
+    return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func (m *memoryRepo) SearchDrugs(ctx context.Context, q string, limit int) ([]Drug, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    type scored struct {
+        d      Drug
+        prefix bool
+        sim    float64
+    }
+    var hits []scored
+    lq := strings.ToLower(q)
+    for _, d := range m.drugs {
+        name := d.Name
+        s := scored{d: d}
+        if q != "" {
+            s.prefix = strings.HasPrefix(strings.ToLower(name), lq)
+            s.sim = trigramSimilarity(name, q)
+            if !s.prefix && s.sim < 0.3 { continue }
+        }
+        hits = append(hits, s)
+    }
+    sort.Slice(hits, func(i, j int) bool {
+        a, b := hits[i], hits[j]
+        if a.prefix != b.prefix { return a.prefix }
+        if a.sim != b.sim { return a.sim > b.sim }
+        if a.d.Name != b.d.Name { return a.d.Name < b.d.Name }
+        return a.d.ID < b.d.ID
+    })
+    out := []Drug{}
+    for i := 0; i < len(hits) && i < limit; i++ { out = append(out, hits[i].d) }
+    return out, nil
+}
+
+func (m *memoryRepo) GetDrug(ctx context.Context, id int64) (*Drug, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    d, ok := m.drugs[id]
+    if !ok { return nil, ErrNotFound }
+    return &d, nil
+}
+
+func (m *memoryRepo) GetDrugs(ctx context.Context, ids []int64) ([]Drug, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var out []Drug
+    for _, id := range ids {
+        if d, ok := m.drugs[id]; ok { out = append(out, d) }
+    }
+    return out, nil
+}
+
+// nameRank scores name against q the way the Postgres name search orders it: whole-name
+// prefix, then word prefix, then trigram similarity. ok is false when nothing matches.
+type nameRank struct {
+    prefix, wordPrefix bool
+    sim                float64
+}
+
+func rankName(name, q string) (nameRank, bool) {
+    lname, lq := strings.ToLower(name), strings.ToLower(q)
+    r := nameRank{
+        prefix:     strings.HasPrefix(lname, lq),
+        wordPrefix: strings.Contains(lname, " "+lq),
+        sim:        trigramSimilarity(name, q),
+    }
+    return r, r.prefix || r.wordPrefix || r.sim >= 0.3
+}
+
+func (a nameRank) before(b nameRank) (less, decided bool) {
+    switch {
+    case a.prefix != b.prefix:
+        return a.prefix, true
+    case a.wordPrefix != b.wordPrefix:
+        return a.wordPrefix, true
+    case a.sim != b.sim:
+        return a.sim > b.sim, true
+    }
+    return false, false
+}
+
+// searchNames ranks candidates (by id) against q and returns the best limit as hits
+func searchNames(typ, q string, limit int, names map[int64]string) []SearchHit {
+    type scored struct {
+        hit  SearchHit
+        rank nameRank
+    }
+    var hits []scored
+    for id, name := range names {
+        if r, ok := rankName(name, q); ok { hits = append(hits, scored{SearchHit{typ, id, name}, r}) }
+    }
+    sort.Slice(hits, func(i, j int) bool {
+        if less, ok := hits[i].rank.before(hits[j].rank); ok { return less }
+        if hits[i].hit.Name != hits[j].hit.Name { return hits[i].hit.Name < hits[j].hit.Name }
+        return hits[i].hit.ID < hits[j].hit.ID
+    })
+    out := []SearchHit{}
+    for i := 0; i < len(hits) && i < limit; i++ { out = append(out, hits[i].hit) }
+    return out
+}
+
+func (m *memoryRepo) SearchPatients(ctx context.Context, q string, limit int, physicianID, patientID *int64) ([]SearchHit, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    names := map[int64]string{}
+    for id, p := range m.patients {
+        if m.hidden(ctx, "patients", id) { continue }
+        if physicianID != nil && !m.links[memoryLink{*physicianID, id}] { continue }
+        if patientID != nil && id != *patientID { continue }
+        names[id] = p.Name
+    }
+    return searchNames("patient", q, limit, names), nil
+}
+
+func (m *memoryRepo) SearchPhysicians(ctx context.Context, q string, limit int, patientID *int64) ([]SearchHit, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    names := map[int64]string{}
+    for id, p := range m.physicians {
+        if m.hidden(ctx, "physicians", id) { continue }
+        if patientID != nil && !m.links[memoryLink{id, *patientID}] { continue }
+        names[id] = p.Name
+    }
+    return searchNames("physician", q, limit, names), nil
+}
+
+func (m *memoryRepo) SearchICDCodes(ctx context.Context, q string, limit int) ([]ICDCode, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    lq := strings.ToLower(q)
+    var prefix, contains []ICDCode
+    for code, desc := range m.icdCodes {
+        switch {
+        case strings.HasPrefix(strings.ToLower(code), lq):
+            prefix = append(prefix, ICDCode{code, desc})
+        case strings.Contains(strings.ToLower(desc), lq):
+            contains = append(contains, ICDCode{code, desc})
+        }
+    }
+    for _, hits := range [][]ICDCode{prefix, contains} {
+        sort.Slice(hits, func(i, j int) bool { return hits[i].Code < hits[j].Code })
+    }
+    out := append(append([]ICDCode{}, prefix...), contains...)
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+func (m *memoryRepo) GetICDCode(ctx context.Context, code string) (*ICDCode, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    desc, ok := m.icdCodes[code]
+    if !ok { return nil, ErrNotFound }
+    return &ICDCode{code, desc}, nil
+}
+
+func (m *memoryRepo) CreateDrug(ctx context.Context, d *Drug) (*Drug, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.findDrugFold(d.Name) != 0 { return nil, ErrDuplicate }
+    d.ID = m.addDrug(d.Name)
+    m.drugs[d.ID] = *d
+    return d, nil
+}
+
+func (m *memoryRepo) SetDrugSchedule(ctx context.Context, id int64, schedule string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    d, ok := m.drugs[id]
+    if !ok { return ErrNotFound }
+    d.Schedule = schedule
+    m.drugs[id] = d
+    return nil
+}
+
+func (m *memoryRepo) SetDrugRules(ctx context.Context, id int64, rules *DispensingRules) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    d, ok := m.drugs[id]
+    if !ok { return ErrNotFound }
+    d.Rules = nil
+    if rules != nil {
+        copied := *rules
+        d.Rules = &copied
+    }
+    m.drugs[id] = d
+    return nil
+}
+
+func (m *memoryRepo) MergeDrugs(ctx context.Context, sourceID, targetID int64) ([]int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, okSource := m.drugs[sourceID]
+    _, okTarget := m.drugs[targetID]
+    if !okSource || !okTarget { return nil, ErrNotFound }
+    moved := []int64{}
+    for id, p := range m.prescriptions {
+        if p.DrugID == sourceID {
+            p.DrugID = targetID
+            m.prescriptions[id] = p
+            moved = append(moved, id)
+        }
+    }
+    slices.Sort(moved)
+    delete(m.drugs, sourceID)
+    return moved, nil
+}
+
+func (m *memoryRepo) GetPatientDetail(ctx context.Context, id int64) (*PatientDetail, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    d, ok := m.patientDetail(ctx, id)
+    if !ok { return nil, ErrNotFound }
+    return d, nil
+}
+
+func (m *memoryRepo) GetPatientDetails(ctx context.Context, ids []int64) ([]PatientDetail, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var out []PatientDetail
+    for _, id := range ids {
+        if d, ok := m.patientDetail(ctx, id); ok { out = append(out, *d) }
+    }
+    return out, nil
+}
+
+// patientDetail builds a patient's detail record, or returns false when the patient is
+// missing or hidden; callers must hold mu.
+func (m *memoryRepo) patientDetail(ctx context.Context, id int64) (*PatientDetail, bool) {
+    p, ok := m.patients[id]
+    if !ok || m.hidden(ctx, "patients", id) { return nil, false }
+    d := &PatientDetail{ID: p.ID, OrgID: m.orgOf("patients", id), Name: p.Name, PatientDemographics: m.demographics[id], Physicians: m.physiciansForPatient(ctx, id)}
+    for _, pr := range m.prescriptions {
+        if pr.PatientID != id || m.hidden(ctx, "prescriptions", pr.ID) || pr.Status == PrescriptionPendingSignature { continue }
+        if pr.Status == PrescriptionActive { d.ActivePrescriptions++ }
+        if d.LastVisitAt == nil || pr.PrescribedAt.After(*d.LastVisitAt) {
+            at := pr.PrescribedAt
+            d.LastVisitAt = &at
+        }
+    }
+    return d, true
+}
+
+func (m *memoryRepo) GetPhysicians(ctx context.Context, ids []int64) ([]Physician, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var out []Physician
+    for _, id := range ids {
+        if ph, ok := m.physicians[id]; ok && !m.hidden(ctx, "physicians", id) { out = append(out, ph) }
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return m.physiciansForPatient(ctx, patientID), nil
+}
+
+// physiciansForPatient lists a patient's linked physicians by name; callers must hold mu.
+func (m *memoryRepo) physiciansForPatient(ctx context.Context, patientID int64) []Physician {
+    out := []Physician{}
+    for l := range m.links {
+        if l.patientID == patientID && !m.hidden(ctx, "physicians", l.physicianID) {
+            out = append(out, m.physicians[l.physicianID])
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Name != out[j].Name { return out[i].Name < out[j].Name }
+        return out[i].ID < out[j].ID
+    })
+    return out
+}
+
+func (m *memoryRepo) LinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, okPatient := m.patients[patientID]
+    _, okPhysician := m.physicians[physicianID]
+    if !okPatient || !okPhysician || !m.sameOrg(ctx, physicianID, patientID) ||
+        m.isDeleted("patients", patientID) || m.isDeleted("physicians", physicianID) {
+        return false, ErrInvalidReference
+    }
+    l := memoryLink{physicianID, patientID}
+    if m.links[l] { return false, nil }
+    m.links[l] = true
+    return true, nil
+}
+
+func (m *memoryRepo) UnlinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    l := memoryLink{physicianID, patientID}
+    if m.outsideOrg(ctx, "patients", patientID) || !m.links[l] { return false, nil }
+    delete(m.links, l)
+    return true, nil
+}
+
+// sameOrg reports whether a physician and patient belong to the same organization, and
+// to ctx's when it is scoped; callers must hold mu.
+func (m *memoryRepo) sameOrg(ctx context.Context, physicianID, patientID int64) bool {
+    return !m.outsideOrg(ctx, "patients", patientID) && m.orgOf("patients", patientID) == m.orgOf("physicians", physicianID)
+}
+
+// consented reports whether a physician is linked to a patient who consented to scope;
+// callers must hold mu.
+func (m *memoryRepo) consented(physicianID, patientID int64, scope string) bool {
+    if !m.links[memoryLink{physicianID, patientID}] { return false }
+    now := time.Now()
+    for _, c := range m.consents {
+        if c.PatientID == patientID && c.PhysicianID == physicianID && c.Scope == scope && c.activeAt(now) { return true }
+    }
+    return false
+}
+
+// addLink links a physician and patient with consent for every scope, as links had before
+// consents existed; callers must hold mu.
+func (m *memoryRepo) addLink(physicianID, patientID int64) {
+    m.links[memoryLink{physicianID, patientID}] = true
+    for scope := range consentScopes {
+        id := m.nextID("consents")
+        m.consents[id] = Consent{ID: id, PatientID: patientID, PhysicianID: physicianID, Scope: scope, GrantedAt: time.Now().UTC()}
+    }
+}
+
+func (m *memoryRepo) GrantConsent(ctx context.Context, c *Consent) (*Consent, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.patients[c.PatientID]; !ok { return nil, ErrInvalidReference }
+    if _, ok := m.physicians[c.PhysicianID]; !ok { return nil, ErrInvalidReference }
+    if !m.sameOrg(ctx, c.PhysicianID, c.PatientID) { return nil, ErrInvalidReference }
+    now := time.Now().UTC()
+    for id, prev := range m.consents {
+        if prev.PatientID == c.PatientID && prev.PhysicianID == c.PhysicianID && prev.Scope == c.Scope && prev.RevokedAt == nil {
+            prev.RevokedAt = &now
+            m.consents[id] = prev
+        }
+    }
+    c.ID, c.GrantedAt = m.nextID("consents"), now
+    m.consents[c.ID] = *c
+    return c, nil
+}
+
+func (m *memoryRepo) ListConsents(ctx context.Context, patientID int64) ([]Consent, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []Consent{}
+    if m.outsideOrg(ctx, "patients", patientID) { return out, nil }
+    for _, c := range m.consents {
+        if c.PatientID == patientID { out = append(out, c) }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if !out[i].GrantedAt.Equal(out[j].GrantedAt) { return out[i].GrantedAt.After(out[j].GrantedAt) }
+        return out[i].ID > out[j].ID
+    })
+    return out, nil
+}
+
+func (m *memoryRepo) RevokeConsent(ctx context.Context, patientID, consentID int64) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    c, ok := m.consents[consentID]
+    if !ok || c.PatientID != patientID || m.outsideOrg(ctx, "patients", patientID) { return false, ErrNotFound }
+    if c.RevokedAt != nil { return false, nil }
+    now := time.Now().UTC()
+    c.RevokedAt = &now
+    m.consents[consentID] = c
+    return true, nil
+}
+
+func (m *memoryRepo) PhysicianPatientAccess(ctx context.Context, physicianID int64, patientIDs []int64, scope string) (map[int64]PatientAccess, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    now := time.Now()
+    out := map[int64]PatientAccess{}
+    for _, id := range patientIDs {
+        if _, ok := m.patients[id]; !ok || m.hidden(ctx, "patients", id) { continue }
+        var a PatientAccess
+        a.Linked = m.links[memoryLink{physicianID, id}] && !m.hidden(ctx, "physicians", physicianID) &&
+            m.orgOf("patients", id) == m.orgOf("physicians", physicianID)
+        for _, c := range m.consents {
+            if a.Linked && c.PatientID == id && c.PhysicianID == physicianID && c.Scope == scope && c.activeAt(now) {
+                a.Consented = true
+                break
+            }
+        }
+        out[id] = a
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) HasActiveConsent(ctx context.Context, patientID, physicianID int64, scope string) (bool, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    if m.outsideOrg(ctx, "patients", patientID) { return false, nil }
+    now := time.Now()
+    for _, c := range m.consents {
+        if c.PatientID == patientID && c.PhysicianID == physicianID && c.Scope == scope && c.activeAt(now) { return true, nil }
+    }
+    return false, nil
+}
+
+func (m *memoryRepo) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    k := memoryIdemKey{rec.Scope, rec.Key}
+    now := time.Now().UTC()
+    if ex, ok := m.idempotency[k]; ok && now.Before(ex.ExpiresAt) && (ex.StatusCode != 0 || now.Sub(ex.ReservedAt) < idempotencyLease) {
+        return &ex, nil
+    }
+    rec.StatusCode, rec.Body = 0, nil
+    rec.CreatedAt, rec.ReservedAt = now, now
+    m.idempotency[k] = rec
+    return nil, nil
+}
+
+func (m *memoryRepo) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, body []byte) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    k := memoryIdemKey{scope, key}
+    if rec, ok := m.idempotency[k]; ok && rec.StatusCode == 0 {
+        rec.StatusCode, rec.Body = statusCode, body
+        m.idempotency[k] = rec
+    }
+    return nil
+}
+
+func (m *memoryRepo) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    k := memoryIdemKey{scope, key}
+    if rec, ok := m.idempotency[k]; ok && rec.StatusCode == 0 {
+        delete(m.idempotency, k)
+    }
+    return nil
+}
+
+func (m *memoryRepo) FindDrugByRxCUI(ctx context.Context, rxcui string) (int64, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var best int64
+    for id, d := range m.drugs {
+        if d.RxCUI == rxcui && (best == 0 || id < best) { best = id }
+    }
+    if best == 0 { return 0, ErrNotFound }
+    return best, nil
+}
+
+func (m *memoryRepo) SetDrugRxNorm(ctx context.Context, drugID int64, c RxNormConcept) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    d, ok := m.drugs[drugID]
+    if !ok || d.RxCUI != "" { return nil }
+    d.RxCUI, d.NormalizedName, d.DoseForm = c.RxCUI, c.NormalizedName, c.DoseForm
+    m.drugs[drugID] = d
+    return nil
+}
+
+func (m *memoryRepo) CreatePharmacy(ctx context.Context, p *Pharmacy) (*Pharmacy, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p.ID = m.addPharmacy(*p)
+    if org, ok := orgFromContext(ctx); ok && org != defaultOrgID { m.rowOrg[memoryRef{"pharmacies", p.ID}] = org }
+    return p, nil
+}
+
+func (m *memoryRepo) ListPharmacies(ctx context.Context) ([]Pharmacy, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := make([]Pharmacy, 0, len(m.pharmacies))
+    for _, p := range m.pharmacies {
+        if !m.outsideOrg(ctx, "pharmacies", p.ID) { out = append(out, p) }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Name != out[j].Name { return out[i].Name < out[j].Name }
+        return out[i].ID < out[j].ID
+    })
+    return out, nil
+}
+
+func (m *memoryRepo) CallerOrg(ctx context.Context, table string, id int64) (int64, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var ok bool
+    switch table {
+    case "patients":
+        _, ok = m.patients[id]
+    case "physicians":
+        _, ok = m.physicians[id]
+    case "pharmacies":
+        _, ok = m.pharmacies[id]
+    case "nurses":
+        _, ok = m.nurses[id]
+    case "org_admins":
+        _, ok = m.orgAdmins[id]
+    }
+    if !ok || m.isDeleted(table, id) { return 0, ErrNotFound }
+    return m.orgOf(table, id), nil
+}
+
+func (m *memoryRepo) CreateOrganization(ctx context.Context, o *Organization) (*Organization, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, ex := range m.orgs {
+        if ex.Name == o.Name { return nil, ErrDuplicate }
+    }
+    o.ID, o.CreatedAt = m.nextID("organizations"), time.Now().UTC()
+    m.orgs[o.ID] = *o
+    return o, nil
+}
+
+func (m *memoryRepo) ListOrganizations(ctx context.Context) ([]Organization, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []Organization{}
+    scoped, isScoped := orgFromContext(ctx)
+    for _, o := range m.orgs {
+        if !isScoped || o.ID == scoped { out = append(out, o) }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    return out, nil
+}
+
+func (m *memoryRepo) RegisterPatient(ctx context.Context, reg PatientRegistration) (int64, bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    org, ok := orgFromContext(ctx)
+    if !ok { org = defaultOrgID }
+    id, exists := m.mrns[memoryMRN{org, reg.MRN}]
+    if exists && m.isDeleted("patients", id) { return 0, false, ErrNotFound }
+    if !exists {
+        id = m.nextID("patients")
+        m.mrns[memoryMRN{org, reg.MRN}] = id
+        m.patientCreated[id] = time.Now().UTC()
+        if org != defaultOrgID { m.rowOrg[memoryRef{"patients", id}] = org }
+    }
+    m.patients[id] = Patient{ID: id, Name: reg.Name}
+    // Blank demographics keep what is on file
+    d := m.demographics[id]
+    for _, f := range []struct{ dst *string; v string }{
+        {&d.BirthDate, reg.BirthDate}, {&d.Sex, reg.Sex}, {&d.Phone, reg.Phone}, {&d.Email, reg.Email}, {&d.Address, reg.Address},
+    } {
+        if f.v != "" { *f.dst = f.v }
+    }
+    m.demographics[id] = d
+    return id, !exists, nil
+}
+
+func (m *memoryRepo) FindPatientByMRN(ctx context.Context, mrn string) (int64, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    org, ok := orgFromContext(ctx)
+    if !ok { org = defaultOrgID }
+    id, exists := m.mrns[memoryMRN{org, mrn}]
+    if !exists || m.isDeleted("patients", id) { return 0, ErrNotFound }
+    return id, nil
+}
+
+func (m *memoryRepo) QuarantineHL7Message(ctx context.Context, q *HL7QuarantinedMessage) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    q.ID, q.ReceivedAt = m.nextID("hl7_quarantine"), time.Now().UTC()
+    q.orgID, _ = orgFromContext(ctx)
+    m.quarantine = append(m.quarantine, *q)
+    return nil
+}
+
+func (m *memoryRepo) ListHL7Quarantine(ctx context.Context, limit int) ([]HL7QuarantinedMessage, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    org, scoped := orgFromContext(ctx)
+    out := []HL7QuarantinedMessage{}
+    for i := len(m.quarantine) - 1; i >= 0 && len(out) < limit; i-- {
+        if q := m.quarantine[i]; !scoped || q.orgID == org { out = append(out, q) }
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) GetNotificationPreferences(ctx context.Context, patientID int64) (*NotificationPreferences, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    if _, ok := m.patients[patientID]; !ok || m.hidden(ctx, "patients", patientID) { return nil, ErrNotFound }
+    np, ok := m.notificationPrefs[patientID]
+    if !ok { np = NotificationPreferences{PatientID: patientID} }
+    return &np, nil
+}
+
+func (m *memoryRepo) SetNotificationPreferences(ctx context.Context, np *NotificationPreferences) (*NotificationPreferences, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.patients[np.PatientID]; !ok || m.hidden(ctx, "patients", np.PatientID) { return nil, ErrNotFound }
+    now := time.Now().UTC()
+    np.UpdatedAt = &now
+    m.notificationPrefs[np.PatientID] = *np
+    return np, nil
+}
+
+func (m *memoryRepo) DispensePrescription(ctx context.Context, id, pharmacyID int64, quantity int) (*Prescription, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.prescriptions[id]
+    if !ok || p.PharmacyID == nil || *p.PharmacyID != pharmacyID || m.hidden(ctx, "prescriptions", id) { return nil, ErrNotFound }
+    if p.Status != PrescriptionActive { return nil, ErrNotActive }
+    if p.DispensedAt != nil { return nil, ErrAlreadyDispensed }
+    if quantity > p.Quantity { return nil, ErrDispenseQuantity }
+    now := time.Now().UTC()
+    p.DispensedAt, p.DispensedQuantity = &now, &quantity
+    m.prescriptions[id] = p
+    out := m.hydrate(p)
+    return &out, nil
+}
+
+func (m *memoryRepo) CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) (*WebhookEndpoint, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    e.ID = m.nextID("webhook_endpoints")
+    e.CreatedAt = time.Now().UTC()
+    m.webhooks[e.ID] = *e
+    return e, nil
+}
+
+func (m *memoryRepo) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := make([]WebhookEndpoint, 0, len(m.webhooks))
+    for _, e := range m.webhooks { out = append(out, e) }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    return out, nil
+}
+
+func (m *memoryRepo) DeleteWebhookEndpoint(ctx context.Context, id int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.webhooks[id]; !ok { return ErrNotFound }
+    delete(m.webhooks, id)
+    kept := m.deliveries[:0]
+    for _, d := range m.deliveries {
+        if d.EndpointID != id { kept = append(kept, d) }
+    }
+    m.deliveries = kept
+    return nil
+}
+
+func (m *memoryRepo) RecordWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.webhooks[d.EndpointID]; !ok { return ErrInvalidReference }
+    d.ID = m.nextID("webhook_deliveries")
+    d.CreatedAt = time.Now().UTC()
+    m.deliveries = append(m.deliveries, *d)
+    return nil
+}
+
+func (m *memoryRepo) ListWebhookDeliveries(ctx context.Context, endpointID int64, limit int) ([]WebhookDelivery, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []WebhookDelivery{}
+    for i := len(m.deliveries) - 1; i >= 0 && len(out) < limit; i-- {
+        if m.deliveries[i].EndpointID == endpointID { out = append(out, m.deliveries[i]) }
+    }
+    return out, nil
+}
+
+// softDelete marks a row deleted if it exists and isn't already; callers must hold mu.
+func (m *memoryRepo) softDelete(ctx context.Context, table string, id int64, exists bool) error {
+    if !exists || m.hidden(ctx, table, id) { return ErrNotFound }
+    m.deleted[memoryRef{table, id}] = time.Now().UTC()
+    return nil
+}
+
+func (m *memoryRepo) SoftDeletePatient(ctx context.Context, id int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, ok := m.patients[id]
+    return m.softDelete(ctx, "patients", id, ok)
+}
+
+func (m *memoryRepo) SoftDeletePhysician(ctx context.Context, id int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, ok := m.physicians[id]
+    return m.softDelete(ctx, "physicians", id, ok)
+}
+
+func (m *memoryRepo) SoftDeletePrescription(ctx context.Context, id int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, ok := m.prescriptions[id]
+    return m.softDelete(ctx, "prescriptions", id, ok)
+}
+
+func (m *memoryRepo) AnonymizePatients(ctx context.Context, cutoff time.Time, limit int) ([]int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var due []int64
+    for id := range m.patients {
+        if m.anonymized[id] || m.outsideOrg(ctx, "patients", id) { continue }
+        deletedAt, deleted := m.deleted[memoryRef{"patients", id}]
+        if deleted && deletedAt.Before(cutoff) || !deleted && m.inactiveSince(id, cutoff) { due = append(due, id) }
+    }
+    sort.Slice(due, func(i, j int) bool { return due[i] < due[j] })
+    if len(due) > limit { due = due[:limit] }
+    for _, id := range due {
+        m.patients[id] = Patient{ID: id, Name: "Anonymized patient " + strconv.FormatInt(id, 10)}
+        delete(m.demographics, id)
+        delete(m.notificationPrefs, id)
+        for k, patientID := range m.mrns {
+            if patientID == id { delete(m.mrns, k) }
+        }
+        m.anonymized[id] = true
+        m.recordAudit(AuditEntry{Actor: auditActorRetention, Action: AuditAnonymize, Entity: "patient", EntityID: id})
+    }
+    return due, nil
+}
+
+// inactiveSince reports whether a patient was created before cutoff and has no prescription
+// written since and none still open, like the Postgres retention query; callers must hold mu.
+func (m *memoryRepo) inactiveSince(patientID int64, cutoff time.Time) bool {
+    created, ok := m.patientCreated[patientID]
+    if !ok || !created.Before(cutoff) { return false }
+    for id, p := range m.prescriptions {
+        if p.PatientID != patientID { continue }
+        if !p.PrescribedAt.Before(cutoff) { return false }
+        if openPrescriptionStatus[p.Status] && !m.isDeleted("prescriptions", id) { return false }
+    }
+    return true
+}
+
+// recordAudit appends to the audit log; callers must hold mu.
+func (m *memoryRepo) recordAudit(e AuditEntry) {
+    e.ID = m.nextID("audit_log")
+    e.CreatedAt = time.Now().UTC()
+    m.audit = append(m.audit, e)
+}
+
+func (m *memoryRepo) ExpirePrescriptions(ctx context.Context, now time.Time, limit int, entry AuditEntry) ([]int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var due []int64
+    for id, p := range m.prescriptions {
+        if p.ExpiresAt != nil && !p.ExpiresAt.After(now) && p.Status == PrescriptionActive && !m.hidden(ctx, "prescriptions", id) {
+            due = append(due, id)
+        }
+    }
+    sort.Slice(due, func(i, j int) bool { return due[i] < due[j] })
+    if len(due) > limit { due = due[:limit] }
+    for _, id := range due {
+        p := m.prescriptions[id]
+        p.Status = PrescriptionExpired
+        m.prescriptions[id] = p
+        e := entry
+        e.Entity, e.EntityID = "prescription", id
+        m.recordAudit(e)
+    }
+    return due, nil
+}
+
+func (m *memoryRepo) PurgeIdempotencyKeys(ctx context.Context, now time.Time, limit int) (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var n int64
+    for k, rec := range m.idempotency {
+        if n == int64(limit) { break }
+        if !rec.ExpiresAt.After(now) {
+            delete(m.idempotency, k)
+            n++
+        }
+    }
+    return n, nil
+}
+
+func (m *memoryRepo) PurgeAuditLog(ctx context.Context, before time.Time, limit int) (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    kept := m.audit[:0]
+    var n int64
+    for _, e := range m.audit {
+        if e.CreatedAt.Before(before) && n < int64(limit) { n++; continue }
+        kept = append(kept, e)
+    }
+    m.audit = kept
+    return n, nil
+}
+
+func (m *memoryRepo) RecordAudit(ctx context.Context, e AuditEntry) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.recordAudit(e)
+    return nil
+}
+
+func (m *memoryRepo) GetPrescription(ctx context.Context, id int64) (*Prescription, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    p, ok := m.prescriptions[id]
+    if !ok || m.hidden(ctx, "prescriptions", id) || m.hidden(ctx, "patients", p.PatientID) { return nil, ErrNotFound }
+    out := m.hydrate(p)
+    return &out, nil
+}
+
+func (m *memoryRepo) CreatePrescriptionComment(ctx context.Context, c *PrescriptionComment) (*PrescriptionComment, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.prescriptions[c.PrescriptionID]; !ok || m.outsideOrg(ctx, "prescriptions", c.PrescriptionID) { return nil, ErrInvalidReference }
+    c.ID = m.nextID("prescription_comments")
+    c.CreatedAt = time.Now().UTC()
+    m.comments = append(m.comments, *c)
+    return c, nil
+}
+
+func (m *memoryRepo) ListPrescriptionComments(ctx context.Context, prescriptionID int64) ([]PrescriptionComment, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []PrescriptionComment{}
+    if m.outsideOrg(ctx, "prescriptions", prescriptionID) { return out, nil }
+    for _, c := range m.comments {
+        if c.PrescriptionID == prescriptionID { out = append(out, c) }
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) CreatePrescriptionAttachment(ctx context.Context, a *PrescriptionAttachment) (*PrescriptionAttachment, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.prescriptions[a.PrescriptionID]; !ok || m.hidden(ctx, "prescriptions", a.PrescriptionID) { return nil, ErrInvalidReference }
+    a.ID = m.nextID("prescription_attachments")
+    a.CreatedAt = time.Now().UTC()
+    m.attachments = append(m.attachments, *a)
+    return a, nil
+}
+
+func (m *memoryRepo) ListPrescriptionAttachments(ctx context.Context, prescriptionID int64) ([]PrescriptionAttachment, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []PrescriptionAttachment{}
+    if m.outsideOrg(ctx, "prescriptions", prescriptionID) { return out, nil }
+    for _, a := range m.attachments {
+        if a.PrescriptionID == prescriptionID { out = append(out, a) }
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) GetPrescriptionAttachment(ctx context.Context, prescriptionID, id int64) (*PrescriptionAttachment, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    if m.outsideOrg(ctx, "prescriptions", prescriptionID) { return nil, ErrNotFound }
+    for _, a := range m.attachments {
+        if a.ID == id && a.PrescriptionID == prescriptionID { return &a, nil }
+    }
+    return nil, ErrNotFound
+}
+
+func (m *memoryRepo) MatchBulkPrescriptions(ctx context.Context, f BulkFilter) ([]int64, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []int64{}
+    for _, p := range m.prescriptions {
+        if p.Status != PrescriptionActive || m.hidden(ctx, "prescriptions", p.ID) { continue }
+        if f.DrugID != nil && p.DrugID != *f.DrugID { continue }
+        if f.PhysicianID != nil && p.PhysicianID != *f.PhysicianID { continue }
+        if f.From != nil && p.PrescribedAt.Before(*f.From) { continue }
+        if f.To != nil && !p.PrescribedAt.Before(*f.To) { continue }
+        out = append(out, p.ID)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+    return out, nil
+}
+
+func (m *memoryRepo) TransitionPrescriptions(ctx context.Context, ids []int64, status string, entry AuditEntry) ([]int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var out []int64
+    for _, id := range ids {
+        p, ok := m.prescriptions[id]
+        if !ok || p.Status != PrescriptionActive || m.hidden(ctx, "prescriptions", id) { continue }
+        p.Status = status
+        m.prescriptions[id] = p
+        e := entry
+        e.Entity, e.EntityID = "prescription", id
+        m.recordAudit(e)
+        out = append(out, id)
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) ReassignPrescriptions(ctx context.Context, patientID, fromPhysicianID, toPhysicianID int64, entry AuditEntry) ([]int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var out []int64
+    for _, p := range m.prescriptions {
+        if p.PatientID != patientID || p.PhysicianID != fromPhysicianID || p.Status != PrescriptionActive || m.hidden(ctx, "prescriptions", p.ID) { continue }
+        out = append(out, p.ID)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+    for _, id := range out {
+        p := m.prescriptions[id]
+        p.PhysicianID, p.Status, p.Signature = toPhysicianID, PrescriptionPendingReauthorization, ""
+        m.prescriptions[id] = p
+        e := entry
+        e.Entity, e.EntityID = "prescription", id
+        m.recordAudit(e)
+    }
+    return out, nil
+}
+
+func (m *memoryRepo) SignPrescription(ctx context.Context, id int64) (*Prescription, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.prescriptions[id]
+    pending := p.Status == PrescriptionPendingSignature || p.Status == PrescriptionPendingReauthorization
+    if !ok || !pending || m.hidden(ctx, "prescriptions", id) { return nil, ErrNotPending }
+    now := time.Now().UTC()
+    p.Status, p.SignedAt = PrescriptionActive, &now
+    m.prescriptions[id] = p
+    out := m.hydrate(p)
+    return &out, nil
+}
+
+func (m *memoryRepo) SetPrescriptionSignature(ctx context.Context, id int64, signature string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.prescriptions[id]
+    if !ok || m.outsideOrg(ctx, "prescriptions", id) { return ErrNotFound }
+    p.Signature = signature
+    m.prescriptions[id] = p
+    return nil
+}
+
+func (m *memoryRepo) IsNurseDelegate(ctx context.Context, nurseID, physicianID int64) (bool, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    if m.hidden(ctx, "physicians", physicianID) { return false, nil }
+    return m.delegations[memoryDelegation{physicianID, nurseID}], nil
+}
+
+func (m *memoryRepo) ListNursesForPhysician(ctx context.Context, physicianID int64) ([]Nurse, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []Nurse{}
+    if m.outsideOrg(ctx, "physicians", physicianID) { return out, nil }
+    for d := range m.delegations {
+        if d.physicianID == physicianID { out = append(out, m.nurses[d.nurseID]) }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Name != out[j].Name { return out[i].Name < out[j].Name }
+        return out[i].ID < out[j].ID
+    })
+    return out, nil
+}
+
+func (m *memoryRepo) AddNurseDelegation(ctx context.Context, physicianID, nurseID int64) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, okPhysician := m.physicians[physicianID]
+    _, okNurse := m.nurses[nurseID]
+    if !okPhysician || !okNurse || m.outsideOrg(ctx, "physicians", physicianID) { return false, ErrInvalidReference }
+    d := memoryDelegation{physicianID, nurseID}
+    if m.delegations[d] { return false, nil }
+    m.delegations[d] = true
+    return true, nil
+}
+
+func (m *memoryRepo) RemoveNurseDelegation(ctx context.Context, physicianID, nurseID int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.outsideOrg(ctx, "physicians", physicianID) { return nil }
+    delete(m.delegations, memoryDelegation{physicianID, nurseID})
+    return nil
+}
+
+func (m *memoryRepo) ListDrugsMissingRxNorm(ctx context.Context, afterID int64, limit int) ([]Drug, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := []Drug{}
+    for id, d := range m.drugs {
+        if id > afterID && d.RxCUI == "" { out = append(out, d) }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    if len(out) > limit { out = out[:limit] }
+    return out, nil
+}
+
+func (m *memoryRepo) CountDrugsMissingRxNorm(ctx context.Context, afterID int64) (int, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    n := 0
+    for id, d := range m.drugs {
+        if id > afterID && d.RxCUI == "" { n++ }
+    }
+    return n, nil
+}
+
+func (m *memoryRepo) RecordProvenance(ctx context.Context, d *DocumentProvenance) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    d.CreatedAt = time.Now().UTC()
+    m.provenance[d.DocumentID] = *d
+    return nil
+}
+
+func (m *memoryRepo) GetProvenance(ctx context.Context, documentID string) (*DocumentProvenance, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    d, ok := m.provenance[documentID]
+    if !ok { return nil, ErrNotFound }
+    return &d, nil
+}
+
+func (m *memoryRepo) FindProvenanceBySHA256(ctx context.Context, sha256 string) (*DocumentProvenance, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var best *DocumentProvenance
+    for _, d := range m.provenance {
+        if d.SHA256 == sha256 && (best == nil || d.CreatedAt.Before(best.CreatedAt)) {
+            d := d
+            best = &d
+        }
+    }
+    if best == nil { return nil, ErrNotFound }
+    return best, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestMemoryRepoPrescriptionFlow(t *testing.T) {
+    ctx := context.Background()
+    m := newMemoryRepo()
+    patient := m.addPatient("Alice")
+    physician := m.addPhysician("Dr. Smith")
+    m.links[memoryLink{physician, patient}] = true
+
+    linked, _ := m.IsPhysicianPatientLinked(ctx, physician, patient)
+    if !linked { t.Fatalf("expected physician %d linked to patient %d", physician, patient) }
+
+    drugID, err := m.FindOrCreateDrug(ctx, "Ibuprofen")
+    if err != nil { t.Fatalf("FindOrCreateDrug: %v", err) }
+    again, _ := m.FindOrCreateDrug(ctx, "Ibuprofen")
+    if again != drugID { t.Fatalf("FindOrCreateDrug not idempotent: %d vs %d", again, drugID) }
+
+    for _, qty := range []int{10, 20} {
+        if _, err := m.CreatePrescription(ctx, &Prescription{PatientID: patient, PhysicianID: physician, DrugID: drugID, Quantity: qty, Sig: "PRN"}); err != nil {
+            t.Fatalf("CreatePrescription: %v", err)
+        }
+    }
+    _, err = m.CreatePrescription(ctx, &Prescription{PatientID: 999, PhysicianID: physician, DrugID: drugID, Quantity: 1, Sig: "PRN"})
+    if !errors.Is(err, ErrInvalidReference) { t.Fatalf("err = %v, want ErrInvalidReference", err) }
+
+    items, _ := m.ListPrescriptions(ctx, ListPrescriptionsFilter{PatientID: &patient})
+    if len(items) != 2 || items[0].DrugName != "Ibuprofen" || items[0].PhysicianName != "Dr. Smith" {
+        t.Fatalf("unexpected list: %+v", items)
+    }
+
+    now := time.Now().UTC()
+    top, _ := m.TopDrugs(ctx, now.Add(-time.Hour), now.Add(time.Hour), 10, nil)
+    if len(top) != 1 || top[0].TotalQty != 30 {
+        t.Fatalf("unexpected top drugs: %+v", top)
+    }
+}
+
+func TestDemoMemoryRepoIsSeeded(t *testing.T) {
+    m := newDemoMemoryRepo()
+    items, _ := m.ListPrescriptions(context.Background(), ListPrescriptionsFilter{})
+    if len(items) == 0 { t.Fatalf("expected seeded prescriptions") }
+    pats, _ := m.ListPatientsForPhysician(context.Background(), 1) // Dr. Smith
+    if len(pats) != 2 { t.Fatalf("expected Dr. Smith to have 2 patients, got %+v", pats) }
+}
+
+func TestMemoryRepoInTx(t *testing.T) {
+    ctx := context.Background()
+    m := newDemoMemoryRepo()
+    errAbort := errors.New("abort")
+    err := m.InTx(ctx, func(ctx context.Context) error {
+        if _, err := m.UnlinkPhysicianPatient(ctx, 1, 1); err != nil { return err }
+        // A failed nested transaction rolls back only its own writes
+        err := m.InTx(ctx, func(ctx context.Context) error {
+            if _, err := m.LinkPhysicianPatient(ctx, 2, 1); err != nil { return err }
+            return errAbort
+        })
+        if !errors.Is(err, errAbort) { t.Fatalf("nested err = %v", err) }
+        if linked, _ := m.IsPhysicianPatientLinked(ctx, 2, 1); linked { t.Fatal("nested link survived its rollback") }
+        if linked, _ := m.IsPhysicianPatientLinked(ctx, 1, 1); linked { t.Fatal("outer unlink rolled back with the nested transaction") }
+        return errAbort
+    })
+    if !errors.Is(err, errAbort) { t.Fatalf("err = %v", err) }
+    if linked, _ := m.IsPhysicianPatientLinked(ctx, 1, 1); !linked { t.Fatal("unlink survived the rollback") }
+
+    if err := m.InTx(ctx, func(ctx context.Context) error { _, err := m.UnlinkPhysicianPatient(ctx, 1, 1); return err }); err != nil { t.Fatalf("InTx: %v", err) }
+    if linked, _ := m.IsPhysicianPatientLinked(ctx, 1, 1); linked { t.Fatal("committed unlink missing") }
+}
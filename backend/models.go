@@ -2,6 +2,19 @@ package main
 
 import "time"
 
+// Prescription lifecycle states. Cancelled and expired prescriptions stay listed but can
+// no longer be dispensed.
+const (
+    // PrescriptionPendingSignature is a nurse-drafted prescription awaiting its physician
+    PrescriptionPendingSignature = "pending_signature"
+    // PrescriptionPendingReauthorization is an active prescription moved to a new physician
+    // by a patient transfer, awaiting that physician's signature
+    PrescriptionPendingReauthorization = "pending_reauthorization"
+    PrescriptionActive    = "active"
+    PrescriptionCancelled = "cancelled"
+    PrescriptionExpired   = "expired"
+)
+
 // Domain models (minimal for handlers)
 type Prescription struct {
     ID           int64     `json:"id"`
@@ -12,8 +25,46 @@ type Prescription struct {
     DrugID       int64     `json:"drug_id"`
     DrugName     string    `json:"drug_name,omitempty"`
     Quantity     int       `json:"quantity"`
+    // QuantityUnit is the UCUM unit of Quantity (e.g. {tablet}, mL); DaysSupply is how
+    // many days the quantity is meant to last. Both are empty on older prescriptions.
+    QuantityUnit string    `json:"quantity_unit,omitempty"`
+    DaysSupply   int       `json:"days_supply,omitempty"`
     Sig          string    `json:"sig"`
+    Dosage       *Dosage   `json:"dosage,omitempty"`
+    Refills      int       `json:"refills"`
+    // Reason is the clinical indication text, mandatory for controlled substances
+    Reason       string    `json:"reason,omitempty"`
+    // DiagnosisCode is the coded indication (ICD-10-CM); the description comes from icd_codes
+    DiagnosisCode        string `json:"diagnosis_code,omitempty"`
+    DiagnosisDescription string `json:"diagnosis_description,omitempty"`
+    // Signature is the server-side e-signature (see GET /prescriptions/{id}/verify)
+    Signature            string `json:"signature,omitempty"`
     PrescribedAt time.Time `json:"prescribed_at"`
+    // ExpiresAt is prescribed_at + dosage.duration_days when a duration was given
+    ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+    // Pharmacy routing and dispensing; all empty until routed/dispensed
+    PharmacyID        *int64     `json:"pharmacy_id,omitempty"`
+    PharmacyName      string     `json:"pharmacy_name,omitempty"`
+    DispensedAt       *time.Time `json:"dispensed_at,omitempty"`
+    DispensedQuantity *int       `json:"dispensed_quantity,omitempty"`
+    Status            string     `json:"status"`
+    // DraftedBy is the nurse who drafted the prescription on the physician's behalf
+    DraftedBy         *int64     `json:"drafted_by,omitempty"`
+    SignedAt          *time.Time `json:"signed_at,omitempty"`
+}
+
+// Drug catalog entry
+type Drug struct {
+    ID   int64  `json:"id"`
+    Name string `json:"name"`
+    // RxNorm normalization, populated when the RxNorm integration is enabled
+    RxCUI          string `json:"rxcui,omitempty"`
+    NormalizedName string `json:"normalized_name,omitempty"`
+    DoseForm       string `json:"dose_form,omitempty"`
+    // Schedule is the DEA controlled substance schedule (CII..CV), empty when not controlled
+    Schedule string `json:"schedule,omitempty"`
+    // Rules bound prescribed quantities and doses (see supply.go); nil when none are set
+    Rules *DispensingRules `json:"dispensing_rules,omitempty"`
 }
 
 type TopDrug struct {
@@ -22,14 +73,100 @@ type TopDrug struct {
     TotalQty int64  `json:"total_quantity"`
 }
 
+// ICDCode is an ICD-10-CM diagnosis code
+type ICDCode struct {
+    Code        string `json:"code"`
+    Description string `json:"description"`
+}
+
+// DiagnosisTopDrugs are the top drugs prescribed for one diagnosis; DiagnosisCode is ""
+// for prescriptions written without one
+type DiagnosisTopDrugs struct {
+    DiagnosisCode        string    `json:"diagnosis_code"`
+    DiagnosisDescription string    `json:"diagnosis_description,omitempty"`
+    TotalQty             int64     `json:"total_quantity"`
+    Drugs                []TopDrug `json:"drugs"`
+}
+
+// Prescription count for one date_trunc bucket (day, week, or month)
+type TimeBucket struct {
+    BucketStart time.Time `json:"bucket_start"`
+    Count       int64     `json:"count"`
+    TotalQty    int64     `json:"total_quantity"`
+}
+
+// Prescription volume for a single physician over a range
+type PhysicianVolume struct {
+    PhysicianID      int64  `json:"physician_id"`
+    PhysicianName    string `json:"physician_name"`
+    Prescriptions    int64  `json:"prescription_count"`
+    DistinctPatients int64  `json:"distinct_patients"`
+}
+
+// AdminStats are the system-wide aggregates of the admin dashboard. Weeks start on
+// Monday and months on the 1st, both UTC; top prescribers cover the current month.
+type AdminStats struct {
+    Patients                   int64             `json:"patients"`
+    Physicians                 int64             `json:"physicians"`
+    Prescriptions              int64             `json:"prescriptions"`
+    PrescriptionsThisWeek      int64             `json:"prescriptions_this_week"`
+    PrescriptionsThisMonth     int64             `json:"prescriptions_this_month"`
+    AvgPrescriptionsPerPatient float64           `json:"avg_prescriptions_per_patient"`
+    TopPrescribers             []PhysicianVolume `json:"top_prescribers"`
+}
+
 // Lightweight list item used for dropdowns
 type Patient struct {
     ID   int64  `json:"id"`
     Name string `json:"name"`
 }
 
+// PatientDemographics are the optional personal details kept on a patient
+type PatientDemographics struct {
+    // BirthDate is YYYY-MM-DD
+    BirthDate string `json:"birth_date,omitempty"`
+    // Sex is one of female, male, other, unknown
+    Sex       string `json:"sex,omitempty"`
+    Phone     string `json:"phone,omitempty"`
+    Email     string `json:"email,omitempty"`
+    Address   string `json:"address,omitempty"`
+}
+
+// PatientDetail is the full patient record returned by GET /patients/{id}
+type PatientDetail struct {
+    ID    int64  `json:"id"`
+    OrgID int64  `json:"org_id"`
+    Name  string `json:"name"`
+    PatientDemographics
+    Physicians          []Physician `json:"physicians"`
+    ActivePrescriptions int         `json:"active_prescription_count"`
+    // LastVisitAt is the most recent prescription date; prescriptions are the only
+    // encounter record kept
+    LastVisitAt *time.Time `json:"last_visit_at,omitempty"`
+}
+
 // Lightweight physician item for patient-linked physician lists
 type Physician struct {
     ID   int64  `json:"id"`
     Name string `json:"name"`
 }
+
+// SearchHit is one GET /search match; Type is patient, physician, or drug
+type SearchHit struct {
+    Type string `json:"type"`
+    ID   int64  `json:"id"`
+    Name string `json:"name"`
+}
+
+// Pharmacy a prescription can be routed to for dispensing
+type Pharmacy struct {
+    ID      int64  `json:"id"`
+    Name    string `json:"name"`
+    Address string `json:"address,omitempty"`
+}
+
+// Nurse may draft prescriptions for physicians who delegated to them
+type Nurse struct {
+    ID   int64  `json:"id"`
+    Name string `json:"name"`
+}
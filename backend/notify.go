@@ -0,0 +1,281 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Notification channels a patient can opt into
+const (
+    ChannelEmail = "email"
+    ChannelSMS   = "sms"
+)
+
+// Notification is one message to a patient. SMS carries only Body.
+type Notification struct {
+    Subject string
+    Body    string
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+    // Channel is ChannelEmail or ChannelSMS
+    Channel() string
+    // Send delivers n to an email address or phone number
+    Send(ctx context.Context, to string, n Notification) error
+}
+
+// NotificationPreferences are the channels a patient wants prescription notifications
+// on. Patients have both off until they opt in.
+type NotificationPreferences struct {
+    PatientID int64      `json:"patient_id"`
+    Email     bool       `json:"email"`
+    SMS       bool       `json:"sms"`
+    UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// smtpNotifier emails notifications through a Mailer
+type smtpNotifier struct{ mailer Mailer }
+
+func (n *smtpNotifier) Channel() string { return ChannelEmail }
+
+func (n *smtpNotifier) Send(ctx context.Context, to string, msg Notification) error {
+    return n.mailer.Send(ctx, []string{to}, msg.Subject, msg.Body)
+}
+
+// defaultTwilioBaseURL is the Twilio REST API
+const defaultTwilioBaseURL = "https://api.twilio.com"
+
+// twilioNotifier texts notifications with the Twilio Messages API
+type twilioNotifier struct {
+    baseURL    string
+    accountSID string
+    authToken  string
+    from       string
+    client     *http.Client
+}
+
+func (n *twilioNotifier) Channel() string { return ChannelSMS }
+
+func (n *twilioNotifier) Send(ctx context.Context, to string, msg Notification) error {
+    form := url.Values{"To": {to}, "From": {n.from}, "Body": {msg.Body}}
+    endpoint := strings.TrimRight(n.baseURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(n.accountSID) + "/Messages.json"
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+    if err != nil { return err }
+    req.SetBasicAuth(n.accountSID, n.authToken)
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    resp, err := n.client.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        var apiErr struct{ Message string `json:"message"` }
+        _ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apiErr)
+        return fmt.Errorf("twilio returned %d: %s", resp.StatusCode, apiErr.Message)
+    }
+    return nil
+}
+
+// notifiersFromConfig builds the notifiers NOTIFIERS names ("smtp", "twilio")
+func notifiersFromConfig(c Config) []Notifier {
+    var out []Notifier
+    for _, name := range splitList(c.Notifiers) {
+        switch name {
+        case "smtp":
+            out = append(out, &smtpNotifier{mailer: smtpMailerFromConfig(c)})
+        case "twilio":
+            out = append(out, &twilioNotifier{baseURL: c.TwilioBaseURL, accountSID: c.TwilioAccountSID, authToken: c.TwilioAuthToken,
+                from: c.TwilioFrom, client: &http.Client{Timeout: 10 * time.Second}})
+        }
+    }
+    return out
+}
+
+// notificationDispatcher subscribes to the event hub and notifies patients of their
+// prescriptions on the channels they opted into. Delivery runs in the background with
+// exponential backoff, so publishing handlers never wait on a mail relay or SMS gateway.
+// Close stops it at server shutdown; notifications still waiting to be sent then are dropped.
+type notificationDispatcher struct {
+    repo        Repository
+    notifiers   map[string]Notifier
+    maxAttempts int
+    baseBackoff time.Duration
+    // pending counts notifications not yet delivered or given up on
+    pending     atomic.Int64
+    // ctx is cancelled by Close, which waits for wg
+    ctx         context.Context
+    cancel      context.CancelFunc
+    wg          sync.WaitGroup
+    mu          sync.Mutex
+    closed      bool
+}
+
+// newNotificationDispatcher returns nil when there are no notifiers
+func newNotificationDispatcher(repo Repository, notifiers []Notifier) *notificationDispatcher {
+    if len(notifiers) == 0 { return nil }
+    d := &notificationDispatcher{repo: repo, notifiers: map[string]Notifier{}, maxAttempts: 5, baseBackoff: 2 * time.Second}
+    d.ctx, d.cancel = context.WithCancel(context.Background())
+    for _, n := range notifiers { d.notifiers[n.Channel()] = n }
+    return d
+}
+
+// spawn runs fn in the background unless the dispatcher is closed
+func (d *notificationDispatcher) spawn(fn func()) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.closed { return }
+    d.pending.Add(1)
+    d.wg.Add(1)
+    go func() {
+        defer d.wg.Done()
+        defer d.pending.Add(-1)
+        fn()
+    }()
+}
+
+// Close cancels delivery in progress, including retries waiting out their backoff, and
+// waits for it to return or for ctx to be done
+func (d *notificationDispatcher) Close(ctx context.Context) error {
+    d.mu.Lock()
+    d.closed = true
+    d.mu.Unlock()
+    d.cancel()
+    done := make(chan struct{})
+    go func() {
+        d.wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// Handle is the event hub subscription; it returns immediately
+func (d *notificationDispatcher) Handle(eventType string, data any) {
+    if eventType != EventPrescriptionCreated { return }
+    var id int64
+    switch p := data.(type) {
+    case *Prescription:
+        id = p.ID
+    case Prescription:
+        id = p.ID
+    default:
+        return
+    }
+    d.spawn(func() { d.notifyPrescription(id) })
+}
+
+// notifyPrescription looks up the prescription, the patient's preferences, and their
+// contact details, and sends on each enabled channel
+func (d *notificationDispatcher) notifyPrescription(id int64) {
+    ctx := d.ctx
+    p, err := d.repo.GetPrescription(ctx, id)
+    if err != nil {
+        log.Printf("notifications: loading prescription %d failed: %v", id, err)
+        return
+    }
+    prefs, err := d.repo.GetNotificationPreferences(ctx, p.PatientID)
+    if errors.Is(err, ErrNotFound) || (err == nil && !prefs.Email && !prefs.SMS) { return }
+    if err != nil {
+        log.Printf("notifications: loading preferences of patient %d failed: %v", p.PatientID, err)
+        return
+    }
+    patient, err := d.repo.GetPatientDetail(ctx, p.PatientID)
+    if err != nil {
+        if !errors.Is(err, ErrNotFound) { log.Printf("notifications: loading patient %d failed: %v", p.PatientID, err) }
+        return
+    }
+    msg := Notification{
+        Subject: "New prescription: " + p.DrugName,
+        Body: p.PhysicianName + " prescribed " + p.DrugName + " (quantity " + strconv.Itoa(p.Quantity) + ", " + p.Sig + ")." +
+            " Prescription #" + strconv.FormatInt(p.ID, 10) + ".",
+    }
+    for _, target := range []struct {
+        enabled bool
+        channel string
+        to      string
+    }{{prefs.Email, ChannelEmail, patient.Email}, {prefs.SMS, ChannelSMS, patient.Phone}} {
+        n := d.notifiers[target.channel]
+        if !target.enabled || n == nil || target.to == "" { continue }
+        to := target.to
+        d.spawn(func() { d.send(n, to, msg, "prescription "+strconv.FormatInt(id, 10)) })
+    }
+}
+
+func (d *notificationDispatcher) send(n Notifier, to string, msg Notification, about string) {
+    backoff := d.baseBackoff
+    for attempt := 1; ; attempt++ {
+        ctx, cancel := context.WithTimeout(d.ctx, 30*time.Second)
+        err := n.Send(ctx, to, msg)
+        cancel()
+        if err == nil { return }
+        if attempt == d.maxAttempts {
+            log.Printf("notifications: %s notification for %s failed after %d attempts: %v", n.Channel(), about, attempt, err)
+            return
+        }
+        timer := time.NewTimer(backoff)
+        select {
+        case <-d.ctx.Done():
+            timer.Stop()
+            log.Printf("notifications: %s notification for %s dropped at shutdown after %d attempts: %v", n.Channel(), about, attempt, err)
+            return
+        case <-timer.C:
+        }
+        backoff *= 2
+    }
+}
+
+// handleNotificationPreferences serves /patients/{id}/notification-preferences:
+//   GET  the patient's channels (both false until they opt in)
+//   PUT  {"email":true,"sms":false} replace them; a channel needs an address on file
+func (s *Server) handleNotificationPreferences(w http.ResponseWriter, r *http.Request, patientID int64) {
+    switch r.Method {
+    case http.MethodGet:
+        if _, ok := s.can(w, r, ActNotificationRead, Resource{PatientID: patientID}); !ok { return }
+        prefs, err := s.repo.GetNotificationPreferences(r.Context(), patientID)
+        if err != nil {
+            if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "patient not found"); return }
+            writeError(w, http.StatusInternalServerError, "failed to load notification preferences")
+            return
+        }
+        writeJSON(w, http.StatusOK, prefs)
+    case http.MethodPut:
+        if _, ok := s.can(w, r, ActNotificationWrite, Resource{PatientID: patientID}); !ok { return }
+        var req struct {
+            Email bool `json:"email"`
+            SMS   bool `json:"sms"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        patient, err := s.repo.GetPatientDetail(r.Context(), patientID)
+        if err != nil {
+            if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "patient not found"); return }
+            writeError(w, http.StatusInternalServerError, "failed to load patient")
+            return
+        }
+        if req.Email && patient.Email == "" { writeError(w, http.StatusBadRequest, "patient has no email address on file"); return }
+        if req.SMS && patient.Phone == "" { writeError(w, http.StatusBadRequest, "patient has no phone number on file"); return }
+        prefs, err := s.repo.SetNotificationPreferences(r.Context(), &NotificationPreferences{PatientID: patientID, Email: req.Email, SMS: req.SMS})
+        if err != nil {
+            if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "patient not found"); return }
+            writeError(w, http.StatusInternalServerError, "failed to save notification preferences")
+            return
+        }
+        writeJSON(w, http.StatusOK, prefs)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeNotifier records what it sends and fails the first failures attempts
+type fakeNotifier struct {
+    channel  string
+    mu       sync.Mutex
+    failures int
+    sent     []string
+}
+
+func (n *fakeNotifier) Channel() string { return n.channel }
+
+func (n *fakeNotifier) Send(_ context.Context, to string, msg Notification) error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    if n.failures > 0 {
+        n.failures--
+        return errors.New("gateway unavailable")
+    }
+    n.sent = append(n.sent, to+": "+msg.Body)
+    return nil
+}
+
+func TestNotificationPreferencesEndpoints(t *testing.T) {
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        userID       string
+        expectStatus int
+        expectBody   string
+    }{
+        {name: "patient reads own defaults", method: http.MethodGet, path: "/patients/1/notification-preferences", role: "patient", userID: "1", expectStatus: http.StatusOK, expectBody: `"email":false,"sms":false`},
+        {name: "patient opts in", method: http.MethodPut, path: "/patients/1/notification-preferences", body: `{"email":true,"sms":true}`, role: "patient", userID: "1", expectStatus: http.StatusOK, expectBody: `"email":true,"sms":true`},
+        {name: "no phone on file", method: http.MethodPut, path: "/patients/3/notification-preferences", body: `{"sms":true}`, role: "patient", userID: "3", expectStatus: http.StatusBadRequest},
+        {name: "other patient", method: http.MethodGet, path: "/patients/2/notification-preferences", role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "physician forbidden", method: http.MethodPut, path: "/patients/1/notification-preferences", body: `{"email":true}`, role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "admin missing patient", method: http.MethodGet, path: "/patients/99/notification-preferences", role: "admin", userID: "1", expectStatus: http.StatusNotFound},
+        {name: "bad method", method: http.MethodPost, path: "/patients/1/notification-preferences", body: `{}`, role: "admin", userID: "1", expectStatus: http.StatusMethodNotAllowed},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, tc.method, tc.path, tc.body, tc.role, tc.userID)
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if tc.expectBody != "" && !strings.Contains(rr.Body.String(), tc.expectBody) { t.Fatalf("body = %s, want %s", rr.Body.String(), tc.expectBody) }
+        })
+    }
+}
+
+func TestNotificationPreferencesPreflight(t *testing.T) {
+    // The web app sets preferences with PUT, which browsers preflight
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    req := httptest.NewRequest(http.MethodOptions, "/v1/patients/1/notification-preferences", nil)
+    req.Header.Set("Origin", "http://localhost:5173")
+    req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    if rr.Code != http.StatusNoContent || !strings.Contains(rr.Header().Get("Access-Control-Allow-Methods"), http.MethodPut) {
+        t.Fatalf("preflight = %d %q", rr.Code, rr.Header().Get("Access-Control-Allow-Methods"))
+    }
+}
+
+func TestPrescriptionNotifications(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    email, sms := &fakeNotifier{channel: ChannelEmail, failures: 2}, &fakeNotifier{channel: ChannelSMS}
+    srv.notifications = newNotificationDispatcher(repo, []Notifier{email, sms})
+    srv.notifications.baseBackoff = time.Millisecond
+    srv.webhooks.Subscribe(srv.notifications.Handle)
+    // Alice (email and phone on file) opts into email only; Bob never opts in
+    if _, err := repo.SetNotificationPreferences(context.Background(), &NotificationPreferences{PatientID: 1, Email: true}); err != nil { t.Fatal(err) }
+
+    for _, body := range []string{
+        `{"patient_id":1,"physician_id":1,"drug_name":"Amoxicillin","quantity":20,"sig":"1 tab BID"}`,
+        `{"patient_id":2,"physician_id":1,"drug_name":"Ibuprofen","quantity":10,"sig":"PRN"}`,
+    } {
+        rr := consentRequest(srv, http.MethodPost, "/prescriptions", body, "physician", "1")
+        if rr.Code != http.StatusCreated { t.Fatalf("create status = %d, body=%s", rr.Code, rr.Body.String()) }
+    }
+    deadline := time.Now().Add(2 * time.Second)
+    for srv.notifications.pending.Load() > 0 && time.Now().Before(deadline) { time.Sleep(time.Millisecond) }
+
+    email.mu.Lock()
+    defer email.mu.Unlock()
+    if len(email.sent) != 1 || !strings.HasPrefix(email.sent[0], "alice@example.com: Dr. Smith prescribed Amoxicillin (quantity 20, 1 tab BID).") {
+        t.Fatalf("emails = %q", email.sent)
+    }
+    if len(sms.sent) != 0 { t.Fatalf("texts = %q", sms.sent) }
+}
+
+func TestNotificationDispatcherClose(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    if _, err := repo.SetNotificationPreferences(context.Background(), &NotificationPreferences{PatientID: 1, Email: true}); err != nil { t.Fatal(err) }
+    email := &fakeNotifier{channel: ChannelEmail, failures: 100}
+    d := newNotificationDispatcher(repo, []Notifier{email})
+    d.baseBackoff = time.Hour
+    d.Handle(EventPrescriptionCreated, Prescription{ID: 1})
+    // Wait until the first attempt failed and the retry is waiting out its backoff
+    deadline := time.Now().Add(2 * time.Second)
+    for time.Now().Before(deadline) {
+        email.mu.Lock()
+        failed := email.failures < 100
+        email.mu.Unlock()
+        if failed { break }
+        time.Sleep(time.Millisecond)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    if err := d.Close(ctx); err != nil { t.Fatalf("Close = %v", err) }
+    if n := d.pending.Load(); n != 0 { t.Fatalf("pending after Close = %d", n) }
+    // Events published after shutdown started are not delivered
+    d.Handle(EventPrescriptionCreated, Prescription{ID: 1})
+    if n := d.pending.Load(); n != 0 { t.Fatalf("pending after a closed Handle = %d", n) }
+}
+
+func TestNotificationHeaderInjection(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    rr := consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_name":"Amoxicillin\r\nBcc: x@example.com","quantity":20,"sig":"1 tab BID"}`, "physician", "1")
+    if rr.Code != http.StatusBadRequest { t.Fatalf("create status = %d, body=%s", rr.Code, rr.Body.String()) }
+
+    // Whatever reaches the mailer, a header value stays on its line
+    m := &smtpMailer{from: "rx@example.com"}
+    msg := m.message([]string{"alice@example.com"}, "New prescription: Amoxicillin\r\nBcc: x@example.com", "line 1\nline 2")
+    header, body, _ := strings.Cut(msg, "\r\n\r\n")
+    if strings.Contains(header, "\r\nBcc:") || !strings.Contains(header, "\r\nSubject: New prescription: Amoxicillin Bcc: x@example.com\r\n") {
+        t.Fatalf("header = %q", header)
+    }
+    if body != "line 1\r\nline 2" { t.Fatalf("body = %q", body) }
+}
+
+func TestTwilioNotifier(t *testing.T) {
+    var got *http.Request
+    var form string
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r
+        _ = r.ParseForm()
+        form = r.PostForm.Encode()
+        if r.PostForm.Get("To") == "+15550000" {
+            w.WriteHeader(http.StatusBadRequest)
+            _, _ = w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+            return
+        }
+        w.WriteHeader(http.StatusCreated)
+    }))
+    defer ts.Close()
+    n := &twilioNotifier{baseURL: ts.URL, accountSID: "AC123", authToken: "secret", from: "+15551234", client: ts.Client()}
+
+    if err := n.Send(context.Background(), "+15550101", Notification{Subject: "ignored", Body: "hello"}); err != nil { t.Fatalf("send: %v", err) }
+    user, pass, _ := got.BasicAuth()
+    if got.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" || user != "AC123" || pass != "secret" || form != "Body=hello&From=%2B15551234&To=%2B15550101" {
+        t.Fatalf("request = %s %s:%s %s", got.URL.Path, user, pass, form)
+    }
+    if err := n.Send(context.Background(), "+15550000", Notification{Body: "hello"}); err == nil || !strings.Contains(err.Error(), "Invalid 'To' Phone Number") {
+        t.Fatalf("error = %v", err)
+    }
+}
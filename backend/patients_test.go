@@ -0,0 +1,57 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestGetPatientDetail(t *testing.T) {
+    // Demo data: Dr. Smith (1) is linked to Alice (1) and Bob (2); Dr. Jones (2) to Bob and Carol (3)
+    cases := []struct {
+        name         string
+        path         string
+        role, userID string
+        expectStatus int
+    }{
+        {name: "admin views anyone", path: "/v1/patients/3", role: "admin", userID: "1", expectStatus: http.StatusOK},
+        {name: "patient views self", path: "/v1/patients/1", role: "patient", userID: "1", expectStatus: http.StatusOK},
+        {name: "patient views other", path: "/v1/patients/2", role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "linked physician", path: "/v1/patients/1", role: "physician", userID: "1", expectStatus: http.StatusOK},
+        {name: "unlinked physician", path: "/v1/patients/1", role: "physician", userID: "2", expectStatus: http.StatusForbidden},
+        {name: "pharmacist forbidden", path: "/v1/patients/1", role: "pharmacist", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "missing patient", path: "/v1/patients/99", role: "admin", userID: "1", expectStatus: http.StatusNotFound},
+        {name: "bad id", path: "/v1/patients/abc", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestGetPatientDetailBody(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    req := httptest.NewRequest(http.MethodGet, "/v1/patients/1", nil)
+    req.Header.Set("X-Role", "patient")
+    req.Header.Set("X-User-ID", "1")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    if rr.Code != http.StatusOK { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var d PatientDetail
+    if err := json.NewDecoder(rr.Body).Decode(&d); err != nil { t.Fatal(err) }
+    if d.Name != "Alice" || d.BirthDate != "1985-04-12" || d.Sex != "female" || d.Email != "alice@example.com" {
+        t.Fatalf("detail = %+v", d)
+    }
+    if len(d.Physicians) != 1 || d.Physicians[0].ID != 1 { t.Fatalf("physicians = %+v", d.Physicians) }
+    if d.ActivePrescriptions != 2 || d.LastVisitAt == nil { t.Fatalf("active = %d, last visit = %v", d.ActivePrescriptions, d.LastVisitAt) }
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// US Letter in points
+const (
+    pdfPageWidth  = 612.0
+    pdfPageHeight = 792.0
+)
+
+// pdfDoc is a minimal PDF 1.4 writer for generated documents: Letter pages with text in
+// the standard Helvetica fonts and straight rules. The standard fonts need no embedding,
+// so output stays small and any viewer renders it; text outside WinAnsi prints as "?".
+type pdfDoc struct {
+    title string
+    pages []*bytes.Buffer
+    // cur is the page being drawn on
+    cur   int
+}
+
+// addPage starts a new page and draws on it
+func (d *pdfDoc) addPage() {
+    d.pages = append(d.pages, &bytes.Buffer{})
+    d.cur = len(d.pages) - 1
+}
+
+func (d *pdfDoc) page() *bytes.Buffer { return d.pages[d.cur] }
+
+// text draws s with its baseline starting at (x, y), measured from the bottom left
+func (d *pdfDoc) text(x, y, size float64, bold bool, s string) {
+    font := "F1"
+    if bold { font = "F2" }
+    fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+// rule draws a horizontal line from x1 to x2 at y
+func (d *pdfDoc) rule(x1, x2, y, width float64) {
+    fmt.Fprintf(d.page(), "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y, x2, y)
+}
+
+// bytes serializes the document: catalog, page tree, fonts, info, then one page and
+// content stream object per page, followed by the cross-reference table
+func (d *pdfDoc) bytes(created time.Time) []byte {
+    var out bytes.Buffer
+    var offsets []int
+    obj := func(body string) {
+        offsets = append(offsets, out.Len())
+        fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+    }
+    out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+    const firstPage = 6
+    kids := make([]string, len(d.pages))
+    for i := range d.pages { kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i) }
+    obj("<< /Type /Catalog /Pages 2 0 R >>")
+    obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+    obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+    obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+    obj(fmt.Sprintf("<< /Title (%s) /Producer (HealthCare Portal) /CreationDate (D:%s) >>", pdfEscape(d.title), created.UTC().Format("20060102150405Z")))
+    for i, content := range d.pages {
+        obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+            pdfPageWidth, pdfPageHeight, firstPage+2*i+1))
+        obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+    }
+    xref := out.Len()
+    fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+    for _, off := range offsets { fmt.Fprintf(&out, "%010d 00000 n \n", off) }
+    fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+    return out.Bytes()
+}
+
+// pdfEscape encodes s as WinAnsi for a PDF literal string
+func pdfEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case r == '\\' || r == '(' || r == ')':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r >= 32 && r < 127:
+            b.WriteRune(r)
+        case r >= 0xa0 && r <= 0xff:
+            // Latin-1 supplement is the same in WinAnsi; escape it to keep the stream ASCII
+            fmt.Fprintf(&b, "\\%03o", r)
+        default:
+            b.WriteByte('?')
+        }
+    }
+    return b.String()
+}
+
+// helveticaWidths are the Helvetica advance widths of ASCII 32..126 in 1/1000 em
+var helveticaWidths = [95]int{
+    278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+    556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+    1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+    667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+    333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+    556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfTextWidth is the width of s in points at size. Bold runs about 10% wider; callers
+// leave room for it.
+func pdfTextWidth(s string, size float64) float64 {
+    w := 0
+    for _, r := range s {
+        if r >= 32 && r < 127 { w += helveticaWidths[r-32] } else { w += 556 }
+    }
+    return float64(w) * size / 1000
+}
+
+// pdfWrap breaks s into lines no wider than width, at spaces where possible and
+// mid-word otherwise. Newlines in s are kept.
+func pdfWrap(s string, size, width float64) []string {
+    var lines []string
+    for _, para := range strings.Split(s, "\n") {
+        line := ""
+        for _, word := range strings.Fields(para) {
+            candidate := word
+            if line != "" { candidate = line + " " + word }
+            if pdfTextWidth(candidate, size) <= width {
+                line = candidate
+                continue
+            }
+            if line != "" { lines = append(lines, line) }
+            // A word wider than the column is split wherever it overflows
+            line = ""
+            for _, r := range word {
+                if line != "" && pdfTextWidth(line+string(r), size) > width {
+                    lines = append(lines, line)
+                    line = ""
+                }
+                line += string(r)
+            }
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
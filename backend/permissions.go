@@ -0,0 +1,346 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+)
+
+// Action names a permission as resource:verb
+type Action string
+
+const (
+    ActPrescriptionCreate   Action = "prescription:create"
+    // ActPrescriptionDraft creates a pending_signature draft for a supervising physician
+    ActPrescriptionDraft    Action = "prescription:draft"
+    ActPrescriptionSign     Action = "prescription:sign"
+    ActPrescriptionList     Action = "prescription:list"
+    ActPrescriptionExport   Action = "prescription:export"
+    // ActPrescriptionExportUnbounded allows raising the export row cap with max_rows
+    ActPrescriptionExportUnbounded Action = "prescription:export_unbounded"
+    ActPrescriptionDispense Action = "prescription:dispense"
+    ActPrescriptionDelete   Action = "prescription:delete"
+    // ActPrescriptionVerify checks a prescription against its e-signature
+    ActPrescriptionVerify   Action = "prescription:verify"
+    // ActPrescriptionBulk runs bulk status operations (cancel/expire) and reads their jobs
+    ActPrescriptionBulk     Action = "prescription:bulk"
+    // ActBackfillRun starts, pauses, and resumes data backfill jobs
+    ActBackfillRun          Action = "backfill:run"
+    ActCommentRead          Action = "comment:read"
+    ActCommentWrite         Action = "comment:write"
+    // ActAttachmentRead/Write cover files attached to prescriptions the caller can list
+    ActAttachmentRead       Action = "attachment:read"
+    ActAttachmentWrite      Action = "attachment:write"
+    ActPatientDelete        Action = "patient:delete"
+    // ActPatientRead is the patient detail record; own-scoped physicians also see linked patients
+    ActPatientRead          Action = "patient:read"
+    ActPhysicianDelete      Action = "physician:delete"
+    // ActPanelRead/Write cover a physician's patient panel (physician_patients links)
+    ActPanelRead            Action = "panel:read"
+    ActPanelWrite           Action = "panel:write"
+    // ActPatientTransfer moves a patient from one physician's panel to another's; own-scoped
+    // physicians may only hand over their own patients
+    ActPatientTransfer      Action = "patient:transfer"
+    // ActPhysicianRead finds physicians by name; own-scoped patients find their care team
+    ActPhysicianRead        Action = "physician:read"
+    // ActCareTeamRead lists the physicians linked to a patient
+    ActCareTeamRead         Action = "care_team:read"
+    ActAnalyticsRead        Action = "analytics:read"
+    ActDrugRead             Action = "drug:read"
+    ActDrugWrite            Action = "drug:write"
+    // ActDiagnosisRead searches the ICD-10-CM code list
+    ActDiagnosisRead        Action = "diagnosis:read"
+    ActPharmacyRead         Action = "pharmacy:read"
+    ActPharmacyWrite        Action = "pharmacy:write"
+    ActWebhookManage        Action = "webhook:manage"
+    // ActConfigRead views the effective (redacted) configuration
+    ActConfigRead           Action = "config:read"
+    // ActProvenanceRead looks up who generated an exported document and verifies its hash
+    ActProvenanceRead       Action = "provenance:read"
+    // ActDelegationRead/Write cover the nurses a physician delegates drafting to
+    ActDelegationRead       Action = "delegation:read"
+    ActDelegationWrite      Action = "delegation:write"
+    // ActConsentRead/Write cover the consents a patient grants to linked physicians
+    ActConsentRead          Action = "consent:read"
+    ActConsentWrite         Action = "consent:write"
+    // ActOrgRead/Write cover the organization (tenant) registry
+    ActOrgRead              Action = "org:read"
+    ActOrgWrite             Action = "org:write"
+    // ActHL7Ingest accepts HL7 v2 messages from interface engines; ActHL7Quarantine lists the rejected ones
+    ActHL7Ingest            Action = "hl7:ingest"
+    ActHL7Quarantine        Action = "hl7:quarantine"
+    // ActNotificationRead/Write cover a patient's notification channel preferences
+    ActNotificationRead     Action = "notification:read"
+    ActNotificationWrite    Action = "notification:write"
+    // ActStatsRead is the system-wide admin dashboard
+    ActStatsRead            Action = "stats:read"
+)
+
+var knownActions = map[Action]bool{
+    ActPrescriptionCreate: true, ActPrescriptionDraft: true, ActPrescriptionSign: true, ActPrescriptionList: true, ActPrescriptionExport: true,
+    ActPrescriptionExportUnbounded: true, ActPrescriptionDispense: true, ActPrescriptionDelete: true, ActPrescriptionVerify: true,
+    ActPrescriptionBulk: true, ActBackfillRun: true,
+    ActCommentRead: true, ActCommentWrite: true, ActAttachmentRead: true, ActAttachmentWrite: true, ActPatientDelete: true, ActPatientRead: true, ActPhysicianDelete: true,
+    ActPanelRead: true, ActPanelWrite: true, ActPatientTransfer: true, ActCareTeamRead: true, ActPhysicianRead: true, ActAnalyticsRead: true,
+    ActDrugRead: true, ActDrugWrite: true, ActDiagnosisRead: true, ActPharmacyRead: true, ActPharmacyWrite: true,
+    ActWebhookManage: true, ActConfigRead: true, ActProvenanceRead: true, ActDelegationRead: true, ActDelegationWrite: true,
+    ActConsentRead: true, ActConsentWrite: true, ActOrgRead: true, ActOrgWrite: true,
+    ActHL7Ingest: true, ActHL7Quarantine: true, ActNotificationRead: true, ActNotificationWrite: true, ActStatsRead: true,
+}
+
+// Scope is how far a granted action reaches
+type Scope string
+
+const (
+    // ScopeOwn limits the action to resources owned by the caller (see RolePolicy.Owns)
+    ScopeOwn Scope = "own"
+    ScopeAll Scope = "all"
+)
+
+// Ownership fields a role's X-User-ID can be matched against
+const (
+    OwnsPatient   = "patient_id"
+    OwnsPhysician = "physician_id"
+    OwnsPharmacy  = "pharmacy_id"
+    // OwnsNurse matches the nurse who drafted a prescription
+    OwnsNurse     = "nurse_id"
+)
+
+// RolePolicy is one role's row of the permission matrix
+type RolePolicy struct {
+    // Owns names the resource field compared with the caller's X-User-ID under ScopeOwn
+    Owns        string           `json:"owns,omitempty"`
+    Permissions map[Action]Scope `json:"permissions"`
+}
+
+// Policy is the role→permission matrix
+type Policy map[Role]RolePolicy
+
+var defaultPolicy = Policy{
+    RoleAdmin: {Permissions: map[Action]Scope{
+        ActPrescriptionList: ScopeAll, ActPrescriptionExport: ScopeAll, ActPrescriptionExportUnbounded: ScopeAll,
+        ActPrescriptionDelete: ScopeAll, ActPrescriptionVerify: ScopeAll, ActPrescriptionBulk: ScopeAll, ActBackfillRun: ScopeAll, ActCommentRead: ScopeAll, ActCommentWrite: ScopeAll,
+        ActAttachmentRead: ScopeAll, ActAttachmentWrite: ScopeAll,
+        ActPatientDelete: ScopeAll, ActPatientRead: ScopeAll, ActPhysicianDelete: ScopeAll,
+        ActPanelRead: ScopeAll, ActPanelWrite: ScopeAll, ActPatientTransfer: ScopeAll, ActCareTeamRead: ScopeAll, ActPhysicianRead: ScopeAll, ActAnalyticsRead: ScopeAll,
+        ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActDrugWrite: ScopeAll, ActPharmacyRead: ScopeAll, ActPharmacyWrite: ScopeAll,
+        ActWebhookManage: ScopeAll, ActConfigRead: ScopeAll, ActProvenanceRead: ScopeAll, ActDelegationRead: ScopeAll, ActDelegationWrite: ScopeAll,
+        ActConsentRead: ScopeAll, ActConsentWrite: ScopeAll, ActOrgRead: ScopeAll, ActOrgWrite: ScopeAll,
+        ActHL7Ingest: ScopeAll, ActHL7Quarantine: ScopeAll, ActNotificationRead: ScopeAll, ActNotificationWrite: ScopeAll,
+        ActStatsRead: ScopeAll,
+    }},
+    // Org admins administer one clinic, the one their org_admins row belongs to, and every
+    // query is scoped to it. Shared catalogs, platform jobs, and configuration stay with admin.
+    RoleOrgAdmin: {Permissions: map[Action]Scope{
+        ActPrescriptionList: ScopeAll, ActPrescriptionExport: ScopeAll, ActPrescriptionDelete: ScopeAll, ActPrescriptionVerify: ScopeAll,
+        ActCommentRead: ScopeAll, ActCommentWrite: ScopeAll, ActAttachmentRead: ScopeAll, ActAttachmentWrite: ScopeAll,
+        ActPatientDelete: ScopeAll, ActPatientRead: ScopeAll, ActPhysicianDelete: ScopeAll,
+        ActPanelRead: ScopeAll, ActPanelWrite: ScopeAll, ActPatientTransfer: ScopeAll, ActCareTeamRead: ScopeAll, ActPhysicianRead: ScopeAll, ActAnalyticsRead: ScopeAll,
+        ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActPharmacyRead: ScopeAll, ActDelegationRead: ScopeAll, ActDelegationWrite: ScopeAll,
+        ActConsentRead: ScopeAll, ActConsentWrite: ScopeAll, ActOrgRead: ScopeAll,
+        ActHL7Ingest: ScopeAll, ActHL7Quarantine: ScopeAll, ActNotificationRead: ScopeAll, ActNotificationWrite: ScopeAll,
+    }},
+    RolePhysician: {Owns: OwnsPhysician, Permissions: map[Action]Scope{
+        ActPrescriptionCreate: ScopeOwn, ActPrescriptionSign: ScopeOwn, ActPrescriptionList: ScopeOwn, ActPrescriptionExport: ScopeOwn,
+        ActPrescriptionVerify: ScopeOwn,
+        ActCommentRead: ScopeOwn, ActCommentWrite: ScopeOwn, ActAttachmentRead: ScopeOwn, ActAttachmentWrite: ScopeOwn,
+        ActDelegationRead: ScopeOwn, ActDelegationWrite: ScopeOwn,
+        ActPanelRead: ScopeOwn, ActPanelWrite: ScopeOwn, ActPatientTransfer: ScopeOwn, ActPatientRead: ScopeOwn, ActAnalyticsRead: ScopeAll,
+        ActPhysicianRead: ScopeAll, ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActPharmacyRead: ScopeAll,
+    }},
+    RolePatient: {Owns: OwnsPatient, Permissions: map[Action]Scope{
+        ActPrescriptionList: ScopeOwn, ActPrescriptionExport: ScopeOwn, ActAttachmentRead: ScopeOwn, ActPatientRead: ScopeOwn,
+        ActCareTeamRead: ScopeOwn, ActPhysicianRead: ScopeOwn, ActAnalyticsRead: ScopeOwn, ActConsentRead: ScopeOwn, ActConsentWrite: ScopeOwn,
+        ActNotificationRead: ScopeOwn, ActNotificationWrite: ScopeOwn,
+        ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActPharmacyRead: ScopeAll,
+    }},
+    RolePharmacist: {Owns: OwnsPharmacy, Permissions: map[Action]Scope{
+        ActPrescriptionList: ScopeOwn, ActPrescriptionExport: ScopeOwn, ActPrescriptionDispense: ScopeOwn, ActPrescriptionVerify: ScopeOwn,
+        ActCommentRead: ScopeOwn, ActCommentWrite: ScopeOwn, ActAttachmentRead: ScopeOwn,
+        ActPhysicianRead: ScopeAll, ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActPharmacyRead: ScopeAll,
+    }},
+    // Nurses draft only for physicians who delegated to them and list only their own drafts
+    RoleNurse: {Owns: OwnsNurse, Permissions: map[Action]Scope{
+        ActPrescriptionDraft: ScopeOwn, ActPrescriptionList: ScopeOwn, ActAttachmentRead: ScopeOwn, ActAttachmentWrite: ScopeOwn,
+        ActPhysicianRead: ScopeAll, ActDrugRead: ScopeAll, ActDiagnosisRead: ScopeAll, ActPharmacyRead: ScopeAll,
+    }},
+}
+
+func (p Policy) validate() error {
+    for role, rp := range p {
+        switch rp.Owns {
+        case "", OwnsPatient, OwnsPhysician, OwnsPharmacy, OwnsNurse:
+        default:
+            return fmt.Errorf("role %q: unknown owns field %q", role, rp.Owns)
+        }
+        for action, scope := range rp.Permissions {
+            if !knownActions[action] { return fmt.Errorf("role %q: unknown action %q", role, action) }
+            if scope != ScopeOwn && scope != ScopeAll { return fmt.Errorf("role %q: action %q has invalid scope %q", role, action, scope) }
+            if scope == ScopeOwn && rp.Owns == "" { return fmt.Errorf("role %q: action %q is scoped own but the role owns nothing", role, action) }
+        }
+    }
+    return nil
+}
+
+// policyFromFile returns the matrix from the JSON file at path (RBAC_POLICY_FILE, which
+// replaces the defaults entirely, so roles can be added or restricted) or the defaults.
+func policyFromFile(path string) Policy {
+    if path == "" { return defaultPolicy }
+    b, err := os.ReadFile(path)
+    if err != nil { log.Fatalf("RBAC_POLICY_FILE: %v", err) }
+    var p Policy
+    if err := json.Unmarshal(b, &p); err != nil { log.Fatalf("RBAC_POLICY_FILE: invalid JSON: %v", err) }
+    if err := p.validate(); err != nil { log.Fatalf("RBAC_POLICY_FILE: %v", err) }
+    return p
+}
+
+// Principal is the authenticated caller. UserID is 0 when X-User-ID was not sent, which
+// only admins may do; OrgID is the caller's organization, 0 only for an admin who sent no
+// X-Org-ID and is therefore unscoped (see orgFromContext).
+type Principal struct {
+    Role   Role
+    UserID int64
+    Owns   string
+    OrgID  int64
+}
+
+// Resource carries the ownership fields of what an action targets; zero means unknown
+type Resource struct {
+    PatientID   int64
+    PhysicianID int64
+    PharmacyID  int64
+    NurseID     int64
+}
+
+func (res Resource) ownedBy(p Principal) bool {
+    switch p.Owns {
+    case OwnsPatient:
+        return res.PatientID != 0 && res.PatientID == p.UserID
+    case OwnsPhysician:
+        return res.PhysicianID != 0 && res.PhysicianID == p.UserID
+    case OwnsPharmacy:
+        return res.PharmacyID != 0 && res.PharmacyID == p.UserID
+    case OwnsNurse:
+        return res.NurseID != 0 && res.NurseID == p.UserID
+    }
+    return false
+}
+
+var (
+    // ErrUnauthenticated maps to 401; ErrForbidden to 403
+    ErrUnauthenticated = errors.New("unauthenticated")
+    ErrForbidden       = errors.New("forbidden")
+)
+
+type principalKey struct{}
+
+// principalResult is what ServeHTTP stores in the request context; err is set when the
+// X-Role header is invalid, userErr when X-User-ID is missing or invalid
+type principalResult struct {
+    p       Principal
+    err     error
+    userErr error
+}
+
+// withPrincipal parses the caller identity headers into the request context and scopes it
+// to the caller's organization. Only admins may be unscoped (and may pick an organization
+// with X-Org-ID); everyone else belongs to the organization of their own row (see
+// callerTable, cached in callerOrgs), and an X-Org-ID naming another one is refused.
+func (s *Server) withPrincipal(r *http.Request) *http.Request {
+    var res principalResult
+    role := Role(r.Header.Get("X-Role"))
+    rp, ok := s.policy[role]
+    orgID, orgErr := readOrgID(r)
+    switch {
+    case !ok:
+        res.err = fmt.Errorf("%w: invalid or missing X-Role header", ErrUnauthenticated)
+    case orgErr != nil:
+        res.err = fmt.Errorf("%w: %v", ErrUnauthenticated, orgErr)
+    default:
+        res.p = Principal{Role: role, Owns: rp.Owns, OrgID: orgID}
+        id, err := readUserID(r)
+        if err != nil {
+            res.userErr = fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+        } else {
+            res.p.UserID = id
+        }
+        if role != RoleAdmin { res.p.OrgID, res.err = s.callerOrg(r.Context(), res.p, res.userErr, orgID) }
+    }
+    ctx := context.WithValue(r.Context(), principalKey{}, res)
+    if res.err == nil && res.p.OrgID != 0 { ctx = withOrg(ctx, res.p.OrgID) }
+    return r.WithContext(ctx)
+}
+
+// callerOrg returns the organization of a non-admin caller's own row. It fails closed: a
+// caller without a valid X-User-ID, or whose role names no table, gets no access at all.
+func (s *Server) callerOrg(ctx context.Context, p Principal, userErr error, headerOrg int64) (int64, error) {
+    if userErr != nil { return 0, userErr }
+    table := callerTable(p)
+    if table == "" { return 0, fmt.Errorf("%w: role %s is not bound to an organization", ErrForbidden, p.Role) }
+    org, err := s.callerOrgs.lookup(ctx, s.repo, table, p.UserID)
+    if errors.Is(err, ErrNotFound) { return 0, fmt.Errorf("%w: unknown X-User-ID for role %s", ErrUnauthenticated, p.Role) }
+    if err != nil { return 0, fmt.Errorf("resolving the caller's organization: %w", err) }
+    if headerOrg != 0 && headerOrg != org { return 0, fmt.Errorf("%w: X-Org-ID is not the caller's organization", ErrForbidden) }
+    return org, nil
+}
+
+// principalOf returns the caller in ctx, for handlers that authorize field by field
+func principalOf(ctx context.Context) (Principal, error) {
+    res, _ := ctx.Value(principalKey{}).(principalResult)
+    if res.err != nil { return Principal{}, res.err }
+    if res.p.Role == "" { return Principal{}, fmt.Errorf("%w: invalid or missing X-Role header", ErrUnauthenticated) }
+    return res.p, nil
+}
+
+// scopeFor returns the caller and the scope at which action is granted to them
+func (s *Server) scopeFor(ctx context.Context, action Action) (Principal, Scope, error) {
+    res, _ := ctx.Value(principalKey{}).(principalResult)
+    if res.err != nil { return Principal{}, "", res.err }
+    if res.p.Role == "" { return Principal{}, "", fmt.Errorf("%w: invalid or missing X-Role header", ErrUnauthenticated) }
+    scope, ok := s.policy[res.p.Role].Permissions[action]
+    if !ok { return res.p, "", fmt.Errorf("%w: role %s may not %s", ErrForbidden, res.p.Role, action) }
+    if scope == ScopeOwn && res.userErr != nil { return res.p, "", res.userErr }
+    return res.p, scope, nil
+}
+
+// authorize checks that the caller in ctx may perform action on res
+func (s *Server) authorize(ctx context.Context, action Action, res Resource) (Principal, error) {
+    p, scope, err := s.scopeFor(ctx, action)
+    if err != nil { return p, err }
+    if scope == ScopeOwn && !res.ownedBy(p) {
+        return p, fmt.Errorf("%w: %s is limited to your own records", ErrForbidden, action)
+    }
+    return p, nil
+}
+
+// writeAuthError maps authorization errors to 401/403 responses, and a failed caller
+// lookup to 500
+func writeAuthError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, ErrUnauthenticated):
+        writeError(w, http.StatusUnauthorized, err.Error())
+    case errors.Is(err, ErrForbidden):
+        writeError(w, http.StatusForbidden, err.Error())
+    default:
+        log.Printf("auth: %v", err)
+        writeError(w, http.StatusInternalServerError, "failed to identify caller")
+    }
+}
+
+// can is authorize for handlers: it writes the 401/403 response and returns false on denial
+func (s *Server) can(w http.ResponseWriter, r *http.Request, action Action, res Resource) (Principal, bool) {
+    p, err := s.authorize(r.Context(), action, res)
+    if err != nil { writeAuthError(w, err); return p, false }
+    return p, true
+}
+
+// permit grants action at any scope, for handlers that scope queries themselves
+func (s *Server) permit(w http.ResponseWriter, r *http.Request, action Action) (Principal, Scope, bool) {
+    p, scope, err := s.scopeFor(r.Context(), action)
+    if err != nil { writeAuthError(w, err); return p, "", false }
+    return p, scope, true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestDefaultPolicyAuthorize(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    cases := []struct {
+        name         string
+        role, userID string
+        action       Action
+        res          Resource
+        expectErr    error
+    }{
+        {name: "physician creates as self", role: "physician", userID: "1", action: ActPrescriptionCreate, res: Resource{PhysicianID: 1}},
+        {name: "physician creates as other", role: "physician", userID: "1", action: ActPrescriptionCreate, res: Resource{PhysicianID: 2}, expectErr: ErrForbidden},
+        {name: "admin cannot create", role: "admin", userID: "1", action: ActPrescriptionCreate, res: Resource{PhysicianID: 1}, expectErr: ErrForbidden},
+        {name: "admin reads any panel", role: "admin", action: ActPanelRead, res: Resource{PhysicianID: 2}},
+        {name: "patient own care team", role: "patient", userID: "3", action: ActCareTeamRead, res: Resource{PatientID: 3}},
+        {name: "patient other care team", role: "patient", userID: "3", action: ActCareTeamRead, res: Resource{PatientID: 1}, expectErr: ErrForbidden},
+        {name: "own scope needs user id", role: "patient", action: ActCareTeamRead, res: Resource{PatientID: 3}, expectErr: ErrUnauthenticated},
+        {name: "pharmacist cannot write drugs", role: "pharmacist", userID: "1", action: ActDrugWrite, expectErr: ErrForbidden},
+        {name: "unknown role", role: "receptionist", userID: "1", action: ActDrugRead, expectErr: ErrUnauthenticated},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, "/", nil)
+            req.Header.Set("X-Role", tc.role)
+            if tc.userID != "" { req.Header.Set("X-User-ID", tc.userID) }
+            _, err := srv.authorize(srv.withPrincipal(req).Context(), tc.action, tc.res)
+            if tc.expectErr == nil && err != nil { t.Fatalf("unexpected error: %v", err) }
+            if tc.expectErr != nil && !errors.Is(err, tc.expectErr) { t.Fatalf("err = %v, want %v", err, tc.expectErr) }
+        })
+    }
+}
+
+func TestPolicyFromFile(t *testing.T) {
+    // A deployment-defined scribe sees what their physician sees
+    path := filepath.Join(t.TempDir(), "policy.json")
+    policy := `{
+        "admin": {"permissions": {"prescription:list": "all"}},
+        "scribe": {"owns": "physician_id", "permissions": {"prescription:list": "own", "panel:read": "own"}}
+    }`
+    if err := os.WriteFile(path, []byte(policy), 0o600); err != nil { t.Fatal(err) }
+    cfg := defaultConfig()
+    cfg.RBACPolicyFile = path
+    srv := NewServer(newDemoMemoryRepo(), cfg)
+
+    cases := []struct {
+        name         string
+        path         string
+        role, userID string
+        expectStatus int
+    }{
+        {name: "scribe lists physician's prescriptions", path: "/v1/prescriptions", role: "scribe", userID: "1", expectStatus: http.StatusOK},
+        {name: "scribe reads own panel", path: "/v1/physicians/1/patients", role: "scribe", userID: "1", expectStatus: http.StatusOK},
+        {name: "scribe reads other panel", path: "/v1/physicians/2/patients", role: "scribe", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "scribe has no analytics", path: "/v1/analytics/top-drugs?from=2025-01-01T00:00:00Z&to=2026-01-01T00:00:00Z", role: "scribe", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "physician dropped from policy", path: "/v1/prescriptions", role: "physician", userID: "1", expectStatus: http.StatusUnauthorized},
+        {name: "admin restricted", path: "/v1/drugs", role: "admin", userID: "1", expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestPolicyValidate(t *testing.T) {
+    cases := []struct {
+        name   string
+        policy Policy
+        valid  bool
+    }{
+        {name: "defaults", policy: defaultPolicy, valid: true},
+        {name: "unknown action", policy: Policy{"nurse": {Owns: OwnsPhysician, Permissions: map[Action]Scope{"prescription:approve": ScopeOwn}}}},
+        {name: "bad scope", policy: Policy{"nurse": {Owns: OwnsPhysician, Permissions: map[Action]Scope{ActPanelRead: "some"}}}},
+        {name: "own without owns", policy: Policy{"nurse": {Permissions: map[Action]Scope{ActPanelRead: ScopeOwn}}}},
+        {name: "unknown owns", policy: Policy{"nurse": {Owns: "ward_id", Permissions: map[Action]Scope{}}}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if err := tc.policy.validate(); (err == nil) != tc.valid { t.Fatalf("validate() = %v, valid=%v", err, tc.valid) }
+        })
+    }
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "reflect"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+)
+
+// queryClass groups PGRepo calls that share a client-side deadline
+type queryClass int
+
+const (
+    queryDefault queryClass = iota
+    // queryAnalytics covers the aggregate scans behind /analytics
+    queryAnalytics
+    // queryExport covers streaming exports, which run as long as the download
+    queryExport
+)
+
+func (c queryClass) String() string {
+    switch c {
+    case queryAnalytics:
+        return "analytics"
+    case queryExport:
+        return "export"
+    }
+    return "default"
+}
+
+// QueryTimeouts are the per-class deadlines PGRepo puts on each call; 0 means none
+type QueryTimeouts struct {
+    Default   time.Duration
+    Analytics time.Duration
+    Export    time.Duration
+}
+
+func (t QueryTimeouts) forClass(c queryClass) time.Duration {
+    switch c {
+    case queryAnalytics:
+        return t.Analytics
+    case queryExport:
+        return t.Export
+    }
+    return t.Default
+}
+
+type queryClassKey struct{}
+
+// withQueryClass marks the PGRepo calls made with ctx as belonging to class c
+func withQueryClass(ctx context.Context, c queryClass) context.Context {
+    return context.WithValue(ctx, queryClassKey{}, c)
+}
+
+func queryClassOf(ctx context.Context) queryClass {
+    c, _ := ctx.Value(queryClassKey{}).(queryClass)
+    return c
+}
+
+// queryContext bounds ctx by the deadline of its query class. An earlier deadline already
+// on ctx (e.g., the client went away) still wins.
+func (r *PGRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+    d := r.timeouts.forClass(queryClassOf(ctx))
+    if d <= 0 { return context.WithCancel(ctx) }
+    return context.WithTimeout(ctx, d)
+}
+
+type pgTxKey struct{}
+
+// pgConn is what statements run on: the pool, or the transaction InTx put in ctx
+type pgConn interface {
+    Begin(ctx context.Context) (pgx.Tx, error)
+    Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+    Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+    QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// txOf returns the transaction ctx runs in, or nil
+func txOf(ctx context.Context) pgx.Tx {
+    tx, _ := ctx.Value(pgTxKey{}).(pgx.Tx)
+    return tx
+}
+
+// conn returns ctx's transaction when there is one and the primary otherwise. Beginning
+// on a transaction opens a savepoint, so methods that need their own transaction nest.
+func (r *PGRepo) conn(ctx context.Context) pgConn {
+    if tx := txOf(ctx); tx != nil { return tx }
+    return r.pool
+}
+
+// InTx runs fn in a transaction carried by the ctx it is passed. Nested calls open a savepoint.
+func (r *PGRepo) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+    return pgx.BeginFunc(ctx, r.conn(ctx), func(tx pgx.Tx) error {
+        return fn(context.WithValue(ctx, pgTxKey{}, tx))
+    })
+}
+
+// query, queryRow, and exec run one statement under queryContext. Inside InTx they use its
+// transaction. Otherwise reads go to readPool and are repeated on the primary when the
+// replica fails them; exec always uses the primary.
+func (r *PGRepo) query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+    ctx, cancel := r.queryContext(ctx)
+    if tx := txOf(ctx); tx != nil {
+        rows, err := tx.Query(ctx, sql, args...)
+        if err != nil {
+            cancel()
+            return nil, err
+        }
+        return cancelRows{rows, cancel}, nil
+    }
+    pool, replica := r.readPool(ctx)
+    rows, err := pool.Query(ctx, sql, args...)
+    if err != nil && replica && r.retryOnPrimary(err) {
+        rows, err = r.pool.Query(ctx, sql, args...)
+    }
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    return cancelRows{rows, cancel}, nil
+}
+
+func (r *PGRepo) queryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+    ctx, cancel := r.queryContext(ctx)
+    if tx := txOf(ctx); tx != nil { return cancelRow{tx.QueryRow(ctx, sql, args...), cancel} }
+    if _, replica := r.readPool(ctx); replica {
+        return replicaRow{r, ctx, cancel, sql, args}
+    }
+    return cancelRow{r.pool.QueryRow(ctx, sql, args...), cancel}
+}
+
+func (r *PGRepo) exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+    ctx, cancel := r.queryContext(ctx)
+    defer cancel()
+    return r.conn(ctx).Exec(ctx, sql, args...)
+}
+
+// cancelRows and cancelRow release the query deadline once the result is consumed
+type cancelRows struct {
+    pgx.Rows
+    cancel context.CancelFunc
+}
+
+func (c cancelRows) Close() {
+    c.Rows.Close()
+    c.cancel()
+}
+
+type cancelRow struct {
+    row    pgx.Row
+    cancel context.CancelFunc
+}
+
+func (c cancelRow) Scan(dest ...any) error {
+    defer c.cancel()
+    return c.row.Scan(dest...)
+}
+
+// replicaRow runs its query on the replica when scanned, and again on the primary if the
+// replica fails it
+type replicaRow struct {
+    r      *PGRepo
+    ctx    context.Context
+    cancel context.CancelFunc
+    sql    string
+    args   []any
+}
+
+func (q replicaRow) Scan(dest ...any) error {
+    defer q.cancel()
+    err := q.r.replica.QueryRow(q.ctx, q.sql, q.args...).Scan(dest...)
+    if err != nil && q.r.retryOnPrimary(err) {
+        return q.r.pool.QueryRow(q.ctx, q.sql, q.args...).Scan(dest...)
+    }
+    return err
+}
+
+type slowQueryStartKey struct{}
+
+type slowQueryStart struct {
+    at   time.Time
+    sql  string
+    args []any
+}
+
+// slowQueryTracer logs statements that take longer than threshold, with their request id,
+// query class, and redacted parameters
+type slowQueryTracer struct {
+    threshold time.Duration
+}
+
+func (t slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+    return context.WithValue(ctx, slowQueryStartKey{}, slowQueryStart{time.Now(), data.SQL, data.Args})
+}
+
+func (t slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+    start, ok := ctx.Value(slowQueryStartKey{}).(slowQueryStart)
+    if !ok { return }
+    elapsed := time.Since(start.at)
+    if elapsed < t.threshold { return }
+    status := "ok"
+    if data.Err != nil { status = data.Err.Error() }
+    log.Printf("slow query: %s class=%s request_id=%s status=%q sql=%q args=%s",
+        elapsed.Round(time.Millisecond), queryClassOf(ctx), requestID(ctx), status,
+        strings.Join(strings.Fields(start.sql), " "), redactQueryArgs(start.args))
+}
+
+// redactQueryArgs renders query parameters for logs. Strings may hold names, sigs, or
+// other PHI, so only their length is shown; numbers, times, and booleans are kept.
+func redactQueryArgs(args []any) string {
+    parts := make([]string, len(args))
+    for i, a := range args {
+        v := reflect.ValueOf(a)
+        for v.Kind() == reflect.Pointer && !v.IsNil() { v = v.Elem() }
+        switch {
+        case !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()):
+            parts[i] = "NULL"
+        case v.Kind() == reflect.String:
+            parts[i] = fmt.Sprintf("<string len=%d>", v.Len())
+        case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+            parts[i] = fmt.Sprintf("<%s len=%d>", v.Type(), v.Len())
+        case v.Type() == reflect.TypeOf(time.Time{}):
+            parts[i] = v.Interface().(time.Time).UTC().Format(time.RFC3339)
+        default:
+            parts[i] = fmt.Sprint(v.Interface())
+        }
+    }
+    return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "log"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+)
+
+func TestRedactQueryArgs(t *testing.T) {
+    id := int64(7)
+    var missing *int64
+    at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    got := redactQueryArgs([]any{"Alice Smith", &id, missing, nil, []int64{1, 2, 3}, at, true, 2.5})
+    want := "[<string len=11>, 7, NULL, NULL, <[]int64 len=3>, 2024-03-01T12:00:00Z, true, 2.5]"
+    if got != want { t.Fatalf("redactQueryArgs = %s, want %s", got, want) }
+    if strings.Contains(got, "Alice") { t.Fatal("string argument leaked") }
+}
+
+func TestQueryContextDeadlines(t *testing.T) {
+    r := &PGRepo{timeouts: QueryTimeouts{Default: time.Second, Analytics: time.Minute}}
+    cases := []struct {
+        name   string
+        ctx    context.Context
+        expect time.Duration // 0 means no deadline
+    }{
+        {name: "default", ctx: context.Background(), expect: time.Second},
+        {name: "analytics", ctx: withQueryClass(context.Background(), queryAnalytics), expect: time.Minute},
+        {name: "export unbounded", ctx: withQueryClass(context.Background(), queryExport)},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            ctx, cancel := r.queryContext(tc.ctx)
+            defer cancel()
+            dl, ok := ctx.Deadline()
+            if tc.expect == 0 {
+                if ok { t.Fatalf("unexpected deadline %s", dl) }
+                return
+            }
+            if left := time.Until(dl); !ok || left > tc.expect || left < tc.expect-time.Second/2 {
+                t.Fatalf("deadline in %s, want about %s", left, tc.expect)
+            }
+        })
+    }
+
+    // An earlier caller deadline wins over the class timeout
+    parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancelParent()
+    ctx, cancel := r.queryContext(withQueryClass(parent, queryAnalytics))
+    defer cancel()
+    if dl, _ := ctx.Deadline(); time.Until(dl) > 10*time.Millisecond { t.Fatalf("caller deadline lost: %s", time.Until(dl)) }
+}
+
+func TestSlowQueryTracer(t *testing.T) {
+    var buf bytes.Buffer
+    prev := log.Writer()
+    log.SetOutput(&buf)
+    defer log.SetOutput(prev)
+    tr := slowQueryTracer{threshold: 20 * time.Millisecond}
+    ctx := withQueryClass(context.WithValue(context.Background(), requestIDKey{}, "req-1"), queryAnalytics)
+    sql := "SELECT id\n    FROM patients WHERE name = $1"
+
+    fast := tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"Alice"}})
+    tr.TraceQueryEnd(fast, nil, pgx.TraceQueryEndData{})
+    if buf.Len() != 0 { t.Fatalf("fast query logged: %s", buf.String()) }
+
+    slow := tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"Alice"}})
+    time.Sleep(25 * time.Millisecond)
+    tr.TraceQueryEnd(slow, nil, pgx.TraceQueryEndData{Err: errors.New("canceling statement due to statement timeout")})
+    out := buf.String()
+    for _, want := range []string{"slow query", "class=analytics", "request_id=req-1", `sql="SELECT id FROM patients WHERE name = $1"`, "<string len=5>", "statement timeout"} {
+        if !strings.Contains(out, want) { t.Fatalf("log %q missing %q", out, want) }
+    }
+    if strings.Contains(out, "Alice") { t.Fatalf("argument leaked: %s", out) }
+}
+
+func TestNewPGRepoQueryTimeouts(t *testing.T) {
+    pg, err := NewPGRepo(context.Background(), "postgres://app@127.0.0.1:1/rx", defaultConfig().poolConfig())
+    if err != nil { t.Fatalf("NewPGRepo: %v", err) }
+    defer pg.pool.Close()
+    cc := pg.pool.Config().ConnConfig
+    if cc.RuntimeParams["statement_timeout"] != "60000" { t.Fatalf("statement_timeout = %q", cc.RuntimeParams["statement_timeout"]) }
+    if _, ok := cc.Tracer.(slowQueryTracer); !ok { t.Fatalf("tracer = %T", cc.Tracer) }
+    if pg.timeouts.Analytics != 30*time.Second { t.Fatalf("timeouts = %+v", pg.timeouts) }
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// handlePharmacies serves the pharmacy registry:
+//   GET  /pharmacies  list pharmacies for routing pickers (any role)
+//   POST /pharmacies  {"name":"...","address":"..."} register a pharmacy (admin)
+func (s *Server) handlePharmacies(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        if _, ok := s.can(w, r, ActPharmacyRead, Resource{}); !ok { return }
+        items, err := s.repo.ListPharmacies(r.Context())
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list pharmacies"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    case http.MethodPost:
+        if _, ok := s.can(w, r, ActPharmacyWrite, Resource{}); !ok { return }
+        var req struct {
+            Name    string `json:"name"`
+            Address string `json:"address"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        p := &Pharmacy{Name: strings.TrimSpace(req.Name), Address: strings.TrimSpace(req.Address)}
+        if p.Name == "" { writeError(w, http.StatusBadRequest, "name is required"); return }
+        if len(p.Name) > 200 || len(p.Address) > 500 { writeError(w, http.StatusBadRequest, "name or address too long"); return }
+        created, err := s.repo.CreatePharmacy(r.Context(), p)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to create pharmacy"); return }
+        writeJSON(w, http.StatusCreated, created)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// handlePrescriptionSubroutes serves endpoints under /prescriptions/{id}/...
+//   POST   /prescriptions/{id}/dispense  {"dispensed_quantity":N} (pharmacist of the routed pharmacy)
+//   POST   /prescriptions/{id}/sign      activate a nurse-drafted prescription (its physician)
+//   GET    /prescriptions/{id}/verify    check the prescription against its e-signature (see esign.go)
+//   DELETE /prescriptions/{id}           soft delete (admin)
+//   GET/POST /prescriptions/{id}/comments  internal care-team thread (see comments.go)
+func (s *Server) handlePrescriptionSubroutes(w http.ResponseWriter, r *http.Request) {
+    rest := strings.TrimPrefix(r.URL.Path, "/prescriptions/")
+    idStr, tail, found := strings.Cut(rest, "/")
+    if !found {
+        s.handleSoftDelete(w, r, ActPrescriptionDelete, "prescription", idStr, s.repo.SoftDeletePrescription)
+        return
+    }
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    attachments := tail == "attachments" || strings.HasPrefix(tail, "attachments/")
+    if err != nil || id <= 0 || (tail != "dispense" && tail != "comments" && tail != "sign" && tail != "verify" && !attachments) { writeError(w, http.StatusNotFound, "not found"); return }
+    if attachments {
+        s.handlePrescriptionAttachments(w, r, id, tail)
+        return
+    }
+    if tail == "comments" {
+        s.handlePrescriptionComments(w, r, id)
+        return
+    }
+    if tail == "verify" {
+        s.handleVerifyPrescription(w, r, id)
+        return
+    }
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if tail == "sign" {
+        s.handleSignPrescription(w, r, id)
+        return
+    }
+    s.handleDispensePrescription(w, r, id)
+}
+
+func (s *Server) handleDispensePrescription(w http.ResponseWriter, r *http.Request, id int64) {
+    // Dispensing is own-scoped to the caller's pharmacy; the repository enforces the
+    // routing match so prescriptions routed elsewhere read as missing.
+    p, scope, ok := s.permit(w, r, ActPrescriptionDispense)
+    if !ok { return }
+    if scope != ScopeOwn || p.Owns != OwnsPharmacy {
+        writeError(w, http.StatusForbidden, "dispensing requires a pharmacy identity")
+        return
+    }
+    pharmacyID := p.UserID
+
+    var req struct {
+        DispensedQuantity int `json:"dispensed_quantity"`
+    }
+    if !decodeJSON(w, r, &req) { return }
+    if req.DispensedQuantity <= 0 { writeError(w, http.StatusBadRequest, "dispensed_quantity must be > 0"); return }
+    // A signed prescription that no longer matches its signature was changed outside the
+    // API and is not dispensed. Unsigned ones predate signing and are let through.
+    if s.signer != nil {
+        rx, err := s.repo.GetPrescription(r.Context(), id)
+        if err == nil && rx.PharmacyID != nil && *rx.PharmacyID == pharmacyID && rx.Signature != "" && !s.signer.verify(*rx) {
+            log.Printf("esign: refusing to dispense prescription %d, which does not match its signature", id)
+            writeErrorCode(w, http.StatusConflict, CodeSignatureInvalid, "prescription does not match its signature")
+            return
+        }
+    }
+
+    dispensed, err := s.repo.DispensePrescription(r.Context(), id, pharmacyID, req.DispensedQuantity)
+    if err != nil {
+        switch {
+        case errors.Is(err, ErrNotFound):
+            // Prescriptions routed elsewhere are indistinguishable from missing ones
+            writeRepoError(w, err, "prescription not found")
+        case errors.Is(err, ErrNotActive):
+            writeRepoError(w, err, "prescription is cancelled or expired")
+        case errors.Is(err, ErrAlreadyDispensed):
+            writeRepoError(w, err, "prescription already dispensed")
+        case errors.Is(err, ErrDispenseQuantity):
+            writeRepoError(w, err, "dispensed_quantity exceeds prescribed quantity")
+        default:
+            writeError(w, http.StatusInternalServerError, "failed to dispense prescription")
+        }
+        return
+    }
+    writeJSON(w, http.StatusOK, dispensed)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestPharmacyRoutingAndDispense(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    do := func(method, path, role, userID, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-Role", role)
+        req.Header.Set("X-User-ID", userID)
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+
+    if rr := do(http.MethodPost, "/pharmacies", "physician", "1", `{"name":"Elm Pharmacy"}`); rr.Code != http.StatusForbidden {
+        t.Fatalf("physician register pharmacy = %d, want 403", rr.Code)
+    }
+    if rr := do(http.MethodPost, "/pharmacies", "admin", "1", `{"name":"Elm Pharmacy"}`); rr.Code != http.StatusCreated {
+        t.Fatalf("admin register pharmacy = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    if rr := do(http.MethodPost, "/prescriptions", "physician", "1", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab","pharmacy_id":99}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("unknown pharmacy = %d, want 400", rr.Code)
+    }
+
+    rr := do(http.MethodPost, "/prescriptions", "physician", "1", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab","pharmacy_id":1}`)
+    if rr.Code != http.StatusCreated { t.Fatalf("create routed = %d, body=%s", rr.Code, rr.Body.String()) }
+    var created Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&created)
+    path := "/prescriptions/" + strconv.FormatInt(created.ID, 10) + "/dispense"
+
+    // Pharmacy 1 sees only the routed prescription; pharmacy 2 sees nothing
+    var list struct{ Items []Prescription `json:"items"` }
+    rr = do(http.MethodGet, "/prescriptions", "pharmacist", "1", "")
+    _ = json.NewDecoder(rr.Body).Decode(&list)
+    if len(list.Items) != 1 || list.Items[0].ID != created.ID || list.Items[0].PharmacyName != "Main Street Pharmacy" {
+        t.Fatalf("pharmacist list = %+v", list.Items)
+    }
+
+    cases := []struct {
+        name         string
+        role, userID string
+        body         string
+        expectStatus int
+    }{
+        {name: "physician cannot dispense", role: "physician", userID: "1", body: `{"dispensed_quantity":30}`, expectStatus: http.StatusForbidden},
+        {name: "other pharmacy", role: "pharmacist", userID: "2", body: `{"dispensed_quantity":30}`, expectStatus: http.StatusNotFound},
+        {name: "over quantity", role: "pharmacist", userID: "1", body: `{"dispensed_quantity":31}`, expectStatus: http.StatusBadRequest},
+        {name: "dispensed", role: "pharmacist", userID: "1", body: `{"dispensed_quantity":28}`, expectStatus: http.StatusOK},
+        {name: "already dispensed", role: "pharmacist", userID: "1", body: `{"dispensed_quantity":2}`, expectStatus: http.StatusConflict},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            rr := do(http.MethodPost, path, tc.role, tc.userID, tc.body)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code != http.StatusOK { return }
+            var p Prescription
+            _ = json.NewDecoder(rr.Body).Decode(&p)
+            if p.DispensedAt == nil || p.DispensedQuantity == nil || *p.DispensedQuantity != 28 {
+                t.Fatalf("dispense not recorded: %+v", p)
+            }
+        })
+    }
+
+    if rr := do(http.MethodGet, "/analytics/top-drugs?from=2020-01-01T00:00:00Z&to=2030-01-01T00:00:00Z", "pharmacist", "1", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("pharmacist analytics = %d, want 403", rr.Code)
+    }
+}
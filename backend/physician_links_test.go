@@ -0,0 +1,70 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+func TestPhysicianPatientLinkEndpoints(t *testing.T) {
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        userID       string
+        expectStatus int
+        expectLinked bool
+        // consent grants Alice's consent to Dr. Smith before the request
+        consent      bool
+    }{
+        {name: "admin links", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":1}`, role: "admin", userID: "1", expectStatus: http.StatusCreated, expectLinked: true},
+        {name: "physician links own panel with consent", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":1}`, role: "physician", userID: "1", expectStatus: http.StatusCreated, expectLinked: true, consent: true},
+        {name: "physician without consent", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":1}`, role: "physician", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "physician other panel", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":1}`, role: "physician", userID: "2", expectStatus: http.StatusForbidden, consent: true},
+        {name: "patient forbidden", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":1}`, role: "patient", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "unknown patient", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":99}`, role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "duplicate is idempotent", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":2}`, role: "admin", userID: "1", expectStatus: http.StatusOK, expectLinked: true},
+        {name: "admin unlinks", method: http.MethodDelete, path: "/physicians/1/patients/2", role: "admin", userID: "1", expectStatus: http.StatusNoContent},
+        {name: "unlink missing is idempotent", method: http.MethodDelete, path: "/physicians/1/patients/1", role: "admin", userID: "1", expectStatus: http.StatusNoContent},
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            f := fixtures.New()
+            f.NewPatient("Alice")
+            f.NewPatient("Bob").WithPhysician("Dr. Smith")
+            f.Physician("Dr. Jones")
+            repo, ids := fixtureMemory(f)
+            physician, bob := ids.Physicians["Dr. Smith"], ids.Patients["Bob"]
+            srv := NewServer(repo, defaultConfig())
+            if tc.consent {
+                if _, err := repo.GrantConsent(context.Background(), &Consent{PatientID: 1, PhysicianID: physician, Scope: ConsentAllergies}); err != nil { t.Fatal(err) }
+            }
+
+            req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if tc.method == http.MethodPost && rr.Code < 300 {
+                linked, _ := repo.IsPhysicianPatientLinked(context.Background(), physician, 1)
+                if tc.expectStatus == http.StatusOK {
+                    linked, _ = repo.IsPhysicianPatientLinked(context.Background(), physician, bob)
+                }
+                if linked != tc.expectLinked {
+                    t.Fatalf("linked = %v, want %v", linked, tc.expectLinked)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "sync/atomic"
+)
+
+// Machine-readable error codes carried in the "code" member of error responses. Clients
+// branch on these, so they never change once released; the detail text may.
+const (
+    CodeBadRequest       = "VALIDATION_FAILED"
+    CodeUnauthenticated  = "UNAUTHENTICATED"
+    CodeForbidden        = "RBAC_FORBIDDEN"
+    CodeNotFound         = "NOT_FOUND"
+    CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+    CodeConflict         = "CONFLICT"
+    CodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+    CodeUnsupportedMedia = "UNSUPPORTED_MEDIA_TYPE"
+    CodeUnprocessable    = "UNPROCESSABLE"
+    CodeInternal         = "INTERNAL_ERROR"
+    CodeUnavailable      = "SERVICE_UNAVAILABLE"
+
+    // Repository outcomes (see problemFor)
+    CodeInvalidReference = "INVALID_REFERENCE"
+    CodeDuplicate        = "DUPLICATE"
+    CodeNotActive        = "PRESCRIPTION_NOT_ACTIVE"
+    CodeAlreadyDispensed = "ALREADY_DISPENSED"
+    CodeDispenseQuantity = "DISPENSE_QUANTITY_EXCEEDED"
+    CodeNotPending       = "NOT_PENDING_SIGNATURE"
+
+    // Access checks beyond the RBAC matrix
+    CodePhysicianNotLinked = "PHYSICIAN_NOT_LINKED"
+    CodeConsentRequired    = "CONSENT_REQUIRED"
+    CodeDelegationRequired = "DELEGATION_REQUIRED"
+
+    // CodeSignatureInvalid: a signed prescription no longer matches its e-signature
+    CodeSignatureInvalid = "SIGNATURE_INVALID"
+
+    // CodeDrugInteraction is reserved for interaction checks on new prescriptions
+    CodeDrugInteraction = "DRUG_INTERACTION"
+)
+
+// statusCodes is the code of errors written with writeError, by status
+var statusCodes = map[int]string{
+    http.StatusBadRequest:            CodeBadRequest,
+    http.StatusUnauthorized:          CodeUnauthenticated,
+    http.StatusForbidden:             CodeForbidden,
+    http.StatusNotFound:              CodeNotFound,
+    http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+    http.StatusConflict:              CodeConflict,
+    http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+    http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+    http.StatusUnprocessableEntity:   CodeUnprocessable,
+    http.StatusInternalServerError:   CodeInternal,
+    http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// sentinelProblems maps the repository and authorization sentinel errors to responses.
+// Handlers that see one of these from the repo write it with writeRepoError instead of
+// picking a status themselves, so the same failure looks the same on every endpoint.
+var sentinelProblems = []struct {
+    err    error
+    status int
+    code   string
+}{
+    {ErrNotFound, http.StatusNotFound, CodeNotFound},
+    {ErrInvalidReference, http.StatusBadRequest, CodeInvalidReference},
+    {ErrDuplicate, http.StatusConflict, CodeDuplicate},
+    {ErrNotActive, http.StatusConflict, CodeNotActive},
+    {ErrAlreadyDispensed, http.StatusConflict, CodeAlreadyDispensed},
+    {ErrDispenseQuantity, http.StatusBadRequest, CodeDispenseQuantity},
+    {ErrNotPending, http.StatusConflict, CodeNotPending},
+    {ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated},
+    {ErrForbidden, http.StatusForbidden, CodeForbidden},
+}
+
+// problemFor returns the status and code for err, or a 500 when it isn't a sentinel
+func problemFor(err error) (int, string) {
+    for _, p := range sentinelProblems {
+        if errors.Is(err, p.err) { return p.status, p.code }
+    }
+    return http.StatusInternalServerError, CodeInternal
+}
+
+// Problem is an RFC 7807 problem details object. Code is an extension member with the
+// stable machine-readable error code; Detail is for humans.
+type Problem struct {
+    Type      string `json:"type"`
+    Title     string `json:"title"`
+    Status    int    `json:"status"`
+    Detail    string `json:"detail,omitempty"`
+    Code      string `json:"code"`
+    RequestID string `json:"request_id,omitempty"`
+}
+
+const problemContentType = "application/problem+json"
+
+// legacyErrors switches error responses back to the old {"error": "...", "code": "..."}
+// body for clients not yet reading problem details (LEGACY_ERROR_FORMAT)
+var legacyErrors atomic.Bool
+
+// writeProblem writes an error response in the configured format
+func writeProblem(w http.ResponseWriter, status int, code, detail string) {
+    if legacyErrors.Load() {
+        body := map[string]string{"error": detail}
+        if code != statusCodes[status] { body["code"] = code }
+        writeJSON(w, status, body)
+        return
+    }
+    w.Header().Set("Content-Type", problemContentType)
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(Problem{
+        Type:      "about:blank",
+        Title:     http.StatusText(status),
+        Status:    status,
+        Detail:    detail,
+        Code:      code,
+        RequestID: w.Header().Get("X-Request-ID"),
+    })
+}
+
+// writeError writes an error with the generic code for status
+func writeError(w http.ResponseWriter, status int, msg string) {
+    code, ok := statusCodes[status]
+    if !ok { code = CodeInternal }
+    writeProblem(w, status, code, msg)
+}
+
+// writeErrorCode is writeError with a specific machine-readable code for the client to branch on
+func writeErrorCode(w http.ResponseWriter, status int, code, msg string) {
+    writeProblem(w, status, code, msg)
+}
+
+// writeRepoError writes the response problemFor maps err to, with msg as the detail
+func writeRepoError(w http.ResponseWriter, err error, msg string) {
+    status, code := problemFor(err)
+    writeProblem(w, status, code, msg)
+}
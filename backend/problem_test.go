@@ -0,0 +1,71 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        userID       string
+        expectStatus int
+        expectCode   string
+    }{
+        {name: "forbidden", method: http.MethodPost, path: "/prescriptions", body: `{}`, role: "patient", userID: "1", expectStatus: http.StatusForbidden, expectCode: CodeForbidden},
+        {name: "unauthenticated", method: http.MethodGet, path: "/prescriptions", role: "", expectStatus: http.StatusUnauthorized, expectCode: CodeUnauthenticated},
+        {name: "invalid body", method: http.MethodPost, path: "/prescriptions", body: `{`, role: "physician", userID: "1", expectStatus: http.StatusBadRequest, expectCode: CodeBadRequest},
+        {name: "invalid reference", method: http.MethodPost, path: "/prescriptions", body: `{"patient_id":1,"physician_id":1,"drug_id":999,"quantity":1,"sig":"PRN"}`, role: "physician", userID: "1", expectStatus: http.StatusBadRequest, expectCode: CodeInvalidReference},
+        {name: "not linked", method: http.MethodPost, path: "/prescriptions", body: `{"patient_id":3,"physician_id":1,"drug_name":"Ibuprofen","quantity":1,"sig":"PRN"}`, role: "physician", userID: "1", expectStatus: http.StatusForbidden, expectCode: CodePhysicianNotLinked},
+        {name: "repo not found", method: http.MethodGet, path: "/patients/99/notification-preferences", role: "admin", userID: "1", expectStatus: http.StatusNotFound, expectCode: CodeNotFound},
+        {name: "method not allowed", method: http.MethodDelete, path: "/prescriptions", role: "admin", userID: "1", expectStatus: http.StatusMethodNotAllowed, expectCode: CodeMethodNotAllowed},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, tc.method, tc.path, tc.body, tc.role, tc.userID)
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if ct := rr.Header().Get("Content-Type"); ct != problemContentType { t.Fatalf("Content-Type = %q", ct) }
+            var p Problem
+            if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil { t.Fatalf("invalid json: %v", err) }
+            if p.Code != tc.expectCode || p.Status != tc.expectStatus || p.Title != http.StatusText(tc.expectStatus) || p.Type != "about:blank" || p.Detail == "" {
+                t.Fatalf("problem = %+v, want code %s", p, tc.expectCode)
+            }
+            if p.RequestID == "" || p.RequestID != rr.Header().Get("X-Request-ID") { t.Fatalf("request_id = %q", p.RequestID) }
+        })
+    }
+}
+
+func TestLegacyErrorFormat(t *testing.T) {
+    legacyErrors.Store(true)
+    defer legacyErrors.Store(false)
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+
+    rr := consentRequest(srv, http.MethodGet, "/patients/99/notification-preferences", "", "admin", "1")
+    if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/json" || strings.TrimSpace(rr.Body.String()) != `{"error":"patient not found"}` {
+        t.Fatalf("legacy error = %d %s", rr.Code, rr.Body.String())
+    }
+    rr = consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":3,"physician_id":1,"drug_name":"Ibuprofen","quantity":1,"sig":"PRN"}`, "physician", "1")
+    if strings.TrimSpace(rr.Body.String()) != `{"code":"PHYSICIAN_NOT_LINKED","error":"physician not linked to patient"}` {
+        t.Fatalf("legacy coded error = %d %s", rr.Code, rr.Body.String())
+    }
+}
+
+func TestProblemFor(t *testing.T) {
+    for err, want := range map[error]string{
+        ErrNotActive:                               CodeNotActive,
+        ErrDispenseQuantity:                        CodeDispenseQuantity,
+        fmt.Errorf("insert drug: %w", ErrDuplicate): CodeDuplicate,
+        errors.New("connection reset"):             CodeInternal,
+    } {
+        if _, got := problemFor(err); got != want { t.Fatalf("problemFor(%v) = %s, want %s", err, got, want) }
+    }
+}
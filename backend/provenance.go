@@ -0,0 +1,94 @@
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+)
+
+type requestIDKey struct{}
+
+// validRequestID bounds caller-supplied X-Request-ID values so they are safe to log and embed
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// withRequestID tags r with the caller's X-Request-ID, or a generated one, and echoes it
+// in the response so a request can be followed from the client through logs and documents
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+    id := r.Header.Get("X-Request-ID")
+    if !validRequestID.MatchString(id) { id = newRandomID("req_") }
+    w.Header().Set("X-Request-ID", id)
+    return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// requestID returns the id withRequestID attached to ctx, or ""
+func requestID(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+func newRandomID(prefix string) string {
+    b := make([]byte, 12)
+    _, _ = rand.Read(b)
+    return prefix + hex.EncodeToString(b)
+}
+
+// DocumentProvenance records who generated a document, from which request or job, and
+// the SHA-256 of its content, so a copy presented back to the clinic can be verified
+type DocumentProvenance struct {
+    DocumentID string    `json:"document_id"`
+    // Kind is what was generated, e.g. prescription_export
+    Kind       string    `json:"kind"`
+    Format     string    `json:"format"`
+    // RequestID is the X-Request-ID of the generating request, or job:<id> for background jobs
+    RequestID  string    `json:"request_id"`
+    Actor      string    `json:"actor"`
+    // Params is the query that selected the content
+    Params     string    `json:"params,omitempty"`
+    Rows       int       `json:"rows"`
+    SHA256     string    `json:"sha256"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// Provenance footer markers. The footer is the last line of a document; SHA256 covers
+// every byte before it.
+const (
+    provenanceCSVPrefix = "# provenance "
+    provenanceJSONKey   = "_provenance"
+)
+
+// handleProvenance serves admin lookups of generated documents:
+//   GET /provenance/{document_id}
+//   GET /provenance?sha256=<hex>   find a document by the hash of its content
+func (s *Server) handleProvenance(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActProvenanceRead, Resource{}); !ok { return }
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    var (
+        doc *DocumentProvenance
+        err error
+    )
+    if id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/provenance"), "/"); id != "" {
+        doc, err = s.repo.GetProvenance(r.Context(), id)
+    } else {
+        sum := strings.ToLower(r.URL.Query().Get("sha256"))
+        if b, decErr := hex.DecodeString(sum); decErr != nil || len(b) != 32 {
+            writeError(w, http.StatusBadRequest, "sha256 must be 64 hex characters")
+            return
+        }
+        doc, err = s.repo.FindProvenanceBySHA256(r.Context(), sum)
+    }
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "no document with this provenance"); return }
+        writeError(w, http.StatusInternalServerError, "failed to look up provenance")
+        return
+    }
+    writeJSON(w, http.StatusOK, doc)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestExportProvenance(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    do := func(path, role, reqID string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, path, nil)
+        req.Header.Set("X-Role", role)
+        req.Header.Set("X-User-ID", "1")
+        if reqID != "" { req.Header.Set("X-Request-ID", reqID) }
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+
+    rr := do("/v1/prescriptions/export?format=csv", "admin", "trace-123")
+    if rr.Code != http.StatusOK { t.Fatalf("export status = %d", rr.Code) }
+    if got := rr.Header().Get("X-Request-ID"); got != "trace-123" { t.Fatalf("X-Request-ID = %q", got) }
+    docID := rr.Header().Get("X-Document-ID")
+
+    // The footer's hash covers everything before it
+    body := rr.Body.String()
+    cut := strings.LastIndex(strings.TrimSuffix(body, "\n"), "\n") + 1
+    content, footer := body[:cut], body[cut:]
+    sum := sha256.Sum256([]byte(content))
+    want := provenanceCSVPrefix + "document_id=" + docID + " request_id=trace-123 rows=4 sha256=" + hex.EncodeToString(sum[:]) + "\n"
+    if footer != want { t.Fatalf("footer = %q, want %q", footer, want) }
+
+    for _, path := range []string{"/v1/provenance/" + docID, "/v1/provenance?sha256=" + hex.EncodeToString(sum[:])} {
+        rr := do(path, "admin", "")
+        if rr.Code != http.StatusOK { t.Fatalf("%s status = %d, body=%s", path, rr.Code, rr.Body.String()) }
+        var doc DocumentProvenance
+        _ = json.NewDecoder(rr.Body).Decode(&doc)
+        if doc.DocumentID != docID || doc.RequestID != "trace-123" || doc.Actor != "admin:1" || doc.Rows != 4 || doc.Params != "format=csv" {
+            t.Fatalf("provenance = %+v", doc)
+        }
+    }
+
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        expectStatus int
+    }{
+        {name: "physician forbidden", path: "/v1/provenance/" + docID, role: "physician", expectStatus: http.StatusForbidden},
+        {name: "unknown document", path: "/v1/provenance/doc_missing", role: "admin", expectStatus: http.StatusNotFound},
+        {name: "unknown hash", path: "/v1/provenance?sha256=" + strings.Repeat("0", 64), role: "admin", expectStatus: http.StatusNotFound},
+        {name: "bad hash", path: "/v1/provenance?sha256=abc", role: "admin", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if rr := do(tc.path, tc.role, ""); rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestRequestIDGeneratedWhenInvalid(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+    req.Header.Set("X-Request-ID", "bad id\nwith newline")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    if got := rr.Header().Get("X-Request-ID"); !strings.HasPrefix(got, "req_") || len(got) != 28 { t.Fatalf("X-Request-ID = %q", got) }
+}
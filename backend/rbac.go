@@ -2,7 +2,6 @@ package main
 
 import (
     "errors"
-    "fmt"
     "net/http"
     "strconv"
 )
@@ -14,19 +13,15 @@ const (
     RoleAdmin     Role = "admin"
     RolePhysician Role = "physician"
     RolePatient   Role = "patient"
+    // RolePharmacist callers identify their pharmacy (not a person) via X-User-ID
+    RolePharmacist Role = "pharmacist"
+    // RoleNurse drafts prescriptions for supervising physicians who delegated to them
+    RoleNurse Role = "nurse"
+    // RoleOrgAdmin administers a single organization, named by X-Org-ID
+    RoleOrgAdmin Role = "org_admin"
 )
 
-func readRole(r *http.Request) (Role, error) {
-    v := r.Header.Get("X-Role")
-    switch Role(v) {
-    case RoleAdmin, RolePhysician, RolePatient:
-        return Role(v), nil
-    default:
-        return "", fmt.Errorf("invalid or missing X-Role header")
-    }
-}
-
-// We use X-User-ID to identify the caller (patient or physician id)
+// We use X-User-ID to identify the caller (patient, physician, or pharmacy id)
 func readUserID(r *http.Request) (int64, error) {
     s := r.Header.Get("X-User-ID")
     if s == "" {
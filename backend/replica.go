@@ -0,0 +1,165 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaLagQuery measures how far the replica's replay trails the primary. A replica that
+// has replayed everything it received reports 0 rather than the age of the last write,
+// which only reflects how long the primary has been idle.
+const replicaLagQuery = `
+    SELECT CASE WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+                ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END::float8`
+
+type replicaReadsKey struct{}
+
+// withReplicaReads marks the PGRepo reads made with ctx as tolerating replication lag, so
+// they may be served by the read replica. Analytics and export queries always are.
+func withReplicaReads(ctx context.Context) context.Context {
+    return context.WithValue(ctx, replicaReadsKey{}, true)
+}
+
+func replicaEligible(ctx context.Context) bool {
+    if c := queryClassOf(ctx); c == queryAnalytics || c == queryExport { return true }
+    ok, _ := ctx.Value(replicaReadsKey{}).(bool)
+    return ok
+}
+
+// ReplicaHealth is the read replica's status as of its last check
+type ReplicaHealth struct {
+    // Status is ok, lagging (further behind than DB_REPLICA_MAX_LAG), down, or unknown
+    // before the first check. Reads go to the primary unless it is ok.
+    Status     string           `json:"status"`
+    LagSeconds float64          `json:"lag_seconds"`
+    CheckedAt  *time.Time       `json:"checked_at,omitempty"`
+    Pool       map[string]int32 `json:"pool,omitempty"`
+}
+
+// replicaState tracks whether the replica may serve reads: it answered its last check and
+// its lag is within maxLag (0 for no limit)
+type replicaState struct {
+    maxLag time.Duration
+
+    mu        sync.RWMutex
+    status    string
+    lag       time.Duration
+    checkedAt time.Time
+}
+
+func newReplicaState(maxLag time.Duration) *replicaState {
+    return &replicaState{maxLag: maxLag, status: "unknown"}
+}
+
+func (s *replicaState) usable() bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.status == "ok"
+}
+
+// record stores the outcome of a check, logging when the replica starts or stops
+// serving reads
+func (s *replicaState) record(lag time.Duration, err error, at time.Time) {
+    status := "ok"
+    switch {
+    case err != nil:
+        status = "down"
+    case s.maxLag > 0 && lag > s.maxLag:
+        status = "lagging"
+    }
+    s.mu.Lock()
+    prev := s.status
+    s.status, s.lag, s.checkedAt = status, lag, at
+    s.mu.Unlock()
+    switch {
+    case status == prev:
+    case err != nil:
+        log.Printf("replica: %s, reading from the primary: %v", status, err)
+    case status == "lagging":
+        log.Printf("replica: %s behind, over db_replica_max_lag; reading from the primary", lag.Round(time.Millisecond))
+    default:
+        log.Printf("replica: %s (lag %s), serving reads", status, lag.Round(time.Millisecond))
+    }
+}
+
+func (s *replicaState) health() ReplicaHealth {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    h := ReplicaHealth{Status: s.status, LagSeconds: s.lag.Seconds()}
+    if !s.checkedAt.IsZero() {
+        at := s.checkedAt
+        h.CheckedAt = &at
+    }
+    return h
+}
+
+// replicaUnreachable reports whether err means the replica couldn't be reached or is
+// shutting down, as opposed to the query itself failing (which the primary would repeat)
+func replicaUnreachable(err error) bool {
+    if err == nil || errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        return false
+    }
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        // connection_exception, or operator_intervention such as admin_shutdown
+        return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+    }
+    return true
+}
+
+// replicaConflict reports whether the replica canceled a query to apply replication,
+// which the primary doesn't do
+func replicaConflict(err error) bool {
+    var pgErr *pgconn.PgError
+    return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+// readPool is the pool a read with ctx runs on: the replica when ctx is eligible and
+// the replica is usable, the primary otherwise
+func (r *PGRepo) readPool(ctx context.Context) (pool *pgxpool.Pool, replica bool) {
+    if r.replica == nil || !replicaEligible(ctx) || !r.replicaState.usable() { return r.pool, false }
+    return r.replica, true
+}
+
+// retryOnPrimary decides whether a read that failed on the replica is repeated on the
+// primary, taking the replica out of rotation until its next check when it is unreachable
+func (r *PGRepo) retryOnPrimary(err error) bool {
+    if replicaUnreachable(err) {
+        r.replicaState.record(0, err, time.Now())
+        return true
+    }
+    return replicaConflict(err)
+}
+
+// checkReplica measures the replica's lag and records the outcome
+func (r *PGRepo) checkReplica(ctx context.Context) {
+    ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+    defer cancel()
+    var seconds float64
+    err := r.replica.QueryRow(ctx, replicaLagQuery).Scan(&seconds)
+    r.replicaState.record(time.Duration(seconds*float64(time.Second)), err, time.Now())
+}
+
+// MonitorReplica checks the replica every DB_REPLICA_CHECK_INTERVAL until ctx is done.
+// Until the first check passes, reads go to the primary. It returns at once without a replica.
+func (r *PGRepo) MonitorReplica(ctx context.Context) {
+    if r.replica == nil { return }
+    t := time.NewTicker(r.replicaCheckInterval)
+    defer t.Stop()
+    for {
+        r.checkReplica(ctx)
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+        }
+    }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestReplicaRouting(t *testing.T) {
+    // The pools connect lazily; nothing listens on port 1, so the replica is unreachable
+    pg, err := NewPGRepo(context.Background(), "postgres://app@127.0.0.1:1/rx", PoolConfig{
+        ReplicaDSN: "postgres://app@127.0.0.1:1/rx_replica", ReplicaMaxLag: 10 * time.Second,
+    })
+    if err != nil { t.Fatalf("NewPGRepo: %v", err) }
+    defer pg.pool.Close()
+    defer pg.replica.Close()
+    if got := pg.replica.Config().ConnConfig.RuntimeParams["default_transaction_read_only"]; got != "on" {
+        t.Fatalf("replica default_transaction_read_only = %q", got)
+    }
+    if pg.replicaCheckInterval != 5*time.Second { t.Fatalf("check interval = %s", pg.replicaCheckInterval) }
+
+    analytics := withQueryClass(context.Background(), queryAnalytics)
+    lists := withReplicaReads(context.Background())
+    onReplica := func(ctx context.Context) bool {
+        _, replica := pg.readPool(ctx)
+        return replica
+    }
+
+    // Reads stay on the primary until the first check passes
+    if onReplica(analytics) { t.Fatal("routed to the replica before it was checked") }
+
+    pg.replicaState.record(2*time.Second, nil, time.Now())
+    if !onReplica(analytics) || !onReplica(lists) { t.Fatal("eligible reads not routed to a healthy replica") }
+    if onReplica(context.Background()) { t.Fatal("default read routed to the replica") }
+
+    pg.replicaState.record(time.Minute, nil, time.Now())
+    if onReplica(analytics) { t.Fatal("routed to a lagging replica") }
+    if h := pg.replicaState.health(); h.Status != "lagging" || h.LagSeconds != 60 || h.CheckedAt == nil {
+        t.Fatalf("health = %+v", h)
+    }
+
+    // A failed check, or a read failing to reach the replica, takes it out of rotation
+    pg.checkReplica(context.Background())
+    if h := pg.replicaState.health(); h.Status != "down" { t.Fatalf("status after failed check = %s", h.Status) }
+    pg.replicaState.record(0, nil, time.Now())
+    var n int
+    if err := pg.queryRow(analytics, `SELECT 1`).Scan(&n); err == nil { t.Fatal("expected the unreachable primary to fail too") }
+    if pg.replicaState.usable() { t.Fatal("replica still in rotation after failing a read") }
+}
+
+func TestReplicaErrors(t *testing.T) {
+    cases := []struct {
+        name              string
+        err               error
+        expectUnreachable bool
+        expectConflict    bool
+    }{
+        {name: "connection refused", err: errors.New("dial tcp 127.0.0.1:5433: connect: connection refused"), expectUnreachable: true},
+        {name: "admin shutdown", err: &pgconn.PgError{Code: "57P01"}, expectUnreachable: true},
+        {name: "recovery conflict", err: &pgconn.PgError{Code: "40001"}, expectConflict: true},
+        {name: "query error", err: &pgconn.PgError{Code: "42703"}},
+        {name: "no rows", err: pgx.ErrNoRows},
+        {name: "deadline", err: context.DeadlineExceeded},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := replicaUnreachable(tc.err); got != tc.expectUnreachable { t.Fatalf("unreachable = %v", got) }
+            if got := replicaConflict(tc.err); got != tc.expectConflict { t.Fatalf("conflict = %v", got) }
+        })
+    }
+}
@@ -2,59 +2,373 @@ package main
 
 import (
     "context"
+    "encoding/json"
     "errors"
+    "fmt"
+    "log"
+    "slices"
     "strconv"
     "time"
 
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
     "github.com/jackc/pgx/v5/pgconn"
 )
 
-// Repository abstracts DB for easy testing
+// Repository abstracts DB for easy testing. Implementations scope every patient,
+// physician, and prescription read and write to the organization in ctx (see withOrg);
+// rows of other tenants behave as if they did not exist.
 type Repository interface {
+    // InTx runs fn in one transaction: the calls fn makes with the ctx it is passed commit
+    // together when it returns nil and roll back when it fails. Calls may nest.
+    InTx(ctx context.Context, fn func(ctx context.Context) error) error
     CreatePrescription(ctx context.Context, p *Prescription) (*Prescription, error)
     TopDrugs(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]TopDrug, error)
+    // TopDrugsByDiagnosis returns the limit diagnoses with the most quantity prescribed in
+    // [from, to), each with its top perDiagnosis drugs; prescriptions without one group under ""
+    TopDrugsByDiagnosis(ctx context.Context, from, to time.Time, limit, perDiagnosis int, patientID *int64) ([]DiagnosisTopDrugs, error)
+    // PrescriptionsOverTime counts prescriptions per bucket ("day", "week", "month") in [from, to)
+    PrescriptionsOverTime(ctx context.Context, from, to time.Time, bucket string, patientID *int64) ([]TimeBucket, error)
+    // PhysicianVolume returns per-physician prescription and distinct patient counts in [from, to)
+    PhysicianVolume(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]PhysicianVolume, error)
+    // Stats computes the admin dashboard aggregates as of now, with topN prescribers
+    Stats(ctx context.Context, now time.Time, topN int) (*AdminStats, error)
     IsPhysicianPatientLinked(ctx context.Context, physicianID, patientID int64) (bool, error)
+    // PhysicianPatientAccess is IsPhysicianPatientLinked and HasActiveConsent for many
+    // patients at once; patients missing, deleted, or outside ctx's organization are left out
+    PhysicianPatientAccess(ctx context.Context, physicianID int64, patientIDs []int64, scope string) (map[int64]PatientAccess, error)
     ListPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) ([]Prescription, error)
+    // CountPrescriptions counts the prescriptions ListPrescriptions would return without a limit
+    CountPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) (int, error)
+    // StreamPrescriptions calls fn for each matching prescription (newest first), up to maxRows (0 = no cap)
+    StreamPrescriptions(ctx context.Context, filter ListPrescriptionsFilter, maxRows int, fn func(Prescription) error) error
     // ListPatientsForPhysician returns patients linked to a physician (for dropdowns)
     ListPatientsForPhysician(ctx context.Context, physicianID int64) ([]Patient, error)
+    // ListPatientsForPhysicians is ListPatientsForPhysician for many physicians, keyed by physician id
+    ListPatientsForPhysicians(ctx context.Context, physicianIDs []int64) (map[int64][]Patient, error)
     // FindOrCreateDrug returns the id for a drug by name, inserting if it doesn't exist
     FindOrCreateDrug(ctx context.Context, name string) (int64, error)
+    // SearchDrugs returns catalog entries matching q by prefix or trigram similarity, best first
+    SearchDrugs(ctx context.Context, q string, limit int) ([]Drug, error)
+    GetDrug(ctx context.Context, id int64) (*Drug, error)
+    // GetDrugs returns the drugs among ids that exist, in no particular order
+    GetDrugs(ctx context.Context, ids []int64) ([]Drug, error)
+    // SearchPatients returns patients whose name starts with q, has a word starting with q, or
+    // is trigram-similar to it, best first. physicianID limits it to that physician's panel,
+    // patientID to one patient.
+    SearchPatients(ctx context.Context, q string, limit int, physicianID, patientID *int64) ([]SearchHit, error)
+    // SearchPhysicians is SearchPatients for physicians; patientID limits it to the patient's care team
+    SearchPhysicians(ctx context.Context, q string, limit int, patientID *int64) ([]SearchHit, error)
+    // SearchICDCodes returns ICD-10-CM codes starting with q, then those whose description contains it
+    SearchICDCodes(ctx context.Context, q string, limit int) ([]ICDCode, error)
+    // GetICDCode returns one ICD-10-CM code, or ErrNotFound
+    GetICDCode(ctx context.Context, code string) (*ICDCode, error)
+    // CreateDrug inserts a catalog entry (name and schedule), returning ErrDuplicate if the name exists (case-insensitive)
+    CreateDrug(ctx context.Context, d *Drug) (*Drug, error)
+    // SetDrugSchedule sets or clears (empty string) a drug's controlled substance schedule
+    SetDrugSchedule(ctx context.Context, id int64, schedule string) error
+    // SetDrugRules sets or clears (nil) a drug's dispensing rules
+    SetDrugRules(ctx context.Context, id int64, rules *DispensingRules) error
+    // FindDrugByRxCUI returns the id of the drug normalized to rxcui, or ErrNotFound
+    FindDrugByRxCUI(ctx context.Context, rxcui string) (int64, error)
+    // SetDrugRxNorm stores RxNorm normalization on a drug that doesn't have it yet
+    SetDrugRxNorm(ctx context.Context, drugID int64, c RxNormConcept) error
+    // ListDrugsMissingRxNorm returns up to limit drugs with id > afterID and no rxcui, by id
+    ListDrugsMissingRxNorm(ctx context.Context, afterID int64, limit int) ([]Drug, error)
+    // CountDrugsMissingRxNorm counts drugs with id > afterID and no rxcui
+    CountDrugsMissingRxNorm(ctx context.Context, afterID int64) (int, error)
+    // MergeDrugs repoints sourceID's prescriptions at targetID, in every organization, and
+    // deletes sourceID; moved holds the repointed prescriptions' ids, ascending
+    MergeDrugs(ctx context.Context, sourceID, targetID int64) (moved []int64, err error)
+    // GetPatientDetail returns a patient's demographics, linked physicians, active prescription
+    // count, and last visit, or ErrNotFound when the patient is missing or soft-deleted
+    GetPatientDetail(ctx context.Context, id int64) (*PatientDetail, error)
+    // GetPatientDetails is GetPatientDetail for many patients, leaving out the missing ones
+    GetPatientDetails(ctx context.Context, ids []int64) ([]PatientDetail, error)
+    // GetPhysicians returns the physicians among ids that exist (not soft-deleted), in no particular order
+    GetPhysicians(ctx context.Context, ids []int64) ([]Physician, error)
     // ListPhysiciansForPatient returns physicians linked to a patient
     ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error)
+    // LinkPhysicianPatient links a physician to a patient; created is false when the link already existed
+    LinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (created bool, err error)
+    // UnlinkPhysicianPatient removes a link; removed is false when there was none, which is not an error
+    UnlinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (removed bool, err error)
+    // GrantConsent records a consent, revoking any active consent for the same patient,
+    // physician, and scope. It sets ID and GrantedAt, or returns ErrInvalidReference.
+    GrantConsent(ctx context.Context, c *Consent) (*Consent, error)
+    // ListConsents returns all of a patient's consents, including revoked and expired, newest first
+    ListConsents(ctx context.Context, patientID int64) ([]Consent, error)
+    // RevokeConsent revokes one of a patient's consents; revoked is false when it already
+    // was. It returns ErrNotFound when the patient has no such consent.
+    RevokeConsent(ctx context.Context, patientID, consentID int64) (revoked bool, err error)
+    // HasActiveConsent reports whether the patient has an unrevoked, unexpired consent for scope
+    HasActiveConsent(ctx context.Context, patientID, physicianID int64, scope string) (bool, error)
+    // ReserveIdempotencyKey claims (scope, key) for an in-flight request. When the key is
+    // already held (completed, or pending for less than idempotencyLease, and not expired)
+    // the existing record is returned; a pending reservation past its lease is taken over.
+    ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (existing *IdempotencyRecord, err error)
+    // CompleteIdempotencyKey stores the response to replay for a reserved key, unless one is
+    // stored already
+    CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, body []byte) error
+    // ReleaseIdempotencyKey drops a reservation so the client may retry (used when the request failed)
+    ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+    CreatePharmacy(ctx context.Context, p *Pharmacy) (*Pharmacy, error)
+    ListPharmacies(ctx context.Context) ([]Pharmacy, error)
+    // CreateOrganization returns ErrDuplicate when the name is taken
+    CreateOrganization(ctx context.Context, o *Organization) (*Organization, error)
+    // CallerOrg returns the organization of the row in table ("patients", "physicians",
+    // "pharmacies", "nurses", or "org_admins") that an API caller's X-User-ID names, or
+    // ErrNotFound when it is missing or soft-deleted
+    CallerOrg(ctx context.Context, table string, id int64) (int64, error)
+    // ListOrganizations returns every organization, or only ctx's when it is scoped
+    ListOrganizations(ctx context.Context) ([]Organization, error)
+    // RegisterPatient creates or updates the patient with reg.MRN in ctx's organization (the
+    // default one when unscoped); created is false on update. It returns ErrNotFound when the
+    // MRN belongs to a deleted patient. The MRN is the patient's identity: names may repeat.
+    RegisterPatient(ctx context.Context, reg PatientRegistration) (id int64, created bool, err error)
+    // FindPatientByMRN returns the id of the patient with mrn in ctx's organization, or ErrNotFound
+    FindPatientByMRN(ctx context.Context, mrn string) (int64, error)
+    // QuarantineHL7Message stores a rejected HL7 message, setting ID and ReceivedAt
+    QuarantineHL7Message(ctx context.Context, q *HL7QuarantinedMessage) error
+    // ListHL7Quarantine returns quarantined messages, newest first
+    ListHL7Quarantine(ctx context.Context, limit int) ([]HL7QuarantinedMessage, error)
+    // GetNotificationPreferences returns a patient's channels (both off when never set), or
+    // ErrNotFound when the patient is missing or deleted
+    GetNotificationPreferences(ctx context.Context, patientID int64) (*NotificationPreferences, error)
+    // SetNotificationPreferences replaces a patient's channels, setting UpdatedAt, or returns ErrNotFound
+    SetNotificationPreferences(ctx context.Context, np *NotificationPreferences) (*NotificationPreferences, error)
+    // DispensePrescription records dispensing of a prescription routed to pharmacyID. It returns
+    // ErrNotFound when the prescription isn't routed there, ErrNotActive, ErrAlreadyDispensed, or
+    // ErrDispenseQuantity when quantity exceeds the prescribed quantity.
+    DispensePrescription(ctx context.Context, id, pharmacyID int64, quantity int) (*Prescription, error)
+    // Soft deletes set deleted_at; deleted rows are hidden from lists, links, and analytics.
+    // Each returns ErrNotFound when the row is missing or already deleted.
+    SoftDeletePatient(ctx context.Context, id int64) error
+    SoftDeletePhysician(ctx context.Context, id int64) error
+    SoftDeletePrescription(ctx context.Context, id int64) error
+    // AnonymizePatients scrubs PII (name, demographics, MRN, and notification preferences)
+    // from up to limit patients soft-deleted before cutoff, or never deleted but inactive
+    // since cutoff (created before it, with no prescription written since and none still
+    // open), writing one audit entry per patient, and returns the anonymized ids
+    AnonymizePatients(ctx context.Context, cutoff time.Time, limit int) ([]int64, error)
+    // ExpirePrescriptions moves up to limit active prescriptions whose expires_at is at or
+    // before now to expired, writing one audit entry each (entry supplies actor, action, and
+    // detail), and returns their ids
+    ExpirePrescriptions(ctx context.Context, now time.Time, limit int, entry AuditEntry) ([]int64, error)
+    // PurgeIdempotencyKeys deletes up to limit keys that expired at or before now
+    PurgeIdempotencyKeys(ctx context.Context, now time.Time, limit int) (int64, error)
+    // PurgeAuditLog deletes up to limit audit entries created before before, oldest first
+    PurgeAuditLog(ctx context.Context, before time.Time, limit int) (int64, error)
+    RecordAudit(ctx context.Context, e AuditEntry) error
+    // RecordProvenance stores a generated document's provenance, setting CreatedAt
+    RecordProvenance(ctx context.Context, d *DocumentProvenance) error
+    // GetProvenance and FindProvenanceBySHA256 return ErrNotFound for unknown documents
+    GetProvenance(ctx context.Context, documentID string) (*DocumentProvenance, error)
+    FindProvenanceBySHA256(ctx context.Context, sha256 string) (*DocumentProvenance, error)
+    // MatchBulkPrescriptions returns the ids of active prescriptions matching f, in id order
+    MatchBulkPrescriptions(ctx context.Context, f BulkFilter) ([]int64, error)
+    // SignPrescription activates a pending_signature draft or a pending_reauthorization
+    // prescription, or returns ErrNotPending
+    SignPrescription(ctx context.Context, id int64) (*Prescription, error)
+    // IsNurseDelegate reports whether physicianID has delegated drafting to nurseID
+    IsNurseDelegate(ctx context.Context, nurseID, physicianID int64) (bool, error)
+    ListNursesForPhysician(ctx context.Context, physicianID int64) ([]Nurse, error)
+    // AddNurseDelegation delegates drafting; created is false when the delegation already existed
+    AddNurseDelegation(ctx context.Context, physicianID, nurseID int64) (created bool, err error)
+    // RemoveNurseDelegation revokes a delegation; revoking a missing one is not an error
+    RemoveNurseDelegation(ctx context.Context, physicianID, nurseID int64) error
+    // TransitionPrescriptions moves the still-active prescriptions among ids to status and
+    // writes one audit entry per prescription (entry supplies actor, action, and detail).
+    // It returns the ids that changed.
+    TransitionPrescriptions(ctx context.Context, ids []int64, status string, entry AuditEntry) ([]int64, error)
+    // ReassignPrescriptions moves a patient's active prescriptions from one physician to
+    // another as pending_reauthorization, clearing their signatures, and writes one audit
+    // entry per prescription. It returns the ids that moved.
+    ReassignPrescriptions(ctx context.Context, patientID, fromPhysicianID, toPhysicianID int64, entry AuditEntry) ([]int64, error)
+    // SetPrescriptionSignature stores the e-signature of a prescription
+    SetPrescriptionSignature(ctx context.Context, id int64, signature string) error
+    // GetPrescription returns one prescription (not soft-deleted) or ErrNotFound
+    GetPrescription(ctx context.Context, id int64) (*Prescription, error)
+    CreatePrescriptionComment(ctx context.Context, c *PrescriptionComment) (*PrescriptionComment, error)
+    // ListPrescriptionComments returns a prescription's comments, oldest first
+    ListPrescriptionComments(ctx context.Context, prescriptionID int64) ([]PrescriptionComment, error)
+    // CreatePrescriptionAttachment records an uploaded file's metadata, or returns
+    // ErrInvalidReference when the prescription doesn't exist
+    CreatePrescriptionAttachment(ctx context.Context, a *PrescriptionAttachment) (*PrescriptionAttachment, error)
+    // ListPrescriptionAttachments returns a prescription's attachments, oldest first
+    ListPrescriptionAttachments(ctx context.Context, prescriptionID int64) ([]PrescriptionAttachment, error)
+    // GetPrescriptionAttachment returns one attachment of a prescription or ErrNotFound
+    GetPrescriptionAttachment(ctx context.Context, prescriptionID, id int64) (*PrescriptionAttachment, error)
+    CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) (*WebhookEndpoint, error)
+    // ListWebhookEndpoints returns all endpoints including secrets (for signing deliveries)
+    ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error)
+    // DeleteWebhookEndpoint removes an endpoint and its delivery log, or returns ErrNotFound
+    DeleteWebhookEndpoint(ctx context.Context, id int64) error
+    RecordWebhookDelivery(ctx context.Context, d *WebhookDelivery) error
+    // ListWebhookDeliveries returns an endpoint's delivery attempts, newest first
+    ListWebhookDeliveries(ctx context.Context, endpointID int64, limit int) ([]WebhookDelivery, error)
 }
 
 // Sentinel errors for handler mapping
 var (
     // ErrInvalidReference means a foreign key failed (patient_id, physician_id, or drug_id not found)
     ErrInvalidReference = errors.New("invalid reference")
+    // ErrNotFound means the requested row does not exist
+    ErrNotFound = errors.New("not found")
+    // ErrDuplicate means a unique constraint failed (e.g., drug name already exists)
+    ErrDuplicate = errors.New("duplicate")
+    // ErrAlreadyDispensed means a pharmacy tried to dispense a prescription twice
+    ErrAlreadyDispensed = errors.New("already dispensed")
+    // ErrDispenseQuantity means the dispensed quantity exceeds what was prescribed
+    ErrDispenseQuantity = errors.New("dispensed quantity exceeds prescribed quantity")
+    // ErrNotActive means the prescription was cancelled, expired, or is still awaiting signature
+    ErrNotActive = errors.New("prescription not active")
+    // ErrNotPending means a sign request targeted a prescription that isn't a pending draft
+    // or awaiting re-authorization
+    ErrNotPending = errors.New("prescription not pending signature")
 )
 
 // Postgres implementation
-type PGRepo struct{ pool *pgxpool.Pool }
+type PGRepo struct {
+    pool     *pgxpool.Pool
+    timeouts QueryTimeouts
+    // replica, when configured, serves the reads replicaEligible allows (see replica.go)
+    replica              *pgxpool.Pool
+    replicaState         *replicaState
+    replicaCheckInterval time.Duration
+}
+
+// PoolConfig tunes the pgx connection pool; zero values keep the pgx defaults
+type PoolConfig struct {
+    MaxConns        int32
+    MinConns        int32
+    MaxConnLifetime time.Duration
+    MaxConnIdleTime time.Duration
+    // StatementTimeout is set as the server-side statement_timeout of every connection
+    StatementTimeout time.Duration
+    // QueryTimeouts are client-side deadlines per query class
+    QueryTimeouts QueryTimeouts
+    // SlowQueryThreshold logs statements slower than this; 0 disables the log
+    SlowQueryThreshold time.Duration
+    // ReplicaDSN optionally names a read replica, tuned like the primary. Reads fall back
+    // to the primary while it is further behind than ReplicaMaxLag (0 for no limit).
+    ReplicaDSN           string
+    ReplicaMaxLag        time.Duration
+    ReplicaCheckInterval time.Duration
+}
+
+// NewPGRepo creates the pools without connecting; see WaitReachable and MonitorReplica
+func NewPGRepo(ctx context.Context, dsn string, pc PoolConfig) (*PGRepo, error) {
+    pool, err := newPGPool(ctx, dsn, pc)
+    if err != nil {
+        return nil, err
+    }
+    r := &PGRepo{pool: pool, timeouts: pc.QueryTimeouts}
+    if pc.ReplicaDSN != "" {
+        // Writes sent to the replica by mistake fail rather than wait on recovery
+        if r.replica, err = newPGPool(ctx, pc.ReplicaDSN, pc, "default_transaction_read_only", "on"); err != nil {
+            pool.Close()
+            return nil, fmt.Errorf("replica: %w", err)
+        }
+        r.replicaState, r.replicaCheckInterval = newReplicaState(pc.ReplicaMaxLag), pc.ReplicaCheckInterval
+        if r.replicaCheckInterval <= 0 { r.replicaCheckInterval = 5 * time.Second }
+    }
+    return r, nil
+}
 
-func NewPGRepo(ctx context.Context, dsn string) (*PGRepo, error) {
-    pool, err := pgxpool.New(ctx, dsn)
+// newPGPool creates one pool tuned by pc, with extra runtime parameters as name, value pairs
+func newPGPool(ctx context.Context, dsn string, pc PoolConfig, params ...string) (*pgxpool.Pool, error) {
+    cfg, err := pgxpool.ParseConfig(dsn)
     if err != nil {
         return nil, err
     }
-    return &PGRepo{pool: pool}, nil
+    for i := 0; i+1 < len(params); i += 2 { cfg.ConnConfig.RuntimeParams[params[i]] = params[i+1] }
+    if pc.MaxConns > 0 { cfg.MaxConns = pc.MaxConns }
+    if pc.MinConns > 0 { cfg.MinConns = pc.MinConns }
+    if pc.MaxConnLifetime > 0 { cfg.MaxConnLifetime = pc.MaxConnLifetime }
+    if pc.MaxConnIdleTime > 0 { cfg.MaxConnIdleTime = pc.MaxConnIdleTime }
+    if pc.StatementTimeout > 0 {
+        cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(pc.StatementTimeout.Milliseconds(), 10)
+    }
+    if pc.SlowQueryThreshold > 0 { cfg.ConnConfig.Tracer = slowQueryTracer{threshold: pc.SlowQueryThreshold} }
+    return pgxpool.NewWithConfig(ctx, cfg)
+}
+
+const (
+    pgConnectBaseBackoff = 500 * time.Millisecond
+    pgConnectMaxBackoff  = 10 * time.Second
+)
+
+// WaitReachable pings Postgres until it answers or ctx is done, backing off exponentially
+// between attempts, so the API can start before the database (e.g. under docker compose).
+// Each ping is bounded by attemptTimeout.
+func (r *PGRepo) WaitReachable(ctx context.Context, attemptTimeout time.Duration) error {
+    return retryWithBackoff(ctx, pgConnectBaseBackoff, pgConnectMaxBackoff, func(ctx context.Context) error {
+        ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+        defer cancel()
+        return r.pool.Ping(ctx)
+    }, func(attempt int, err error, wait time.Duration) {
+        log.Printf("postgres not reachable (attempt %d): %v; retrying in %s", attempt, err, wait)
+    })
+}
+
+// retryWithBackoff calls fn until it succeeds, sleeping base, 2*base, ... (capped at
+// maxWait) between attempts and reporting each failure to onRetry. When ctx is done it
+// returns the last error.
+func retryWithBackoff(ctx context.Context, base, maxWait time.Duration, fn func(context.Context) error, onRetry func(attempt int, err error, wait time.Duration)) error {
+    wait := base
+    for attempt := 1; ; attempt++ {
+        err := fn(ctx)
+        if err == nil { return nil }
+        if ctx.Err() != nil { return err }
+        onRetry(attempt, err, wait)
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(wait):
+        }
+        wait *= 2
+        if wait > maxWait { wait = maxWait }
+    }
 }
 
 func (r *PGRepo) CreatePrescription(ctx context.Context, p *Prescription) (*Prescription, error) {
     // Do not pass prescribed_at from the application layer. Rely on the DB default (NOW()).
     // Passing Go's zero time results in year 0001 timestamps, which caused UI discrepancies.
+    // expires_at is derived from the same NOW() so it lines up exactly with prescribed_at.
+    // org_id comes from the patient, so a patient outside ctx's organization, or a deleted
+    // patient or physician, leaves it NULL and the insert fails; the (physician_id, org_id)
+    // key rejects cross-tenant physicians.
     const q = `
-        INSERT INTO prescriptions (patient_id, physician_id, drug_id, quantity, sig)
-        VALUES ($1,$2,$3,$4,$5)
-        RETURNING id, prescribed_at
+        INSERT INTO prescriptions (patient_id, physician_id, drug_id, quantity, sig,
+                                   dose_amount, dose_unit, route, frequency, duration_days, expires_at,
+                                   refills, reason, pharmacy_id, status, drafted_by, org_id, diagnosis_code,
+                                   quantity_unit, days_supply)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10::int,
+                CASE WHEN $10::int IS NULL THEN NULL ELSE NOW() + make_interval(days => $10::int) END,
+                $11, NULLIF($12,''), $13, $14, $15,
+                (SELECT org_id FROM patients WHERE id=$1 AND deleted_at IS NULL AND ($16::bigint IS NULL OR org_id = $16)
+                   AND EXISTS (SELECT 1 FROM physicians WHERE id=$2 AND deleted_at IS NULL)),
+                NULLIF($17,''), NULLIF($18,''), NULLIF($19,0))
+        RETURNING id, prescribed_at, expires_at
     `
-    row := r.pool.QueryRow(ctx, q, p.PatientID, p.PhysicianID, p.DrugID, p.Quantity, p.Sig)
-    if err := row.Scan(&p.ID, &p.PrescribedAt); err != nil {
+    var amount *float64
+    var unit, route, freq *string
+    var duration *int
+    if d := p.Dosage; d != nil {
+        amount, unit, route, freq = &d.Amount, &d.Unit, &d.Route, &d.Frequency
+        if d.DurationDays > 0 { duration = &d.DurationDays }
+    }
+    if p.Status == "" { p.Status = PrescriptionActive }
+    row := r.queryRow(ctx, q, p.PatientID, p.PhysicianID, p.DrugID, p.Quantity, p.Sig,
+        amount, unit, route, freq, duration, p.Refills, p.Reason, p.PharmacyID, p.Status, p.DraftedBy, orgArg(ctx), p.DiagnosisCode,
+        p.QuantityUnit, p.DaysSupply)
+    if err := row.Scan(&p.ID, &p.PrescribedAt, &p.ExpiresAt); err != nil {
         // Translate common FK errors to a friendlier error the handler can map to 400
         var pgErr *pgconn.PgError
         if errors.As(err, &pgErr) {
-            if pgErr.Code == "23503" { // foreign_key_violation
+            // foreign_key_violation, or not_null_violation for a patient outside the organization
+            if pgErr.Code == "23503" || pgErr.Code == "23502" {
                 return nil, ErrInvalidReference
             }
         }
@@ -64,21 +378,23 @@ func (r *PGRepo) CreatePrescription(ctx context.Context, p *Prescription) (*Pres
 }
 
 func (r *PGRepo) TopDrugs(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]TopDrug, error) {
+    ctx = withQueryClass(ctx, queryAnalytics)
     // Aggregate by total quantity for performance and usefulness
     base := `
         SELECT d.id, d.name, COALESCE(SUM(pr.quantity),0) AS total_qty
         FROM prescriptions pr
         JOIN drugs d ON d.id = pr.drug_id
-        WHERE pr.prescribed_at >= $1 AND pr.prescribed_at < $2
+        WHERE pr.prescribed_at >= $1 AND pr.prescribed_at < $2 AND pr.deleted_at IS NULL AND pr.status <> 'pending_signature'
     `
-    args := []any{from, to}
+    args := []any{from, to, orgArg(ctx)}
+    base += " AND " + orgFilter("pr.org_id", 3)
     if patientID != nil {
-        base += " AND pr.patient_id = $3"
+        base += " AND pr.patient_id = $4"
         args = append(args, *patientID)
     }
     base += " GROUP BY d.id, d.name ORDER BY total_qty DESC, d.id ASC LIMIT " + strconv.Itoa(limit)
 
-    rows, err := r.pool.Query(ctx, base, args...)
+    rows, err := r.query(ctx, base, args...)
     if err != nil {
         return nil, err
     }
@@ -94,9 +410,150 @@ func (r *PGRepo) TopDrugs(ctx context.Context, from, to time.Time, limit int, pa
     return out, rows.Err()
 }
 
+func (r *PGRepo) TopDrugsByDiagnosis(ctx context.Context, from, to time.Time, limit, perDiagnosis int, patientID *int64) ([]DiagnosisTopDrugs, error) {
+    ctx = withQueryClass(ctx, queryAnalytics)
+    // Rank drugs within each diagnosis, then keep the top perDiagnosis of the top limit diagnoses
+    q := `
+        WITH totals AS (
+            SELECT COALESCE(pr.diagnosis_code,'') AS code, d.id, d.name, SUM(pr.quantity) AS qty
+            FROM prescriptions pr
+            JOIN drugs d ON d.id = pr.drug_id
+            WHERE pr.prescribed_at >= $1 AND pr.prescribed_at < $2 AND pr.deleted_at IS NULL AND pr.status <> 'pending_signature'
+              AND ` + orgFilter("pr.org_id", 3)
+    args := []any{from, to, orgArg(ctx)}
+    if patientID != nil {
+        q += " AND pr.patient_id = $4"
+        args = append(args, *patientID)
+    }
+    q += `
+            GROUP BY 1, d.id, d.name
+        ), ranked AS (
+            SELECT t.*, SUM(qty) OVER (PARTITION BY code) AS code_qty,
+                   ROW_NUMBER() OVER (PARTITION BY code ORDER BY qty DESC, id ASC) AS n
+            FROM totals t
+        ), codes AS (
+            SELECT code, code_qty FROM ranked WHERE n = 1
+            ORDER BY code_qty DESC, code ASC LIMIT ` + strconv.Itoa(limit) + `
+        )
+        SELECT r.code, COALESCE(ic.description,''), r.code_qty, r.id, r.name, r.qty
+        FROM ranked r
+        JOIN codes c ON c.code = r.code
+        LEFT JOIN icd_codes ic ON ic.code = r.code
+        WHERE r.n <= ` + strconv.Itoa(perDiagnosis) + `
+        ORDER BY r.code_qty DESC, r.code ASC, r.n ASC`
+
+    rows, err := r.query(ctx, q, args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []DiagnosisTopDrugs{}
+    for rows.Next() {
+        var g DiagnosisTopDrugs
+        var td TopDrug
+        if err := rows.Scan(&g.DiagnosisCode, &g.DiagnosisDescription, &g.TotalQty, &td.DrugID, &td.DrugName, &td.TotalQty); err != nil {
+            return nil, err
+        }
+        if n := len(out); n == 0 || out[n-1].DiagnosisCode != g.DiagnosisCode { out = append(out, g) }
+        last := &out[len(out)-1]
+        last.Drugs = append(last.Drugs, td)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) PrescriptionsOverTime(ctx context.Context, from, to time.Time, bucket string, patientID *int64) ([]TimeBucket, error) {
+    ctx = withQueryClass(ctx, queryAnalytics)
+    // bucket is whitelisted by the handler; date_trunc takes it as a bound parameter anyway
+    q := `
+        SELECT date_trunc($1, pr.prescribed_at, 'UTC') AS bucket, COUNT(*), COALESCE(SUM(pr.quantity),0)
+        FROM prescriptions pr
+        WHERE pr.prescribed_at >= $2 AND pr.prescribed_at < $3 AND pr.deleted_at IS NULL AND pr.status <> 'pending_signature'
+    `
+    args := []any{bucket, from, to, orgArg(ctx)}
+    q += " AND " + orgFilter("pr.org_id", 4)
+    if patientID != nil {
+        q += " AND pr.patient_id = $5"
+        args = append(args, *patientID)
+    }
+    q += " GROUP BY bucket ORDER BY bucket ASC"
+
+    rows, err := r.query(ctx, q, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var out []TimeBucket
+    for rows.Next() {
+        var b TimeBucket
+        if err := rows.Scan(&b.BucketStart, &b.Count, &b.TotalQty); err != nil {
+            return nil, err
+        }
+        out = append(out, b)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) PhysicianVolume(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]PhysicianVolume, error) {
+    ctx = withQueryClass(ctx, queryAnalytics)
+    q := `
+        SELECT ph.id, ph.name, COUNT(*) AS n, COUNT(DISTINCT pr.patient_id)
+        FROM prescriptions pr
+        JOIN physicians ph ON ph.id = pr.physician_id
+        WHERE pr.prescribed_at >= $1 AND pr.prescribed_at < $2 AND pr.deleted_at IS NULL AND pr.status <> 'pending_signature'
+    `
+    args := []any{from, to, orgArg(ctx)}
+    q += " AND " + orgFilter("pr.org_id", 3)
+    if patientID != nil {
+        q += " AND pr.patient_id = $4"
+        args = append(args, *patientID)
+    }
+    q += " GROUP BY ph.id, ph.name ORDER BY n DESC, ph.id ASC LIMIT " + strconv.Itoa(limit)
+
+    rows, err := r.query(ctx, q, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var out []PhysicianVolume
+    for rows.Next() {
+        var v PhysicianVolume
+        if err := rows.Scan(&v.PhysicianID, &v.PhysicianName, &v.Prescriptions, &v.DistinctPatients); err != nil {
+            return nil, err
+        }
+        out = append(out, v)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) Stats(ctx context.Context, now time.Time, topN int) (*AdminStats, error) {
+    ctx = withQueryClass(ctx, queryAnalytics)
+    week, month := truncateTime(now, "week"), truncateTime(now, "month")
+    q := `
+        SELECT
+            (SELECT COUNT(*) FROM patients WHERE deleted_at IS NULL AND ` + orgFilter("org_id", 3) + `),
+            (SELECT COUNT(*) FROM physicians WHERE deleted_at IS NULL AND ` + orgFilter("org_id", 3) + `),
+            COUNT(*),
+            COUNT(*) FILTER (WHERE pr.prescribed_at >= $1),
+            COUNT(*) FILTER (WHERE pr.prescribed_at >= $2)
+        FROM prescriptions pr
+        WHERE pr.deleted_at IS NULL AND pr.status <> 'pending_signature' AND ` + orgFilter("pr.org_id", 3)
+    st := &AdminStats{}
+    if err := r.queryRow(ctx, q, week, month, orgArg(ctx)).Scan(&st.Patients, &st.Physicians, &st.Prescriptions,
+        &st.PrescriptionsThisWeek, &st.PrescriptionsThisMonth); err != nil {
+        return nil, err
+    }
+    if st.Patients > 0 { st.AvgPrescriptionsPerPatient = float64(st.Prescriptions) / float64(st.Patients) }
+    top, err := r.PhysicianVolume(ctx, month, month.AddDate(0, 1, 0), topN, nil)
+    if err != nil { return nil, err }
+    st.TopPrescribers = top
+    return st, nil
+}
+
 func (r *PGRepo) IsPhysicianPatientLinked(ctx context.Context, physicianID, patientID int64) (bool, error) {
-    const q = `SELECT 1 FROM physician_patients WHERE physician_id=$1 AND patient_id=$2 LIMIT 1`
-    row := r.pool.QueryRow(ctx, q, physicianID, patientID)
+    const q = `
+        SELECT 1 FROM physician_patients pp
+        JOIN patients p    ON p.id = pp.patient_id AND p.deleted_at IS NULL
+        JOIN physicians ph ON ph.id = pp.physician_id AND ph.deleted_at IS NULL AND ph.org_id = p.org_id
+        WHERE pp.physician_id=$1 AND pp.patient_id=$2 AND ($3::bigint IS NULL OR p.org_id = $3) LIMIT 1`
+    row := r.queryRow(ctx, q, physicianID, patientID, orgArg(ctx))
     var one int
     if err := row.Scan(&one); err != nil {
         return false, nil
@@ -104,27 +561,68 @@ func (r *PGRepo) IsPhysicianPatientLinked(ctx context.Context, physicianID, pati
     return true, nil
 }
 
+func (r *PGRepo) PhysicianPatientAccess(ctx context.Context, physicianID int64, patientIDs []int64, scope string) (map[int64]PatientAccess, error) {
+    const q = `
+        SELECT p.id,
+               EXISTS (SELECT 1 FROM physician_patients pp
+                       JOIN physicians ph ON ph.id = pp.physician_id AND ph.deleted_at IS NULL AND ph.org_id = p.org_id
+                       WHERE pp.physician_id = $1 AND pp.patient_id = p.id),
+               EXISTS (SELECT 1 FROM consents c
+                       WHERE c.patient_id = p.id AND c.physician_id = $1 AND c.scope = $3
+                         AND c.revoked_at IS NULL AND (c.expires_at IS NULL OR c.expires_at > NOW()))
+        FROM patients p
+        WHERE p.id = ANY($2) AND p.deleted_at IS NULL AND ($4::bigint IS NULL OR p.org_id = $4)`
+    rows, err := r.query(ctx, q, physicianID, patientIDs, scope, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[int64]PatientAccess{}
+    for rows.Next() {
+        var id int64
+        var a PatientAccess
+        if err := rows.Scan(&id, &a.Linked, &a.Consented); err != nil { return nil, err }
+        // Like physicianAccess, consent only counts for linked physicians
+        a.Consented = a.Linked && a.Consented
+        out[id] = a
+    }
+    return out, rows.Err()
+}
+
 func (r *PGRepo) ListPatientsForPhysician(ctx context.Context, physicianID int64) ([]Patient, error) {
+    panels, err := r.ListPatientsForPhysicians(ctx, []int64{physicianID})
+    return panels[physicianID], err
+}
+
+func (r *PGRepo) ListPatientsForPhysicians(ctx context.Context, physicianIDs []int64) (map[int64][]Patient, error) {
     const q = `
-        SELECT p.id, p.name
+        SELECT pp.physician_id, p.id, p.name
         FROM physician_patients pp
         JOIN patients p ON p.id = pp.patient_id
-        WHERE pp.physician_id = $1
+        WHERE pp.physician_id = ANY($1) AND p.deleted_at IS NULL AND ($2::bigint IS NULL OR p.org_id = $2)
         ORDER BY p.name ASC, p.id ASC
     `
-    rows, err := r.pool.Query(ctx, q, physicianID)
+    rows, err := r.query(ctx, q, physicianIDs, orgArg(ctx))
     if err != nil { return nil, err }
     defer rows.Close()
-    var out []Patient
+    out := map[int64][]Patient{}
     for rows.Next() {
+        var physicianID int64
         var it Patient
-        if err := rows.Scan(&it.ID, &it.Name); err != nil { return nil, err }
-        out = append(out, it)
+        if err := rows.Scan(&physicianID, &it.ID, &it.Name); err != nil { return nil, err }
+        out[physicianID] = append(out[physicianID], it)
     }
     return out, rows.Err()
 }
 
 func (r *PGRepo) FindOrCreateDrug(ctx context.Context, name string) (int64, error) {
+    // Prefer an existing entry that differs only by case so the catalog doesn't grow duplicates
+    var id int64
+    err := r.queryRow(ctx, `SELECT id FROM drugs WHERE lower(name) = lower($1) ORDER BY id LIMIT 1`, name).Scan(&id)
+    if err == nil {
+        return id, nil
+    }
+    if !errors.Is(err, pgx.ErrNoRows) {
+        return 0, err
+    }
     // Use UPSERT to return existing id when name already present
     const q = `
         INSERT INTO drugs(name)
@@ -132,109 +630,1374 @@ func (r *PGRepo) FindOrCreateDrug(ctx context.Context, name string) (int64, erro
         ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
         RETURNING id
     `
-    var id int64
-    if err := r.pool.QueryRow(ctx, q, name).Scan(&id); err != nil {
+    if err := r.queryRow(ctx, q, name).Scan(&id); err != nil {
         return 0, err
     }
     return id, nil
 }
 
-func (r *PGRepo) ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error) {
-    const q = `
-        SELECT ph.id, ph.name
-        FROM physician_patients pp
-        JOIN physicians ph ON ph.id = pp.physician_id
-        WHERE pp.patient_id = $1
-        ORDER BY ph.name ASC, ph.id ASC
-    `
-    rows, err := r.pool.Query(ctx, q, patientID)
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+    out := make([]byte, 0, len(s))
+    for i := 0; i < len(s); i++ {
+        if s[i] == '%' || s[i] == '_' || s[i] == '\\' { out = append(out, '\\') }
+        out = append(out, s[i])
+    }
+    return string(out)
+}
+
+func (r *PGRepo) SearchDrugs(ctx context.Context, q string, limit int) ([]Drug, error) {
+    var rows pgx.Rows
+    var err error
+    if q == "" {
+        rows, err = r.query(ctx, `SELECT `+drugColumns+` FROM drugs ORDER BY name ASC, id ASC LIMIT `+strconv.Itoa(limit))
+    } else {
+        // Prefix matches rank first, then pg_trgm similarity (the % operator uses pg_trgm.similarity_threshold)
+        const sq = `
+            SELECT ` + drugColumns + `
+            FROM drugs
+            WHERE name ILIKE $1 || '%' OR name % $2
+            ORDER BY (name ILIKE $1 || '%') DESC, similarity(name, $2) DESC, name ASC, id ASC
+            LIMIT `
+        rows, err = r.query(ctx, sq+strconv.Itoa(limit), escapeLike(q), q)
+    }
     if err != nil { return nil, err }
     defer rows.Close()
-    var out []Physician
+    out := []Drug{}
     for rows.Next() {
-        var it Physician
-        if err := rows.Scan(&it.ID, &it.Name); err != nil { return nil, err }
-        out = append(out, it)
+        var d Drug
+        if err := scanDrug(rows, &d); err != nil { return nil, err }
+        out = append(out, d)
     }
     return out, rows.Err()
 }
 
-// ListPrescriptions returns prescriptions based on RBAC-aware filters
-type ListPrescriptionsFilter struct {
-    // Exactly one of PatientID or PhysicianID should typically be set based on caller role
-    PatientID   *int64
-    PhysicianID *int64
-    Limit       int
+// nameSearchOrder ranks a name search: whole-name prefix, then word prefix, then
+// pg_trgm similarity. $1 is the LIKE-escaped query, $2 the raw one.
+func nameSearchOrder(col string) string {
+    return `(` + col + ` ILIKE $1 || '%') DESC, (` + col + ` ILIKE '% ' || $1 || '%') DESC, similarity(` + col + `, $2) DESC, ` + col + ` ASC`
 }
 
-func (r *PGRepo) ListPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) ([]Prescription, error) {
-    limit := filter.Limit
-    if limit <= 0 || limit > 200 {
-        limit = 50
+// nameSearchMatch is the WHERE predicate matching nameSearchOrder
+func nameSearchMatch(col string) string {
+    return `(` + col + ` ILIKE $1 || '%' OR ` + col + ` ILIKE '% ' || $1 || '%' OR ` + col + ` % $2)`
+}
+
+func (r *PGRepo) SearchPatients(ctx context.Context, q string, limit int, physicianID, patientID *int64) ([]SearchHit, error) {
+    sq := `SELECT p.id, p.name FROM patients p WHERE p.deleted_at IS NULL AND ` + nameSearchMatch("p.name") + ` AND ` + orgFilter("p.org_id", 3)
+    args := []any{escapeLike(q), q, orgArg(ctx)}
+    if physicianID != nil {
+        args = append(args, *physicianID)
+        sq += ` AND EXISTS (SELECT 1 FROM physician_patients pp WHERE pp.patient_id = p.id AND pp.physician_id = $` + strconv.Itoa(len(args)) + `)`
     }
-    q := `
-        SELECT pr.id,
-               pr.patient_id, p.name AS patient_name,
-               pr.physician_id, ph.name AS physician_name,
-               pr.drug_id, d.name AS drug_name,
-               pr.quantity, pr.sig, pr.prescribed_at
-        FROM prescriptions pr
-        JOIN patients p   ON p.id = pr.patient_id
-        JOIN physicians ph ON ph.id = pr.physician_id
-        JOIN drugs d      ON d.id = pr.drug_id
-        WHERE 1=1`
-    args := []any{}
-    if filter.PatientID != nil {
-        q += " AND pr.patient_id = $" + strconv.Itoa(len(args)+1)
-        args = append(args, *filter.PatientID)
+    if patientID != nil {
+        args = append(args, *patientID)
+        sq += ` AND p.id = $` + strconv.Itoa(len(args))
     }
-    if filter.PhysicianID != nil {
-        q += " AND pr.physician_id = $" + strconv.Itoa(len(args)+1)
-        args = append(args, *filter.PhysicianID)
+    sq += ` ORDER BY ` + nameSearchOrder("p.name") + `, p.id ASC LIMIT ` + strconv.Itoa(limit)
+    return r.searchHits(ctx, "patient", sq, args...)
+}
+
+func (r *PGRepo) SearchPhysicians(ctx context.Context, q string, limit int, patientID *int64) ([]SearchHit, error) {
+    sq := `SELECT ph.id, ph.name FROM physicians ph WHERE ph.deleted_at IS NULL AND ` + nameSearchMatch("ph.name") + ` AND ` + orgFilter("ph.org_id", 3)
+    args := []any{escapeLike(q), q, orgArg(ctx)}
+    if patientID != nil {
+        args = append(args, *patientID)
+        sq += ` AND EXISTS (SELECT 1 FROM physician_patients pp WHERE pp.physician_id = ph.id AND pp.patient_id = $4)`
     }
-    q += " ORDER BY pr.prescribed_at DESC, pr.id DESC LIMIT " + strconv.Itoa(limit)
+    sq += ` ORDER BY ` + nameSearchOrder("ph.name") + `, ph.id ASC LIMIT ` + strconv.Itoa(limit)
+    return r.searchHits(ctx, "physician", sq, args...)
+}
 
-    rows, err := r.pool.Query(ctx, q, args...)
+// searchHits runs a query selecting (id, name) into hits of type typ
+func (r *PGRepo) searchHits(ctx context.Context, typ, q string, args ...any) ([]SearchHit, error) {
+    rows, err := r.query(ctx, q, args...)
     if err != nil { return nil, err }
     defer rows.Close()
-    var out []Prescription
+    out := []SearchHit{}
     for rows.Next() {
-        var p Prescription
-        if err := rows.Scan(
-            &p.ID,
-            &p.PatientID, &p.PatientName,
-            &p.PhysicianID, &p.PhysicianName,
-            &p.DrugID, &p.DrugName,
-            &p.Quantity, &p.Sig, &p.PrescribedAt,
-        ); err != nil {
-            return nil, err
+        h := SearchHit{Type: typ}
+        if err := rows.Scan(&h.ID, &h.Name); err != nil { return nil, err }
+        out = append(out, h)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) SearchICDCodes(ctx context.Context, q string, limit int) ([]ICDCode, error) {
+    // Code prefix matches (E11 finds E11.9) rank before description matches
+    const sq = `
+        SELECT code, description
+        FROM icd_codes
+        WHERE code ILIKE $1 || '%' OR description ILIKE '%' || $1 || '%'
+        ORDER BY (code ILIKE $1 || '%') DESC, code ASC
+        LIMIT `
+    rows, err := r.query(ctx, sq+strconv.Itoa(limit), escapeLike(q))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []ICDCode{}
+    for rows.Next() {
+        var c ICDCode
+        if err := rows.Scan(&c.Code, &c.Description); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) GetICDCode(ctx context.Context, code string) (*ICDCode, error) {
+    var c ICDCode
+    if err := r.queryRow(ctx, `SELECT code, description FROM icd_codes WHERE code=$1`, code).Scan(&c.Code, &c.Description); err != nil {
+        if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+        return nil, err
+    }
+    return &c, nil
+}
+
+const drugColumns = `id, name, COALESCE(rxcui,''), COALESCE(normalized_name,''), COALESCE(dose_form,''), COALESCE(schedule,''),
+    dispense_unit, COALESCE(strength,0), COALESCE(strength_unit,''), COALESCE(max_daily_dose,0), COALESCE(max_daily_dose_unit,'')`
+
+func scanDrug(row rowScanner, d *Drug) error {
+    var dispenseUnit *string
+    var rules DispensingRules
+    if err := row.Scan(&d.ID, &d.Name, &d.RxCUI, &d.NormalizedName, &d.DoseForm, &d.Schedule,
+        &dispenseUnit, &rules.Strength, &rules.StrengthUnit, &rules.MaxDailyDose, &rules.MaxDailyDoseUnit); err != nil {
+        return err
+    }
+    // The rules are set and cleared together, so dispense_unit decides presence
+    if dispenseUnit != nil {
+        rules.DispenseUnit = *dispenseUnit
+        d.Rules = &rules
+    }
+    return nil
+}
+
+// drugRulesArgs flattens rules into the nullable drug columns, all NULL for nil
+func drugRulesArgs(rules *DispensingRules) []any {
+    if rules == nil { return []any{nil, nil, nil, nil, nil} }
+    var strength, maxDaily *float64
+    var strengthUnit, maxDailyUnit *string
+    if rules.Strength > 0 { strength, strengthUnit = &rules.Strength, &rules.StrengthUnit }
+    if rules.MaxDailyDose > 0 { maxDaily, maxDailyUnit = &rules.MaxDailyDose, &rules.MaxDailyDoseUnit }
+    return []any{rules.DispenseUnit, strength, strengthUnit, maxDaily, maxDailyUnit}
+}
+
+func (r *PGRepo) GetDrug(ctx context.Context, id int64) (*Drug, error) {
+    var d Drug
+    if err := scanDrug(r.queryRow(ctx, `SELECT `+drugColumns+` FROM drugs WHERE id=$1`, id), &d); err != nil {
+        if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+        return nil, err
+    }
+    return &d, nil
+}
+
+func (r *PGRepo) GetDrugs(ctx context.Context, ids []int64) ([]Drug, error) {
+    rows, err := r.query(ctx, `SELECT `+drugColumns+` FROM drugs WHERE id = ANY($1)`, ids)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Drug
+    for rows.Next() {
+        var d Drug
+        if err := scanDrug(rows, &d); err != nil { return nil, err }
+        out = append(out, d)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) CreateDrug(ctx context.Context, d *Drug) (*Drug, error) {
+    const q = `
+        INSERT INTO drugs(name, schedule, dispense_unit, strength, strength_unit, max_daily_dose, max_daily_dose_unit)
+        SELECT $1, NULLIF($2,''), $3, $4, $5, $6, $7
+        WHERE NOT EXISTS (SELECT 1 FROM drugs WHERE lower(name) = lower($1))
+        RETURNING id
+    `
+    args := append([]any{d.Name, d.Schedule}, drugRulesArgs(d.Rules)...)
+    if err := r.queryRow(ctx, q, args...).Scan(&d.ID); err != nil {
+        var pgErr *pgconn.PgError
+        if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == "23505") {
+            return nil, ErrDuplicate
         }
-        out = append(out, p)
+        return nil, err
+    }
+    return d, nil
+}
+
+func (r *PGRepo) SetDrugSchedule(ctx context.Context, id int64, schedule string) error {
+    tag, err := r.exec(ctx, `UPDATE drugs SET schedule=NULLIF($2,'') WHERE id=$1`, id, schedule)
+    if err != nil { return err }
+    if tag.RowsAffected() == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *PGRepo) SetDrugRules(ctx context.Context, id int64, rules *DispensingRules) error {
+    const q = `UPDATE drugs SET dispense_unit=$2, strength=$3, strength_unit=$4, max_daily_dose=$5, max_daily_dose_unit=$6 WHERE id=$1`
+    tag, err := r.exec(ctx, q, append([]any{id}, drugRulesArgs(rules)...)...)
+    if err != nil { return err }
+    if tag.RowsAffected() == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *PGRepo) FindDrugByRxCUI(ctx context.Context, rxcui string) (int64, error) {
+    var id int64
+    if err := r.queryRow(ctx, `SELECT id FROM drugs WHERE rxcui=$1 ORDER BY id LIMIT 1`, rxcui).Scan(&id); err != nil {
+        if errors.Is(err, pgx.ErrNoRows) { return 0, ErrNotFound }
+        return 0, err
+    }
+    return id, nil
+}
+
+func (r *PGRepo) SetDrugRxNorm(ctx context.Context, drugID int64, c RxNormConcept) error {
+    const q = `
+        UPDATE drugs SET rxcui=$2, normalized_name=$3, dose_form=NULLIF($4,'')
+        WHERE id=$1 AND rxcui IS NULL
+    `
+    _, err := r.exec(ctx, q, drugID, c.RxCUI, c.NormalizedName, c.DoseForm)
+    return err
+}
+
+func (r *PGRepo) ListDrugsMissingRxNorm(ctx context.Context, afterID int64, limit int) ([]Drug, error) {
+    rows, err := r.query(ctx, `SELECT `+drugColumns+` FROM drugs WHERE rxcui IS NULL AND id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Drug{}
+    for rows.Next() {
+        var d Drug
+        if err := scanDrug(rows, &d); err != nil { return nil, err }
+        out = append(out, d)
     }
     return out, rows.Err()
 }
 
-// noopRepo is a placeholder when no DB is configured
-type noopRepo struct{}
+func (r *PGRepo) CountDrugsMissingRxNorm(ctx context.Context, afterID int64) (int, error) {
+    var n int
+    err := r.queryRow(ctx, `SELECT COUNT(*) FROM drugs WHERE rxcui IS NULL AND id > $1`, afterID).Scan(&n)
+    return n, err
+}
+
+func (r *PGRepo) MergeDrugs(ctx context.Context, sourceID, targetID int64) ([]int64, error) {
+    ctx, cancel := r.queryContext(ctx)
+    defer cancel()
+    tx, err := r.conn(ctx).Begin(ctx)
+    if err != nil { return nil, err }
+    defer tx.Rollback(ctx)
+
+    // Lock both rows so a concurrent merge or prescription insert can't race the delete
+    var n int
+    if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM (SELECT id FROM drugs WHERE id = ANY($1) FOR UPDATE) t`, []int64{sourceID, targetID}).Scan(&n); err != nil {
+        return nil, err
+    }
+    if n != 2 { return nil, ErrNotFound }
+    rows, err := tx.Query(ctx, `UPDATE prescriptions SET drug_id=$2 WHERE drug_id=$1 RETURNING id`, sourceID, targetID)
+    if err != nil { return nil, err }
+    moved, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+    if err != nil { return nil, err }
+    slices.Sort(moved)
+    if _, err := tx.Exec(ctx, `DELETE FROM drugs WHERE id=$1`, sourceID); err != nil { return nil, err }
+    if err := tx.Commit(ctx); err != nil { return nil, err }
+    return moved, nil
+}
 
-func (n *noopRepo) CreatePrescription(ctx context.Context, p *Prescription) (*Prescription, error) {
-    return nil, errors.New("db not configured")
+func (r *PGRepo) GetPatientDetail(ctx context.Context, id int64) (*PatientDetail, error) {
+    details, err := r.GetPatientDetails(ctx, []int64{id})
+    if err != nil { return nil, err }
+    if len(details) == 0 { return nil, ErrNotFound }
+    return &details[0], nil
 }
-func (n *noopRepo) TopDrugs(ctx context.Context, from, to time.Time, limit int, patientID *int64) ([]TopDrug, error) {
-    return []TopDrug{}, nil
+
+func (r *PGRepo) GetPatientDetails(ctx context.Context, ids []int64) ([]PatientDetail, error) {
+    // Unsigned drafts and deleted prescriptions count neither as active nor as a visit
+    const q = `
+        SELECT p.id, p.org_id, p.name, COALESCE(to_char(p.birth_date, 'YYYY-MM-DD'),''), COALESCE(p.sex,''),
+               COALESCE(p.phone,''), COALESCE(p.email,''), COALESCE(p.address,''),
+               (SELECT COUNT(*) FROM prescriptions pr
+                WHERE pr.patient_id = p.id AND pr.status = 'active' AND pr.deleted_at IS NULL),
+               (SELECT MAX(pr.prescribed_at) FROM prescriptions pr
+                WHERE pr.patient_id = p.id AND pr.status <> 'pending_signature' AND pr.deleted_at IS NULL)
+        FROM patients p
+        WHERE p.id = ANY($1) AND p.deleted_at IS NULL AND ($2::bigint IS NULL OR p.org_id = $2)
+    `
+    rows, err := r.query(ctx, q, ids, orgArg(ctx))
+    if err != nil { return nil, err }
+    var out []PatientDetail
+    for rows.Next() {
+        var d PatientDetail
+        if err := rows.Scan(&d.ID, &d.OrgID, &d.Name, &d.BirthDate, &d.Sex, &d.Phone, &d.Email, &d.Address,
+            &d.ActivePrescriptions, &d.LastVisitAt); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        out = append(out, d)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil { return nil, err }
+    if len(out) == 0 { return out, nil }
+    teams, err := r.physiciansForPatients(ctx, ids)
+    if err != nil { return nil, err }
+    for i := range out {
+        out[i].Physicians = teams[out[i].ID]
+        if out[i].Physicians == nil { out[i].Physicians = []Physician{} }
+    }
+    return out, nil
 }
-func (n *noopRepo) IsPhysicianPatientLinked(ctx context.Context, physicianID, patientID int64) (bool, error) {
-    return false, nil
+
+func (r *PGRepo) ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error) {
+    teams, err := r.physiciansForPatients(ctx, []int64{patientID})
+    return teams[patientID], err
 }
-func (n *noopRepo) ListPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) ([]Prescription, error) {
-    return []Prescription{}, nil
+
+// physiciansForPatients lists the physicians linked to each of patientIDs, by name
+func (r *PGRepo) physiciansForPatients(ctx context.Context, patientIDs []int64) (map[int64][]Physician, error) {
+    const q = `
+        SELECT pp.patient_id, ph.id, ph.name
+        FROM physician_patients pp
+        JOIN physicians ph ON ph.id = pp.physician_id
+        WHERE pp.patient_id = ANY($1) AND ph.deleted_at IS NULL AND ($2::bigint IS NULL OR ph.org_id = $2)
+        ORDER BY ph.name ASC, ph.id ASC
+    `
+    rows, err := r.query(ctx, q, patientIDs, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := map[int64][]Physician{}
+    for rows.Next() {
+        var patientID int64
+        var it Physician
+        if err := rows.Scan(&patientID, &it.ID, &it.Name); err != nil { return nil, err }
+        out[patientID] = append(out[patientID], it)
+    }
+    return out, rows.Err()
 }
-func (n *noopRepo) ListPatientsForPhysician(ctx context.Context, physicianID int64) ([]Patient, error) {
-    return []Patient{}, nil
+
+func (r *PGRepo) GetPhysicians(ctx context.Context, ids []int64) ([]Physician, error) {
+    const q = `SELECT id, name FROM physicians WHERE id = ANY($1) AND deleted_at IS NULL AND ($2::bigint IS NULL OR org_id = $2)`
+    rows, err := r.query(ctx, q, ids, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Physician
+    for rows.Next() {
+        var it Physician
+        if err := rows.Scan(&it.ID, &it.Name); err != nil { return nil, err }
+        out = append(out, it)
+    }
+    return out, rows.Err()
 }
-func (n *noopRepo) FindOrCreateDrug(ctx context.Context, name string) (int64, error) {
-    return 0, errors.New("db not configured")
+
+func (r *PGRepo) LinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    // Both sides must exist, undeleted, in the same organization, and in ctx's when it is scoped
+    const q = `
+        WITH pair AS (
+            SELECT ph.id AS physician_id, p.id AS patient_id
+            FROM physicians ph
+            JOIN patients p ON p.org_id = ph.org_id
+            WHERE ph.id = $1 AND p.id = $2 AND ($3::bigint IS NULL OR p.org_id = $3)
+              AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+        ), ins AS (
+            INSERT INTO physician_patients (physician_id, patient_id)
+            SELECT physician_id, patient_id FROM pair
+            ON CONFLICT DO NOTHING
+            RETURNING 1
+        )
+        SELECT EXISTS (SELECT 1 FROM pair), EXISTS (SELECT 1 FROM ins)
+    `
+    var valid, created bool
+    if err := r.queryRow(ctx, q, physicianID, patientID, orgArg(ctx)).Scan(&valid, &created); err != nil {
+        return false, err
+    }
+    if !valid { return false, ErrInvalidReference }
+    return created, nil
 }
-func (n *noopRepo) ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error) {
-    return []Physician{}, nil
+
+func (r *PGRepo) UnlinkPhysicianPatient(ctx context.Context, physicianID, patientID int64) (bool, error) {
+    const q = `
+        DELETE FROM physician_patients
+        WHERE physician_id=$1 AND patient_id=$2
+          AND patient_id IN (SELECT id FROM patients WHERE $3::bigint IS NULL OR org_id = $3)
+    `
+    tag, err := r.exec(ctx, q, physicianID, patientID, orgArg(ctx))
+    if err != nil { return false, err }
+    return tag.RowsAffected() > 0, nil
+}
+
+func (r *PGRepo) GrantConsent(ctx context.Context, c *Consent) (*Consent, error) {
+    ctx, cancel := r.queryContext(ctx)
+    defer cancel()
+    tx, err := r.conn(ctx).Begin(ctx)
+    if err != nil { return nil, err }
+    defer tx.Rollback(ctx)
+
+    var valid bool
+    err = tx.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM patients p JOIN physicians ph ON ph.org_id = p.org_id
+            WHERE p.id=$1 AND ph.id=$2 AND ($3::bigint IS NULL OR p.org_id = $3))`,
+        c.PatientID, c.PhysicianID, orgArg(ctx)).Scan(&valid)
+    if err != nil { return nil, err }
+    if !valid { return nil, ErrInvalidReference }
+    if _, err := tx.Exec(ctx, `UPDATE consents SET revoked_at=NOW() WHERE patient_id=$1 AND physician_id=$2 AND scope=$3 AND revoked_at IS NULL`,
+        c.PatientID, c.PhysicianID, c.Scope); err != nil {
+        return nil, err
+    }
+    err = tx.QueryRow(ctx, `INSERT INTO consents (patient_id, physician_id, scope, expires_at) VALUES ($1,$2,$3,$4) RETURNING id, granted_at`,
+        c.PatientID, c.PhysicianID, c.Scope, c.ExpiresAt).Scan(&c.ID, &c.GrantedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23503" { return nil, ErrInvalidReference }
+        return nil, err
+    }
+    if err := tx.Commit(ctx); err != nil { return nil, err }
+    return c, nil
+}
+
+func (r *PGRepo) ListConsents(ctx context.Context, patientID int64) ([]Consent, error) {
+    const q = `
+        SELECT c.id, c.patient_id, c.physician_id, c.scope, c.granted_at, c.expires_at, c.revoked_at
+        FROM consents c
+        JOIN patients p ON p.id = c.patient_id
+        WHERE c.patient_id=$1 AND ($2::bigint IS NULL OR p.org_id = $2)
+        ORDER BY c.granted_at DESC, c.id DESC
+    `
+    rows, err := r.query(ctx, q, patientID, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Consent{}
+    for rows.Next() {
+        var c Consent
+        if err := rows.Scan(&c.ID, &c.PatientID, &c.PhysicianID, &c.Scope, &c.GrantedAt, &c.ExpiresAt, &c.RevokedAt); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) RevokeConsent(ctx context.Context, patientID, consentID int64) (bool, error) {
+    var revokedAt *time.Time
+    const q = `
+        SELECT c.revoked_at FROM consents c
+        JOIN patients p ON p.id = c.patient_id
+        WHERE c.id=$1 AND c.patient_id=$2 AND ($3::bigint IS NULL OR p.org_id = $3)
+    `
+    err := r.queryRow(ctx, q, consentID, patientID, orgArg(ctx)).Scan(&revokedAt)
+    if errors.Is(err, pgx.ErrNoRows) { return false, ErrNotFound }
+    if err != nil { return false, err }
+    if revokedAt != nil { return false, nil }
+    tag, err := r.exec(ctx, `UPDATE consents SET revoked_at=NOW() WHERE id=$1 AND revoked_at IS NULL`, consentID)
+    if err != nil { return false, err }
+    return tag.RowsAffected() == 1, nil
+}
+
+func (r *PGRepo) HasActiveConsent(ctx context.Context, patientID, physicianID int64, scope string) (bool, error) {
+    const q = `
+        SELECT EXISTS (
+            SELECT 1 FROM consents c
+            JOIN patients p ON p.id = c.patient_id
+            WHERE c.patient_id=$1 AND c.physician_id=$2 AND c.scope=$3
+              AND c.revoked_at IS NULL AND (c.expires_at IS NULL OR c.expires_at > NOW())
+              AND ($4::bigint IS NULL OR p.org_id = $4)
+        )
+    `
+    var ok bool
+    err := r.queryRow(ctx, q, patientID, physicianID, scope, orgArg(ctx)).Scan(&ok)
+    return ok, err
+}
+
+func (r *PGRepo) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+    // Expired keys are treated as absent so the same key can be reused after the TTL, and so
+    // are reservations whose request outlived its lease
+    const del = `
+        DELETE FROM idempotency_keys
+        WHERE scope=$1 AND key=$2
+          AND (expires_at <= NOW() OR status_code IS NULL AND reserved_at <= NOW() - make_interval(secs => $3))
+    `
+    if _, err := r.exec(ctx, del, rec.Scope, rec.Key, idempotencyLease.Seconds()); err != nil {
+        return nil, err
+    }
+    const ins = `
+        INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+        VALUES ($1,$2,$3,$4)
+        ON CONFLICT (scope, key) DO NOTHING
+    `
+    tag, err := r.exec(ctx, ins, rec.Scope, rec.Key, rec.RequestHash, rec.ExpiresAt)
+    if err != nil {
+        return nil, err
+    }
+    if tag.RowsAffected() == 1 {
+        return nil, nil
+    }
+    const sel = `
+        SELECT scope, key, request_hash, COALESCE(status_code, 0), COALESCE(response_body, ''::bytea), created_at, reserved_at, expires_at
+        FROM idempotency_keys WHERE scope=$1 AND key=$2
+    `
+    var ex IdempotencyRecord
+    if err := r.queryRow(ctx, sel, rec.Scope, rec.Key).Scan(
+        &ex.Scope, &ex.Key, &ex.RequestHash, &ex.StatusCode, &ex.Body, &ex.CreatedAt, &ex.ReservedAt, &ex.ExpiresAt,
+    ); err != nil {
+        return nil, err
+    }
+    return &ex, nil
+}
+
+func (r *PGRepo) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, body []byte) error {
+    const q = `UPDATE idempotency_keys SET status_code=$3, response_body=$4 WHERE scope=$1 AND key=$2 AND status_code IS NULL`
+    _, err := r.exec(ctx, q, scope, key, statusCode, body)
+    return err
+}
+
+func (r *PGRepo) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+    const q = `DELETE FROM idempotency_keys WHERE scope=$1 AND key=$2 AND status_code IS NULL`
+    _, err := r.exec(ctx, q, scope, key)
+    return err
+}
+
+// ListPrescriptions returns prescriptions based on RBAC-aware filters
+type ListPrescriptionsFilter struct {
+    // Exactly one of PatientID or PhysicianID should typically be set based on caller role
+    PatientID   *int64
+    PhysicianID *int64
+    // PharmacyID scopes pharmacists to prescriptions routed to their pharmacy
+    PharmacyID  *int64
+    // DraftedBy scopes nurses to the drafts they wrote
+    DraftedBy   *int64
+    // ConsentScope, with PhysicianID, keeps only patients linked to that physician who
+    // consented to the scope (the list form of physicianCanRead)
+    ConsentScope string
+    // ExcludePending hides unsigned drafts (from patients and pharmacies)
+    ExcludePending bool
+    // OrgID limits results to one organization. PGRepo sets it from ctx; callers need not.
+    OrgID       *int64
+    Limit       int
+    // Sort is a key of prescriptionSortColumns ("" means prescribed_at), newest/largest
+    // first unless Ascending. Ties break on id in the same direction.
+    Sort        string
+    Ascending   bool
+}
+
+// prescriptionSortColumns whitelists the ?sort= fields of GET /prescriptions
+var prescriptionSortColumns = map[string]string{
+    "prescribed_at": "pr.prescribed_at",
+    "quantity":      "pr.quantity",
+    "drug_name":     "lower(d.name)",
+}
+
+// prescriptionOrder is the ORDER BY clause for filter's sort
+func prescriptionOrder(filter ListPrescriptionsFilter) string {
+    col, ok := prescriptionSortColumns[filter.Sort]
+    if !ok { col = prescriptionSortColumns["prescribed_at"] }
+    dir := " DESC"
+    if filter.Ascending { dir = " ASC" }
+    return " ORDER BY " + col + dir + ", pr.id" + dir
+}
+
+func (r *PGRepo) CreatePharmacy(ctx context.Context, p *Pharmacy) (*Pharmacy, error) {
+    org, ok := orgFromContext(ctx)
+    if !ok { org = defaultOrgID }
+    err := r.queryRow(ctx, `INSERT INTO pharmacies(name, address, org_id) VALUES ($1, NULLIF($2,''), $3) RETURNING id`,
+        p.Name, p.Address, org).Scan(&p.ID)
+    if err != nil { return nil, err }
+    return p, nil
+}
+
+func (r *PGRepo) ListPharmacies(ctx context.Context) ([]Pharmacy, error) {
+    rows, err := r.query(ctx, `SELECT id, name, COALESCE(address,'') FROM pharmacies WHERE `+orgFilter("org_id", 1)+` ORDER BY name, id`, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Pharmacy{}
+    for rows.Next() {
+        var p Pharmacy
+        if err := rows.Scan(&p.ID, &p.Name, &p.Address); err != nil { return nil, err }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+// callerOrgQueries look up CallerOrg's row, by table
+var callerOrgQueries = map[string]string{
+    "patients":   `SELECT org_id FROM patients WHERE id=$1 AND deleted_at IS NULL`,
+    "physicians": `SELECT org_id FROM physicians WHERE id=$1 AND deleted_at IS NULL`,
+    "pharmacies": `SELECT org_id FROM pharmacies WHERE id=$1`,
+    "nurses":     `SELECT org_id FROM nurses WHERE id=$1`,
+    "org_admins": `SELECT org_id FROM org_admins WHERE id=$1`,
+}
+
+func (r *PGRepo) CallerOrg(ctx context.Context, table string, id int64) (int64, error) {
+    q, ok := callerOrgQueries[table]
+    if !ok { return 0, fmt.Errorf("CallerOrg: unknown table %q", table) }
+    var org int64
+    if err := r.queryRow(ctx, q, id).Scan(&org); err != nil {
+        if errors.Is(err, pgx.ErrNoRows) { return 0, ErrNotFound }
+        return 0, err
+    }
+    return org, nil
+}
+
+func (r *PGRepo) CreateOrganization(ctx context.Context, o *Organization) (*Organization, error) {
+    err := r.queryRow(ctx, `INSERT INTO organizations(name) VALUES ($1) RETURNING id, created_at`, o.Name).Scan(&o.ID, &o.CreatedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" { return nil, ErrDuplicate }
+        return nil, err
+    }
+    return o, nil
+}
+
+func (r *PGRepo) ListOrganizations(ctx context.Context) ([]Organization, error) {
+    rows, err := r.query(ctx, `SELECT id, name, created_at FROM organizations WHERE $1::bigint IS NULL OR id = $1 ORDER BY id`, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Organization{}
+    for rows.Next() {
+        var o Organization
+        if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt); err != nil { return nil, err }
+        out = append(out, o)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) RegisterPatient(ctx context.Context, reg PatientRegistration) (int64, bool, error) {
+    // Blank demographics keep what is on file; a deleted patient's MRN is not reused
+    const q = `
+        INSERT INTO patients(org_id, mrn, name, birth_date, sex, phone, email, address)
+        VALUES ($1, $2, $3, NULLIF($4,'')::date, NULLIF($5,''), NULLIF($6,''), NULLIF($7,''), NULLIF($8,''))
+        ON CONFLICT (org_id, mrn) WHERE mrn IS NOT NULL DO UPDATE SET
+            name = EXCLUDED.name,
+            birth_date = COALESCE(EXCLUDED.birth_date, patients.birth_date),
+            sex = COALESCE(EXCLUDED.sex, patients.sex),
+            phone = COALESCE(EXCLUDED.phone, patients.phone),
+            email = COALESCE(EXCLUDED.email, patients.email),
+            address = COALESCE(EXCLUDED.address, patients.address)
+        WHERE patients.deleted_at IS NULL
+        RETURNING id, (xmax = 0)
+    `
+    org, ok := orgFromContext(ctx)
+    if !ok { org = defaultOrgID }
+    var id int64
+    var created bool
+    err := r.queryRow(ctx, q, org, reg.MRN, reg.Name, reg.BirthDate, reg.Sex, reg.Phone, reg.Email, reg.Address).Scan(&id, &created)
+    if errors.Is(err, pgx.ErrNoRows) { return 0, false, ErrNotFound }
+    if err != nil { return 0, false, err }
+    return id, created, nil
+}
+
+func (r *PGRepo) FindPatientByMRN(ctx context.Context, mrn string) (int64, error) {
+    org, ok := orgFromContext(ctx)
+    if !ok { org = defaultOrgID }
+    var id int64
+    err := r.queryRow(ctx, `SELECT id FROM patients WHERE org_id = $1 AND mrn = $2 AND deleted_at IS NULL`, org, mrn).Scan(&id)
+    if errors.Is(err, pgx.ErrNoRows) { return 0, ErrNotFound }
+    return id, err
+}
+
+func (r *PGRepo) QuarantineHL7Message(ctx context.Context, q *HL7QuarantinedMessage) error {
+    return r.queryRow(ctx, `
+        INSERT INTO hl7_quarantine(org_id, request_id, control_id, message_type, reason, raw)
+        VALUES ($1, $2, NULLIF($3,''), NULLIF($4,''), $5, $6)
+        RETURNING id, received_at
+    `, orgArg(ctx), q.RequestID, q.ControlID, q.MessageType, q.Reason, q.Raw).Scan(&q.ID, &q.ReceivedAt)
+}
+
+func (r *PGRepo) ListHL7Quarantine(ctx context.Context, limit int) ([]HL7QuarantinedMessage, error) {
+    const q = `
+        SELECT id, received_at, request_id, COALESCE(control_id,''), COALESCE(message_type,''), reason, raw
+        FROM hl7_quarantine
+        WHERE ($1::bigint IS NULL OR org_id = $1)
+        ORDER BY received_at DESC, id DESC
+        LIMIT $2
+    `
+    rows, err := r.query(ctx, q, orgArg(ctx), limit)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []HL7QuarantinedMessage{}
+    for rows.Next() {
+        var m HL7QuarantinedMessage
+        if err := rows.Scan(&m.ID, &m.ReceivedAt, &m.RequestID, &m.ControlID, &m.MessageType, &m.Reason, &m.Raw); err != nil {
+            return nil, err
+        }
+        out = append(out, m)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) GetNotificationPreferences(ctx context.Context, patientID int64) (*NotificationPreferences, error) {
+    const q = `
+        SELECT p.id, COALESCE(np.email, FALSE), COALESCE(np.sms, FALSE), np.updated_at
+        FROM patients p
+        LEFT JOIN notification_preferences np ON np.patient_id = p.id
+        WHERE p.id = $1 AND p.deleted_at IS NULL AND ($2::bigint IS NULL OR p.org_id = $2)
+    `
+    var np NotificationPreferences
+    err := r.queryRow(ctx, q, patientID, orgArg(ctx)).Scan(&np.PatientID, &np.Email, &np.SMS, &np.UpdatedAt)
+    if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return &np, nil
+}
+
+func (r *PGRepo) SetNotificationPreferences(ctx context.Context, np *NotificationPreferences) (*NotificationPreferences, error) {
+    const q = `
+        INSERT INTO notification_preferences (patient_id, email, sms)
+        SELECT id, $2, $3 FROM patients WHERE id = $1 AND deleted_at IS NULL AND ($4::bigint IS NULL OR org_id = $4)
+        ON CONFLICT (patient_id) DO UPDATE SET email = EXCLUDED.email, sms = EXCLUDED.sms, updated_at = NOW()
+        RETURNING updated_at
+    `
+    err := r.queryRow(ctx, q, np.PatientID, np.Email, np.SMS, orgArg(ctx)).Scan(&np.UpdatedAt)
+    if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return np, nil
+}
+
+func (r *PGRepo) DispensePrescription(ctx context.Context, id, pharmacyID int64, quantity int) (*Prescription, error) {
+    ctx, cancel := r.queryContext(ctx)
+    defer cancel()
+    tx, err := r.conn(ctx).Begin(ctx)
+    if err != nil { return nil, err }
+    defer tx.Rollback(ctx)
+
+    var prescribed int
+    var dispensedAt *time.Time
+    var status string
+    const sel = `
+        SELECT quantity, dispensed_at, status FROM prescriptions
+        WHERE id=$1 AND pharmacy_id=$2 AND deleted_at IS NULL AND ($3::bigint IS NULL OR org_id = $3)
+        FOR UPDATE
+    `
+    err = tx.QueryRow(ctx, sel, id, pharmacyID, orgArg(ctx)).Scan(&prescribed, &dispensedAt, &status)
+    if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    if status != PrescriptionActive { return nil, ErrNotActive }
+    if dispensedAt != nil { return nil, ErrAlreadyDispensed }
+    if quantity > prescribed { return nil, ErrDispenseQuantity }
+    if _, err := tx.Exec(ctx, `UPDATE prescriptions SET dispensed_at=NOW(), dispensed_quantity=$2 WHERE id=$1`, id, quantity); err != nil {
+        return nil, err
+    }
+
+    q, args := prescriptionByID(ctx, id)
+    var p Prescription
+    if err := scanPrescription(tx.QueryRow(ctx, q, args...), &p); err != nil { return nil, err }
+    if err := tx.Commit(ctx); err != nil { return nil, err }
+    return &p, nil
+}
+
+func (r *PGRepo) CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) (*WebhookEndpoint, error) {
+    err := r.queryRow(ctx, `INSERT INTO webhook_endpoints(url, secret) VALUES ($1,$2) RETURNING id, created_at`,
+        e.URL, e.Secret).Scan(&e.ID, &e.CreatedAt)
+    if err != nil { return nil, err }
+    return e, nil
+}
+
+func (r *PGRepo) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+    rows, err := r.query(ctx, `SELECT id, url, secret, created_at FROM webhook_endpoints ORDER BY id`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []WebhookEndpoint{}
+    for rows.Next() {
+        var e WebhookEndpoint
+        if err := rows.Scan(&e.ID, &e.URL, &e.Secret, &e.CreatedAt); err != nil { return nil, err }
+        out = append(out, e)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) DeleteWebhookEndpoint(ctx context.Context, id int64) error {
+    tag, err := r.exec(ctx, `DELETE FROM webhook_endpoints WHERE id=$1`, id)
+    if err != nil { return err }
+    if tag.RowsAffected() == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *PGRepo) RecordWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+    const q = `
+        INSERT INTO webhook_deliveries(endpoint_id, event_id, event_type, attempt, status_code, error, succeeded)
+        VALUES ($1,$2,$3,$4,NULLIF($5,0),NULLIF($6,''),$7)
+        RETURNING id, created_at
+    `
+    err := r.queryRow(ctx, q, d.EndpointID, d.EventID, d.EventType, d.Attempt, d.StatusCode, d.Error, d.Succeeded).
+        Scan(&d.ID, &d.CreatedAt)
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23503" { return ErrInvalidReference }
+    return err
+}
+
+func (r *PGRepo) ListWebhookDeliveries(ctx context.Context, endpointID int64, limit int) ([]WebhookDelivery, error) {
+    const q = `
+        SELECT id, endpoint_id, event_id, event_type, attempt, COALESCE(status_code,0), COALESCE(error,''), succeeded, created_at
+        FROM webhook_deliveries
+        WHERE endpoint_id = $1
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2
+    `
+    rows, err := r.query(ctx, q, endpointID, limit)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []WebhookDelivery{}
+    for rows.Next() {
+        var d WebhookDelivery
+        if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.Succeeded, &d.CreatedAt); err != nil {
+            return nil, err
+        }
+        out = append(out, d)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) softDelete(ctx context.Context, table string, id int64) error {
+    // table is one of our own constants, never user input; each has an org_id column
+    tag, err := r.exec(ctx, `UPDATE `+table+` SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL AND ($2::bigint IS NULL OR org_id = $2)`,
+        id, orgArg(ctx))
+    if err != nil { return err }
+    if tag.RowsAffected() == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *PGRepo) SoftDeletePatient(ctx context.Context, id int64) error { return r.softDelete(ctx, "patients", id) }
+
+func (r *PGRepo) SoftDeletePhysician(ctx context.Context, id int64) error { return r.softDelete(ctx, "physicians", id) }
+
+func (r *PGRepo) SoftDeletePrescription(ctx context.Context, id int64) error { return r.softDelete(ctx, "prescriptions", id) }
+
+func (r *PGRepo) AnonymizePatients(ctx context.Context, cutoff time.Time, limit int) ([]int64, error) {
+    // Anonymization and its audit rows commit together in one statement
+    const q = `
+        WITH due AS (
+            SELECT p.id FROM patients p
+            WHERE p.anonymized_at IS NULL AND ($5::bigint IS NULL OR p.org_id = $5)
+              AND (p.deleted_at < $1 OR p.deleted_at IS NULL AND p.created_at < $1 AND NOT EXISTS (
+                  SELECT 1 FROM prescriptions pr
+                  WHERE pr.patient_id = p.id AND (pr.prescribed_at >= $1 OR
+                        pr.status IN ('active','pending_signature','pending_reauthorization') AND pr.deleted_at IS NULL)))
+            ORDER BY p.id LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        ), scrubbed AS (
+            UPDATE patients p SET name = 'Anonymized patient ' || p.id, anonymized_at = NOW(),
+                   birth_date = NULL, sex = NULL, phone = NULL, email = NULL, address = NULL, mrn = NULL
+            FROM due WHERE p.id = due.id
+            RETURNING p.id
+        ), unsubscribed AS (
+            DELETE FROM notification_preferences np USING due WHERE np.patient_id = due.id
+        )
+        INSERT INTO audit_log (actor, action, entity, entity_id)
+        SELECT $3, $4, 'patient', id FROM scrubbed
+        RETURNING entity_id
+    `
+    rows, err := r.query(ctx, q, cutoff, limit, auditActorRetention, AuditAnonymize, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        out = append(out, id)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) ExpirePrescriptions(ctx context.Context, now time.Time, limit int, entry AuditEntry) ([]int64, error) {
+    // Like TransitionPrescriptions, the status change and its audit rows commit together
+    const q = `
+        WITH due AS (
+            SELECT id FROM prescriptions
+            WHERE expires_at <= $1 AND status = 'active' AND deleted_at IS NULL AND ($6::bigint IS NULL OR org_id = $6)
+            ORDER BY id LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        ), changed AS (
+            UPDATE prescriptions p SET status = 'expired'
+            FROM due WHERE p.id = due.id
+            RETURNING p.id
+        )
+        INSERT INTO audit_log (actor, action, entity, entity_id, detail)
+        SELECT $3, $4, 'prescription', id, NULLIF($5,'') FROM changed
+        RETURNING entity_id
+    `
+    rows, err := r.query(ctx, q, now, limit, entry.Actor, entry.Action, entry.Detail, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        out = append(out, id)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) PurgeIdempotencyKeys(ctx context.Context, now time.Time, limit int) (int64, error) {
+    const q = `
+        DELETE FROM idempotency_keys WHERE (scope, key) IN (
+            SELECT scope, key FROM idempotency_keys WHERE expires_at <= $1 LIMIT $2
+        )
+    `
+    tag, err := r.exec(ctx, q, now, limit)
+    if err != nil { return 0, err }
+    return tag.RowsAffected(), nil
+}
+
+func (r *PGRepo) PurgeAuditLog(ctx context.Context, before time.Time, limit int) (int64, error) {
+    const q = `DELETE FROM audit_log WHERE id IN (SELECT id FROM audit_log WHERE created_at < $1 ORDER BY id LIMIT $2)`
+    tag, err := r.exec(ctx, q, before, limit)
+    if err != nil { return 0, err }
+    return tag.RowsAffected(), nil
+}
+
+func (r *PGRepo) RecordAudit(ctx context.Context, e AuditEntry) error {
+    _, err := r.exec(ctx, `INSERT INTO audit_log (actor, action, entity, entity_id, detail) VALUES ($1,$2,$3,$4,NULLIF($5,''))`,
+        e.Actor, e.Action, e.Entity, e.EntityID, e.Detail)
+    return err
+}
+
+func (r *PGRepo) RecordProvenance(ctx context.Context, d *DocumentProvenance) error {
+    const q = `
+        INSERT INTO document_provenance (document_id, kind, format, request_id, actor, params, row_count, sha256)
+        VALUES ($1,$2,$3,$4,$5,NULLIF($6,''),$7,$8)
+        RETURNING created_at
+    `
+    return r.queryRow(ctx, q, d.DocumentID, d.Kind, d.Format, d.RequestID, d.Actor, d.Params, d.Rows, d.SHA256).Scan(&d.CreatedAt)
+}
+
+const provenanceColumns = `document_id, kind, format, request_id, actor, COALESCE(params,''), row_count, sha256, created_at`
+
+func (r *PGRepo) getProvenance(ctx context.Context, where string, arg string) (*DocumentProvenance, error) {
+    var d DocumentProvenance
+    err := r.queryRow(ctx, `SELECT `+provenanceColumns+` FROM document_provenance WHERE `+where+` ORDER BY created_at LIMIT 1`, arg).
+        Scan(&d.DocumentID, &d.Kind, &d.Format, &d.RequestID, &d.Actor, &d.Params, &d.Rows, &d.SHA256, &d.CreatedAt)
+    if err != nil {
+        if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+        return nil, err
+    }
+    return &d, nil
+}
+
+func (r *PGRepo) GetProvenance(ctx context.Context, documentID string) (*DocumentProvenance, error) {
+    return r.getProvenance(ctx, "document_id = $1", documentID)
+}
+
+// FindProvenanceBySHA256 returns the earliest document with this content hash
+func (r *PGRepo) FindProvenanceBySHA256(ctx context.Context, sha256 string) (*DocumentProvenance, error) {
+    return r.getProvenance(ctx, "sha256 = $1", sha256)
+}
+
+func (r *PGRepo) MatchBulkPrescriptions(ctx context.Context, f BulkFilter) ([]int64, error) {
+    q := `SELECT id FROM prescriptions WHERE status = 'active' AND deleted_at IS NULL AND ` + orgFilter("org_id", 1)
+    args := []any{orgArg(ctx)}
+    if f.DrugID != nil {
+        args = append(args, *f.DrugID)
+        q += " AND drug_id = $" + strconv.Itoa(len(args))
+    }
+    if f.PhysicianID != nil {
+        args = append(args, *f.PhysicianID)
+        q += " AND physician_id = $" + strconv.Itoa(len(args))
+    }
+    if f.From != nil {
+        args = append(args, *f.From)
+        q += " AND prescribed_at >= $" + strconv.Itoa(len(args))
+    }
+    if f.To != nil {
+        args = append(args, *f.To)
+        q += " AND prescribed_at < $" + strconv.Itoa(len(args))
+    }
+    rows, err := r.query(ctx, q+" ORDER BY id", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []int64{}
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        out = append(out, id)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) TransitionPrescriptions(ctx context.Context, ids []int64, status string, entry AuditEntry) ([]int64, error) {
+    // The status change and its audit rows commit together in one statement
+    const q = `
+        WITH changed AS (
+            UPDATE prescriptions SET status = $2
+            WHERE id = ANY($1) AND status = 'active' AND deleted_at IS NULL AND ($6::bigint IS NULL OR org_id = $6)
+            RETURNING id
+        )
+        INSERT INTO audit_log (actor, action, entity, entity_id, detail)
+        SELECT $3, $4, 'prescription', id, NULLIF($5,'') FROM changed
+        RETURNING entity_id
+    `
+    rows, err := r.query(ctx, q, ids, status, entry.Actor, entry.Action, entry.Detail, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        out = append(out, id)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) ReassignPrescriptions(ctx context.Context, patientID, fromPhysicianID, toPhysicianID int64, entry AuditEntry) ([]int64, error) {
+    const q = `
+        WITH moved AS (
+            UPDATE prescriptions SET physician_id = $3, status = 'pending_reauthorization', signature = NULL
+            WHERE patient_id = $1 AND physician_id = $2 AND status = 'active' AND deleted_at IS NULL
+              AND ($7::bigint IS NULL OR org_id = $7)
+            RETURNING id
+        )
+        INSERT INTO audit_log (actor, action, entity, entity_id, detail)
+        SELECT $4, $5, 'prescription', id, NULLIF($6,'') FROM moved
+        RETURNING entity_id
+    `
+    rows, err := r.query(ctx, q, patientID, fromPhysicianID, toPhysicianID, entry.Actor, entry.Action, entry.Detail, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        out = append(out, id)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) SignPrescription(ctx context.Context, id int64) (*Prescription, error) {
+    const q = `
+        UPDATE prescriptions SET status='active', signed_at=NOW()
+        WHERE id=$1 AND status IN ('pending_signature','pending_reauthorization') AND deleted_at IS NULL AND ($2::bigint IS NULL OR org_id = $2)
+    `
+    tag, err := r.exec(ctx, q, id, orgArg(ctx))
+    if err != nil { return nil, err }
+    if tag.RowsAffected() == 0 { return nil, ErrNotPending }
+    return r.GetPrescription(ctx, id)
+}
+
+func (r *PGRepo) SetPrescriptionSignature(ctx context.Context, id int64, signature string) error {
+    tag, err := r.exec(ctx, `UPDATE prescriptions SET signature=$2 WHERE id=$1 AND ($3::bigint IS NULL OR org_id = $3)`, id, signature, orgArg(ctx))
+    if err != nil { return err }
+    if tag.RowsAffected() == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *PGRepo) IsNurseDelegate(ctx context.Context, nurseID, physicianID int64) (bool, error) {
+    const q = `
+        SELECT EXISTS (
+            SELECT 1 FROM nurse_delegations nd
+            JOIN physicians ph ON ph.id = nd.physician_id AND ph.deleted_at IS NULL
+            WHERE nd.nurse_id=$1 AND nd.physician_id=$2 AND ($3::bigint IS NULL OR ph.org_id = $3))`
+    var ok bool
+    err := r.queryRow(ctx, q, nurseID, physicianID, orgArg(ctx)).Scan(&ok)
+    return ok, err
+}
+
+func (r *PGRepo) ListNursesForPhysician(ctx context.Context, physicianID int64) ([]Nurse, error) {
+    const q = `
+        SELECT n.id, n.name
+        FROM nurse_delegations nd
+        JOIN nurses n ON n.id = nd.nurse_id
+        JOIN physicians ph ON ph.id = nd.physician_id
+        WHERE nd.physician_id = $1 AND ($2::bigint IS NULL OR ph.org_id = $2)
+        ORDER BY n.name ASC, n.id ASC
+    `
+    rows, err := r.query(ctx, q, physicianID, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Nurse{}
+    for rows.Next() {
+        var n Nurse
+        if err := rows.Scan(&n.ID, &n.Name); err != nil { return nil, err }
+        out = append(out, n)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) AddNurseDelegation(ctx context.Context, physicianID, nurseID int64) (bool, error) {
+    // Nurses are shared across organizations; the physician must be in ctx's
+    const q = `
+        WITH ph AS (
+            SELECT id FROM physicians WHERE id = $1 AND ($3::bigint IS NULL OR org_id = $3)
+        ), ins AS (
+            INSERT INTO nurse_delegations (physician_id, nurse_id)
+            SELECT id, $2 FROM ph
+            ON CONFLICT DO NOTHING
+            RETURNING 1
+        )
+        SELECT EXISTS (SELECT 1 FROM ph), EXISTS (SELECT 1 FROM ins)
+    `
+    var valid, created bool
+    if err := r.queryRow(ctx, q, physicianID, nurseID, orgArg(ctx)).Scan(&valid, &created); err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23503" { return false, ErrInvalidReference }
+        return false, err
+    }
+    if !valid { return false, ErrInvalidReference }
+    return created, nil
+}
+
+func (r *PGRepo) RemoveNurseDelegation(ctx context.Context, physicianID, nurseID int64) error {
+    const q = `
+        DELETE FROM nurse_delegations
+        WHERE physician_id=$1 AND nurse_id=$2
+          AND physician_id IN (SELECT id FROM physicians WHERE $3::bigint IS NULL OR org_id = $3)
+    `
+    _, err := r.exec(ctx, q, physicianID, nurseID, orgArg(ctx))
+    return err
+}
+
+func (r *PGRepo) GetPrescription(ctx context.Context, id int64) (*Prescription, error) {
+    q, args := prescriptionByID(ctx, id)
+    var p Prescription
+    err := scanPrescription(r.queryRow(ctx, q, args...), &p)
+    if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return &p, nil
+}
+
+func (r *PGRepo) CreatePrescriptionComment(ctx context.Context, c *PrescriptionComment) (*PrescriptionComment, error) {
+    const q = `
+        INSERT INTO prescription_comments (prescription_id, author_role, author_id, body, mentions)
+        SELECT $1,$2,$3,$4,$5
+        WHERE EXISTS (SELECT 1 FROM prescriptions WHERE id = $1 AND ($6::bigint IS NULL OR org_id = $6))
+        RETURNING id, created_at
+    `
+    mentions, err := json.Marshal(c.Mentions)
+    if err != nil { return nil, err }
+    if err := r.queryRow(ctx, q, c.PrescriptionID, string(c.AuthorRole), c.AuthorID, c.Body, mentions, orgArg(ctx)).Scan(&c.ID, &c.CreatedAt); err != nil {
+        var pgErr *pgconn.PgError
+        if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == "23503") { return nil, ErrInvalidReference }
+        return nil, err
+    }
+    return c, nil
+}
+
+func (r *PGRepo) ListPrescriptionComments(ctx context.Context, prescriptionID int64) ([]PrescriptionComment, error) {
+    const q = `
+        SELECT c.id, c.prescription_id, c.author_role, c.author_id, c.body, c.mentions, c.created_at
+        FROM prescription_comments c
+        JOIN prescriptions pr ON pr.id = c.prescription_id
+        WHERE c.prescription_id = $1 AND ($2::bigint IS NULL OR pr.org_id = $2)
+        ORDER BY c.created_at ASC, c.id ASC
+    `
+    rows, err := r.query(ctx, q, prescriptionID, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []PrescriptionComment{}
+    for rows.Next() {
+        var c PrescriptionComment
+        var mentions []byte
+        if err := rows.Scan(&c.ID, &c.PrescriptionID, &c.AuthorRole, &c.AuthorID, &c.Body, &mentions, &c.CreatedAt); err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal(mentions, &c.Mentions); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+const attachmentColumns = `a.id, a.prescription_id, a.kind, a.filename, a.content_type, a.size_bytes, a.sha256, a.storage_key,
+        a.uploaded_by_role, a.uploaded_by_id, a.created_at`
+
+func scanAttachment(row rowScanner, a *PrescriptionAttachment) error {
+    return row.Scan(&a.ID, &a.PrescriptionID, &a.Kind, &a.Filename, &a.ContentType, &a.SizeBytes, &a.SHA256, &a.StorageKey,
+        &a.UploadedByRole, &a.UploadedByID, &a.CreatedAt)
+}
+
+func (r *PGRepo) CreatePrescriptionAttachment(ctx context.Context, a *PrescriptionAttachment) (*PrescriptionAttachment, error) {
+    const q = `
+        INSERT INTO prescription_attachments (prescription_id, kind, filename, content_type, size_bytes, sha256, storage_key, uploaded_by_role, uploaded_by_id)
+        SELECT $1,$2,$3,$4,$5,$6,$7,$8,$9
+        WHERE EXISTS (SELECT 1 FROM prescriptions WHERE id = $1 AND deleted_at IS NULL AND ($10::bigint IS NULL OR org_id = $10))
+        RETURNING id, created_at
+    `
+    err := r.queryRow(ctx, q, a.PrescriptionID, a.Kind, a.Filename, a.ContentType, a.SizeBytes, a.SHA256, a.StorageKey,
+        string(a.UploadedByRole), a.UploadedByID, orgArg(ctx)).Scan(&a.ID, &a.CreatedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == "23503") { return nil, ErrInvalidReference }
+        return nil, err
+    }
+    return a, nil
+}
+
+func (r *PGRepo) ListPrescriptionAttachments(ctx context.Context, prescriptionID int64) ([]PrescriptionAttachment, error) {
+    q := `
+        SELECT ` + attachmentColumns + `
+        FROM prescription_attachments a
+        JOIN prescriptions pr ON pr.id = a.prescription_id
+        WHERE a.prescription_id = $1 AND ($2::bigint IS NULL OR pr.org_id = $2)
+        ORDER BY a.created_at ASC, a.id ASC
+    `
+    rows, err := r.query(ctx, q, prescriptionID, orgArg(ctx))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []PrescriptionAttachment{}
+    for rows.Next() {
+        var a PrescriptionAttachment
+        if err := scanAttachment(rows, &a); err != nil { return nil, err }
+        out = append(out, a)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) GetPrescriptionAttachment(ctx context.Context, prescriptionID, id int64) (*PrescriptionAttachment, error) {
+    q := `
+        SELECT ` + attachmentColumns + `
+        FROM prescription_attachments a
+        JOIN prescriptions pr ON pr.id = a.prescription_id
+        WHERE a.id = $1 AND a.prescription_id = $2 AND ($3::bigint IS NULL OR pr.org_id = $3)
+    `
+    var a PrescriptionAttachment
+    err := scanAttachment(r.queryRow(ctx, q, id, prescriptionID, orgArg(ctx)), &a)
+    if errors.Is(err, pgx.ErrNoRows) { return nil, ErrNotFound }
+    if err != nil { return nil, err }
+    return &a, nil
+}
+
+// rowScanner is satisfied by pgx.Row and pgx.Rows
+type rowScanner interface{ Scan(dest ...any) error }
+
+// prescriptionQuery builds the joined prescription SELECT (without ORDER BY/LIMIT)
+// shared by list and export so both honor exactly the same filters.
+func prescriptionQuery(filter ListPrescriptionsFilter) (string, []any) {
+    q := `
+        SELECT pr.id,
+               pr.patient_id, p.name AS patient_name,
+               pr.physician_id, ph.name AS physician_name,
+               pr.drug_id, d.name AS drug_name,
+               pr.quantity, COALESCE(pr.quantity_unit,''), COALESCE(pr.days_supply,0), pr.sig, pr.prescribed_at,
+               pr.dose_amount, pr.dose_unit, pr.route, pr.frequency, pr.duration_days, pr.expires_at,
+               pr.refills, COALESCE(pr.reason,''),
+               pr.pharmacy_id, COALESCE(phm.name,''), pr.dispensed_at, pr.dispensed_quantity,
+               pr.status, pr.drafted_by, pr.signed_at,
+               COALESCE(pr.diagnosis_code,''), COALESCE(ic.description,''), COALESCE(pr.signature,'')
+        FROM prescriptions pr
+        JOIN patients p   ON p.id = pr.patient_id
+        JOIN physicians ph ON ph.id = pr.physician_id
+        JOIN drugs d      ON d.id = pr.drug_id
+        LEFT JOIN pharmacies phm ON phm.id = pr.pharmacy_id
+        LEFT JOIN icd_codes ic ON ic.code = pr.diagnosis_code
+        WHERE pr.deleted_at IS NULL AND p.deleted_at IS NULL`
+    args := []any{}
+    if filter.PatientID != nil {
+        q += " AND pr.patient_id = $" + strconv.Itoa(len(args)+1)
+        args = append(args, *filter.PatientID)
+    }
+    if filter.PhysicianID != nil {
+        q += " AND pr.physician_id = $" + strconv.Itoa(len(args)+1)
+        args = append(args, *filter.PhysicianID)
+    }
+    if filter.PhysicianID != nil && filter.ConsentScope != "" {
+        q += ` AND EXISTS (SELECT 1 FROM physician_patients pp WHERE pp.physician_id = pr.physician_id AND pp.patient_id = pr.patient_id)
+               AND EXISTS (SELECT 1 FROM consents c WHERE c.patient_id = pr.patient_id AND c.physician_id = pr.physician_id
+                             AND c.scope = $` + strconv.Itoa(len(args)+1) + ` AND c.revoked_at IS NULL AND (c.expires_at IS NULL OR c.expires_at > NOW()))`
+        args = append(args, filter.ConsentScope)
+    }
+    if filter.PharmacyID != nil {
+        q += " AND pr.pharmacy_id = $" + strconv.Itoa(len(args)+1)
+        args = append(args, *filter.PharmacyID)
+    }
+    if filter.DraftedBy != nil {
+        q += " AND pr.drafted_by = $" + strconv.Itoa(len(args)+1)
+        args = append(args, *filter.DraftedBy)
+    }
+    if filter.ExcludePending {
+        q += " AND pr.status <> 'pending_signature'"
+    }
+    if filter.OrgID != nil {
+        q += " AND pr.org_id = $" + strconv.Itoa(len(args)+1)
+        args = append(args, *filter.OrgID)
+    }
+    return q, args
+}
+
+// prescriptionByID is prescriptionQuery narrowed to one prescription in ctx's organization
+func prescriptionByID(ctx context.Context, id int64) (string, []any) {
+    q, args := prescriptionQuery(ListPrescriptionsFilter{OrgID: orgArg(ctx)})
+    args = append(args, id)
+    return q + " AND pr.id = $" + strconv.Itoa(len(args)), args
+}
+
+func scanPrescription(row rowScanner, p *Prescription) error {
+    var amount *float64
+    var unit, route, freq *string
+    var duration *int
+    if err := row.Scan(
+        &p.ID,
+        &p.PatientID, &p.PatientName,
+        &p.PhysicianID, &p.PhysicianName,
+        &p.DrugID, &p.DrugName,
+        &p.Quantity, &p.QuantityUnit, &p.DaysSupply, &p.Sig, &p.PrescribedAt,
+        &amount, &unit, &route, &freq, &duration, &p.ExpiresAt,
+        &p.Refills, &p.Reason,
+        &p.PharmacyID, &p.PharmacyName, &p.DispensedAt, &p.DispensedQuantity,
+        &p.Status, &p.DraftedBy, &p.SignedAt,
+        &p.DiagnosisCode, &p.DiagnosisDescription, &p.Signature,
+    ); err != nil {
+        return err
+    }
+    // Structured dosing is all-or-nothing at insert time, so amount decides presence
+    if amount != nil {
+        p.Dosage = &Dosage{Amount: *amount}
+        if unit != nil { p.Dosage.Unit = *unit }
+        if route != nil { p.Dosage.Route = *route }
+        if freq != nil { p.Dosage.Frequency = *freq }
+        if duration != nil { p.Dosage.DurationDays = *duration }
+    }
+    return nil
+}
+
+func (r *PGRepo) ListPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) ([]Prescription, error) {
+    limit := filter.Limit
+    if limit <= 0 || limit > 200 {
+        limit = 50
+    }
+    filter.OrgID = orgArg(ctx)
+    q, args := prescriptionQuery(filter)
+    q += prescriptionOrder(filter) + " LIMIT " + strconv.Itoa(limit)
+    // Lists may trail a just-written prescription by the replica's lag
+    ctx = withReplicaReads(ctx)
+
+    rows, err := r.query(ctx, q, args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Prescription
+    for rows.Next() {
+        var p Prescription
+        if err := scanPrescription(rows, &p); err != nil {
+            return nil, err
+        }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+func (r *PGRepo) CountPrescriptions(ctx context.Context, filter ListPrescriptionsFilter) (int, error) {
+    filter.OrgID = orgArg(ctx)
+    q, args := prescriptionQuery(filter)
+    var n int
+    err := r.queryRow(ctx, "SELECT COUNT(*) FROM ("+q+") t", args...).Scan(&n)
+    return n, err
+}
+
+// StreamPrescriptions walks matching prescriptions row by row without buffering the result
+func (r *PGRepo) StreamPrescriptions(ctx context.Context, filter ListPrescriptionsFilter, maxRows int, fn func(Prescription) error) error {
+    filter.OrgID = orgArg(ctx)
+    q, args := prescriptionQuery(filter)
+    q += " ORDER BY pr.prescribed_at DESC, pr.id DESC"
+    if maxRows > 0 {
+        q += " LIMIT " + strconv.Itoa(maxRows)
+    }
+    ctx, cancel := r.queryContext(withQueryClass(ctx, queryExport))
+    defer cancel()
+    // A download can outlast the pool-wide statement_timeout, so the export class carries
+    // its own in a read-only transaction
+    pool, replica := r.readPool(ctx)
+    tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+    if err != nil && replica && r.retryOnPrimary(err) {
+        tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+    }
+    if err != nil { return err }
+    defer tx.Rollback(ctx)
+    if _, err := tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`, strconv.FormatInt(r.timeouts.Export.Milliseconds(), 10)); err != nil {
+        return err
+    }
+    rows, err := tx.Query(ctx, q, args...)
+    if err != nil { return err }
+    defer rows.Close()
+    for rows.Next() {
+        var p Prescription
+        if err := scanPrescription(rows, &p); err != nil {
+            return err
+        }
+        if err := fn(p); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
 }
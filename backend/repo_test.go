@@ -0,0 +1,46 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestNewPGRepoPoolConfig(t *testing.T) {
+    // The pool connects lazily, so no database is needed
+    pg, err := NewPGRepo(context.Background(), "postgres://app@127.0.0.1:1/rx", PoolConfig{MaxConns: 12, MinConns: 0, MaxConnLifetime: 5 * time.Minute})
+    if err != nil { t.Fatalf("NewPGRepo: %v", err) }
+    defer pg.pool.Close()
+    cfg := pg.pool.Config()
+    if cfg.MaxConns != 12 || cfg.MaxConnLifetime != 5*time.Minute || cfg.MaxConnIdleTime != 30*time.Minute {
+        t.Fatalf("pool config = max %d, lifetime %s, idle %s", cfg.MaxConns, cfg.MaxConnLifetime, cfg.MaxConnIdleTime)
+    }
+    if _, err := NewPGRepo(context.Background(), "postgres://app@db/rx?pool_max_conns=x", PoolConfig{}); err == nil {
+        t.Fatal("expected an invalid DSN to fail")
+    }
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+    var waits []time.Duration
+    onRetry := func(_ int, _ error, wait time.Duration) { waits = append(waits, wait) }
+
+    calls := 0
+    err := retryWithBackoff(context.Background(), time.Millisecond, 3*time.Millisecond, func(context.Context) error {
+        calls++
+        if calls < 4 { return errors.New("connection refused") }
+        return nil
+    }, onRetry)
+    if err != nil || calls != 4 { t.Fatalf("err = %v after %d calls", err, calls) }
+    if len(waits) != 3 || waits[0] != time.Millisecond || waits[1] != 2*time.Millisecond || waits[2] != 3*time.Millisecond {
+        t.Fatalf("waits = %v", waits)
+    }
+
+    // Gives up with the last error once the context is done
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    down := errors.New("still down")
+    if err := retryWithBackoff(ctx, time.Millisecond, 5*time.Millisecond, func(context.Context) error { return down }, func(int, error, time.Duration) {}); !errors.Is(err, down) {
+        t.Fatalf("err = %v, want %v", err, down)
+    }
+}
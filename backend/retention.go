@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// retentionBatch bounds how many patients one pass anonymizes
+const retentionBatch = 500
+
+// openPrescriptionStatus holds the prescription states that keep a patient active, however
+// long ago the prescription was written
+var openPrescriptionStatus = map[string]bool{
+    PrescriptionActive: true, PrescriptionPendingSignature: true, PrescriptionPendingReauthorization: true,
+}
+
+// retentionConfig controls the anonymization job. A zero Window disables it.
+type retentionConfig struct {
+    // Window is how long a patient keeps their PII after being soft-deleted, or after their
+    // last prescription (or registration) when never deleted
+    Window time.Duration
+    // Interval is how often the job runs
+    Interval time.Duration
+}
+
+// retentionFromConfig derives the job settings from RETENTION_DAYS and RETENTION_INTERVAL
+func retentionFromConfig(c Config) retentionConfig {
+    return retentionConfig{
+        Window:   time.Duration(c.RetentionDays) * 24 * time.Hour,
+        Interval: time.Duration(c.RetentionInterval),
+    }
+}
+
+// runRetention anonymizes every patient that was soft-deleted, or last active, more than
+// cfg.Window before now, in batches, and returns how many were anonymized.
+func runRetention(ctx context.Context, repo Repository, cfg retentionConfig, now time.Time) (int, error) {
+    cutoff := now.Add(-cfg.Window)
+    total := 0
+    for {
+        ids, err := repo.AnonymizePatients(ctx, cutoff, retentionBatch)
+        total += len(ids)
+        if err != nil || len(ids) < retentionBatch { return total, err }
+    }
+}
+
+// handleSoftDelete serves DELETE /{entity}s/{id} for callers granted action: the row is marked deleted
+// (hidden everywhere but kept for audit and retention) and the deletion is audited.
+func (s *Server) handleSoftDelete(w http.ResponseWriter, r *http.Request, action Action, entity, idStr string, del func(context.Context, int64) error) {
+    if r.Method != http.MethodDelete {
+        w.Header().Set("Allow", http.MethodDelete)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if _, ok := s.can(w, r, action, Resource{}); !ok { return }
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusNotFound, "not found"); return }
+    if err := del(r.Context(), id); err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, entity+" not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to delete "+entity)
+        return
+    }
+    s.callerOrgs.forget(entity+"s", id)
+    s.audit(r, AuditDelete, entity, id)
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestSoftDelete(t *testing.T) {
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        expectStatus int
+    }{
+        {name: "admin deletes patient", path: "/patients/1", role: "admin", expectStatus: http.StatusNoContent},
+        {name: "admin deletes physician", path: "/physicians/2", role: "admin", expectStatus: http.StatusNoContent},
+        {name: "admin deletes prescription", path: "/prescriptions/1", role: "admin", expectStatus: http.StatusNoContent},
+        {name: "missing patient", path: "/patients/99", role: "admin", expectStatus: http.StatusNotFound},
+        {name: "physician forbidden", path: "/patients/1", role: "physician", expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            repo := newDemoMemoryRepo()
+            srv := NewServer(repo, defaultConfig())
+            req := httptest.NewRequest(http.MethodDelete, tc.path, nil)
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if rr.Code == http.StatusNoContent && (len(repo.audit) != 1 || repo.audit[0].Actor != "admin:1") {
+                t.Fatalf("audit = %+v", repo.audit)
+            }
+        })
+    }
+}
+
+func TestSoftDeletedPatientHidden(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    if err := repo.SoftDeletePatient(context.Background(), 1); err != nil { t.Fatal(err) }
+
+    req := httptest.NewRequest(http.MethodGet, "/prescriptions", nil)
+    req.Header.Set("X-Role", "admin")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    var list struct{ Items []Prescription `json:"items"` }
+    _ = json.NewDecoder(rr.Body).Decode(&list)
+    for _, p := range list.Items {
+        if p.PatientID == 1 { t.Fatalf("deleted patient's prescription listed: %+v", p) }
+    }
+    if linked, _ := repo.IsPhysicianPatientLinked(context.Background(), 1, 1); linked {
+        t.Fatalf("deleted patient still linked")
+    }
+    if err := repo.SoftDeletePatient(context.Background(), 1); err != ErrNotFound { t.Fatalf("second delete = %v, want ErrNotFound", err) }
+
+    // Deleted patients and physicians can't be linked or prescribed for
+    ctx := context.Background()
+    if _, err := repo.LinkPhysicianPatient(ctx, 2, 1); err != ErrInvalidReference { t.Fatalf("link deleted patient = %v, want ErrInvalidReference", err) }
+    if _, err := repo.CreatePrescription(ctx, &Prescription{PatientID: 1, PhysicianID: 1, DrugID: 1, Quantity: 1, Sig: "x"}); err != ErrInvalidReference {
+        t.Fatalf("prescribe for deleted patient = %v, want ErrInvalidReference", err)
+    }
+    if err := repo.SoftDeletePhysician(ctx, 2); err != nil { t.Fatal(err) }
+    if _, err := repo.LinkPhysicianPatient(ctx, 2, 3); err != ErrInvalidReference { t.Fatalf("link deleted physician = %v, want ErrInvalidReference", err) }
+    if _, err := repo.CreatePrescription(ctx, &Prescription{PatientID: 2, PhysicianID: 2, DrugID: 1, Quantity: 1, Sig: "x"}); err != ErrInvalidReference {
+        t.Fatalf("prescribe by deleted physician = %v, want ErrInvalidReference", err)
+    }
+}
+
+func TestRunRetentionAnonymizesOldDeletions(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    ctx := context.Background()
+    _ = repo.SoftDeletePatient(ctx, 1)
+    _ = repo.SoftDeletePatient(ctx, 2)
+    // Patient 1 was deleted long ago; patient 2 just now
+    repo.deleted[memoryRef{"patients", 1}] = time.Now().Add(-40 * 24 * time.Hour)
+    cfg := retentionConfig{Window: 30 * 24 * time.Hour}
+
+    n, err := runRetention(ctx, repo, cfg, time.Now())
+    if err != nil || n != 1 { t.Fatalf("runRetention = %d, %v", n, err) }
+    if got := repo.patients[1].Name; got != "Anonymized patient 1" { t.Fatalf("patient 1 name = %q", got) }
+    if got := repo.patients[2].Name; got != "Bob" { t.Fatalf("patient 2 should keep PII until the window passes, got %q", got) }
+    if len(repo.audit) != 1 || repo.audit[0].Action != AuditAnonymize || repo.audit[0].EntityID != 1 {
+        t.Fatalf("audit = %+v", repo.audit)
+    }
+    // Already anonymized patients are not processed again
+    if n, _ := runRetention(ctx, repo, cfg, time.Now()); n != 0 { t.Fatalf("second run anonymized %d", n) }
+}
+
+func TestRunRetentionAnonymizesInactivePatients(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    ctx := context.Background()
+    day := 24 * time.Hour
+    dave, erin := repo.addPatient("Dave"), repo.addPatient("Erin")
+    for id := range repo.patients {
+        if id != erin { repo.patientCreated[id] = time.Now().Add(-60 * day) }
+    }
+    // Alice's prescriptions are old and closed; Bob's is old but still active; Carol's was
+    // cancelled recently. Dave never had one, and Erin registered just now.
+    for id, p := range repo.prescriptions {
+        switch p.PatientID {
+        case 1:
+            p.PrescribedAt, p.Status = time.Now().Add(-40*day), PrescriptionExpired
+        case 2:
+            p.PrescribedAt = time.Now().Add(-40 * day)
+        case 3:
+            p.PrescribedAt, p.Status = time.Now().Add(-10*day), PrescriptionCancelled
+        }
+        repo.prescriptions[id] = p
+    }
+
+    n, err := runRetention(ctx, repo, retentionConfig{Window: 30 * day}, time.Now())
+    if err != nil || n != 2 { t.Fatalf("runRetention = %d, %v", n, err) }
+    for id, want := range map[int64]string{1: "Anonymized patient 1", 2: "Bob", 3: "Carol", dave: "Anonymized patient 4", erin: "Erin"} {
+        if got := repo.patients[id].Name; got != want { t.Fatalf("patient %d name = %q, want %q", id, got, want) }
+    }
+    if _, ok := repo.demographics[1]; ok { t.Fatal("Alice's demographics were kept") }
+}
+
+func TestRetentionScrubsMRNAndNotificationPreferences(t *testing.T) {
+    repo := newDemoMemoryRepo()
+    ctx := context.Background()
+    id, _, err := repo.RegisterPatient(ctx, PatientRegistration{MRN: "MRN-7", Name: "Frank"})
+    if err != nil { t.Fatal(err) }
+    if _, err := repo.SetNotificationPreferences(ctx, &NotificationPreferences{PatientID: id, Email: true}); err != nil { t.Fatal(err) }
+    _ = repo.SoftDeletePatient(ctx, id)
+    repo.deleted[memoryRef{"patients", id}] = time.Now().Add(-40 * 24 * time.Hour)
+
+    if n, err := runRetention(ctx, repo, retentionConfig{Window: 30 * 24 * time.Hour}, time.Now()); err != nil || n != 1 { t.Fatalf("runRetention = %d, %v", n, err) }
+    if _, err := repo.FindPatientByMRN(ctx, "MRN-7"); err != ErrNotFound { t.Fatalf("MRN lookup after anonymization = %v, want ErrNotFound", err) }
+    if _, ok := repo.notificationPrefs[id]; ok { t.Fatal("notification preferences were kept") }
+    // The MRN is free again, so a new registration makes a new patient
+    if newID, created, err := repo.RegisterPatient(ctx, PatientRegistration{MRN: "MRN-7", Name: "Frank"}); err != nil || !created || newID == id {
+        t.Fatalf("re-register = %d, %v, %v", newID, created, err)
+    }
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// RxNormConcept is the normalized form of a free-text drug name
+type RxNormConcept struct {
+    RxCUI          string `json:"rxcui"`
+    NormalizedName string `json:"normalized_name"`
+    DoseForm       string `json:"dose_form,omitempty"`
+}
+
+// DrugNormalizer resolves free-text drug names to RxNorm concepts. Resolve returns
+// (nil, nil) when the name has no confident match.
+type DrugNormalizer interface {
+    Resolve(ctx context.Context, name string) (*RxNormConcept, error)
+}
+
+const (
+    defaultRxNormBaseURL = "https://rxnav.nlm.nih.gov/REST"
+    defaultRxNormTimeout = 3 * time.Second
+    rxNormCacheTTL       = 24 * time.Hour
+)
+
+// rxNormClient talks to the NLM RxNav REST API and caches results (including misses)
+type rxNormClient struct {
+    baseURL string
+    http    *http.Client
+
+    mu    sync.Mutex
+    cache map[string]rxNormCacheEntry
+}
+
+type rxNormCacheEntry struct {
+    concept *RxNormConcept
+    expires time.Time
+}
+
+func newRxNormClient(baseURL string, timeout time.Duration) *rxNormClient {
+    return &rxNormClient{
+        baseURL: strings.TrimRight(baseURL, "/"),
+        http:    &http.Client{Timeout: timeout},
+        cache:   map[string]rxNormCacheEntry{},
+    }
+}
+
+// rxNormFromConfig returns a client when RXNORM_ENABLED=1, or nil to keep drug handling local-only
+func rxNormFromConfig(c Config) DrugNormalizer {
+    if !c.RxNormEnabled {
+        return nil
+    }
+    return newRxNormClient(c.RxNormBaseURL, time.Duration(c.RxNormTimeout))
+}
+
+func (c *rxNormClient) Resolve(ctx context.Context, name string) (*RxNormConcept, error) {
+    key := strings.ToLower(strings.TrimSpace(name))
+    c.mu.Lock()
+    if e, ok := c.cache[key]; ok && time.Now().Before(e.expires) {
+        c.mu.Unlock()
+        return e.concept, nil
+    }
+    c.mu.Unlock()
+
+    concept, err := c.lookup(ctx, name)
+    if err != nil {
+        // Errors are not cached so a transient outage doesn't pin a miss for a day
+        return nil, err
+    }
+    c.mu.Lock()
+    c.cache[key] = rxNormCacheEntry{concept: concept, expires: time.Now().Add(rxNormCacheTTL)}
+    c.mu.Unlock()
+    return concept, nil
+}
+
+func (c *rxNormClient) lookup(ctx context.Context, name string) (*RxNormConcept, error) {
+    var approx struct {
+        ApproximateGroup struct {
+            Candidate []struct {
+                RxCUI string `json:"rxcui"`
+                Rank  string `json:"rank"`
+            } `json:"candidate"`
+        } `json:"approximateGroup"`
+    }
+    q := url.Values{"term": {name}, "maxEntries": {"1"}}
+    if err := c.get(ctx, "/approximateTerm.json?"+q.Encode(), &approx); err != nil {
+        return nil, err
+    }
+    if len(approx.ApproximateGroup.Candidate) == 0 || approx.ApproximateGroup.Candidate[0].Rank != "1" {
+        return nil, nil
+    }
+    rxcui := approx.ApproximateGroup.Candidate[0].RxCUI
+
+    var props struct {
+        Properties struct {
+            RxCUI string `json:"rxcui"`
+            Name  string `json:"name"`
+        } `json:"properties"`
+    }
+    if err := c.get(ctx, "/rxcui/"+url.PathEscape(rxcui)+"/properties.json", &props); err != nil {
+        return nil, err
+    }
+    if props.Properties.Name == "" {
+        return nil, nil
+    }
+    concept := &RxNormConcept{RxCUI: rxcui, NormalizedName: props.Properties.Name}
+
+    // Dose form is only related to clinical drugs; ingredients legitimately have none
+    var related struct {
+        RelatedGroup struct {
+            ConceptGroup []struct {
+                ConceptProperties []struct {
+                    Name string `json:"name"`
+                } `json:"conceptProperties"`
+            } `json:"conceptGroup"`
+        } `json:"relatedGroup"`
+    }
+    if err := c.get(ctx, "/rxcui/"+url.PathEscape(rxcui)+"/related.json?tty=DF", &related); err == nil {
+        for _, g := range related.RelatedGroup.ConceptGroup {
+            if len(g.ConceptProperties) > 0 {
+                concept.DoseForm = g.ConceptProperties[0].Name
+                break
+            }
+        }
+    }
+    return concept, nil
+}
+
+func (c *rxNormClient) get(ctx context.Context, path string, v any) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+    if err != nil { return err }
+    req.Header.Set("Accept", "application/json")
+    resp, err := c.http.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("rxnorm: %s returned %d", path, resp.StatusCode)
+    }
+    return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func newFakeRxNav(t *testing.T, calls *int32) *httptest.Server {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(calls, 1)
+        w.Header().Set("Content-Type", "application/json")
+        switch r.URL.Path {
+        case "/approximateTerm.json":
+            if r.URL.Query().Get("term") == "unknownium" {
+                _, _ = w.Write([]byte(`{"approximateGroup":{"candidate":[]}}`))
+                return
+            }
+            _, _ = w.Write([]byte(`{"approximateGroup":{"candidate":[{"rxcui":"5640","rank":"1"}]}}`))
+        case "/rxcui/5640/properties.json":
+            _, _ = w.Write([]byte(`{"properties":{"rxcui":"5640","name":"ibuprofen","tty":"IN"}}`))
+        case "/rxcui/5640/related.json":
+            _, _ = w.Write([]byte(`{"relatedGroup":{"conceptGroup":[{"tty":"DF","conceptProperties":[{"name":"Oral Tablet"}]}]}}`))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestRxNormClientResolveAndCache(t *testing.T) {
+    var calls int32
+    rx := newFakeRxNav(t, &calls)
+    c := newRxNormClient(rx.URL, time.Second)
+
+    got, err := c.Resolve(context.Background(), "Ibuprofen 200mg")
+    if err != nil { t.Fatalf("Resolve: %v", err) }
+    want := RxNormConcept{RxCUI: "5640", NormalizedName: "ibuprofen", DoseForm: "Oral Tablet"}
+    if got == nil || *got != want { t.Fatalf("Resolve = %+v, want %+v", got, want) }
+
+    before := atomic.LoadInt32(&calls)
+    if _, err := c.Resolve(context.Background(), "ibuprofen 200MG"); err != nil { t.Fatalf("Resolve: %v", err) }
+    if atomic.LoadInt32(&calls) != before { t.Fatalf("expected cached result, got %d extra calls", atomic.LoadInt32(&calls)-before) }
+
+    miss, err := c.Resolve(context.Background(), "unknownium")
+    if err != nil || miss != nil { t.Fatalf("Resolve miss = %+v, %v", miss, err) }
+}
+
+func TestResolveDrugUsesRxNormAndFallsBack(t *testing.T) {
+    var calls int32
+    rx := newFakeRxNav(t, &calls)
+    repo := newMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    srv.rxnorm = newRxNormClient(rx.URL, time.Second)
+    ctx := context.Background()
+
+    first, err := srv.resolveDrug(ctx, "Ibuprofen 200mg")
+    if err != nil { t.Fatalf("resolveDrug: %v", err) }
+    if d := repo.drugs[first]; d.RxCUI != "5640" || d.NormalizedName != "ibuprofen" {
+        t.Fatalf("drug not normalized: %+v", d)
+    }
+    // A differently spelled name with the same rxcui reuses the catalog entry
+    second, _ := srv.resolveDrug(ctx, "Advil")
+    if second != first { t.Fatalf("expected rxcui match to reuse drug %d, got %d", first, second) }
+
+    // Integration down: falls back to local-only behavior
+    srv.rxnorm = newRxNormClient("http://127.0.0.1:1", 100*time.Millisecond)
+    id, err := srv.resolveDrug(ctx, "Metformin")
+    if err != nil || id == 0 { t.Fatalf("fallback resolveDrug = %d, %v", id, err) }
+    if repo.drugs[id].RxCUI != "" { t.Fatalf("fallback drug should not be normalized: %+v", repo.drugs[id]) }
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+    "crypto/subtle"
+    "math"
+    "net/http"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    // latencyWindowSize caps the samples kept; under heavy load the window covers the most
+    // recent latencyWindowSize requests rather than the full latencyWindowSpan
+    latencyWindowSize = 4096
+    latencyWindowSpan = time.Minute
+)
+
+type latencySample struct {
+    at time.Time
+    d  time.Duration
+}
+
+// latencyWindow keeps recent request latencies in a ring buffer for percentile reporting
+type latencyWindow struct {
+    mu      sync.Mutex
+    samples []latencySample
+    next    int
+}
+
+func newLatencyWindow() *latencyWindow {
+    return &latencyWindow{samples: make([]latencySample, 0, latencyWindowSize)}
+}
+
+func (l *latencyWindow) record(at time.Time, d time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if len(l.samples) < latencyWindowSize {
+        l.samples = append(l.samples, latencySample{at, d})
+        return
+    }
+    l.samples[l.next] = latencySample{at, d}
+    l.next = (l.next + 1) % latencyWindowSize
+}
+
+// snapshot returns the latencies recorded since now-latencyWindowSpan, sorted ascending
+func (l *latencyWindow) snapshot(now time.Time) []time.Duration {
+    cutoff := now.Add(-latencyWindowSpan)
+    l.mu.Lock()
+    out := make([]time.Duration, 0, len(l.samples))
+    for _, s := range l.samples {
+        if s.at.After(cutoff) { out = append(out, s.d) }
+    }
+    l.mu.Unlock()
+    sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+    return out
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies, 0 when empty
+func percentile(sorted []time.Duration, p float64) time.Duration {
+    if len(sorted) == 0 { return 0 }
+    i := int(math.Ceil(float64(len(sorted))*p/100)) - 1
+    if i < 0 { i = 0 }
+    return sorted[i]
+}
+
+// requestStats tracks in-flight requests and recent latencies for /scaling
+type requestStats struct {
+    inFlight  atomic.Int64
+    latencies *latencyWindow
+}
+
+func newRequestStats() *requestStats {
+    return &requestStats{latencies: newLatencyWindow()}
+}
+
+// track wraps one API request
+func (rs *requestStats) track(next func()) {
+    rs.inFlight.Add(1)
+    start := time.Now()
+    defer func() {
+        rs.inFlight.Add(-1)
+        rs.latencies.record(time.Now(), time.Since(start))
+    }()
+    next()
+}
+
+// ScalingSignals is the flat document served by /scaling, shaped for external autoscalers
+// (a KEDA metrics-api trigger's valueLocation, or an HPA external metrics adapter)
+type ScalingSignals struct {
+    WindowSeconds     int     `json:"window_seconds"`
+    RequestsInFlight  int64   `json:"requests_in_flight"`
+    RequestsPerSecond float64 `json:"requests_per_second"`
+    LatencyP50MS      float64 `json:"latency_p50_ms"`
+    LatencyP95MS      float64 `json:"latency_p95_ms"`
+    // Background work still to do
+    WebhookDeliveriesPending int64 `json:"webhook_deliveries_pending"`
+    BulkJobsActive           int   `json:"bulk_jobs_active"`
+    BackfillJobsActive       int   `json:"backfill_jobs_active"`
+    // Postgres pool; omitted for the in-memory repository. Saturation is acquired/max.
+    DBPoolAcquired   *int32   `json:"db_pool_acquired,omitempty"`
+    DBPoolMax        *int32   `json:"db_pool_max,omitempty"`
+    DBPoolSaturation *float64 `json:"db_pool_saturation,omitempty"`
+}
+
+func (s *Server) scalingSignals(now time.Time) ScalingSignals {
+    lat := s.stats.latencies.snapshot(now)
+    ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+    sig := ScalingSignals{
+        WindowSeconds:            int(latencyWindowSpan / time.Second),
+        RequestsInFlight:         s.stats.inFlight.Load(),
+        RequestsPerSecond:        float64(len(lat)) / latencyWindowSpan.Seconds(),
+        LatencyP50MS:             ms(percentile(lat, 50)),
+        LatencyP95MS:             ms(percentile(lat, 95)),
+        WebhookDeliveriesPending: s.webhooks.pending.Load(),
+    }
+    for _, j := range s.bulk.list() {
+        if j.Status == BulkQueued || j.Status == BulkRunning { sig.BulkJobsActive++ }
+    }
+    for _, j := range s.backfills.list() {
+        if j.Status == BackfillQueued || j.Status == BackfillRunning { sig.BackfillJobsActive++ }
+    }
+    if pg, ok := s.repo.(*PGRepo); ok {
+        st := pg.pool.Stat()
+        acquired, maxConns := st.AcquiredConns(), st.MaxConns()
+        saturation := 0.0
+        if maxConns > 0 { saturation = float64(acquired) / float64(maxConns) }
+        sig.DBPoolAcquired, sig.DBPoolMax, sig.DBPoolSaturation = &acquired, &maxConns, &saturation
+    }
+    return sig
+}
+
+// handleScaling serves GET /scaling. Like the probes it is unversioned and doesn't use
+// X-Role, since autoscalers can't act as a role; set SCALING_TOKEN to require
+// "Authorization: Bearer <token>".
+func (s *Server) handleScaling(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    if token := s.cfg.ScalingToken; token != "" {
+        got := r.Header.Get("Authorization")
+        if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+            writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+            return
+        }
+    }
+    writeJSON(w, http.StatusOK, s.scalingSignals(time.Now()))
+}
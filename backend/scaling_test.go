@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestPercentile(t *testing.T) {
+    ms := func(ns ...int) []time.Duration {
+        out := make([]time.Duration, len(ns))
+        for i, n := range ns { out[i] = time.Duration(n) * time.Millisecond }
+        return out
+    }
+    cases := []struct {
+        name   string
+        sorted []time.Duration
+        p      float64
+        want   time.Duration
+    }{
+        {name: "empty", p: 95},
+        {name: "single", sorted: ms(7), p: 95, want: 7 * time.Millisecond},
+        {name: "median", sorted: ms(1, 2, 3, 4), p: 50, want: 2 * time.Millisecond},
+        {name: "p95 of 20", sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 100), p: 95, want: 19 * time.Millisecond},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := percentile(tc.sorted, tc.p); got != tc.want { t.Fatalf("percentile = %v, want %v", got, tc.want) }
+        })
+    }
+}
+
+func TestLatencyWindowDropsOldSamples(t *testing.T) {
+    l := newLatencyWindow()
+    now := time.Now()
+    l.record(now.Add(-2*latencyWindowSpan), time.Second)
+    for i := 0; i < latencyWindowSize+10; i++ { l.record(now, time.Millisecond) }
+    got := l.snapshot(now)
+    if len(got) != latencyWindowSize || got[len(got)-1] != time.Millisecond { t.Fatalf("snapshot has %d samples, max %v", len(got), got[len(got)-1]) }
+}
+
+func TestScalingEndpoint(t *testing.T) {
+    cfg := defaultConfig()
+    cfg.ScalingToken = "scale-me"
+    srv := NewServer(newDemoMemoryRepo(), cfg)
+    get := func(path, auth string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, path, nil)
+        req.Header.Set("X-Role", "admin")
+        if auth != "" { req.Header.Set("Authorization", auth) }
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr
+    }
+    get("/v1/drugs", "")
+    get("/v1/prescriptions", "")
+    get("/healthz", "")
+
+    if rr := get("/scaling", ""); rr.Code != http.StatusUnauthorized { t.Fatalf("no token status = %d, want 401", rr.Code) }
+    if rr := get("/scaling", "Bearer wrong"); rr.Code != http.StatusUnauthorized { t.Fatalf("bad token status = %d, want 401", rr.Code) }
+    rr := get("/scaling", "Bearer scale-me")
+    if rr.Code != http.StatusOK { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var sig ScalingSignals
+    if err := json.NewDecoder(rr.Body).Decode(&sig); err != nil { t.Fatal(err) }
+    // Probes are excluded, so only the two API calls count
+    if sig.WindowSeconds != 60 || sig.RequestsPerSecond != 2.0/60 || sig.RequestsInFlight != 0 || sig.DBPoolMax != nil {
+        t.Fatalf("signals = %+v", sig)
+    }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "strconv"
+)
+
+// DEA controlled substance schedules stored on drugs.schedule. An empty schedule means
+// the drug is not controlled. Schedule I substances cannot be prescribed at all and
+// are therefore not accepted on the catalog.
+const (
+    ScheduleII  = "CII"
+    ScheduleIII = "CIII"
+    ScheduleIV  = "CIV"
+    ScheduleV   = "CV"
+)
+
+// scheduleRule captures per-schedule prescribing limits
+type scheduleRule struct {
+    MaxQuantity int
+    MaxRefills  int
+}
+
+var scheduleRules = map[string]scheduleRule{
+    ScheduleII:  {MaxQuantity: 90, MaxRefills: 0},
+    ScheduleIII: {MaxQuantity: 180, MaxRefills: 5},
+    ScheduleIV:  {MaxQuantity: 180, MaxRefills: 5},
+    ScheduleV:   {MaxQuantity: 240, MaxRefills: 5},
+}
+
+// maxRefills applies to every prescription regardless of schedule
+const maxRefills = 11
+
+// Machine-readable codes returned with 422 denials so the UI can explain them
+const (
+    CodeCSReasonRequired   = "CONTROLLED_SUBSTANCE_REASON_REQUIRED"
+    CodeCSQuantityExceeded = "CONTROLLED_SUBSTANCE_QUANTITY_EXCEEDED"
+    CodeCSRefillsExceeded  = "CONTROLLED_SUBSTANCE_REFILLS_EXCEEDED"
+)
+
+func validSchedule(s string) bool {
+    _, ok := scheduleRules[s]
+    return s == "" || ok
+}
+
+// ruleViolation is a prescribing rule denial, answered with 422 and Code
+type ruleViolation struct {
+    Code    string
+    Message string
+}
+
+// checkSchedule enforces the rules for drug's schedule; it returns nil when allowed
+func checkSchedule(drug *Drug, quantity, refills int, reason string) *ruleViolation {
+    rule, ok := scheduleRules[drug.Schedule]
+    if !ok {
+        return nil
+    }
+    if reason == "" {
+        return &ruleViolation{CodeCSReasonRequired, "reason is required for Schedule " + drug.Schedule[1:] + " drugs"}
+    }
+    if quantity > rule.MaxQuantity {
+        return &ruleViolation{CodeCSQuantityExceeded, "quantity for Schedule " + drug.Schedule[1:] + " drugs may not exceed " + strconv.Itoa(rule.MaxQuantity)}
+    }
+    if refills > rule.MaxRefills {
+        if rule.MaxRefills == 0 {
+            return &ruleViolation{CodeCSRefillsExceeded, "Schedule II drugs may not have refills"}
+        }
+        return &ruleViolation{CodeCSRefillsExceeded, "refills for Schedule " + drug.Schedule[1:] + " drugs may not exceed " + strconv.Itoa(rule.MaxRefills)}
+    }
+    return nil
+}
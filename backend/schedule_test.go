@@ -0,0 +1,71 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestCreatePrescriptionControlledSubstance(t *testing.T) {
+    // Demo drug 5 is Oxycodone (Schedule II); drug 1 is Amoxicillin (not controlled)
+    cases := []struct {
+        name         string
+        body         string
+        expectStatus int
+        expectCode   string
+    }{
+        {name: "uncontrolled ignores schedule rules", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":500,"sig":"1 tab","refills":11}`, expectStatus: http.StatusCreated},
+        {name: "CII within limits", body: `{"patient_id":1,"physician_id":1,"drug_id":5,"quantity":30,"sig":"1 tab q6h PRN","reason":"post-operative pain"}`, expectStatus: http.StatusCreated},
+        {name: "CII missing reason", body: `{"patient_id":1,"physician_id":1,"drug_id":5,"quantity":30,"sig":"1 tab q6h PRN"}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeCSReasonRequired},
+        {name: "CII quantity cap", body: `{"patient_id":1,"physician_id":1,"drug_id":5,"quantity":120,"sig":"1 tab q6h PRN","reason":"pain"}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeCSQuantityExceeded},
+        {name: "CII no refills", body: `{"patient_id":1,"physician_id":1,"drug_id":5,"quantity":30,"sig":"1 tab q6h PRN","reason":"pain","refills":1}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeCSRefillsExceeded},
+        {name: "refills out of range", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab","refills":12}`, expectStatus: http.StatusBadRequest},
+        {name: "unknown drug", body: `{"patient_id":1,"physician_id":1,"drug_id":999,"quantity":30,"sig":"1 tab"}`, expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", "physician")
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if tc.expectCode == "" { return }
+            var body Problem
+            if err := json.NewDecoder(rr.Body).Decode(&body); err != nil { t.Fatalf("invalid json: %v", err) }
+            if body.Code != tc.expectCode { t.Fatalf("code = %q, want %q", body.Code, tc.expectCode) }
+        })
+    }
+}
+
+func TestSetDrugSchedule(t *testing.T) {
+    cases := []struct {
+        name         string
+        role         string
+        body         string
+        expectStatus int
+    }{
+        {name: "admin sets schedule", role: "admin", body: `{"schedule":"CIV"}`, expectStatus: http.StatusOK},
+        {name: "admin clears schedule", role: "admin", body: `{"schedule":""}`, expectStatus: http.StatusOK},
+        {name: "invalid schedule", role: "admin", body: `{"schedule":"CI"}`, expectStatus: http.StatusBadRequest},
+        {name: "physician forbidden", role: "physician", body: `{"schedule":"CIV"}`, expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodPatch, "/drugs/2", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// searchTypes are the entity sets GET /search covers, in response order
+var searchTypes = []string{"patient", "physician", "drug"}
+
+// searchActions is the permission that lets a caller see each type in search results
+var searchActions = map[string]Action{"patient": ActPatientRead, "physician": ActPhysicianRead, "drug": ActDrugRead}
+
+// handleSearch serves GET /search?q=&limit=5&types=patient,physician,drug, the omnibox
+// lookup. Each type is searched only when the caller may read it, at the scope they have:
+// physicians find patients on their panel, patients find themselves and their care team.
+// Types the caller may not read are left out rather than failing the request. limit
+// (1..20) applies per type; within a type, matches are ordered by relevance.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    query := r.URL.Query()
+    q := strings.TrimSpace(query.Get("q"))
+    if len(q) < 2 || len(q) > 100 { writeError(w, http.StatusBadRequest, "q must be 2..100 characters"); return }
+    limit := 5
+    if ls := query.Get("limit"); ls != "" {
+        if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 20 { limit = n } else {
+            writeError(w, http.StatusBadRequest, "limit must be 1..20"); return
+        }
+    }
+    types := query.Get("types")
+    if types == "" { types = strings.Join(searchTypes, ",") }
+    wanted := map[string]bool{}
+    for _, t := range strings.Split(types, ",") {
+        t = strings.TrimSpace(t)
+        if _, ok := searchActions[t]; !ok {
+            writeError(w, http.StatusBadRequest, "types must be a comma-separated list of patient, physician, drug")
+            return
+        }
+        wanted[t] = true
+    }
+
+    ctx := r.Context()
+    items := []SearchHit{}
+    searched := 0
+    for _, typ := range searchTypes {
+        if !wanted[typ] { continue }
+        caller, scope, err := s.scopeFor(ctx, searchActions[typ])
+        if errors.Is(err, ErrForbidden) { continue }
+        if err != nil { writeAuthError(w, err); return }
+        // Own scope narrows to the caller's panel (physicians) or to themself (patients)
+        var physicianID, patientID *int64
+        if scope == ScopeOwn {
+            switch caller.Owns {
+            case OwnsPhysician:
+                physicianID = &caller.UserID
+            case OwnsPatient:
+                patientID = &caller.UserID
+            default:
+                continue
+            }
+        }
+        var hits []SearchHit
+        switch typ {
+        case "patient":
+            hits, err = s.repo.SearchPatients(ctx, q, limit, physicianID, patientID)
+        case "physician":
+            hits, err = s.repo.SearchPhysicians(ctx, q, limit, patientID)
+        case "drug":
+            var drugs []Drug
+            drugs, err = s.repo.SearchDrugs(ctx, q, limit)
+            for _, d := range drugs { hits = append(hits, SearchHit{Type: "drug", ID: d.ID, Name: d.Name}) }
+        }
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to search "+typ+"s"); return }
+        items = append(items, hits...)
+        searched++
+    }
+    if searched == 0 { writeError(w, http.StatusForbidden, "no searchable types for this role"); return }
+    writeJSON(w, http.StatusOK, map[string]any{"q": q, "limit": limit, "items": items})
+}
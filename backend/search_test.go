@@ -0,0 +1,47 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestSearch(t *testing.T) {
+    cases := []struct {
+        name         string
+        path         string
+        role         string
+        userID       string
+        expectStatus int
+        expectHits   string
+    }{
+        {name: "admin sees every type", path: "/search?q=smi", role: "admin", userID: "1", expectStatus: http.StatusOK, expectHits: "physician:1:Dr. Smith"},
+        {name: "word prefix and fuzzy", path: "/search?q=ibuprofn", role: "admin", userID: "1", expectStatus: http.StatusOK, expectHits: "drug:2:Ibuprofen"},
+        {name: "physician limited to panel", path: "/search?q=carol", role: "physician", userID: "1", expectStatus: http.StatusOK, expectHits: ""},
+        {name: "physician panel patient", path: "/search?q=bob", role: "physician", userID: "1", expectStatus: http.StatusOK, expectHits: "patient:2:Bob"},
+        {name: "patient finds only themself", path: "/search?q=bob", role: "patient", userID: "1", expectStatus: http.StatusOK, expectHits: ""},
+        {name: "patient care team", path: "/search?q=dr&types=physician", role: "patient", userID: "1", expectStatus: http.StatusOK, expectHits: "physician:1:Dr. Smith"},
+        {name: "pharmacist gets no patients", path: "/search?q=al", role: "pharmacist", userID: "1", expectStatus: http.StatusOK, expectHits: ""},
+        {name: "types filter", path: "/search?q=dr&types=physician", role: "admin", userID: "1", expectStatus: http.StatusOK, expectHits: "physician:2:Dr. Jones,physician:1:Dr. Smith"},
+        {name: "per-type limit", path: "/search?q=dr&types=physician&limit=1", role: "admin", userID: "1", expectStatus: http.StatusOK, expectHits: "physician:2:Dr. Jones"},
+        {name: "only forbidden types", path: "/search?q=al&types=patient", role: "pharmacist", userID: "1", expectStatus: http.StatusForbidden},
+        {name: "short query", path: "/search?q=a", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "unknown type", path: "/search?q=al&types=nurse", role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "no role", path: "/search?q=al", role: "", userID: "1", expectStatus: http.StatusUnauthorized},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, http.MethodGet, tc.path, "", tc.role, tc.userID)
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+            if rr.Code != http.StatusOK { return }
+            var resp struct{ Items []SearchHit `json:"items"` }
+            if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil { t.Fatalf("invalid json: %v", err) }
+            var hits []string
+            for _, h := range resp.Items { hits = append(hits, h.Type+":"+strconv.FormatInt(h.ID, 10)+":"+h.Name) }
+            if got := strings.Join(hits, ","); got != tc.expectHits { t.Fatalf("hits = %s, want %s", got, tc.expectHits) }
+        })
+    }
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+)
+
+// seedBatchSize is how many patients, with their links and prescriptions, each seed
+// transaction inserts
+const seedBatchSize = 500
+
+// seedOptions are the flags of the seed subcommand
+type seedOptions struct {
+    Synthetic SyntheticConfig
+    OrgID     int64
+}
+
+// parseSeedArgs reads the seed subcommand's flags. The dataset is anchored at midnight
+// UTC of -anchor (default today), so runs on the same day with the same flags generate
+// the same rows.
+func parseSeedArgs(args []string, output io.Writer, now time.Time) (seedOptions, error) {
+    fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+    fs.SetOutput(output)
+    fs.Usage = func() {
+        fmt.Fprintln(output, "usage: healthcareportal seed [flags]\n\nLoads synthetic patients, physicians, links, drugs, and prescriptions into DATABASE_URL.\nRe-running with the same flags adds nothing.\n\nflags:")
+        fs.PrintDefaults()
+    }
+    patients := fs.Int("patients", 1000, "patients to generate")
+    physicians := fs.Int("physicians", 0, "physicians to generate (default patients/20+1)")
+    mean := fs.Int("prescriptions", 4, "average prescriptions per patient")
+    days := fs.Int("days", 365, "days of prescription history before the anchor")
+    seed := fs.Int64("seed", 1, "random seed; the same seed generates the same names and prescriptions")
+    org := fs.Int64("org", 1, "organization to load into")
+    anchor := fs.String("anchor", now.UTC().Format("2006-01-02"), "date (YYYY-MM-DD) the history ends on")
+    if err := fs.Parse(args); err != nil { return seedOptions{}, err }
+    if fs.NArg() > 0 { return seedOptions{}, fmt.Errorf("unexpected argument %q", fs.Arg(0)) }
+
+    var errs []error
+    if *patients <= 0 { errs = append(errs, errors.New("-patients must be positive")) }
+    if *physicians < 0 { errs = append(errs, errors.New("-physicians must not be negative")) }
+    if *physicians == 0 { *physicians = *patients/20 + 1 }
+    if *mean <= 0 { errs = append(errs, errors.New("-prescriptions must be positive")) }
+    if *days <= 0 || *days > 3650 { errs = append(errs, errors.New("-days must be 1..3650")) }
+    if *org <= 0 { errs = append(errs, errors.New("-org must be positive")) }
+    end, err := time.Parse("2006-01-02", *anchor)
+    if err != nil { errs = append(errs, fmt.Errorf("-anchor must be a YYYY-MM-DD date, got %q", *anchor)) }
+    if err := errors.Join(errs...); err != nil { return seedOptions{}, err }
+    return seedOptions{
+        Synthetic: SyntheticConfig{
+            Seed: *seed, Patients: *patients, Physicians: *physicians, MeanPrescriptions: *mean,
+            HistoryDays: *days, Now: end,
+        },
+        OrgID: *org,
+    }, nil
+}
+
+// runSeed serves `healthcareportal seed`: it generates a synthetic dataset (see
+// synthetic.go) and loads it into the configured Postgres database
+func runSeed(cfg Config, args []string, output io.Writer) error {
+    opts, err := parseSeedArgs(args, output, time.Now())
+    if errors.Is(err, flag.ErrHelp) { return nil }
+    if err != nil { return err }
+    if cfg.DatabaseURL == "" { return errors.New("DATABASE_URL is required") }
+
+    ctx := context.Background()
+    pc := cfg.poolConfig()
+    pc.ReplicaDSN = ""
+    pg, err := NewPGRepo(ctx, cfg.DatabaseURL, pc)
+    if err != nil { return err }
+    defer pg.pool.Close()
+    waitCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DBStartupWait))
+    defer cancel()
+    if err := pg.WaitReachable(waitCtx, time.Duration(cfg.DBConnectTimeout)); err != nil { return err }
+
+    start := time.Now()
+    ds := GenerateSynthetic(opts.Synthetic)
+    res, err := pg.SeedSynthetic(ctx, ds, opts.OrgID, func(done int) {
+        log.Printf("seed: %d/%d patients processed", done, len(ds.Patients))
+    })
+    log.Printf("seed: added %d patients, %d physicians, %d drugs, %d links, %d prescriptions in %s",
+        res.Patients, res.Physicians, res.Drugs, res.Links, res.Prescriptions, time.Since(start).Round(time.Millisecond))
+    return err
+}
+
+// SeedResult counts the rows a seed run inserted
+type SeedResult struct {
+    Patients, Physicians, Drugs, Links, Prescriptions int
+}
+
+// SeedSynthetic loads ds into organization orgID, committing every seedBatchSize patients
+// along with their links (consented for every scope) and prescriptions. Patients whose
+// name already exists are skipped together with their links and prescriptions, so loading
+// the same dataset again adds nothing and an interrupted run picks up where it stopped.
+// progress is called after each batch with the number of patients processed.
+func (r *PGRepo) SeedSynthetic(ctx context.Context, ds SyntheticDataset, orgID int64, progress func(done int)) (SeedResult, error) {
+    var res SeedResult
+    drugIDs, n, err := r.seedNames(ctx, `drugs`, ``, ds.Drugs, 0)
+    if err != nil { return res, fmt.Errorf("drugs: %w", err) }
+    res.Drugs = n
+    physicianIDs, n, err := r.seedNames(ctx, `physicians`, `org_id`, ds.Physicians, orgID)
+    if err != nil { return res, fmt.Errorf("physicians: %w", err) }
+    res.Physicians = n
+
+    linksOf := make([][]int, len(ds.Patients))
+    for _, l := range ds.Links { linksOf[l[1]] = append(linksOf[l[1]], l[0]) }
+    prescriptionsOf := make([][]SyntheticPrescription, len(ds.Patients))
+    for _, p := range ds.Prescriptions { prescriptionsOf[p.PatientIdx] = append(prescriptionsOf[p.PatientIdx], p) }
+
+    for lo := 0; lo < len(ds.Patients); lo += seedBatchSize {
+        hi := min(lo+seedBatchSize, len(ds.Patients))
+        err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+            rows, err := tx.Query(ctx, `
+                INSERT INTO patients (name, org_id) SELECT unnest($1::text[]), $2
+                ON CONFLICT (org_id, name) WHERE mrn IS NULL DO NOTHING
+                RETURNING id, name`, ds.Patients[lo:hi], orgID)
+            if err != nil { return err }
+            created := map[string]int64{}
+            for rows.Next() {
+                var id int64
+                var name string
+                if err := rows.Scan(&id, &name); err != nil { rows.Close(); return err }
+                created[name] = id
+            }
+            if err := rows.Err(); err != nil { return err }
+
+            var linkPhysicians, linkPatients []int64
+            var prescriptions [][]any
+            for pi := lo; pi < hi; pi++ {
+                patientID, ok := created[ds.Patients[pi]]
+                if !ok { continue }
+                for _, phi := range linksOf[pi] {
+                    linkPhysicians, linkPatients = append(linkPhysicians, physicianIDs[phi]), append(linkPatients, patientID)
+                }
+                for _, p := range prescriptionsOf[pi] {
+                    prescriptions = append(prescriptions, []any{
+                        patientID, physicianIDs[p.PhysicianIdx], drugIDs[p.DrugIdx], p.Quantity, p.Sig, p.PrescribedAt, orgID,
+                    })
+                }
+            }
+            if _, err := tx.Exec(ctx, `
+                INSERT INTO physician_patients (physician_id, patient_id) SELECT unnest($1::bigint[]), unnest($2::bigint[])
+                ON CONFLICT DO NOTHING`, linkPhysicians, linkPatients); err != nil {
+                return err
+            }
+            if _, err := tx.Exec(ctx, `
+                INSERT INTO consents (physician_id, patient_id, scope)
+                SELECT l.physician_id, l.patient_id, s.scope
+                FROM unnest($1::bigint[], $2::bigint[]) AS l(physician_id, patient_id)
+                CROSS JOIN (VALUES ('prescriptions'),('allergies'),('analytics')) AS s(scope)
+                ON CONFLICT DO NOTHING`, linkPhysicians, linkPatients); err != nil {
+                return err
+            }
+            copied, err := tx.CopyFrom(ctx, pgx.Identifier{"prescriptions"},
+                []string{"patient_id", "physician_id", "drug_id", "quantity", "sig", "prescribed_at", "org_id"},
+                pgx.CopyFromRows(prescriptions))
+            if err != nil { return err }
+            res.Patients += len(created)
+            res.Links += len(linkPatients)
+            res.Prescriptions += int(copied)
+            return nil
+        })
+        if err != nil { return res, fmt.Errorf("patients %d..%d: %w", lo, hi-1, err) }
+        if progress != nil { progress(hi) }
+    }
+    return res, nil
+}
+
+// seedNames inserts the names missing from table (with orgColumn set to orgID, unless
+// orgColumn is empty) and returns the ids of all of them, parallel to names, and how many
+// were inserted. Names are unique per organization where there is an orgColumn, so a
+// name taken in another organization is inserted anew.
+func (r *PGRepo) seedNames(ctx context.Context, table, orgColumn string, names []string, orgID int64) ([]int64, int, error) {
+    insert := `INSERT INTO ` + table + ` (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`
+    lookup := `SELECT id, name FROM ` + table + ` WHERE name = ANY($1)`
+    args := []any{names}
+    if orgColumn != "" {
+        insert = `INSERT INTO ` + table + ` (name, ` + orgColumn + `) SELECT unnest($1::text[]), $2 ON CONFLICT (` + orgColumn + `, name) DO NOTHING`
+        lookup += ` AND ` + orgColumn + ` = $2`
+        args = append(args, orgID)
+    }
+    tag, err := r.pool.Exec(ctx, insert, args...)
+    if err != nil { return nil, 0, err }
+    rows, err := r.pool.Query(ctx, lookup, args...)
+    if err != nil { return nil, 0, err }
+    defer rows.Close()
+    byName := map[string]int64{}
+    for rows.Next() {
+        var id int64
+        var name string
+        if err := rows.Scan(&id, &name); err != nil { return nil, 0, err }
+        byName[name] = id
+    }
+    if err := rows.Err(); err != nil { return nil, 0, err }
+    ids := make([]int64, len(names))
+    for i, name := range names {
+        if ids[i] = byName[name]; ids[i] == 0 { return nil, 0, fmt.Errorf("%q was not stored", name) }
+    }
+    return ids, int(tag.RowsAffected()), nil
+}
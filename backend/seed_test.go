@@ -0,0 +1,53 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "flag"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseSeedArgs(t *testing.T) {
+    now := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+    cases := []struct {
+        name      string
+        args      []string
+        expect    seedOptions
+        expectErr string
+    }{
+        {name: "defaults", expect: seedOptions{OrgID: 1, Synthetic: SyntheticConfig{
+            Seed: 1, Patients: 1000, Physicians: 51, MeanPrescriptions: 4, HistoryDays: 365, Now: time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC),
+        }}},
+        {name: "scaled", args: []string{"-patients", "100000", "-physicians", "800", "-prescriptions", "12", "-days", "730", "-seed", "42", "-org", "3", "-anchor", "2025-12-31"},
+            expect: seedOptions{OrgID: 3, Synthetic: SyntheticConfig{
+                Seed: 42, Patients: 100000, Physicians: 800, MeanPrescriptions: 12, HistoryDays: 730, Now: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+            }}},
+        {name: "every problem listed", args: []string{"-patients", "0", "-days", "4000"}, expectErr: "-patients must be positive\n-days must be 1..3650"},
+        {name: "bad anchor", args: []string{"-anchor", "yesterday"}, expectErr: "-anchor"},
+        {name: "stray argument", args: []string{"now"}, expectErr: `unexpected argument "now"`},
+        {name: "unknown flag", args: []string{"-rows", "5"}, expectErr: "flag provided but not defined"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            opts, err := parseSeedArgs(tc.args, &bytes.Buffer{}, now)
+            if tc.expectErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tc.expectErr) { t.Fatalf("err = %v, want %q", err, tc.expectErr) }
+                return
+            }
+            if err != nil { t.Fatalf("parseSeedArgs: %v", err) }
+            if opts != tc.expect { t.Fatalf("opts = %+v, want %+v", opts, tc.expect) }
+        })
+    }
+
+    // -h prints usage and isn't a failure
+    var out bytes.Buffer
+    if _, err := parseSeedArgs([]string{"-h"}, &out, now); !errors.Is(err, flag.ErrHelp) || !strings.Contains(out.String(), "-patients") {
+        t.Fatalf("err = %v, usage = %q", err, out.String())
+    }
+    if err := runSeed(defaultConfig(), []string{"-h"}, &out); err != nil { t.Fatalf("runSeed -h: %v", err) }
+    if err := runSeed(defaultConfig(), nil, &out); err == nil || !strings.Contains(err.Error(), "DATABASE_URL") {
+        t.Fatalf("runSeed without a database: %v", err)
+    }
+}
@@ -7,68 +7,151 @@ import (
     "fmt"
     "net/http"
     "strconv"
+    "strings"
     "time"
-    "os"
+    "unicode"
+
+    graphql "github.com/graph-gophers/graphql-go"
+    "github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Server struct {
     repo Repository
     mux  *http.ServeMux
     allowOrigin string
+    // rxnorm normalizes free-text drug names; nil keeps drug handling local-only
+    rxnorm DrugNormalizer
+    webhooks *webhookDispatcher
+    bulk     *bulkJobs
+    backfills *backfillJobs
+    // policy is the role→permission matrix consulted by authorize
+    policy Policy
+    // callerOrgs remembers the organization of recent callers (see withPrincipal)
+    callerOrgs *callerOrgCache
+    cfg    Config
+    // stats feeds the /scaling autoscaler signals
+    stats  *requestStats
+    // jobs is the background job runner started by main, reported by /debug/jobs; nil in tests
+    jobs   *jobRunner
+    // notifications tells patients about their prescriptions; nil without NOTIFIERS
+    notifications *notificationDispatcher
+    // signer e-signs prescriptions; nil without PRESCRIPTION_SIGNING_KEY
+    signer *prescriptionSigner
+    // blobs stores prescription attachments; nil without ATTACHMENT_STORE
+    blobs  BlobStore
+    // gql executes /graphql queries (see graphql.go)
+    gql    *graphql.Schema
 }
 
-func NewServer(repo Repository) *Server {
-    s := &Server{repo: repo, mux: http.NewServeMux()}
+func NewServer(repo Repository, cfg Config) *Server {
+    s := &Server{repo: repo, mux: http.NewServeMux(), cfg: cfg}
     // Allow CORS from configured web origin (e.g., http://localhost:5173)
-    if v := os.Getenv("WEB_ORIGIN"); v != "" {
-        s.allowOrigin = v
-    } else {
-        // Provide a sensible default for local dev if not configured
-        s.allowOrigin = "http://localhost:5173"
-    }
+    s.allowOrigin = cfg.WebOrigin
+    s.rxnorm = rxNormFromConfig(cfg)
+    s.signer = signerFromConfig(cfg)
+    s.blobs = blobStoreFromConfig(cfg)
+    s.policy = policyFromFile(cfg.RBACPolicyFile)
+    s.callerOrgs = newCallerOrgCache()
+    s.webhooks = newWebhookDispatcher(repo)
+    s.notifications = newNotificationDispatcher(repo, notifiersFromConfig(cfg))
+    if s.notifications != nil { s.webhooks.Subscribe(s.notifications.Handle) }
+    s.bulk = newBulkJobs()
+    s.backfills = newBackfillJobs()
+    s.stats = newRequestStats()
+    s.gql = newGraphQLSchema(s)
     s.routes()
     return s
 }
 
+// Shutdown stops the background work requests started (notification delivery) and waits
+// for it until ctx is done. Call it after http.Server.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+    if s.notifications == nil { return nil }
+    return s.notifications.Close(ctx)
+}
+
 func (s *Server) routes() {
-    s.mux.HandleFunc("/prescriptions", s.handlePrescriptions)
-    s.mux.HandleFunc("/analytics/top-drugs", s.handleTopDrugs)
-    s.mux.HandleFunc("/physicians/", s.handlePhysicianSubroutes)
-    s.mux.HandleFunc("/patients/", s.handlePatientSubroutes)
-    // Readiness endpoint that also checks DB connectivity when possible
-    s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodGet {
-            w.Header().Set("Allow", http.MethodGet)
-            writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-            return
-        }
-        // Default payload
-        status := map[string]any{"status": "ok", "db": "unknown"}
-        if pg, ok := s.repo.(*PGRepo); ok {
-            ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
-            defer cancel()
-            // lightweight ping
-            if err := pg.pool.Ping(ctx); err != nil {
-                status["db"] = "down"
-                writeJSON(w, http.StatusServiceUnavailable, status)
-                return
-            }
-            status["db"] = "ok"
-        }
-        writeJSON(w, http.StatusOK, status)
-    })
-    // Simple health endpoint for readiness/liveness checks
-    s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-        if r.Method != http.MethodGet {
-            w.Header().Set("Allow", http.MethodGet)
-            writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-            return
-        }
-        writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
-    })
+    v1 := s.v1Routes()
+    s.mountVersion("/v1", v1)
+    // Unprefixed paths predate versioning; they keep serving v1 but advertise deprecation
+    s.mountLegacy("/v1", v1)
+    // Probes are infrastructure, not API surface, and stay unversioned
+    s.mux.HandleFunc("/readyz", s.handleReadyz)
+    s.mux.HandleFunc("/healthz", s.handleHealthz)
+    s.mux.HandleFunc("/debug/config", s.handleDebugConfig)
+    s.mux.HandleFunc("/debug/jobs", s.handleDebugJobs)
+    s.mux.HandleFunc("/scaling", s.handleScaling)
+}
+
+// handleReadyz is a readiness endpoint that also checks DB connectivity when possible
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    h := s.dbHealth(r.Context())
+    status := map[string]any{"status": "ok", "db": h.Status}
+    if h.Pool != nil { status["pool"] = h.Pool }
+    // A down replica doesn't make the server unready, since reads fall back to the primary
+    if h.Replica != nil { status["replica"] = h.Replica }
+    if h.Status == "down" {
+        writeJSON(w, http.StatusServiceUnavailable, status)
+        return
+    }
+    writeJSON(w, http.StatusOK, status)
+}
+
+// DBHealth is the database status reported by /readyz and /admin/stats
+type DBHealth struct {
+    // Status is ok, down, or unknown (the in-memory repository)
+    Status    string           `json:"status"`
+    LatencyMS float64          `json:"latency_ms,omitempty"`
+    Pool      map[string]int32 `json:"pool,omitempty"`
+    // Replica is set when a read replica is configured
+    Replica   *ReplicaHealth   `json:"replica,omitempty"`
+}
+
+// dbHealth pings Postgres with a 2s timeout and reports the pool's connections, and the
+// replica's last check
+func (s *Server) dbHealth(ctx context.Context) DBHealth {
+    pg, ok := s.repo.(*PGRepo)
+    if !ok { return DBHealth{Status: "unknown"} }
+    ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+    defer cancel()
+    h := DBHealth{Status: "ok", Pool: poolStats(pg.pool)}
+    if pg.replica != nil {
+        rh := pg.replicaState.health()
+        rh.Pool = poolStats(pg.replica)
+        h.Replica = &rh
+    }
+    // Ping acquires a pooled connection, so an exhausted pool reports down as well
+    start := time.Now()
+    if err := pg.pool.Ping(ctx); err != nil {
+        h.Status = "down"
+        return h
+    }
+    h.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+    return h
+}
+
+func poolStats(pool *pgxpool.Pool) map[string]int32 {
+    st := pool.Stat()
+    return map[string]int32{"total": st.TotalConns(), "idle": st.IdleConns(), "acquired": st.AcquiredConns(), "max": st.MaxConns()}
+}
+
+// handleHealthz is a simple health endpoint for liveness checks
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.secureHeaders(w, r)
     // Minimal CORS
     if s.allowOrigin != "" {
         origin := r.Header.Get("Origin")
@@ -94,14 +177,23 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
             w.Header().Set("Access-Control-Allow-Origin", ao)
         }
         w.Header().Set("Vary", "Origin")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Role, X-User-ID")
-        w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Role, X-User-ID, X-Org-ID, X-Request-ID, Idempotency-Key")
+        w.Header().Set("Access-Control-Expose-Headers", "Deprecation, Sunset, Link, Idempotent-Replayed, X-Request-ID, X-Document-ID")
+        w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
     }
     if r.Method == http.MethodOptions {
         w.WriteHeader(http.StatusNoContent)
         return
     }
-    s.mux.ServeHTTP(w, r)
+    r = withRequestID(w, r)
+    if !s.limitBody(w, r) { return }
+    switch r.URL.Path {
+    case "/healthz", "/readyz", "/scaling":
+        // Probe and scraper traffic would skew the latency signals
+        s.mux.ServeHTTP(w, s.withPrincipal(r))
+    default:
+        s.stats.track(func() { s.mux.ServeHTTP(w, s.withPrincipal(r)) })
+    }
 }
 
 // splitCSV splits a comma-separated list, trimming spaces and ignoring empties.
@@ -129,7 +221,18 @@ type createPrescriptionReq struct {
     DrugID      int64  `json:"drug_id"`
     DrugName    string `json:"drug_name"`
     Quantity    int    `json:"quantity"`
+    // QuantityUnit defaults to the drug's dispense unit; DaysSupply to dosage.duration_days
+    QuantityUnit string `json:"quantity_unit"`
+    DaysSupply   int    `json:"days_supply"`
     Sig         string `json:"sig"`
+    // Dosage is optional structured dosing; sig may be omitted when it is present
+    Dosage  *Dosage `json:"dosage"`
+    Refills int     `json:"refills"`
+    Reason  string  `json:"reason"`
+    // PharmacyID optionally routes the prescription to a pharmacy for dispensing
+    PharmacyID *int64 `json:"pharmacy_id"`
+    // DiagnosisCode is an optional ICD-10-CM code for the indication
+    DiagnosisCode string `json:"diagnosis_code"`
 }
 
 func (req *createPrescriptionReq) validate() error {
@@ -143,10 +246,33 @@ func (req *createPrescriptionReq) validate() error {
         if len(req.DrugName) > 200 {
             return fmt.Errorf("drug_name too long")
         }
+        // Drug names end up in notification email subjects, where CR/LF would add headers
+        if strings.ContainsFunc(req.DrugName, unicode.IsControl) {
+            return fmt.Errorf("drug_name must not contain control characters")
+        }
     }
     if req.Quantity <= 0 { return fmt.Errorf("quantity must be > 0") }
+    if req.QuantityUnit != "" {
+        code, err := canonicalUnit(req.QuantityUnit)
+        if err != nil || !allowedDoseUnits[code] { return fmt.Errorf("quantity_unit %q is not an allowed unit", req.QuantityUnit) }
+        req.QuantityUnit = code
+    }
+    if req.DaysSupply < 0 || req.DaysSupply > maxDurationDays { return fmt.Errorf("days_supply must be 1..%d", maxDurationDays) }
+    if req.Dosage != nil {
+        if err := req.Dosage.validate(); err != nil { return err }
+        if len(req.Sig) == 0 { req.Sig = req.Dosage.sig() }
+        if req.DaysSupply == 0 { req.DaysSupply = req.Dosage.DurationDays }
+    }
     if len(req.Sig) == 0 { return fmt.Errorf("sig is required") }
     if len(req.Sig) > 500 { return fmt.Errorf("sig too long") }
+    if req.Refills < 0 || req.Refills > maxRefills { return fmt.Errorf("refills must be 0..%d", maxRefills) }
+    if len(req.Reason) > 500 { return fmt.Errorf("reason too long") }
+    if req.PharmacyID != nil && *req.PharmacyID <= 0 { return fmt.Errorf("pharmacy_id must be > 0") }
+    if req.DiagnosisCode != "" {
+        code, ok := normalizeICDCode(req.DiagnosisCode)
+        if !ok { return fmt.Errorf("diagnosis_code must be an ICD-10-CM code such as E11.9") }
+        req.DiagnosisCode = code
+    }
     return nil
 }
 
@@ -156,10 +282,6 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
     _ = json.NewEncoder(w).Encode(v)
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-    writeJSON(w, status, map[string]string{"error": msg})
-}
-
 func (s *Server) handlePrescriptions(w http.ResponseWriter, r *http.Request) {
     if r.Method == http.MethodGet {
         s.handleListPrescriptions(w, r)
@@ -170,35 +292,38 @@ func (s *Server) handlePrescriptions(w http.ResponseWriter, r *http.Request) {
         writeError(w, http.StatusMethodNotAllowed, "method not allowed")
         return
     }
-    role, err := readRole(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-    // Only physicians may create prescriptions; admins and patients are forbidden
-    if role != RolePhysician { writeError(w, http.StatusForbidden, "only physicians may create prescriptions"); return }
+    // Retried POSTs carrying the same Idempotency-Key replay the first response
+    p, err := principalOf(r.Context())
+    if err != nil { writeAuthError(w, err); return }
+    s.withIdempotency(w, r, idempotencyScope(p), s.handleCreatePrescription)
+}
 
-    // Read caller id only if needed (physician/patient flows)
-    // Caller must be the physician creating the prescription
-    callerID, err := readUserID(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
+func (s *Server) handleCreatePrescription(w http.ResponseWriter, r *http.Request) {
+    // Callers who may not prescribe may still be allowed to draft for a physician
+    action := ActPrescriptionCreate
+    if _, _, err := s.scopeFor(r.Context(), action); errors.Is(err, ErrForbidden) {
+        if _, _, err := s.scopeFor(r.Context(), ActPrescriptionDraft); err == nil { action = ActPrescriptionDraft }
+    }
+    caller, scope, ok := s.permit(w, r, action)
+    if !ok { return }
 
     var req createPrescriptionReq
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        writeError(w, http.StatusBadRequest, "invalid JSON body")
-        return
-    }
+    if !decodeJSON(w, r, &req) { return }
     if err := req.validate(); err != nil {
         writeError(w, http.StatusBadRequest, err.Error())
         return
     }
-
-    // RBAC checks
-    // Physician RBAC: must create as themselves and be linked to patient
-    if req.PhysicianID != callerID {
-        writeError(w, http.StatusForbidden, "physicians may only create as themselves")
-        return
+    status, draftedBy := PrescriptionActive, (*int64)(nil)
+    if action == ActPrescriptionCreate {
+        // Physicians may only prescribe as themselves
+        if _, ok := s.can(w, r, ActPrescriptionCreate, Resource{PhysicianID: req.PhysicianID}); !ok { return }
+    } else {
+        if !s.authorizeDraft(w, r, caller, scope, req.PhysicianID) { return }
+        status, draftedBy = PrescriptionPendingSignature, &caller.UserID
     }
-    linked, err := s.repo.IsPhysicianPatientLinked(r.Context(), callerID, req.PatientID)
-    if err != nil { writeError(w, http.StatusInternalServerError, "link check failed"); return }
-    if !linked { writeError(w, http.StatusForbidden, "physician not linked to patient"); return }
+
+    // The prescribing physician must be linked to the patient, with consent to prescribe
+    if !s.authorizePhysicianAccess(w, r, req.PhysicianID, req.PatientID, ConsentPrescriptions) { return }
 
     // Resolve drug id: use provided id, or find/create by name
     var drugID int64 = req.DrugID
@@ -209,63 +334,154 @@ func (s *Server) handlePrescriptions(w http.ResponseWriter, r *http.Request) {
         for len(name) > 0 && (name[0] == ' ' || name[0] == '\t') { name = name[1:] }
         for len(name) > 0 && (name[len(name)-1] == ' ' || name[len(name)-1] == '\t') { name = name[:len(name)-1] }
         if name == "" { writeError(w, http.StatusBadRequest, "drug_name cannot be blank"); return }
-        id, err := s.repo.FindOrCreateDrug(r.Context(), name)
+        id, err := s.resolveDrug(r.Context(), name)
         if err != nil { writeError(w, http.StatusInternalServerError, "failed to resolve drug"); return }
         drugID = id
     }
 
+    // Controlled substance rules depend on the resolved drug's schedule
+    drug, err := s.repo.GetDrug(r.Context(), drugID)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) {
+            // The drug id came from the request, so a missing drug is a bad reference
+            writeErrorCode(w, http.StatusBadRequest, CodeInvalidReference, "invalid patient_id, physician_id, or drug_id")
+            return
+        }
+        writeError(w, http.StatusInternalServerError, "failed to resolve drug")
+        return
+    }
+    if v := checkSchedule(drug, req.Quantity, req.Refills, req.Reason); v != nil {
+        writeErrorCode(w, http.StatusUnprocessableEntity, v.Code, v.Message)
+        return
+    }
+    if req.QuantityUnit == "" && drug.Rules != nil { req.QuantityUnit = drug.Rules.DispenseUnit }
+    if v := checkSupply(drug, req.Quantity, req.QuantityUnit, req.DaysSupply, req.Dosage); v != nil {
+        writeErrorCode(w, http.StatusUnprocessableEntity, v.Code, v.Message)
+        return
+    }
+    var diagnosis string
+    if req.DiagnosisCode != "" {
+        icd, err := s.repo.GetICDCode(r.Context(), req.DiagnosisCode)
+        if err != nil {
+            if errors.Is(err, ErrNotFound) {
+                writeErrorCode(w, http.StatusBadRequest, CodeInvalidReference, "unknown diagnosis_code "+req.DiagnosisCode)
+                return
+            }
+            writeError(w, http.StatusInternalServerError, "failed to look up diagnosis_code")
+            return
+        }
+        diagnosis = icd.Description
+    }
+
     p := &Prescription{
         PatientID: req.PatientID, PhysicianID: req.PhysicianID, DrugID: drugID,
-        Quantity: req.Quantity, Sig: req.Sig,
+        Quantity: req.Quantity, QuantityUnit: req.QuantityUnit, DaysSupply: req.DaysSupply, Sig: req.Sig, Dosage: req.Dosage,
+        Refills: req.Refills, Reason: req.Reason, PharmacyID: req.PharmacyID,
+        Status: status, DraftedBy: draftedBy,
+        DiagnosisCode: req.DiagnosisCode, DiagnosisDescription: diagnosis,
     }
     created, err := s.repo.CreatePrescription(r.Context(), p)
     if err != nil {
         if errors.Is(err, ErrInvalidReference) {
-            writeError(w, http.StatusBadRequest, "invalid patient_id, physician_id, or drug_id")
+            writeRepoError(w, err, "invalid patient_id, physician_id, drug_id, pharmacy_id, or diagnosis_code")
             return
         }
         writeError(w, http.StatusInternalServerError, "failed to create prescription")
         return
     }
+    // Drafts are signed and announced when the physician signs them
+    s.signPrescription(r.Context(), created)
+    if created.Status == PrescriptionActive {
+        s.webhooks.Publish(r.Context(), EventPrescriptionCreated, created)
+    }
     writeJSON(w, http.StatusCreated, created)
 }
 
 // handleListPrescriptions returns prescriptions according to RBAC
 func (s *Server) handleListPrescriptions(w http.ResponseWriter, r *http.Request) {
-    role, err := readRole(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
+    p, scope, ok := s.permit(w, r, ActPrescriptionList)
+    if !ok { return }
     limit := 50
     if ls := r.URL.Query().Get("limit"); ls != "" {
         if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 200 { limit = n } else {
             writeError(w, http.StatusBadRequest, "limit must be 1..200"); return
         }
     }
-    var filter ListPrescriptionsFilter
+    filter, ok := prescriptionFilterFor(w, r, p, scope)
+    if !ok { return }
     filter.Limit = limit
-    switch role {
-    case RolePatient:
-        id, err := readUserID(r); if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-        filter.PatientID = &id
-    case RolePhysician:
-        id, err := readUserID(r); if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-        filter.PhysicianID = &id
-    case RoleAdmin:
-        // Optional filters for admin via query params
-        if v := r.URL.Query().Get("patient_id"); v != "" {
-            if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 { filter.PatientID = &n } else { writeError(w, http.StatusBadRequest, "invalid patient_id"); return }
-        }
-        if v := r.URL.Query().Get("physician_id"); v != "" {
-            if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 { filter.PhysicianID = &n } else { writeError(w, http.StatusBadRequest, "invalid physician_id"); return }
+    // sort=<field> or <field>:asc|desc; descending by default
+    sortParam := "prescribed_at:desc"
+    if v := r.URL.Query().Get("sort"); v != "" {
+        field, dir, _ := strings.Cut(v, ":")
+        if _, known := prescriptionSortColumns[field]; !known || (dir != "" && dir != "asc" && dir != "desc") {
+            writeError(w, http.StatusBadRequest, "sort must be prescribed_at, quantity, or drug_name, optionally followed by :asc or :desc")
+            return
         }
+        if dir == "" { dir = "desc" }
+        filter.Sort, filter.Ascending = field, dir == "asc"
+        sortParam = field + ":" + dir
+    }
+    includeTotal := false
+    if v := r.URL.Query().Get("include_total"); v != "" {
+        b, err := strconv.ParseBool(v)
+        if err != nil { writeError(w, http.StatusBadRequest, "include_total must be true or false"); return }
+        includeTotal = b
     }
     items, err := s.repo.ListPrescriptions(r.Context(), filter)
     if err != nil { writeError(w, http.StatusInternalServerError, "failed to list prescriptions"); return }
-    writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit})
+    resp := map[string]any{"items": items, "limit": limit, "sort": sortParam}
+    if includeTotal {
+        total, err := s.repo.CountPrescriptions(r.Context(), filter)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to count prescriptions"); return }
+        resp["total"] = total
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// prescriptionFilterFor scopes a prescription query by the caller's grant: own-scoped
+// callers (patients, physicians, pharmacists, nurses) see only prescriptions they own,
+// physicians only for patients who consent to it (see physicianCanRead), and
+// unrestricted callers may narrow by patient_id/physician_id query params. Patients and
+// pharmacies never see unsigned drafts.
+// It writes the error response and returns false when the request is rejected.
+func prescriptionFilterFor(w http.ResponseWriter, r *http.Request, p Principal, scope Scope) (ListPrescriptionsFilter, bool) {
+    var filter ListPrescriptionsFilter
+    if scope == ScopeOwn { return ownPrescriptionFilter(p), true }
+    if v := r.URL.Query().Get("patient_id"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 { filter.PatientID = &n } else { writeError(w, http.StatusBadRequest, "invalid patient_id"); return filter, false }
+    }
+    if v := r.URL.Query().Get("physician_id"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 { filter.PhysicianID = &n } else { writeError(w, http.StatusBadRequest, "invalid physician_id"); return filter, false }
+    }
+    return filter, true
+}
+
+// ownPrescriptionFilter limits a prescription query to what an own-scoped caller owns
+func ownPrescriptionFilter(p Principal) ListPrescriptionsFilter {
+    var filter ListPrescriptionsFilter
+    id := p.UserID
+    switch p.Owns {
+    case OwnsPatient:
+        filter.PatientID, filter.ExcludePending = &id, true
+    case OwnsPhysician:
+        filter.PhysicianID, filter.ConsentScope = &id, ConsentPrescriptions
+    case OwnsPharmacy:
+        filter.PharmacyID, filter.ExcludePending = &id, true
+    case OwnsNurse:
+        filter.DraftedBy = &id
+    }
+    return filter
 }
 
 // handlePhysicianSubroutes handles endpoints under /physicians/{id}/...
 func (s *Server) handlePhysicianSubroutes(w http.ResponseWriter, r *http.Request) {
-    // Expected path: /physicians/{id}/patients
+    // Expected paths:
+    //   GET    /physicians/{id}/patients
+    //   POST   /physicians/{id}/patients
+    //   DELETE /physicians/{id}/patients/{patientID}
+    //   GET/POST /physicians/{id}/nurses, DELETE /physicians/{id}/nurses/{nurseID} (see delegation.go)
+    //   DELETE /physicians/{id}  (admin soft delete)
     // Basic parse
     // Trim prefix
     path := r.URL.Path
@@ -278,45 +494,103 @@ func (s *Server) handlePhysicianSubroutes(w http.ResponseWriter, r *http.Request
     slash := -1
     for i := 0; i < len(rest); i++ { if rest[i] == '/' { slash = i; break } }
     if slash == -1 {
-        writeError(w, http.StatusNotFound, "not found")
+        s.handleSoftDelete(w, r, ActPhysicianDelete, "physician", rest, s.repo.SoftDeletePhysician)
         return
     }
     idStr := rest[:slash]
     tail := rest[slash:]
-    // currently only /patients
-    if tail != "/patients" {
+    if tail == "/nurses" || (len(tail) > len("/nurses/") && tail[:len("/nurses/")] == "/nurses/") {
+        s.handlePhysicianNurses(w, r, idStr, tail[len("/nurses"):])
+        return
+    }
+    var patientIDStr string
+    if len(tail) > len("/patients/") && tail[:len("/patients/")] == "/patients/" {
+        patientIDStr = tail[len("/patients/"):]
+        tail = "/patients/"
+    }
+    if tail != "/patients" && tail != "/patients/" {
         writeError(w, http.StatusNotFound, "not found")
         return
     }
-    // RBAC
-    role, err := readRole(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
     id, err := strconv.ParseInt(idStr, 10, 64)
     if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid physician id in path"); return }
 
-    switch role {
-    case RolePatient:
-        writeError(w, http.StatusForbidden, "patients cannot access this resource")
-        return
-    case RolePhysician:
-        callerID, err := readUserID(r)
-        if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-        if callerID != id {
-            writeError(w, http.StatusForbidden, "physicians may only view their own patients")
-            return
-        }
-    case RoleAdmin:
-        // allowed
+    switch {
+    case tail == "/patients" && r.Method == http.MethodGet:
+        s.handleListPhysicianPatients(w, r, id)
+    case tail == "/patients" && r.Method == http.MethodPost:
+        s.handleLinkPhysicianPatient(w, r, id)
+    case tail == "/patients/" && r.Method == http.MethodDelete:
+        patientID, err := strconv.ParseInt(patientIDStr, 10, 64)
+        if err != nil || patientID <= 0 { writeError(w, http.StatusBadRequest, "invalid patient id in path"); return }
+        s.handleUnlinkPhysicianPatient(w, r, id, patientID)
+    case tail == "/patients":
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    default:
+        w.Header().Set("Allow", http.MethodDelete)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
     }
+}
+
+func (s *Server) handleListPhysicianPatients(w http.ResponseWriter, r *http.Request, id int64) {
+    if _, ok := s.can(w, r, ActPanelRead, Resource{PhysicianID: id}); !ok { return }
 
     items, err := s.repo.ListPatientsForPhysician(r.Context(), id)
     if err != nil { writeError(w, http.StatusInternalServerError, "failed to list patients"); return }
     writeJSON(w, http.StatusOK, map[string]any{"items": items})
 }
 
+type linkPatientReq struct {
+    PatientID int64 `json:"patient_id"`
+}
+
+// handleLinkPhysicianPatient links a patient to a physician's panel. Re-linking an
+// existing pair is a no-op and returns 200 instead of 201.
+func (s *Server) handleLinkPhysicianPatient(w http.ResponseWriter, r *http.Request, physicianID int64) {
+    p, ok := s.can(w, r, ActPanelWrite, Resource{PhysicianID: physicianID})
+    if !ok { return }
+    var req linkPatientReq
+    if !decodeJSON(w, r, &req) { return }
+    if req.PatientID <= 0 { writeError(w, http.StatusBadRequest, "patient_id must be > 0"); return }
+    // Only unrestricted callers (admins) may link patients who haven't consented to the physician
+    if s.policy[p.Role].Permissions[ActPanelWrite] != ScopeAll {
+        ok, err := s.hasAnyConsent(r.Context(), req.PatientID, physicianID)
+        if err != nil { writeError(w, http.StatusInternalServerError, "consent check failed"); return }
+        if !ok {
+            writeErrorCode(w, http.StatusForbidden, CodeConsentRequired, "patient has not consented to access by this physician")
+            return
+        }
+    }
+    created, err := s.repo.LinkPhysicianPatient(r.Context(), physicianID, req.PatientID)
+    if err != nil {
+        if errors.Is(err, ErrInvalidReference) {
+            writeRepoError(w, err, "invalid physician id or patient_id")
+            return
+        }
+        writeError(w, http.StatusInternalServerError, "failed to link patient")
+        return
+    }
+    status := http.StatusOK
+    if created { status = http.StatusCreated }
+    writeJSON(w, status, map[string]any{"physician_id": physicianID, "patient_id": req.PatientID, "created": created})
+}
+
+// handleUnlinkPhysicianPatient removes a link; unlinking a missing pair still returns 204.
+func (s *Server) handleUnlinkPhysicianPatient(w http.ResponseWriter, r *http.Request, physicianID, patientID int64) {
+    if _, ok := s.can(w, r, ActPanelWrite, Resource{PhysicianID: physicianID}); !ok { return }
+    if _, err := s.repo.UnlinkPhysicianPatient(r.Context(), physicianID, patientID); err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to unlink patient")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
 // handlePatientSubroutes handles endpoints under /patients/{id}/...
 func (s *Server) handlePatientSubroutes(w http.ResponseWriter, r *http.Request) {
-    // Expected path: /patients/{id}/physicians
+    // Expected paths: GET /patients/{id}, GET /patients/{id}/physicians, DELETE /patients/{id} (admin soft delete),
+    // /patients/{id}/consents[/{consentID}] (see consent.go), /patients/{id}/notification-preferences (see notify.go),
+    // GET /patients/{id}/prescriptions.pdf (see medlist.go), POST /patients/{id}/transfer (see transfer.go)
     path := r.URL.Path
     if len(path) < len("/patients/") || path[:len("/patients/")] != "/patients/" {
         writeError(w, http.StatusNotFound, "not found")
@@ -325,55 +599,59 @@ func (s *Server) handlePatientSubroutes(w http.ResponseWriter, r *http.Request)
     rest := path[len("/patients/"):]
     slash := -1
     for i := 0; i < len(rest); i++ { if rest[i] == '/' { slash = i; break } }
-    if slash == -1 { writeError(w, http.StatusNotFound, "not found"); return }
+    if slash == -1 && r.Method == http.MethodGet { s.handleGetPatient(w, r, rest); return }
+    if slash == -1 { s.handleSoftDelete(w, r, ActPatientDelete, "patient", rest, s.repo.SoftDeletePatient); return }
     idStr := rest[:slash]
     tail := rest[slash:]
-    if tail != "/physicians" { writeError(w, http.StatusNotFound, "not found"); return }
+    isConsents := tail == "/consents" || strings.HasPrefix(tail, "/consents/")
+    if tail != "/physicians" && tail != "/notification-preferences" && tail != "/prescriptions.pdf" && tail != "/transfer" && !isConsents { writeError(w, http.StatusNotFound, "not found"); return }
 
-    // RBAC: patients can only view their own physicians; admin allowed; physicians forbidden
-    role, err := readRole(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
     id, err := strconv.ParseInt(idStr, 10, 64)
     if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid patient id in path"); return }
-
-    switch role {
-    case RolePhysician:
-        writeError(w, http.StatusForbidden, "physicians cannot access this resource")
-        return
-    case RolePatient:
-        callerID, err := readUserID(r)
-        if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-        if callerID != id { writeError(w, http.StatusForbidden, "patients may only view their own physicians"); return }
-    case RoleAdmin:
-        // allowed
-    }
+    if isConsents { s.handlePatientConsents(w, r, id, tail[len("/consents"):]); return }
+    if tail == "/notification-preferences" { s.handleNotificationPreferences(w, r, id); return }
+    if tail == "/prescriptions.pdf" { s.handleMedicationListPDF(w, r, id); return }
+    if tail == "/transfer" { s.handlePatientTransfer(w, r, id); return }
+    // Patients can only view their own physicians
+    if _, ok := s.can(w, r, ActCareTeamRead, Resource{PatientID: id}); !ok { return }
 
     items, err := s.repo.ListPhysiciansForPatient(r.Context(), id)
     if err != nil { writeError(w, http.StatusInternalServerError, "failed to list physicians"); return }
     writeJSON(w, http.StatusOK, map[string]any{"items": items})
 }
 
+// handleGetPatient returns the patient detail record. Patients may view themselves and
+// physicians only linked patients who consented to prescriptions access; admins may view anyone.
+func (s *Server) handleGetPatient(w http.ResponseWriter, r *http.Request, idStr string) {
+    caller, scope, ok := s.permit(w, r, ActPatientRead)
+    if !ok { return }
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusBadRequest, "invalid patient id in path"); return }
+    if scope == ScopeOwn && !(Resource{PatientID: id}).ownedBy(caller) {
+        if caller.Owns != OwnsPhysician { writeError(w, http.StatusForbidden, "patients may only view themselves"); return }
+        if !s.authorizePhysicianAccess(w, r, caller.UserID, id, ConsentPrescriptions) { return }
+    }
+    d, err := s.repo.GetPatientDetail(r.Context(), id)
+    if err != nil {
+        if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "patient not found"); return }
+        writeError(w, http.StatusInternalServerError, "failed to fetch patient")
+        return
+    }
+    writeJSON(w, http.StatusOK, d)
+}
+
 func (s *Server) handleTopDrugs(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         w.Header().Set("Allow", http.MethodGet)
         writeError(w, http.StatusMethodNotAllowed, "method not allowed")
         return
     }
-    role, err := readRole(r)
-    if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
+    patientID, ok := s.analyticsPatientScope(w, r)
+    if !ok { return }
 
     q := r.URL.Query()
-    fromS, toS := q.Get("from"), q.Get("to")
-    if fromS == "" || toS == "" {
-        writeError(w, http.StatusBadRequest, "from and to query params are required (RFC3339 date or datetime)")
-        return
-    }
-    from, err1 := time.Parse(time.RFC3339, fromS)
-    to, err2 := time.Parse(time.RFC3339, toS)
-    if err1 != nil || err2 != nil || !to.After(from) {
-        writeError(w, http.StatusBadRequest, "invalid from/to range")
-        return
-    }
+    from, to, ok := parseAnalyticsRange(w, r)
+    if !ok { return }
     limit := 10
     if ls := q.Get("limit"); ls != "" {
         if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 100 {
@@ -384,11 +662,31 @@ func (s *Server) handleTopDrugs(w http.ResponseWriter, r *http.Request) {
         }
     }
 
-    var patientID *int64
-    if role == RolePatient {
-        id, err := readUserID(r)
-        if err != nil { writeError(w, http.StatusUnauthorized, err.Error()); return }
-        patientID = &id
+    switch q.Get("group_by") {
+    case "":
+    case "diagnosis":
+        // limit caps the diagnoses; per_diagnosis caps the drugs listed under each
+        per := 5
+        if ps := q.Get("per_diagnosis"); ps != "" {
+            if n, err := strconv.Atoi(ps); err == nil && n > 0 && n <= 20 {
+                per = n
+            } else {
+                writeError(w, http.StatusBadRequest, "per_diagnosis must be 1..20")
+                return
+            }
+        }
+        groups, err := s.repo.TopDrugsByDiagnosis(r.Context(), from, to, limit, per, patientID)
+        if err != nil {
+            writeError(w, http.StatusInternalServerError, "failed to fetch analytics")
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{
+            "from": from, "to": to, "limit": limit, "group_by": "diagnosis", "per_diagnosis": per, "items": groups,
+        })
+        return
+    default:
+        writeError(w, http.StatusBadRequest, "group_by must be diagnosis")
+        return
     }
 
     results, err := s.repo.TopDrugs(r.Context(), from, to, limit, patientID)
@@ -0,0 +1,149 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// DispensingRules describe how a drug is dispensed and dosed, so implausible quantities
+// can be refused when prescribed. Only DispenseUnit is required; each check runs when
+// the fields it needs are set.
+type DispensingRules struct {
+    // DispenseUnit is the UCUM unit quantities are counted in, e.g. {tablet} or mL
+    DispenseUnit string `json:"dispense_unit"`
+    // Strength is the amount of drug in one DispenseUnit, e.g. 500 mg per {tablet}
+    Strength     float64 `json:"strength,omitempty"`
+    StrengthUnit string  `json:"strength_unit,omitempty"`
+    // MaxDailyDose is the most that may be taken in one day
+    MaxDailyDose     float64 `json:"max_daily_dose,omitempty"`
+    MaxDailyDoseUnit string  `json:"max_daily_dose_unit,omitempty"`
+}
+
+// Machine-readable codes for quantity and dose denials (see checkSupply)
+const (
+    CodeQuantityUnitMismatch  = "QUANTITY_UNIT_MISMATCH"
+    CodeDoseUnitMismatch      = "DOSE_UNIT_MISMATCH"
+    CodeMaxDailyDoseExceeded  = "MAX_DAILY_DOSE_EXCEEDED"
+    CodeQuantityExceedsSupply = "QUANTITY_EXCEEDS_DAYS_SUPPLY"
+    CodeQuantityBelowSupply   = "QUANTITY_BELOW_DAYS_SUPPLY"
+)
+
+// supplyOverage is how far a quantity may exceed what the dosage needs for days_supply;
+// packaging (bottles, blister packs) rounds dispensed amounts up, but not by half again
+const supplyOverage = 1.5
+
+// validate checks the rules are coherent and canonicalizes their units to UCUM codes
+func (d *DispensingRules) validate() error {
+    unit := func(field string, u *string) error {
+        code, err := canonicalUnit(*u)
+        if err != nil || !allowedDoseUnits[code] { return fmt.Errorf("dispensing_rules.%s %q is not an allowed unit", field, *u) }
+        *u = code
+        return nil
+    }
+    if d.DispenseUnit == "" { return fmt.Errorf("dispensing_rules.dispense_unit is required") }
+    if err := unit("dispense_unit", &d.DispenseUnit); err != nil { return err }
+    if d.Strength != 0 || d.StrengthUnit != "" {
+        if d.Strength <= 0 || d.StrengthUnit == "" { return fmt.Errorf("dispensing_rules.strength must be > 0 and given with strength_unit") }
+        if err := unit("strength_unit", &d.StrengthUnit); err != nil { return err }
+        if _, err := convertQuantity(1, d.StrengthUnit, d.DispenseUnit); err == nil {
+            return fmt.Errorf("dispensing_rules.strength_unit must measure the drug, not the dispensed form")
+        }
+    }
+    if d.MaxDailyDose != 0 || d.MaxDailyDoseUnit != "" {
+        if d.MaxDailyDose <= 0 || d.MaxDailyDoseUnit == "" { return fmt.Errorf("dispensing_rules.max_daily_dose must be > 0 and given with max_daily_dose_unit") }
+        if err := unit("max_daily_dose_unit", &d.MaxDailyDoseUnit); err != nil { return err }
+        if _, ok := d.convert(1, d.DispenseUnit, d.MaxDailyDoseUnit); !ok {
+            return fmt.Errorf("dispensing_rules.max_daily_dose_unit must be convertible to dispense_unit or strength_unit")
+        }
+    }
+    return nil
+}
+
+// convert converts v between units, going through the strength when one unit measures
+// the dispensed form (tablets, mL) and the other the drug (mg)
+func (d *DispensingRules) convert(v float64, from, to string) (float64, bool) {
+    if n, err := convertQuantity(v, from, to); err == nil { return n, true }
+    if d.Strength <= 0 { return 0, false }
+    if n, err := convertQuantity(v, from, d.DispenseUnit); err == nil {
+        n, err = convertQuantity(n*d.Strength, d.StrengthUnit, to)
+        return n, err == nil
+    }
+    if n, err := convertQuantity(v, from, d.StrengthUnit); err == nil {
+        n, err = convertQuantity(n/d.Strength, d.DispenseUnit, to)
+        return n, err == nil
+    }
+    return 0, false
+}
+
+// formatAmount renders an amount for a message, e.g. "3333.3 mg" or "60 tablets"
+func formatAmount(v float64, unit string) string {
+    s := strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64) + " " + unitDisplay(unit)
+    if strings.HasPrefix(unit, "{") && s != "1 "+unitDisplay(unit) { s += "s" }
+    return s
+}
+
+// exceeds compares computed amounts with a little slack for floating point rounding
+func exceeds(v, limit float64) bool {
+    return v > limit*(1+1e-9)
+}
+
+// checkSupply checks a prescription's quantity against its days supply, its dosage, and
+// the drug's dispensing rules; it returns nil when allowed. unit is the quantity's UCUM
+// unit; without one, or without rules on the drug, only what the request itself relates
+// (e.g. a dosage in tablets against a quantity in tablets) is checked.
+func checkSupply(drug *Drug, quantity int, unit string, daysSupply int, dosage *Dosage) *ruleViolation {
+    rules := DispensingRules{DispenseUnit: unit}
+    if drug.Rules != nil { rules = *drug.Rules }
+    if rules.DispenseUnit == "" { return nil }
+    if unit == "" { unit = rules.DispenseUnit }
+    qty, err := convertQuantity(float64(quantity), unit, rules.DispenseUnit)
+    if err != nil {
+        return &ruleViolation{CodeQuantityUnitMismatch, drug.Name + " is dispensed in " + unitDisplay(rules.DispenseUnit) +
+            "; quantity_unit must be " + unitDisplay(rules.DispenseUnit) + " or convertible to it"}
+    }
+
+    // What a scheduled dosage takes in a day, in its own unit and in dispense units
+    var perDay, dailyQty float64
+    if dosage != nil { perDay = dosage.Amount * doseFrequencies[dosage.Frequency] }
+    if perDay > 0 {
+        var ok bool
+        if dailyQty, ok = rules.convert(perDay, dosage.Unit, rules.DispenseUnit); !ok && rules.Strength > 0 {
+            return &ruleViolation{CodeDoseUnitMismatch, "dosage.unit must be " + unitDisplay(rules.DispenseUnit) + " or " +
+                unitDisplay(rules.StrengthUnit) + ", or convertible to them, for " + drug.Name}
+        }
+        if rules.MaxDailyDose > 0 {
+            if daily, ok := rules.convert(perDay, dosage.Unit, rules.MaxDailyDoseUnit); ok && exceeds(daily, rules.MaxDailyDose) {
+                return &ruleViolation{CodeMaxDailyDoseExceeded, "dosage of " + formatAmount(dosage.Amount, dosage.Unit) + " " + dosage.Frequency +
+                    " is " + formatAmount(daily, rules.MaxDailyDoseUnit) + " a day, above the " +
+                    formatAmount(rules.MaxDailyDose, rules.MaxDailyDoseUnit) + " maximum for " + drug.Name}
+            }
+        }
+    }
+    if daysSupply <= 0 { return nil }
+
+    days := strconv.Itoa(daysSupply) + " days"
+    if rules.MaxDailyDose > 0 {
+        if avg, ok := rules.convert(qty/float64(daysSupply), rules.DispenseUnit, rules.MaxDailyDoseUnit); ok && exceeds(avg, rules.MaxDailyDose) {
+            return &ruleViolation{CodeQuantityExceedsSupply, "quantity of " + formatAmount(float64(quantity), unit) + " over " + days +
+                " averages " + formatAmount(avg, rules.MaxDailyDoseUnit) + " a day, above the " +
+                formatAmount(rules.MaxDailyDose, rules.MaxDailyDoseUnit) + " maximum for " + drug.Name +
+                "; lower quantity or raise days_supply"}
+        }
+    }
+    if dailyQty > 0 {
+        need := dailyQty * float64(daysSupply)
+        if exceeds(need, qty) {
+            return &ruleViolation{CodeQuantityBelowSupply, "quantity of " + formatAmount(float64(quantity), unit) + " does not last " +
+                days + " at " + formatAmount(dosage.Amount, dosage.Unit) + " " + dosage.Frequency + ", which needs " +
+                formatAmount(need, rules.DispenseUnit) + "; raise quantity or lower days_supply"}
+        }
+        if exceeds(qty, need*supplyOverage) {
+            return &ruleViolation{CodeQuantityExceedsSupply, "quantity of " + formatAmount(float64(quantity), unit) + " is far more than " +
+                days + " at " + formatAmount(dosage.Amount, dosage.Unit) + " " + dosage.Frequency + " needs (" +
+                formatAmount(need, rules.DispenseUnit) + "); lower quantity or raise days_supply"}
+        }
+    }
+    return nil
+}
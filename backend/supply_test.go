@@ -0,0 +1,93 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+func TestCreatePrescriptionSupply(t *testing.T) {
+    // Demo drug 2 is Ibuprofen: 200 mg tablets, at most 3200 mg a day. Drug 1,
+    // Amoxicillin, has no dispensing rules.
+    cases := []struct {
+        name         string
+        body         string
+        expectStatus int
+        expectCode   string
+        expectUnit   string
+        expectDays   int
+    }{
+        {name: "unit and days supply defaulted", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"dosage":{"amount":400,"unit":"mg","route":"oral","frequency":"TID","duration_days":10}}`, expectStatus: http.StatusCreated, expectUnit: "{tablet}", expectDays: 10},
+        {name: "unit alias stored as UCUM code", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":100,"quantity_unit":"tablet","days_supply":30,"sig":"1 tab q6h PRN pain"}`, expectStatus: http.StatusCreated, expectUnit: "{tablet}", expectDays: 30},
+        {name: "no rules or unit skips checks", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":500,"sig":"1 tab"}`, expectStatus: http.StatusCreated},
+        {name: "quantity unit mismatch", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"quantity_unit":"mL","sig":"1 tab"}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeQuantityUnitMismatch},
+        {name: "dose unit mismatch", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"dosage":{"amount":5,"unit":"mL","route":"oral","frequency":"TID"}}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeDoseUnitMismatch},
+        {name: "daily dose above maximum", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"dosage":{"amount":1200,"unit":"mg","route":"oral","frequency":"QID"}}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeMaxDailyDoseExceeded},
+        {name: "quantity averages above maximum", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":500,"days_supply":30,"sig":"PRN pain"}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeQuantityExceedsSupply},
+        {name: "quantity far above dosage needs", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":200,"days_supply":30,"dosage":{"amount":1,"unit":"tablet","route":"oral","frequency":"daily"}}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeQuantityExceedsSupply},
+        {name: "quantity short of days supply", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":10,"days_supply":30,"dosage":{"amount":1,"unit":"tablet","route":"oral","frequency":"BID"}}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeQuantityBelowSupply},
+        {name: "liquid quantity checked without drug rules", body: `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":1,"quantity_unit":"mL","dosage":{"amount":5,"unit":"mL","route":"oral","frequency":"TID","duration_days":10}}`, expectStatus: http.StatusUnprocessableEntity, expectCode: CodeQuantityBelowSupply},
+        {name: "unknown quantity unit", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"quantity_unit":"spoonful","sig":"1 tab"}`, expectStatus: http.StatusBadRequest},
+        {name: "days supply out of range", body: `{"patient_id":1,"physician_id":1,"drug_id":2,"quantity":60,"days_supply":400,"sig":"1 tab"}`, expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            rr := consentRequest(srv, http.MethodPost, "/prescriptions", tc.body, "physician", "1")
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if tc.expectCode != "" {
+                var body Problem
+                if err := json.NewDecoder(rr.Body).Decode(&body); err != nil { t.Fatalf("invalid json: %v", err) }
+                if body.Code != tc.expectCode { t.Fatalf("code = %q, want %q (%s)", body.Code, tc.expectCode, body.Detail) }
+                return
+            }
+            if rr.Code != http.StatusCreated { return }
+            var p Prescription
+            if err := json.NewDecoder(rr.Body).Decode(&p); err != nil { t.Fatalf("invalid json: %v", err) }
+            if p.QuantityUnit != tc.expectUnit || p.DaysSupply != tc.expectDays {
+                t.Fatalf("quantity_unit = %q, days_supply = %d, want %q, %d", p.QuantityUnit, p.DaysSupply, tc.expectUnit, tc.expectDays)
+            }
+        })
+    }
+}
+
+func TestSetDrugRules(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    cases := []struct {
+        name         string
+        body         string
+        expectStatus int
+    }{
+        {name: "liquid with strength", body: `{"dispensing_rules":{"dispense_unit":"ml","strength":50,"strength_unit":"mg","max_daily_dose":3000,"max_daily_dose_unit":"mg"}}`, expectStatus: http.StatusOK},
+        {name: "schedule and rules together", body: `{"schedule":"","dispensing_rules":{"dispense_unit":"mL"}}`, expectStatus: http.StatusOK},
+        {name: "dispense unit required", body: `{"dispensing_rules":{"strength":50,"strength_unit":"mg"}}`, expectStatus: http.StatusBadRequest},
+        {name: "strength in the dispensed form", body: `{"dispensing_rules":{"dispense_unit":"mL","strength":5,"strength_unit":"mL"}}`, expectStatus: http.StatusBadRequest},
+        {name: "maximum in an unrelated unit", body: `{"dispensing_rules":{"dispense_unit":"tablet","max_daily_dose":4,"max_daily_dose_unit":"mg"}}`, expectStatus: http.StatusBadRequest},
+        {name: "unknown rule field", body: `{"dispensing_rules":{"dispense_unit":"tablet","max":4}}`, expectStatus: http.StatusBadRequest},
+        {name: "nothing to change", body: `{}`, expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            rr := consentRequest(srv, http.MethodPatch, "/drugs/1", tc.body, "admin", "1")
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String()) }
+        })
+    }
+
+    // Amoxicillin suspension at 50 mg/mL: 20 mL TID is 3000 mg a day, exactly the maximum
+    consentRequest(srv, http.MethodPatch, "/drugs/1", `{"dispensing_rules":{"dispense_unit":"mL","strength":50,"strength_unit":"mg","max_daily_dose":3000,"max_daily_dose_unit":"mg"}}`, "admin", "1")
+    rr := consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":600,"dosage":{"amount":1000,"unit":"mg","route":"oral","frequency":"TID","duration_days":10}}`, "physician", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+    rr = consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":600,"dosage":{"amount":25,"unit":"mL","route":"oral","frequency":"TID","duration_days":8}}`, "physician", "1")
+    if rr.Code != http.StatusUnprocessableEntity { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+
+    // Clearing the rules turns the checks off again
+    rr = consentRequest(srv, http.MethodPatch, "/drugs/1", `{"dispensing_rules":null}`, "admin", "1")
+    var d Drug
+    if err := json.NewDecoder(rr.Body).Decode(&d); err != nil || rr.Code != http.StatusOK || d.Rules != nil {
+        t.Fatalf("status = %d, drug = %+v, err = %v", rr.Code, d, err)
+    }
+    rr = consentRequest(srv, http.MethodPost, "/prescriptions", `{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":600,"dosage":{"amount":25,"unit":"mL","route":"oral","frequency":"TID","duration_days":8}}`, "physician", "1")
+    if rr.Code != http.StatusCreated { t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String()) }
+}
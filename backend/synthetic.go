@@ -0,0 +1,184 @@
+package main
+
+import (
+    "math/rand"
+    "time"
+)
+
+// Synthetic data generation for demo and sandbox environments. Everything here is
+// drawn from fixed name lists and hand-tuned frequency tables; nothing is derived
+// from real patient data. The same seed always produces the same dataset.
+
+var syntheticFirstNames = []string{
+    "James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+    "David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+    "Thomas", "Sarah", "Charles", "Karen", "Daniel", "Lisa", "Matthew", "Nancy",
+    "Anthony", "Sandra", "Mark", "Ashley", "Steven", "Emily", "Andrew", "Donna",
+    "Priya", "Wei", "Fatima", "Carlos", "Aisha", "Hiroshi", "Olga", "Mateo",
+}
+
+var syntheticLastNames = []string{
+    "Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+    "Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+    "Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+    "Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson", "Patel", "Nguyen",
+    "Kim", "Chen", "Okafor", "Novak", "Silva", "Tanaka", "Ivanova", "Haddad",
+}
+
+// syntheticDrug is a drug with a relative prescribing weight and typical orders.
+type syntheticDrug struct {
+    Name       string
+    Weight     int
+    Sigs       []string
+    Quantities []int
+}
+
+// Weights loosely follow outpatient prescribing volume: chronic maintenance drugs
+// dominate, acute drugs show up less often.
+var syntheticDrugs = []syntheticDrug{
+    {"Lisinopril", 90, []string{"10mg daily", "20mg daily"}, []int{30, 90}},
+    {"Atorvastatin", 85, []string{"20mg at bedtime", "40mg at bedtime"}, []int{30, 90}},
+    {"Levothyroxine", 75, []string{"50mcg daily before breakfast", "100mcg daily before breakfast"}, []int{30, 90}},
+    {"Metformin", 70, []string{"500mg BID with meals", "1000mg BID with meals"}, []int{60, 180}},
+    {"Amlodipine", 60, []string{"5mg daily", "10mg daily"}, []int{30, 90}},
+    {"Metoprolol", 50, []string{"25mg BID", "50mg BID"}, []int{60, 180}},
+    {"Omeprazole", 45, []string{"20mg daily before breakfast"}, []int{30, 90}},
+    {"Losartan", 40, []string{"50mg daily"}, []int{30, 90}},
+    {"Albuterol", 35, []string{"2 puffs q4-6h PRN wheeze"}, []int{1, 2}},
+    {"Gabapentin", 30, []string{"300mg TID"}, []int{90}},
+    {"Hydrochlorothiazide", 28, []string{"25mg daily"}, []int{30, 90}},
+    {"Sertraline", 27, []string{"50mg daily"}, []int{30, 90}},
+    {"Amoxicillin", 25, []string{"500mg TID x10 days"}, []int{30}},
+    {"Ibuprofen", 20, []string{"400mg q6h PRN pain"}, []int{20, 30}},
+    {"Azithromycin", 15, []string{"500mg day 1 then 250mg daily x4 days"}, []int{6}},
+    {"Prednisone", 12, []string{"40mg daily x5 days"}, []int{10}},
+}
+
+// SyntheticConfig controls the size and shape of a generated dataset.
+type SyntheticConfig struct {
+    Seed       int64
+    Patients   int
+    Physicians int
+    // MeanPrescriptions is the average number of prescriptions per patient
+    MeanPrescriptions int
+    // HistoryDays spreads prescriptions uniformly over the days before Now
+    HistoryDays int
+    Now         time.Time
+}
+
+// SyntheticPrescription references patients, physicians, and drugs by their index in
+// the dataset so it can be loaded into any repository regardless of id allocation.
+type SyntheticPrescription struct {
+    PatientIdx   int
+    PhysicianIdx int
+    DrugIdx      int
+    Quantity     int
+    Sig          string
+    PrescribedAt time.Time
+}
+
+// SyntheticDataset is the output of GenerateSynthetic. Names are unique within a
+// dataset, matching the per-organization unique name indexes on patients and physicians.
+type SyntheticDataset struct {
+    Patients      []string
+    Physicians    []string
+    Drugs         []string
+    // Links are {physicianIdx, patientIdx}; loaded links come with consent for every scope
+    Links         [][2]int
+    Prescriptions []SyntheticPrescription
+}
+
+// SyntheticIDs are the ids a repository assigned when loading a SyntheticDataset,
+// parallel to its Patients, Physicians, and Drugs
+type SyntheticIDs struct {
+    Patients   []int64
+    Physicians []int64
+    Drugs      []int64
+}
+
+// GenerateSynthetic builds a deterministic synthetic dataset. Each patient is linked
+// to one or two physicians and only receives prescriptions from them.
+func GenerateSynthetic(cfg SyntheticConfig) SyntheticDataset {
+    if cfg.Physicians <= 0 { cfg.Physicians = 1 }
+    if cfg.MeanPrescriptions <= 0 { cfg.MeanPrescriptions = 3 }
+    if cfg.HistoryDays <= 0 { cfg.HistoryDays = 365 }
+    if cfg.Now.IsZero() { cfg.Now = time.Now().UTC() }
+    rng := rand.New(rand.NewSource(cfg.Seed))
+
+    var ds SyntheticDataset
+    for _, d := range syntheticDrugs {
+        ds.Drugs = append(ds.Drugs, d.Name)
+    }
+    seen := map[string]bool{}
+    ds.Physicians = uniqueNames(rng, cfg.Physicians, "Dr. ", seen)
+    ds.Patients = uniqueNames(rng, cfg.Patients, "", seen)
+
+    totalWeight := 0
+    for _, d := range syntheticDrugs { totalWeight += d.Weight }
+    span := time.Duration(cfg.HistoryDays) * 24 * time.Hour
+
+    for pi := range ds.Patients {
+        primary := rng.Intn(cfg.Physicians)
+        physicians := []int{primary}
+        ds.Links = append(ds.Links, [2]int{primary, pi})
+        if cfg.Physicians > 1 && rng.Intn(4) == 0 {
+            second := (primary + 1 + rng.Intn(cfg.Physicians-1)) % cfg.Physicians
+            physicians = append(physicians, second)
+            ds.Links = append(ds.Links, [2]int{second, pi})
+        }
+        // Uniform over 0..2*mean so the per-patient average matches MeanPrescriptions
+        n := rng.Intn(2*cfg.MeanPrescriptions + 1)
+        for i := 0; i < n; i++ {
+            di := weightedDrug(rng, totalWeight)
+            d := syntheticDrugs[di]
+            ds.Prescriptions = append(ds.Prescriptions, SyntheticPrescription{
+                PatientIdx:   pi,
+                PhysicianIdx: physicians[rng.Intn(len(physicians))],
+                DrugIdx:      di,
+                Quantity:     d.Quantities[rng.Intn(len(d.Quantities))],
+                Sig:          d.Sigs[rng.Intn(len(d.Sigs))],
+                PrescribedAt: cfg.Now.Add(-time.Duration(rng.Int63n(int64(span)))).Truncate(time.Second),
+            })
+        }
+    }
+    return ds
+}
+
+func weightedDrug(rng *rand.Rand, totalWeight int) int {
+    n := rng.Intn(totalWeight)
+    for i, d := range syntheticDrugs {
+        if n < d.Weight { return i }
+        n -= d.Weight
+    }
+    return len(syntheticDrugs) - 1
+}
+
+// uniqueNames draws n "First Last" names (prefixed), adding a generational suffix
+// (II, III, ...) when a combination was already used.
+func uniqueNames(rng *rand.Rand, n int, prefix string, seen map[string]bool) []string {
+    out := make([]string, 0, n)
+    for len(out) < n {
+        base := prefix + syntheticFirstNames[rng.Intn(len(syntheticFirstNames))] + " " + syntheticLastNames[rng.Intn(len(syntheticLastNames))]
+        name := base
+        for i := 2; seen[name]; i++ {
+            name = base + " " + itoaRoman(i)
+        }
+        seen[name] = true
+        out = append(out, name)
+    }
+    return out
+}
+
+// itoaRoman renders small generational suffixes (II, III, IV...) for name collisions.
+func itoaRoman(n int) string {
+    vals := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+    syms := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+    out := ""
+    for i, v := range vals {
+        for n >= v {
+            out += syms[i]
+            n -= v
+        }
+    }
+    return out
+}
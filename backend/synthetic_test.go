@@ -0,0 +1,36 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestGenerateSynthetic(t *testing.T) {
+    cfg := SyntheticConfig{Seed: 7, Patients: 500, Physicians: 10, MeanPrescriptions: 3, Now: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+    ds := GenerateSynthetic(cfg)
+    if !reflect.DeepEqual(ds, GenerateSynthetic(cfg)) {
+        t.Fatalf("same seed produced different datasets")
+    }
+    if len(ds.Patients) != 500 || len(ds.Physicians) != 10 {
+        t.Fatalf("got %d patients, %d physicians", len(ds.Patients), len(ds.Physicians))
+    }
+    seen := map[string]bool{}
+    for _, n := range append(append([]string{}, ds.Patients...), ds.Physicians...) {
+        if seen[n] { t.Fatalf("duplicate name %q", n) }
+        seen[n] = true
+    }
+    linked := map[[2]int]bool{}
+    for _, l := range ds.Links { linked[l] = true }
+    for _, p := range ds.Prescriptions {
+        if !linked[[2]int{p.PhysicianIdx, p.PatientIdx}] {
+            t.Fatalf("prescription from unlinked physician: %+v", p)
+        }
+        if p.PrescribedAt.After(cfg.Now) || p.PrescribedAt.Before(cfg.Now.AddDate(-1, 0, 0)) {
+            t.Fatalf("prescribed_at outside history window: %v", p.PrescribedAt)
+        }
+    }
+    if avg := float64(len(ds.Prescriptions)) / 500; avg < 2.5 || avg > 3.5 {
+        t.Fatalf("average prescriptions per patient = %.2f, want ~3", avg)
+    }
+}
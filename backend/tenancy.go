@@ -0,0 +1,171 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Organization is a clinic (tenant). Patients, physicians, prescriptions, pharmacies,
+// nurses, and org admins belong to exactly one; the drug catalog is shared.
+type Organization struct {
+    ID        int64     `json:"id"`
+    Name      string    `json:"name"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// defaultOrgID is the organization that rows created before multi-tenancy belong to
+const defaultOrgID int64 = 1
+
+type orgKey struct{}
+
+// withOrg scopes the repository calls made with ctx to one organization
+func withOrg(ctx context.Context, orgID int64) context.Context {
+    return context.WithValue(ctx, orgKey{}, orgID)
+}
+
+// withoutOrg lifts ctx's organization scope, for changes to the shared drug catalog that
+// reach every organization's rows
+func withoutOrg(ctx context.Context) context.Context {
+    return context.WithValue(ctx, orgKey{}, nil)
+}
+
+// orgFromContext returns the organization ctx is scoped to; ok is false for unscoped
+// callers (platform admins and background jobs), which see every tenant
+func orgFromContext(ctx context.Context) (orgID int64, ok bool) {
+    orgID, ok = ctx.Value(orgKey{}).(int64)
+    return orgID, ok
+}
+
+// orgArg is the organization as a query parameter: nil when ctx is unscoped, so
+// "($n::bigint IS NULL OR org_id = $n)" matches every tenant
+func orgArg(ctx context.Context) *int64 {
+    if id, ok := orgFromContext(ctx); ok { return &id }
+    return nil
+}
+
+// orgFilter is the SQL predicate limiting col to the organization bound as parameter $n
+// (an orgArg value)
+func orgFilter(col string, n int) string {
+    p := "$" + strconv.Itoa(n)
+    return "(" + p + "::bigint IS NULL OR " + col + " = " + p + ")"
+}
+
+// callerTable names the table whose row a caller's X-User-ID identifies, and whose
+// org_id is therefore their organization; "" when the role has none
+func callerTable(p Principal) string {
+    if p.Role == RoleOrgAdmin { return "org_admins" }
+    switch p.Owns {
+    case OwnsPatient:
+        return "patients"
+    case OwnsPhysician:
+        return "physicians"
+    case OwnsPharmacy:
+        return "pharmacies"
+    case OwnsNurse:
+        return "nurses"
+    }
+    return ""
+}
+
+// callerOrgTTL is how long withPrincipal reuses a caller's organization before reading
+// their row again. Soft deletes forget the row at once; nothing else moves rows between
+// organizations.
+const callerOrgTTL = time.Minute
+
+// callerOrgPruneAt is the cache size at which expired entries are swept on insert
+const callerOrgPruneAt = 4096
+
+// callerOrgCache remembers CallerOrg results so withPrincipal doesn't query the caller's
+// row on every request. Lookup errors, including unknown callers, are not cached.
+type callerOrgCache struct {
+    mu      sync.Mutex
+    entries map[callerRef]callerOrgEntry
+}
+
+type callerRef struct {
+    table string
+    id    int64
+}
+
+type callerOrgEntry struct {
+    org     int64
+    expires time.Time
+}
+
+func newCallerOrgCache() *callerOrgCache {
+    return &callerOrgCache{entries: map[callerRef]callerOrgEntry{}}
+}
+
+// lookup returns the organization of id's row in table, from the cache while it is fresh
+func (c *callerOrgCache) lookup(ctx context.Context, repo Repository, table string, id int64) (int64, error) {
+    ref, now := callerRef{table, id}, time.Now()
+    c.mu.Lock()
+    e, ok := c.entries[ref]
+    c.mu.Unlock()
+    if ok && now.Before(e.expires) { return e.org, nil }
+    org, err := repo.CallerOrg(ctx, table, id)
+    if err != nil { return 0, err }
+    c.mu.Lock()
+    if len(c.entries) >= callerOrgPruneAt {
+        for k, e := range c.entries {
+            if !now.Before(e.expires) { delete(c.entries, k) }
+        }
+    }
+    c.entries[ref] = callerOrgEntry{org: org, expires: now.Add(callerOrgTTL)}
+    c.mu.Unlock()
+    return org, nil
+}
+
+// forget drops id's row in table, so a deleted caller loses access immediately
+func (c *callerOrgCache) forget(table string, id int64) {
+    c.mu.Lock()
+    delete(c.entries, callerRef{table, id})
+    c.mu.Unlock()
+}
+
+// readOrgID parses X-Org-ID; 0 means the header was not sent
+func readOrgID(r *http.Request) (int64, error) {
+    s := r.Header.Get("X-Org-ID")
+    if s == "" { return 0, nil }
+    id, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || id <= 0 { return 0, errors.New("invalid X-Org-ID header") }
+    return id, nil
+}
+
+// handleOrganizations serves the tenant registry:
+//   GET  /organizations  list organizations (admin: all, unless scoped by X-Org-ID; org_admin: their own)
+//   POST /organizations  {"name":"..."} create an organization (admin)
+func (s *Server) handleOrganizations(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        if _, ok := s.can(w, r, ActOrgRead, Resource{}); !ok { return }
+        items, err := s.repo.ListOrganizations(r.Context())
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list organizations"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    case http.MethodPost:
+        if _, ok := s.can(w, r, ActOrgWrite, Resource{}); !ok { return }
+        var req struct {
+            Name string `json:"name"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        o := &Organization{Name: strings.TrimSpace(req.Name)}
+        if o.Name == "" { writeError(w, http.StatusBadRequest, "name is required"); return }
+        if len(o.Name) > 200 { writeError(w, http.StatusBadRequest, "name too long"); return }
+        created, err := s.repo.CreateOrganization(r.Context(), o)
+        if err != nil {
+            if errors.Is(err, ErrDuplicate) { writeRepoError(w, err, "organization name already exists"); return }
+            writeError(w, http.StatusInternalServerError, "failed to create organization")
+            return
+        }
+        s.audit(r, AuditOrgCreate, "organization", created.ID)
+        writeJSON(w, http.StatusCreated, created)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
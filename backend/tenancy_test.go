@@ -0,0 +1,190 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "HealthCarePortal/backend/internal/fixtures"
+)
+
+// tenantFixture is two clinics: Alice, Dr. Smith, and org admin 1 in the default
+// organization, Dana, Dr. Lee, and org admin 2 in organization 2, each patient with two
+// prescriptions
+func tenantFixture(t *testing.T) (*memoryRepo, fixtures.IDs) {
+    t.Helper()
+    f := fixtures.New()
+    f.NewPatient("Alice").WithPhysician("Dr. Smith").WithPrescriptions(2)
+    f.NewPatient("Dana").WithPhysician("Dr. Lee").WithPrescriptions(2)
+    m, ids := fixtureMemory(f)
+    north, err := m.CreateOrganization(context.Background(), &Organization{Name: "Northside"})
+    if err != nil || north.ID != 2 { t.Fatalf("create org = %+v, %v", north, err) }
+    m.rowOrg[memoryRef{"patients", ids.Patients["Dana"]}] = north.ID
+    m.rowOrg[memoryRef{"physicians", ids.Physicians["Dr. Lee"]}] = north.ID
+    m.addOrgAdmin("Default Admin", defaultOrgID)
+    m.addOrgAdmin("Northside Admin", north.ID)
+    return m, ids
+}
+
+func TestOrgScopedRequests(t *testing.T) {
+    cases := []struct {
+        name         string
+        method       string
+        path         string
+        body         string
+        role         string
+        userID       string
+        orgID        string
+        expectStatus int
+        expectItems  int
+    }{
+        {name: "admin sees every clinic", method: http.MethodGet, path: "/prescriptions", role: "admin", userID: "1", expectStatus: http.StatusOK, expectItems: 4},
+        {name: "admin scoped by header", method: http.MethodGet, path: "/prescriptions", role: "admin", userID: "1", orgID: "2", expectStatus: http.StatusOK, expectItems: 2},
+        {name: "org admin sees own clinic", method: http.MethodGet, path: "/prescriptions", role: "org_admin", userID: "1", orgID: "1", expectStatus: http.StatusOK, expectItems: 2},
+        {name: "org admin scoped without header", method: http.MethodGet, path: "/prescriptions", role: "org_admin", userID: "2", expectStatus: http.StatusOK, expectItems: 2},
+        {name: "org admin names another org", method: http.MethodGet, path: "/prescriptions", role: "org_admin", userID: "1", orgID: "2", expectStatus: http.StatusForbidden},
+        {name: "unknown org admin", method: http.MethodGet, path: "/prescriptions", role: "org_admin", userID: "9", expectStatus: http.StatusUnauthorized},
+        {name: "physician requires user id", method: http.MethodGet, path: "/prescriptions", role: "physician", expectStatus: http.StatusUnauthorized},
+        {name: "invalid org header", method: http.MethodGet, path: "/prescriptions", role: "admin", userID: "1", orgID: "abc", expectStatus: http.StatusUnauthorized},
+        {name: "org admin reads own patient", method: http.MethodGet, path: "/patients/2", role: "org_admin", userID: "2", orgID: "2", expectStatus: http.StatusOK},
+        {name: "other clinic patient is missing", method: http.MethodGet, path: "/patients/2", role: "org_admin", userID: "1", orgID: "1", expectStatus: http.StatusNotFound},
+        {name: "other clinic delete is missing", method: http.MethodDelete, path: "/patients/2", role: "org_admin", userID: "1", orgID: "1", expectStatus: http.StatusNotFound},
+        {name: "cross clinic link rejected", method: http.MethodPost, path: "/physicians/1/patients", body: `{"patient_id":2}`, role: "admin", userID: "1", expectStatus: http.StatusBadRequest},
+        {name: "physician names other clinic", method: http.MethodGet, path: "/prescriptions", role: "physician", userID: "1", orgID: "2", expectStatus: http.StatusForbidden},
+        {name: "org admin lists own org", method: http.MethodGet, path: "/organizations", role: "org_admin", userID: "2", expectStatus: http.StatusOK, expectItems: 1},
+        {name: "admin lists orgs", method: http.MethodGet, path: "/organizations", role: "admin", userID: "1", expectStatus: http.StatusOK, expectItems: 2},
+        {name: "admin creates org", method: http.MethodPost, path: "/organizations", body: `{"name":"Eastside"}`, role: "admin", userID: "1", expectStatus: http.StatusCreated},
+        {name: "duplicate org name", method: http.MethodPost, path: "/organizations", body: `{"name":"Northside"}`, role: "admin", userID: "1", expectStatus: http.StatusConflict},
+        {name: "org admin cannot create orgs", method: http.MethodPost, path: "/organizations", body: `{"name":"Eastside"}`, role: "org_admin", userID: "1", orgID: "1", expectStatus: http.StatusForbidden},
+        {name: "org admin cannot run bulk jobs", method: http.MethodGet, path: "/bulk-jobs", role: "org_admin", userID: "1", orgID: "1", expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            repo, _ := tenantFixture(t)
+            srv := NewServer(repo, defaultConfig())
+            req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", tc.userID)
+            if tc.orgID != "" { req.Header.Set("X-Org-ID", tc.orgID) }
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if tc.method != http.MethodGet || rr.Code != http.StatusOK || strings.HasPrefix(tc.path, "/patients/") { return }
+            var resp struct{ Items []json.RawMessage `json:"items"` }
+            if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil { t.Fatalf("invalid JSON: %v", err) }
+            if len(resp.Items) != tc.expectItems {
+                t.Fatalf("items = %d, want %d: %s", len(resp.Items), tc.expectItems, rr.Body.String())
+            }
+        })
+    }
+}
+
+func TestPhysicianWithoutOrgHeader(t *testing.T) {
+    // Dr. Smith holds analytics and physician search at ScopeAll, which must still stop
+    // at the default organization when no X-Org-ID is sent
+    repo, _ := tenantFixture(t)
+    srv := NewServer(repo, defaultConfig())
+    get := func(path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, path, nil)
+        req.Header.Set("X-Role", "physician")
+        req.Header.Set("X-User-ID", "1")
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        if rr.Code != http.StatusOK { t.Fatalf("%s status = %d, body=%s", path, rr.Code, rr.Body.String()) }
+        return rr
+    }
+
+    now := time.Now().UTC()
+    rr := get("/analytics/physician-volume?from=" + now.AddDate(0, 0, -30).Format(time.RFC3339) + "&to=" + now.Add(time.Hour).Format(time.RFC3339))
+    var volume struct{ Items []PhysicianVolume `json:"items"` }
+    if err := json.Unmarshal(rr.Body.Bytes(), &volume); err != nil { t.Fatalf("invalid JSON: %v", err) }
+    if len(volume.Items) != 1 || volume.Items[0].PhysicianName != "Dr. Smith" { t.Fatalf("volume = %s", rr.Body.String()) }
+
+    rr = get("/search?q=dr&types=physician")
+    if strings.Contains(rr.Body.String(), "Dr. Lee") || !strings.Contains(rr.Body.String(), "Dr. Smith") { t.Fatalf("search = %s", rr.Body.String()) }
+}
+
+func TestMemoryRepoOrgIsolation(t *testing.T) {
+    m, ids := tenantFixture(t)
+    alice, dana := ids.Patients["Alice"], ids.Patients["Dana"]
+    smith, lee := ids.Physicians["Dr. Smith"], ids.Physicians["Dr. Lee"]
+    drug := ids.Drugs[fixtures.Drugs[0].Name]
+    north := withOrg(context.Background(), 2)
+
+    // A physician can't prescribe for a patient of another clinic, even unscoped
+    if _, err := m.CreatePrescription(context.Background(), &Prescription{PatientID: dana, PhysicianID: smith, DrugID: drug, Quantity: 1, Sig: "x"}); err != ErrInvalidReference {
+        t.Fatalf("cross-org prescription err = %v, want ErrInvalidReference", err)
+    }
+    if _, err := m.CreatePrescription(north, &Prescription{PatientID: alice, PhysicianID: smith, DrugID: drug, Quantity: 1, Sig: "x"}); err != ErrInvalidReference {
+        t.Fatalf("prescription outside scope err = %v, want ErrInvalidReference", err)
+    }
+    if _, err := m.CreatePrescription(north, &Prescription{PatientID: dana, PhysicianID: lee, DrugID: drug, Quantity: 1, Sig: "x"}); err != nil {
+        t.Fatalf("in-org prescription: %v", err)
+    }
+
+    if linked, _ := m.IsPhysicianPatientLinked(north, smith, alice); linked {
+        t.Fatal("link in another organization should be hidden")
+    }
+    if _, err := m.GrantConsent(north, &Consent{PatientID: alice, PhysicianID: smith, Scope: ConsentPrescriptions}); err != ErrInvalidReference {
+        t.Fatalf("consent outside scope err = %v, want ErrInvalidReference", err)
+    }
+    if err := m.SoftDeletePatient(north, alice); err != ErrNotFound {
+        t.Fatalf("delete outside scope err = %v, want ErrNotFound", err)
+    }
+    d, err := m.GetPatientDetail(north, dana)
+    if err != nil || d.OrgID != 2 || len(d.Physicians) != 1 { t.Fatalf("detail = %+v, %v", d, err) }
+    if n, _ := m.CountPrescriptions(north, ListPrescriptionsFilter{}); n != 3 { t.Fatalf("org 2 prescriptions = %d, want 3", n) }
+    if n, _ := m.CountPrescriptions(context.Background(), ListPrescriptionsFilter{}); n != 5 { t.Fatalf("all prescriptions = %d, want 5", n) }
+    buckets, _ := m.PrescriptionsOverTime(north, time.Now().AddDate(0, 0, -1), time.Now().Add(time.Hour), "month", nil)
+    var count int64
+    for _, b := range buckets { count += b.Count }
+    if count != 3 { t.Fatalf("org 2 analytics count = %d, want 3", count) }
+
+    // Names are unique per clinic only, so one taken elsewhere is neither rejected nor revealed
+    if _, created, err := m.RegisterPatient(north, PatientRegistration{MRN: "N1", Name: "Alice"}); err != nil || !created {
+        t.Fatalf("register Alice in org 2 = %v, %v", created, err)
+    }
+}
+
+// countingOrgRepo counts the caller lookups withPrincipal makes
+type countingOrgRepo struct {
+    *memoryRepo
+    lookups int
+}
+
+func (c *countingOrgRepo) CallerOrg(ctx context.Context, table string, id int64) (int64, error) {
+    c.lookups++
+    return c.memoryRepo.CallerOrg(ctx, table, id)
+}
+
+func TestCallerOrgCached(t *testing.T) {
+    m, ids := tenantFixture(t)
+    repo := &countingOrgRepo{memoryRepo: m}
+    srv := NewServer(repo, defaultConfig())
+    lee := ids.Physicians["Dr. Lee"]
+    do := func(method, path, role string, userID int64) int {
+        req := httptest.NewRequest(method, path, nil)
+        req.Header.Set("X-Role", role)
+        req.Header.Set("X-User-ID", strconv.FormatInt(userID, 10))
+        rr := httptest.NewRecorder()
+        srv.ServeHTTP(rr, req)
+        return rr.Code
+    }
+    path := "/physicians/" + strconv.FormatInt(lee, 10) + "/patients"
+    for i := 0; i < 3; i++ {
+        if code := do(http.MethodGet, path, "physician", lee); code != http.StatusOK { t.Fatalf("panel status = %d", code) }
+    }
+    if repo.lookups != 1 { t.Fatalf("CallerOrg lookups = %d, want 1", repo.lookups) }
+
+    // A deleted physician is not served from the cache
+    if code := do(http.MethodDelete, "/physicians/"+strconv.FormatInt(lee, 10), "org_admin", 2); code != http.StatusNoContent { t.Fatalf("delete status = %d", code) }
+    if code := do(http.MethodGet, path, "physician", lee); code != http.StatusUnauthorized { t.Fatalf("deleted physician status = %d, want 401", code) }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+    "crypto/tls"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "regexp"
+    "strconv"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/acme"
+    "golang.org/x/crypto/acme/autocert"
+)
+
+// autocertDomainPattern is a DNS host name, as Let's Encrypt issues certificates for:
+// no scheme, port, or wildcard
+var autocertDomainPattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}$`)
+
+// tlsCipherSuites are the TLS 1.2 suites offered: ECDHE key exchange with AEAD ciphers
+// only. TLS 1.3 suites aren't configurable and are all modern. HTTP/2 requires the
+// AES-128-GCM ones.
+var tlsCipherSuites = []uint16{
+    tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+    tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+    tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+    tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+    tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// tlsEnabled reports whether the server listens with TLS
+func (c Config) tlsEnabled() bool {
+    return c.TLSCertFile != "" || len(splitList(c.TLSAutocertDomains)) > 0
+}
+
+// tlsFromConfig returns the TLS configuration to serve with, or nil for plain HTTP.
+// challenge wraps the plain-HTTP redirect handler so it also answers ACME HTTP-01
+// challenges; it is nil outside autocert mode.
+func tlsFromConfig(c Config) (cfg *tls.Config, challenge func(http.Handler) http.Handler, err error) {
+    if !c.tlsEnabled() { return nil, nil, nil }
+    cfg = &tls.Config{
+        MinVersion:       tls.VersionTLS12,
+        CipherSuites:     tlsCipherSuites,
+        CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+        NextProtos:       []string{"h2", "http/1.1"},
+    }
+    if c.TLSCertFile != "" {
+        kp, err := newKeypairReloader(c.TLSCertFile, c.TLSKeyFile)
+        if err != nil { return nil, nil, err }
+        cfg.GetCertificate = kp.GetCertificate
+        return cfg, nil, nil
+    }
+    m := &autocert.Manager{
+        Prompt:     autocert.AcceptTOS,
+        HostPolicy: autocert.HostWhitelist(splitList(c.TLSAutocertDomains)...),
+        Cache:      autocert.DirCache(c.TLSAutocertCacheDir),
+        Email:      c.TLSAutocertEmail,
+    }
+    cfg.GetCertificate = m.GetCertificate
+    // TLS-ALPN-01 challenges arrive on the TLS listener itself
+    cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
+    return cfg, m.HTTPHandler, nil
+}
+
+// keypairReloader serves a certificate from files, reloading them when the certificate
+// file changes so a renewal (e.g., by certbot) takes effect without a restart
+type keypairReloader struct {
+    certFile, keyFile string
+
+    mu      sync.Mutex
+    cert    *tls.Certificate
+    modTime time.Time
+}
+
+func newKeypairReloader(certFile, keyFile string) (*keypairReloader, error) {
+    kp := &keypairReloader{certFile: certFile, keyFile: keyFile}
+    if err := kp.reload(); err != nil { return nil, err }
+    return kp, nil
+}
+
+// reload loads the key pair when the certificate file is newer than the one loaded.
+// Callers hold mu, except the constructor.
+func (kp *keypairReloader) reload() error {
+    fi, err := os.Stat(kp.certFile)
+    if err != nil { return fmt.Errorf("tls_cert_file: %w", err) }
+    if kp.cert != nil && fi.ModTime().Equal(kp.modTime) { return nil }
+    cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+    if err != nil { return fmt.Errorf("loading tls_cert_file and tls_key_file: %w", err) }
+    kp.cert, kp.modTime = &cert, fi.ModTime()
+    return nil
+}
+
+// GetCertificate keeps serving the last good certificate when a reload fails, since the
+// files may be caught mid-renewal
+func (kp *keypairReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    kp.mu.Lock()
+    defer kp.mu.Unlock()
+    if err := kp.reload(); err != nil { log.Printf("tls: %v; serving the previous certificate", err) }
+    return kp.cert, nil
+}
+
+// redirectServer serves TLSRedirectAddr: GET and HEAD are redirected to the same URL
+// over HTTPS, anything else is refused, since its body already crossed the network in
+// plaintext and a client that sent it should be fixed rather than silently forwarded.
+func redirectServer(c Config, challenge func(http.Handler) http.Handler) *http.Server {
+    _, port, _ := net.SplitHostPort(c.Addr)
+    var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            writeError(w, http.StatusBadRequest, "this API is only served over HTTPS")
+            return
+        }
+        host := r.Host
+        if h, _, err := net.SplitHostPort(host); err == nil { host = h }
+        if port != "" && port != "443" { host = net.JoinHostPort(host, port) }
+        http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+    })
+    if challenge != nil { h = challenge(h) }
+    return &http.Server{
+        Addr:              c.TLSRedirectAddr,
+        Handler:           h,
+        ReadHeaderTimeout: time.Duration(c.HTTPReadHeaderTimeout),
+        // Nothing here reads a body or writes more than a redirect
+        ReadTimeout:       30 * time.Second,
+        WriteTimeout:      30 * time.Second,
+        IdleTimeout:       time.Duration(c.HTTPIdleTimeout),
+    }
+}
+
+// secureHeaders sets the headers every response carries: no MIME sniffing, no framing,
+// and no Referer leaking record ids in URLs. Strict-Transport-Security is only sent over
+// TLS, where browsers honor it.
+func (s *Server) secureHeaders(w http.ResponseWriter, r *http.Request) {
+    h := w.Header()
+    h.Set("X-Content-Type-Options", "nosniff")
+    h.Set("X-Frame-Options", "DENY")
+    h.Set("Content-Security-Policy", "frame-ancestors 'none'")
+    h.Set("Referrer-Policy", "no-referrer")
+    if r.TLS != nil && s.cfg.HSTSMaxAge > 0 {
+        h.Set("Strict-Transport-Security", "max-age="+strconv.FormatInt(int64(time.Duration(s.cfg.HSTSMaxAge)/time.Second), 10))
+    }
+}
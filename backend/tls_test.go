@@ -0,0 +1,139 @@
+package main
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// writeTestKeypair writes a self-signed certificate for 127.0.0.1 with the given
+// common name, and its key, as PEM files
+func writeTestKeypair(t *testing.T, certFile, keyFile, cn string) {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil { t.Fatal(err) }
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(time.Now().UnixNano()),
+        Subject:      pkix.Name{CommonName: cn},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil { t.Fatal(err) }
+    keyDER, err := x509.MarshalECPrivateKey(key)
+    if err != nil { t.Fatal(err) }
+    if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil { t.Fatal(err) }
+    if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil { t.Fatal(err) }
+}
+
+func TestServeTLS(t *testing.T) {
+    dir := t.TempDir()
+    cfg := defaultConfig()
+    cfg.DemoMode = true
+    cfg.TLSCertFile, cfg.TLSKeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+    writeTestKeypair(t, cfg.TLSCertFile, cfg.TLSKeyFile, "first")
+
+    tlsCfg, challenge, err := tlsFromConfig(cfg)
+    if err != nil { t.Fatalf("tlsFromConfig: %v", err) }
+    if challenge != nil { t.Fatalf("challenge handler outside autocert mode") }
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Fatal(err) }
+    server := &http.Server{Handler: NewServer(newDemoMemoryRepo(), cfg), TLSConfig: tlsCfg}
+    go server.ServeTLS(ln, "", "")
+    defer server.Close()
+
+    get := func() *http.Response {
+        t.Helper()
+        // A fresh transport per request, so each one handshakes
+        client := &http.Client{Transport: &http.Transport{
+            TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+            ForceAttemptHTTP2: true,
+        }}
+        req, _ := http.NewRequest(http.MethodGet, "https://"+ln.Addr().String()+"/v1/drugs", nil)
+        req.Header.Set("X-Role", "physician")
+        req.Header.Set("X-User-ID", "1")
+        resp, err := client.Do(req)
+        if err != nil { t.Fatalf("request: %v", err) }
+        resp.Body.Close()
+        return resp
+    }
+
+    resp := get()
+    if resp.StatusCode != http.StatusOK { t.Fatalf("status = %d", resp.StatusCode) }
+    if resp.ProtoMajor != 2 { t.Fatalf("proto = %s, want HTTP/2", resp.Proto) }
+    if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=31536000" { t.Fatalf("hsts = %q", got) }
+    if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != "first" { t.Fatalf("cert = %s", cn) }
+
+    // A renewed certificate is picked up without a restart
+    writeTestKeypair(t, cfg.TLSCertFile, cfg.TLSKeyFile, "renewed")
+    later := time.Now().Add(time.Minute)
+    if err := os.Chtimes(cfg.TLSCertFile, later, later); err != nil { t.Fatal(err) }
+    if cn := get().TLS.PeerCertificates[0].Subject.CommonName; cn != "renewed" { t.Fatalf("cert after renewal = %s", cn) }
+
+    // A broken renewal keeps the last good certificate
+    if err := os.WriteFile(cfg.TLSCertFile, []byte("not a certificate"), 0o600); err != nil { t.Fatal(err) }
+    later = later.Add(time.Minute)
+    if err := os.Chtimes(cfg.TLSCertFile, later, later); err != nil { t.Fatal(err) }
+    if cn := get().TLS.PeerCertificates[0].Subject.CommonName; cn != "renewed" { t.Fatalf("cert after failed renewal = %s", cn) }
+}
+
+func TestSecureHeaders(t *testing.T) {
+    srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+    rr := consentRequest(srv, http.MethodGet, "/drugs", "", "physician", "1")
+    for name, want := range map[string]string{
+        "X-Content-Type-Options":  "nosniff",
+        "X-Frame-Options":         "DENY",
+        "Referrer-Policy":         "no-referrer",
+        // Plain HTTP: browsers ignore HSTS there, so it isn't sent
+        "Strict-Transport-Security": "",
+    } {
+        if got := rr.Header().Get(name); got != want { t.Errorf("%s = %q, want %q", name, got, want) }
+    }
+
+    // Errors carry them too
+    rr = consentRequest(srv, http.MethodGet, "/patients/999", "", "admin", "1")
+    if rr.Code != http.StatusNotFound || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+        t.Fatalf("status = %d, headers = %v", rr.Code, rr.Header())
+    }
+}
+
+func TestRedirectServer(t *testing.T) {
+    cfg := defaultConfig()
+    cfg.Addr, cfg.TLSRedirectAddr = ":8443", ":8080"
+    cases := []struct {
+        name           string
+        method         string
+        addr           string
+        expectStatus   int
+        expectLocation string
+    }{
+        {name: "get keeps the https port", method: http.MethodGet, addr: ":8443", expectStatus: http.StatusMovedPermanently, expectLocation: "https://clinic.example:8443/v1/drugs?q=amox"},
+        {name: "default port is omitted", method: http.MethodHead, addr: ":443", expectStatus: http.StatusMovedPermanently, expectLocation: "https://clinic.example/v1/drugs?q=amox"},
+        {name: "post is refused", method: http.MethodPost, addr: ":443", expectStatus: http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            cfg.Addr = tc.addr
+            h := redirectServer(cfg, nil).Handler
+            rr := httptest.NewRecorder()
+            h.ServeHTTP(rr, httptest.NewRequest(tc.method, "http://clinic.example:8080/v1/drugs?q=amox", nil))
+            if rr.Code != tc.expectStatus { t.Fatalf("status = %d, want %d", rr.Code, tc.expectStatus) }
+            if got := rr.Header().Get("Location"); got != tc.expectLocation { t.Fatalf("location = %q, want %q", got, tc.expectLocation) }
+        })
+    }
+}
@@ -12,6 +12,8 @@ import (
 
 // fakeRepo implements Repository for tests
 type fakeRepo struct {
+    // Repository is left nil; methods these tests don't exercise are not stubbed
+    Repository
     // configurable outputs
     top []TopDrug
     // capture inputs
@@ -41,6 +43,9 @@ func (f *fakeRepo) FindOrCreateDrug(ctx context.Context, name string) (int64, er
 func (f *fakeRepo) ListPhysiciansForPatient(ctx context.Context, patientID int64) ([]Physician, error) {
     return []Physician{}, nil
 }
+func (f *fakeRepo) CallerOrg(ctx context.Context, table string, id int64) (int64, error) {
+    return defaultOrgID, nil
+}
 
 func TestHandleTopDrugs(t *testing.T) {
     now := time.Now().UTC()
@@ -64,7 +69,7 @@ func TestHandleTopDrugs(t *testing.T) {
     for _, tc := range cases {
         t.Run(tc.name, func(t *testing.T) {
             fr := &fakeRepo{top: []TopDrug{{DrugID: 1, DrugName: "Ibuprofen", TotalQty: 30}}}
-            srv := NewServer(fr)
+            srv := NewServer(fr, defaultConfig())
 
             req := httptest.NewRequest(http.MethodGet, "/analytics/top-drugs?from="+from+"&to="+to+func() string { if tc.limitParam != "" { return "&limit="+tc.limitParam }; return "" }() , nil)
             req.Header.Set("X-Role", tc.role)
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+)
+
+// errTransferNotLinked aborts a transfer whose patient isn't on the from physician's panel
+var errTransferNotLinked = errors.New("patient not linked to from physician")
+
+type patientTransferReq struct {
+    FromPhysicianID int64 `json:"from_physician_id"`
+    ToPhysicianID   int64 `json:"to_physician_id"`
+    // RequireReauthorization moves the patient's active prescriptions from the old physician
+    // to the new one, who must sign each before it can be dispensed again
+    RequireReauthorization bool `json:"require_reauthorization"`
+}
+
+// PatientTransfer is the result of POST /patients/{id}/transfer
+type PatientTransfer struct {
+    PatientID       int64 `json:"patient_id"`
+    FromPhysicianID int64 `json:"from_physician_id"`
+    ToPhysicianID   int64 `json:"to_physician_id"`
+    // PendingReauthorization lists the prescriptions moved to the new physician
+    PendingReauthorization []int64 `json:"pending_reauthorization"`
+}
+
+// handlePatientTransfer serves POST /patients/{id}/transfer: the patient leaves the from
+// physician's panel for the to physician's. The links, the optional move of prescriptions,
+// and the audit entries commit together or not at all.
+func (s *Server) handlePatientTransfer(w http.ResponseWriter, r *http.Request, patientID int64) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+        return
+    }
+    var req patientTransferReq
+    if !decodeJSON(w, r, &req) { return }
+    if req.FromPhysicianID <= 0 || req.ToPhysicianID <= 0 { writeError(w, http.StatusBadRequest, "from_physician_id and to_physician_id must be > 0"); return }
+    if req.FromPhysicianID == req.ToPhysicianID { writeError(w, http.StatusBadRequest, "from_physician_id and to_physician_id must differ"); return }
+    caller, ok := s.can(w, r, ActPatientTransfer, Resource{PhysicianID: req.FromPhysicianID})
+    if !ok { return }
+    // The new physician gets a link, so the same consent rule as linking applies
+    if s.policy[caller.Role].Permissions[ActPatientTransfer] != ScopeAll {
+        ok, err := s.hasAnyConsent(r.Context(), patientID, req.ToPhysicianID)
+        if err != nil { writeError(w, http.StatusInternalServerError, "consent check failed"); return }
+        if !ok {
+            writeErrorCode(w, http.StatusForbidden, CodeConsentRequired, "patient has not consented to access by to_physician_id")
+            return
+        }
+    }
+
+    out := PatientTransfer{PatientID: patientID, FromPhysicianID: req.FromPhysicianID, ToPhysicianID: req.ToPhysicianID, PendingReauthorization: []int64{}}
+    detail := "from physician " + strconv.FormatInt(req.FromPhysicianID, 10) + " to physician " + strconv.FormatInt(req.ToPhysicianID, 10)
+    err := s.repo.InTx(r.Context(), func(ctx context.Context) error {
+        // Unlinking first locks the link, so concurrent transfers of one patient can't both pass
+        removed, err := s.repo.UnlinkPhysicianPatient(ctx, req.FromPhysicianID, patientID)
+        if err != nil { return err }
+        if !removed { return errTransferNotLinked }
+        if _, err := s.repo.LinkPhysicianPatient(ctx, req.ToPhysicianID, patientID); err != nil { return err }
+        if req.RequireReauthorization {
+            entry := AuditEntry{Actor: auditActor(r), Action: AuditTransfer, Detail: detail}
+            moved, err := s.repo.ReassignPrescriptions(ctx, patientID, req.FromPhysicianID, req.ToPhysicianID, entry)
+            if err != nil { return err }
+            if moved != nil { out.PendingReauthorization = moved }
+        }
+        return s.repo.RecordAudit(ctx, AuditEntry{Actor: auditActor(r), Action: AuditTransfer, Entity: "patient", EntityID: patientID, Detail: detail})
+    })
+    if err != nil {
+        switch {
+        case errors.Is(err, errTransferNotLinked):
+            writeErrorCode(w, http.StatusConflict, CodePhysicianNotLinked, "patient is not linked to from_physician_id")
+        case errors.Is(err, ErrInvalidReference):
+            writeRepoError(w, err, "invalid to_physician_id")
+        default:
+            writeError(w, http.StatusInternalServerError, "failed to transfer patient")
+        }
+        return
+    }
+    writeJSON(w, http.StatusOK, out)
+}
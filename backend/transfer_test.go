@@ -0,0 +1,100 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestPatientTransfer(t *testing.T) {
+    // Demo data: Alice (patient 1) is on Dr. Smith's (physician 1) panel with two active prescriptions
+    repo := newDemoMemoryRepo()
+    srv := NewServer(repo, defaultConfig())
+    rr := consentRequest(srv, http.MethodPost, "/v1/patients/1/transfer", `{"from_physician_id":1,"to_physician_id":2,"require_reauthorization":true}`, "admin", "1")
+    if rr.Code != http.StatusOK { t.Fatalf("transfer status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var out PatientTransfer
+    _ = json.NewDecoder(rr.Body).Decode(&out)
+    if len(out.PendingReauthorization) != 2 || out.PendingReauthorization[0] != 1 || out.PendingReauthorization[1] != 2 {
+        t.Fatalf("transfer = %+v", out)
+    }
+
+    ctx := context.Background()
+    if linked, _ := repo.IsPhysicianPatientLinked(ctx, 1, 1); linked { t.Fatal("Alice still on Dr. Smith's panel") }
+    if linked, _ := repo.IsPhysicianPatientLinked(ctx, 2, 1); !linked { t.Fatal("Alice not on Dr. Jones's panel") }
+    for _, id := range out.PendingReauthorization {
+        p := repo.prescriptions[id]
+        if p.PhysicianID != 2 || p.Status != PrescriptionPendingReauthorization { t.Fatalf("prescription %d = %+v", id, p) }
+    }
+    // One entry per moved prescription, then the patient's
+    if len(repo.audit) != 3 || repo.audit[2].Action != AuditTransfer || repo.audit[2].Entity != "patient" || repo.audit[2].Detail != "from physician 1 to physician 2" {
+        t.Fatalf("audit = %+v", repo.audit)
+    }
+
+    // Moved prescriptions can't be dispensed until the new physician signs them
+    if rr := consentRequest(srv, http.MethodPost, "/v1/prescriptions/1/sign", "", "physician", "1"); rr.Code != http.StatusNotFound {
+        t.Fatalf("old physician sign status = %d", rr.Code)
+    }
+    // Re-authorizing is prescribing, so the new physician needs the patient's consent first
+    rr = consentRequest(srv, http.MethodPost, "/v1/prescriptions/1/sign", "", "physician", "2")
+    if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"code":"`+CodeConsentRequired+`"`) {
+        t.Fatalf("sign without consent status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    if rr := consentRequest(srv, http.MethodPost, "/v1/patients/1/consents", `{"physician_id":2,"scope":"prescriptions"}`, "patient", "1"); rr.Code != http.StatusCreated {
+        t.Fatalf("consent status = %d, body=%s", rr.Code, rr.Body.String())
+    }
+    rr = consentRequest(srv, http.MethodPost, "/v1/prescriptions/1/sign", "", "physician", "2")
+    if rr.Code != http.StatusOK { t.Fatalf("sign status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var signed Prescription
+    _ = json.NewDecoder(rr.Body).Decode(&signed)
+    if signed.Status != PrescriptionActive || signed.PhysicianID != 2 { t.Fatalf("signed = %+v", signed) }
+
+    // The patient is no longer Dr. Smith's to transfer
+    rr = consentRequest(srv, http.MethodPost, "/v1/patients/1/transfer", `{"from_physician_id":1,"to_physician_id":2}`, "admin", "1")
+    if rr.Code != http.StatusConflict { t.Fatalf("repeat transfer status = %d, body=%s", rr.Code, rr.Body.String()) }
+    var body Problem
+    if err := json.NewDecoder(rr.Body).Decode(&body); err != nil { t.Fatalf("invalid json: %v", err) }
+    if body.Code != CodePhysicianNotLinked { t.Fatalf("code = %q, want %q", body.Code, CodePhysicianNotLinked) }
+}
+
+func TestPatientTransferRejected(t *testing.T) {
+    cases := []struct {
+        name         string
+        body         string
+        role, userID string
+        expectStatus int
+        expectCode   string
+    }{
+        {name: "same physician", body: `{"from_physician_id":1,"to_physician_id":1}`, role: "admin", userID: "1", expectStatus: http.StatusBadRequest, expectCode: CodeBadRequest},
+        {name: "missing physician", body: `{"from_physician_id":1}`, role: "admin", userID: "1", expectStatus: http.StatusBadRequest, expectCode: CodeBadRequest},
+        {name: "unknown new physician", body: `{"from_physician_id":1,"to_physician_id":99,"require_reauthorization":true}`, role: "admin", userID: "1", expectStatus: http.StatusBadRequest, expectCode: CodeInvalidReference},
+        {name: "patient", body: `{"from_physician_id":1,"to_physician_id":2}`, role: "patient", userID: "1", expectStatus: http.StatusForbidden, expectCode: CodeForbidden},
+        {name: "another physician's patient", body: `{"from_physician_id":1,"to_physician_id":2}`, role: "physician", userID: "2", expectStatus: http.StatusForbidden, expectCode: CodeForbidden},
+        {name: "own patient without consent", body: `{"from_physician_id":1,"to_physician_id":2}`, role: "physician", userID: "1", expectStatus: http.StatusForbidden, expectCode: CodeConsentRequired},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            repo := newDemoMemoryRepo()
+            srv := NewServer(repo, defaultConfig())
+            rr := consentRequest(srv, http.MethodPost, "/v1/patients/1/transfer", tc.body, tc.role, tc.userID)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            var body Problem
+            if err := json.NewDecoder(rr.Body).Decode(&body); err != nil { t.Fatalf("invalid json: %v", err) }
+            if body.Code != tc.expectCode { t.Fatalf("code = %q, want %q", body.Code, tc.expectCode) }
+            // A rejected transfer changes nothing, even when it failed halfway
+            if linked, _ := repo.IsPhysicianPatientLinked(context.Background(), 1, 1); !linked { t.Fatal("Alice was unlinked") }
+            if repo.prescriptions[1].Status != PrescriptionActive || len(repo.audit) != 0 { t.Fatalf("prescription = %+v, audit = %+v", repo.prescriptions[1], repo.audit) }
+        })
+    }
+
+    // Physicians hand over their own patients once the patient consented to the new physician
+    repo := newDemoMemoryRepo()
+    if _, err := repo.GrantConsent(context.Background(), &Consent{PatientID: 1, PhysicianID: 2, Scope: ConsentPrescriptions}); err != nil { t.Fatal(err) }
+    srv := NewServer(repo, defaultConfig())
+    rr := consentRequest(srv, http.MethodPost, "/v1/patients/1/transfer", `{"from_physician_id":1,"to_physician_id":2}`, "physician", "1")
+    if rr.Code != http.StatusOK { t.Fatalf("own transfer status = %d, body=%s", rr.Code, rr.Body.String()) }
+    if rr := consentRequest(srv, http.MethodGet, "/v1/patients/1/transfer", "", "admin", "1"); rr.Code != http.StatusMethodNotAllowed { t.Fatalf("GET status = %d", rr.Code) }
+}
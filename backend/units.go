@@ -0,0 +1,86 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Units of measure follow UCUM (https://ucum.org) case-sensitive codes. Values are
+// stored with the canonical code so "mcg" and "ug" can never be compared as different
+// units, and conversions refuse to cross dimensions (mass vs volume, tablets vs mg).
+
+// ErrUnitMismatch means a conversion was attempted between incompatible dimensions
+var ErrUnitMismatch = errors.New("incompatible units")
+
+type ucumUnit struct {
+    Code    string
+    Display string
+    // Dimension groups convertible units; count-like units are each their own dimension
+    Dimension string
+    // Value in base unit = value*Factor + Offset (offset only for temperatures)
+    Factor float64
+    Offset float64
+}
+
+var ucumUnits = map[string]ucumUnit{
+    // mass, base g
+    "ug": {Code: "ug", Display: "mcg", Dimension: "mass", Factor: 1e-6},
+    "mg": {Code: "mg", Display: "mg", Dimension: "mass", Factor: 1e-3},
+    "g":  {Code: "g", Display: "g", Dimension: "mass", Factor: 1},
+    "kg": {Code: "kg", Display: "kg", Dimension: "mass", Factor: 1e3},
+    "[lb_av]": {Code: "[lb_av]", Display: "lb", Dimension: "mass", Factor: 453.59237},
+    // volume, base L
+    "mL": {Code: "mL", Display: "mL", Dimension: "volume", Factor: 1e-3},
+    "L":  {Code: "L", Display: "L", Dimension: "volume", Factor: 1},
+    // temperature, base Cel
+    "Cel":    {Code: "Cel", Display: "°C", Dimension: "temperature", Factor: 1},
+    "[degF]": {Code: "[degF]", Display: "°F", Dimension: "temperature", Factor: 5.0 / 9, Offset: -32 * 5.0 / 9},
+    // pressure, base mm[Hg]
+    "mm[Hg]": {Code: "mm[Hg]", Display: "mmHg", Dimension: "pressure", Factor: 1},
+    // arbitrary and count units
+    "[iU]":      {Code: "[iU]", Display: "units", Dimension: "[iU]", Factor: 1},
+    "{tablet}":  {Code: "{tablet}", Display: "tablet", Dimension: "{tablet}", Factor: 1},
+    "{capsule}": {Code: "{capsule}", Display: "capsule", Dimension: "{capsule}", Factor: 1},
+    "{puff}":    {Code: "{puff}", Display: "puff", Dimension: "{puff}", Factor: 1},
+    "{drop}":    {Code: "{drop}", Display: "drop", Dimension: "{drop}", Factor: 1},
+    "{patch}":   {Code: "{patch}", Display: "patch", Dimension: "{patch}", Factor: 1},
+}
+
+// unitAliases maps common non-UCUM spellings accepted from clients to UCUM codes
+var unitAliases = map[string]string{
+    "mcg": "ug", "µg": "ug", "ml": "mL", "l": "L", "lb": "[lb_av]", "lbs": "[lb_av]",
+    "units": "[iU]", "IU": "[iU]", "tablet": "{tablet}", "capsule": "{capsule}",
+    "puff": "{puff}", "drop": "{drop}", "patch": "{patch}", "degF": "[degF]", "mmHg": "mm[Hg]",
+}
+
+// lookupUnit resolves a UCUM code or accepted alias
+func lookupUnit(s string) (ucumUnit, error) {
+    if u, ok := ucumUnits[s]; ok { return u, nil }
+    if code, ok := unitAliases[s]; ok { return ucumUnits[code], nil }
+    return ucumUnit{}, fmt.Errorf("unknown unit %q", s)
+}
+
+// canonicalUnit returns the UCUM code for s
+func canonicalUnit(s string) (string, error) {
+    u, err := lookupUnit(s)
+    return u.Code, err
+}
+
+// unitDisplay renders a unit for people (e.g., in a generated sig); unknown units pass through
+func unitDisplay(s string) string {
+    if u, err := lookupUnit(s); err == nil { return u.Display }
+    return s
+}
+
+// convertQuantity converts v between two units of the same dimension
+func convertQuantity(v float64, from, to string) (float64, error) {
+    f, err := lookupUnit(from)
+    if err != nil { return 0, err }
+    t, err := lookupUnit(to)
+    if err != nil { return 0, err }
+    if f.Dimension != t.Dimension {
+        return 0, fmt.Errorf("%w: %s to %s", ErrUnitMismatch, f.Code, t.Code)
+    }
+    base := v*f.Factor + f.Offset
+    return (base - t.Offset) / t.Factor, nil
+}
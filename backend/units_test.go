@@ -0,0 +1,38 @@
+package main
+
+import (
+    "errors"
+    "math"
+    "testing"
+)
+
+func TestConvertQuantity(t *testing.T) {
+    cases := []struct {
+        name     string
+        v        float64
+        from, to string
+        want     float64
+        wantErr  error
+    }{
+        {name: "mg to g", v: 500, from: "mg", to: "g", want: 0.5},
+        {name: "g to mg", v: 1.5, from: "g", to: "mg", want: 1500},
+        {name: "mcg alias to mg", v: 250, from: "mcg", to: "mg", want: 0.25},
+        {name: "lb to kg", v: 10, from: "[lb_av]", to: "kg", want: 4.5359237},
+        {name: "kg to lb alias", v: 70, from: "kg", to: "lb", want: 154.3235835},
+        {name: "fahrenheit to celsius", v: 98.6, from: "[degF]", to: "Cel", want: 37},
+        {name: "mass to volume", v: 5, from: "mg", to: "mL", wantErr: ErrUnitMismatch},
+        {name: "tablets to mg", v: 1, from: "tablet", to: "mg", wantErr: ErrUnitMismatch},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            got, err := convertQuantity(tc.v, tc.from, tc.to)
+            if tc.wantErr != nil {
+                if !errors.Is(err, tc.wantErr) { t.Fatalf("err = %v, want %v", err, tc.wantErr) }
+                return
+            }
+            if err != nil { t.Fatalf("convertQuantity: %v", err) }
+            if math.Abs(got-tc.want) > 1e-6 { t.Fatalf("got %v, want %v", got, tc.want) }
+        })
+    }
+    if _, err := convertQuantity(1, "spoonful", "mL"); err == nil { t.Fatalf("expected unknown unit error") }
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// route is one API path pattern (http.ServeMux syntax, without a version prefix)
+type route struct {
+    pattern string
+    handler http.HandlerFunc
+}
+
+// v1Routes is the v1 route registry. A future /v2 gets its own registry, reusing v1
+// handlers where nothing changed, and is mounted alongside in routes().
+func (s *Server) v1Routes() []route {
+    return []route{
+        {"/prescriptions", s.handlePrescriptions},
+        {"/prescriptions/export", s.handleExportPrescriptions},
+        {"/prescriptions/", s.handlePrescriptionSubroutes},
+        {"/pharmacies", s.handlePharmacies},
+        {"/organizations", s.handleOrganizations},
+        {"/hl7", s.handleHL7},
+        {"/hl7/quarantine", s.handleHL7Quarantine},
+        {"/webhooks", s.handleWebhooks},
+        {"/webhooks/", s.handleWebhookSubroutes},
+        {"/bulk-jobs", s.handleBulkJobs},
+        {"/bulk-jobs/", s.handleBulkJob},
+        {"/backfill-jobs", s.handleBackfillJobs},
+        {"/backfill-jobs/", s.handleBackfillJob},
+        {"/provenance", s.handleProvenance},
+        {"/provenance/", s.handleProvenance},
+        {"/analytics/top-drugs", s.handleTopDrugs},
+        {"/analytics/prescriptions-over-time", s.handlePrescriptionsOverTime},
+        {"/analytics/physician-volume", s.handlePhysicianVolume},
+        {"/admin/stats", s.handleAdminStats},
+        {"/drugs", s.handleDrugs},
+        {"/drugs/", s.handleDrugSubroutes},
+        {"/icd", s.handleICDSearch},
+        {"/search", s.handleSearch},
+        {"/physicians/", s.handlePhysicianSubroutes},
+        {"/patients/", s.handlePatientSubroutes},
+        {"/graphql", s.handleGraphQL},
+    }
+}
+
+// mountVersion registers routes under prefix. Handlers parse r.URL.Path themselves, so
+// the prefix is stripped before they run and they stay version-agnostic.
+func (s *Server) mountVersion(prefix string, routes []route) {
+    for _, rt := range routes {
+        s.mux.Handle(prefix+rt.pattern, http.StripPrefix(prefix, rt.handler))
+    }
+}
+
+// Legacy unprefixed API lifecycle (RFC 9745 Deprecation, RFC 8594 Sunset)
+var (
+    legacyDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+    legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// mountLegacy serves routes unprefixed, pointing clients at the successor version
+func (s *Server) mountLegacy(successor string, routes []route) {
+    for _, rt := range routes {
+        h := rt.handler
+        s.mux.HandleFunc(rt.pattern, func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+            w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+            w.Header().Set("Link", "<"+successor+r.URL.Path+">; rel=\"successor-version\"")
+            h(w, r)
+        })
+    }
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestVersionedRouting(t *testing.T) {
+    cases := []struct {
+        name             string
+        path             string
+        expectStatus     int
+        expectDeprecated bool
+        expectLink       string
+    }{
+        {name: "v1 collection", path: "/v1/drugs?q=ibu", expectStatus: http.StatusOK},
+        {name: "v1 subroute", path: "/v1/drugs/2", expectStatus: http.StatusOK},
+        {name: "legacy collection", path: "/drugs?q=ibu", expectStatus: http.StatusOK, expectDeprecated: true, expectLink: `</v1/drugs>; rel="successor-version"`},
+        {name: "legacy subroute", path: "/physicians/1/patients", expectStatus: http.StatusOK, expectDeprecated: true, expectLink: `</v1/physicians/1/patients>; rel="successor-version"`},
+        {name: "probe unversioned", path: "/healthz", expectStatus: http.StatusOK},
+        {name: "unknown version", path: "/v2/drugs", expectStatus: http.StatusNotFound},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+            req.Header.Set("X-Role", "admin")
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            deprecated := rr.Header().Get("Deprecation") != "" && rr.Header().Get("Sunset") != ""
+            if deprecated != tc.expectDeprecated { t.Fatalf("deprecation headers = %v, want %v", rr.Header(), tc.expectDeprecated) }
+            if got := rr.Header().Get("Link"); got != tc.expectLink { t.Fatalf("Link = %q, want %q", got, tc.expectLink) }
+        })
+    }
+}
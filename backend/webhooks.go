@@ -0,0 +1,250 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// Webhook event types pushed to registered endpoints
+const (
+    EventPrescriptionCreated = "prescription.created"
+)
+
+// WebhookEndpoint is an admin-registered receiver. Every endpoint receives every event.
+type WebhookEndpoint struct {
+    ID        int64     `json:"id"`
+    URL       string    `json:"url"`
+    // Secret signs deliveries; it is write-only and never returned by the API
+    Secret    string    `json:"-"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one delivery attempt of an event to an endpoint
+type WebhookDelivery struct {
+    ID         int64     `json:"id"`
+    EndpointID int64     `json:"endpoint_id"`
+    EventID    string    `json:"event_id"`
+    EventType  string    `json:"event_type"`
+    Attempt    int       `json:"attempt"`
+    StatusCode int       `json:"status_code,omitempty"`
+    Error      string    `json:"error,omitempty"`
+    Succeeded  bool      `json:"succeeded"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// webhookEvent is the JSON body POSTed to endpoints
+type webhookEvent struct {
+    ID        string    `json:"id"`
+    Type      string    `json:"type"`
+    CreatedAt time.Time `json:"created_at"`
+    Data      any       `json:"data"`
+}
+
+// webhookDispatcher signs and delivers events in the background, retrying failed
+// attempts with exponential backoff and logging every attempt to the repository.
+type webhookDispatcher struct {
+    repo        Repository
+    client      *http.Client
+    maxAttempts int
+    baseBackoff time.Duration
+    // pending counts deliveries not yet finished, including those waiting to retry
+    pending     atomic.Int64
+    // subscribers receive every published event in process; they must not block
+    subscribers []func(eventType string, data any)
+}
+
+func newWebhookDispatcher(repo Repository) *webhookDispatcher {
+    return &webhookDispatcher{
+        repo:        repo,
+        client:      &http.Client{Timeout: 10 * time.Second},
+        maxAttempts: 5,
+        baseBackoff: 2 * time.Second,
+    }
+}
+
+// Subscribe registers fn for every event published from now on; call it before serving
+func (d *webhookDispatcher) Subscribe(fn func(eventType string, data any)) {
+    d.subscribers = append(d.subscribers, fn)
+}
+
+// Publish hands an event to the subscribers and queues it for every registered endpoint,
+// returning immediately. Delivery failures are recorded in the delivery log, never
+// surfaced to the caller.
+func (d *webhookDispatcher) Publish(ctx context.Context, eventType string, data any) {
+    for _, fn := range d.subscribers { fn(eventType, data) }
+    endpoints, err := d.repo.ListWebhookEndpoints(ctx)
+    if err != nil {
+        log.Printf("webhooks: listing endpoints for %s failed: %v", eventType, err)
+        return
+    }
+    if len(endpoints) == 0 { return }
+    ev := webhookEvent{ID: newEventID(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+    body, err := json.Marshal(ev)
+    if err != nil {
+        log.Printf("webhooks: encoding %s failed: %v", eventType, err)
+        return
+    }
+    for _, ep := range endpoints {
+        d.pending.Add(1)
+        go d.deliver(ep, ev, body)
+    }
+}
+
+func (d *webhookDispatcher) deliver(ep WebhookEndpoint, ev webhookEvent, body []byte) {
+    defer d.pending.Add(-1)
+    backoff := d.baseBackoff
+    for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+        rec := &WebhookDelivery{EndpointID: ep.ID, EventID: ev.ID, EventType: ev.Type, Attempt: attempt}
+        status, err := d.post(ep, ev, body)
+        rec.StatusCode = status
+        if err != nil {
+            rec.Error = err.Error()
+        } else {
+            rec.Succeeded = true
+        }
+        if err := d.repo.RecordWebhookDelivery(context.Background(), rec); err != nil {
+            // The endpoint was unregistered while we were retrying
+            if errors.Is(err, ErrInvalidReference) { return }
+            log.Printf("webhooks: recording delivery of %s to endpoint %d failed: %v", ev.ID, ep.ID, err)
+        }
+        if rec.Succeeded { return }
+        if attempt < d.maxAttempts {
+            time.Sleep(backoff)
+            backoff *= 2
+        }
+    }
+}
+
+func (d *webhookDispatcher) post(ep WebhookEndpoint, ev webhookEvent, body []byte) (int, error) {
+    req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(body))
+    if err != nil { return 0, err }
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Webhook-ID", ev.ID)
+    req.Header.Set("X-Webhook-Event", ev.Type)
+    req.Header.Set("X-Webhook-Timestamp", ts)
+    req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(ep.Secret, ts, body))
+    resp, err := d.client.Do(req)
+    if err != nil { return 0, err }
+    resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+    }
+    return resp.StatusCode, nil
+}
+
+// signWebhook is hex(HMAC-SHA256(secret, timestamp + "." + body)). Receivers recompute
+// it and should reject stale timestamps to prevent replays.
+func signWebhook(secret, timestamp string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp + "."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newEventID() string {
+    b := make([]byte, 12)
+    _, _ = rand.Read(b)
+    return "evt_" + hex.EncodeToString(b)
+}
+
+// validWebhookURL requires https, allowing plain http only for loopback receivers in development
+func validWebhookURL(raw string) bool {
+    u, err := url.Parse(raw)
+    if err != nil || u.Host == "" { return false }
+    switch u.Scheme {
+    case "https":
+        return true
+    case "http":
+        host := u.Hostname()
+        if host == "localhost" { return true }
+        ip := net.ParseIP(host)
+        return ip != nil && ip.IsLoopback()
+    }
+    return false
+}
+
+// handleWebhooks serves the admin-only endpoint registry:
+//   GET  /webhooks  list endpoints (secrets are never returned)
+//   POST /webhooks  {"url":"https://...","secret":"..."} register an endpoint
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActWebhookManage, Resource{}); !ok { return }
+    switch r.Method {
+    case http.MethodGet:
+        items, err := s.repo.ListWebhookEndpoints(r.Context())
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list webhooks"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items})
+    case http.MethodPost:
+        var req struct {
+            URL    string `json:"url"`
+            Secret string `json:"secret"`
+        }
+        if !decodeJSON(w, r, &req) { return }
+        if len(req.URL) > 2000 || !validWebhookURL(req.URL) {
+            writeError(w, http.StatusBadRequest, "url must be an https URL")
+            return
+        }
+        if len(req.Secret) < 16 || len(req.Secret) > 200 {
+            writeError(w, http.StatusBadRequest, "secret must be 16..200 characters")
+            return
+        }
+        ep, err := s.repo.CreateWebhookEndpoint(r.Context(), &WebhookEndpoint{URL: req.URL, Secret: req.Secret})
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to create webhook"); return }
+        writeJSON(w, http.StatusCreated, ep)
+    default:
+        w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    }
+}
+
+// handleWebhookSubroutes serves (admin only):
+//   DELETE /webhooks/{id}             unregister an endpoint
+//   GET    /webhooks/{id}/deliveries  recent delivery attempts, newest first
+func (s *Server) handleWebhookSubroutes(w http.ResponseWriter, r *http.Request) {
+    if _, ok := s.can(w, r, ActWebhookManage, Resource{}); !ok { return }
+    idStr, tail, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+    id, err := strconv.ParseInt(idStr, 10, 64)
+    if err != nil || id <= 0 { writeError(w, http.StatusNotFound, "not found"); return }
+    switch {
+    case tail == "" && r.Method == http.MethodDelete:
+        if err := s.repo.DeleteWebhookEndpoint(r.Context(), id); err != nil {
+            if errors.Is(err, ErrNotFound) { writeRepoError(w, err, "webhook not found"); return }
+            writeError(w, http.StatusInternalServerError, "failed to delete webhook")
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    case tail == "deliveries" && r.Method == http.MethodGet:
+        limit := 50
+        if ls := r.URL.Query().Get("limit"); ls != "" {
+            if n, err := strconv.Atoi(ls); err == nil && n > 0 && n <= 200 { limit = n } else {
+                writeError(w, http.StatusBadRequest, "limit must be 1..200"); return
+            }
+        }
+        items, err := s.repo.ListWebhookDeliveries(r.Context(), id, limit)
+        if err != nil { writeError(w, http.StatusInternalServerError, "failed to list deliveries"); return }
+        writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit})
+    case tail == "":
+        w.Header().Set("Allow", http.MethodDelete)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    case tail == "deliveries":
+        w.Header().Set("Allow", http.MethodGet)
+        writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+    default:
+        writeError(w, http.StatusNotFound, "not found")
+    }
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestWebhookRegistration(t *testing.T) {
+    cases := []struct {
+        name         string
+        role         string
+        body         string
+        expectStatus int
+    }{
+        {name: "admin https", role: "admin", body: `{"url":"https://example.com/hook","secret":"0123456789abcdef"}`, expectStatus: http.StatusCreated},
+        {name: "admin loopback http", role: "admin", body: `{"url":"http://127.0.0.1:9000/hook","secret":"0123456789abcdef"}`, expectStatus: http.StatusCreated},
+        {name: "plain http rejected", role: "admin", body: `{"url":"http://example.com/hook","secret":"0123456789abcdef"}`, expectStatus: http.StatusBadRequest},
+        {name: "short secret", role: "admin", body: `{"url":"https://example.com/hook","secret":"short"}`, expectStatus: http.StatusBadRequest},
+        {name: "physician forbidden", role: "physician", body: `{"url":"https://example.com/hook","secret":"0123456789abcdef"}`, expectStatus: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            srv := NewServer(newDemoMemoryRepo(), defaultConfig())
+            req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(tc.body))
+            req.Header.Set("X-Role", tc.role)
+            req.Header.Set("X-User-ID", "1")
+            rr := httptest.NewRecorder()
+            srv.ServeHTTP(rr, req)
+            if rr.Code != tc.expectStatus {
+                t.Fatalf("status = %d, want %d, body=%s", rr.Code, tc.expectStatus, rr.Body.String())
+            }
+            if strings.Contains(rr.Body.String(), "0123456789abcdef") { t.Fatalf("secret echoed in response") }
+        })
+    }
+}
+
+func TestWebhookDeliverySignedWithRetry(t *testing.T) {
+    const secret = "0123456789abcdef"
+    var calls int32
+    got := make(chan *http.Request, 1)
+    receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // Fail the first attempt to exercise retry
+        if atomic.AddInt32(&calls, 1) == 1 { w.WriteHeader(http.StatusServiceUnavailable); return }
+        body, _ := io.ReadAll(r.Body)
+        if sig := r.Header.Get("X-Webhook-Signature"); sig != "sha256="+signWebhook(secret, r.Header.Get("X-Webhook-Timestamp"), body) {
+            t.Errorf("bad signature %q", sig)
+        }
+        got <- r
+    }))
+    defer receiver.Close()
+
+    repo := newDemoMemoryRepo()
+    ep, _ := repo.CreateWebhookEndpoint(context.Background(), &WebhookEndpoint{URL: receiver.URL, Secret: secret})
+    srv := NewServer(repo, defaultConfig())
+    srv.webhooks.baseBackoff = time.Millisecond
+
+    req := httptest.NewRequest(http.MethodPost, "/prescriptions", strings.NewReader(`{"patient_id":1,"physician_id":1,"drug_id":1,"quantity":30,"sig":"1 tab"}`))
+    req.Header.Set("X-Role", "physician")
+    req.Header.Set("X-User-ID", "1")
+    rr := httptest.NewRecorder()
+    srv.ServeHTTP(rr, req)
+    if rr.Code != http.StatusCreated { t.Fatalf("create = %d, body=%s", rr.Code, rr.Body.String()) }
+
+    select {
+    case r := <-got:
+        if r.Header.Get("X-Webhook-Event") != EventPrescriptionCreated { t.Fatalf("event = %q", r.Header.Get("X-Webhook-Event")) }
+    case <-time.After(2 * time.Second):
+        t.Fatalf("webhook not delivered")
+    }
+    // The successful attempt is logged right after the receiver responds
+    deadline := time.Now().Add(time.Second)
+    for {
+        ds, _ := repo.ListWebhookDeliveries(context.Background(), ep.ID, 10)
+        if len(ds) == 2 && ds[0].Succeeded && ds[0].Attempt == 2 && !ds[1].Succeeded && ds[1].StatusCode == 503 { break }
+        if time.Now().After(deadline) { t.Fatalf("delivery log = %+v", ds) }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
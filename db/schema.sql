@@ -37,6 +37,305 @@ CREATE INDEX IF NOT EXISTS idx_prescriptions_patient ON prescriptions(patient_id
 CREATE INDEX IF NOT EXISTS idx_prescriptions_drug ON prescriptions(drug_id);
 CREATE INDEX IF NOT EXISTS idx_prescriptions_range_patient ON prescriptions(patient_id, prescribed_at);
 
--- Ensure natural key uniqueness for idempotent seeds
-CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_name ON patients(name);
-CREATE UNIQUE INDEX IF NOT EXISTS idx_physicians_name ON physicians(name);
+-- Stored responses for retried POSTs carrying an Idempotency-Key header.
+-- status_code/response_body stay NULL while the first request is in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope         TEXT NOT NULL,
+    key           TEXT NOT NULL,
+    request_hash  TEXT NOT NULL,
+    status_code   INT,
+    response_body BYTEA,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+-- A pending key whose request has not finished a minute after reserved_at is taken over by
+-- the next request with it (see backend/idempotency.go)
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS reserved_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Drug catalog search: pg_trgm powers fuzzy autocomplete (GET /drugs?q=)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_drugs_name_trgm ON drugs USING gin (name gin_trgm_ops);
+-- ...and the patient and physician halves of GET /search
+CREATE INDEX IF NOT EXISTS idx_patients_name_trgm ON patients USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_physicians_name_trgm ON physicians USING gin (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_drugs_name_lower ON drugs (lower(name));
+
+-- RxNorm normalization (populated when RXNORM_ENABLED=1)
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS rxcui TEXT;
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS normalized_name TEXT;
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS dose_form TEXT;
+CREATE INDEX IF NOT EXISTS idx_drugs_rxcui ON drugs(rxcui);
+
+-- Optional structured dosing stored alongside the free-text sig
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS dose_amount NUMERIC(10,3) CHECK (dose_amount > 0);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS dose_unit TEXT;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS route TEXT;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS frequency TEXT;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS duration_days INT CHECK (duration_days > 0);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_prescriptions_expires ON prescriptions(expires_at) WHERE expires_at IS NOT NULL;
+
+-- Controlled substances: DEA schedule on the catalog, refills and indication on prescriptions
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS schedule TEXT CHECK (schedule IN ('CII','CIII','CIV','CV'));
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS refills INT NOT NULL DEFAULT 0 CHECK (refills BETWEEN 0 AND 11);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS reason TEXT;
+
+-- Pharmacies and dispensing; pharmacists act on behalf of one pharmacy
+CREATE TABLE IF NOT EXISTS pharmacies (
+    id      BIGSERIAL PRIMARY KEY,
+    name    TEXT NOT NULL,
+    address TEXT
+);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS pharmacy_id BIGINT REFERENCES pharmacies(id);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS dispensed_at TIMESTAMPTZ;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS dispensed_quantity INT CHECK (dispensed_quantity > 0);
+CREATE INDEX IF NOT EXISTS idx_prescriptions_pharmacy ON prescriptions(pharmacy_id, prescribed_at DESC) WHERE pharmacy_id IS NOT NULL;
+
+-- Structured dose units are stored as UCUM codes; migrate rows written with the old aliases
+UPDATE prescriptions SET dose_unit = CASE dose_unit
+    WHEN 'mcg' THEN 'ug' WHEN 'units' THEN '[iU]' WHEN 'tablet' THEN '{tablet}' WHEN 'capsule' THEN '{capsule}'
+    WHEN 'puff' THEN '{puff}' WHEN 'drop' THEN '{drop}' WHEN 'patch' THEN '{patch}' END
+WHERE dose_unit IN ('mcg','units','tablet','capsule','puff','drop','patch');
+
+-- Webhook endpoints receive signed prescription events; every attempt is logged
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id         BIGSERIAL PRIMARY KEY,
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id          BIGSERIAL PRIMARY KEY,
+    endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id    TEXT NOT NULL,
+    event_type  TEXT NOT NULL,
+    attempt     INT NOT NULL,
+    status_code INT,
+    error       TEXT,
+    succeeded   BOOLEAN NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, created_at DESC);
+
+-- Soft delete: rows with deleted_at are hidden from the API but kept for audit/retention
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+-- When the patient was registered; retention counts inactivity from it for patients without
+-- recent prescriptions. Rows from before the column get NOW(), and so a full window.
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE physicians ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_patients_retention ON patients(deleted_at) WHERE deleted_at IS NOT NULL AND anonymized_at IS NULL;
+
+-- Append-only audit log (actor is "role:user_id" or "system:<job>")
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         BIGSERIAL PRIMARY KEY,
+    actor      TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    entity     TEXT NOT NULL,
+    entity_id  BIGINT NOT NULL,
+    detail     TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id, created_at DESC);
+
+-- Internal care-team comments on prescriptions (never shown to patients)
+CREATE TABLE IF NOT EXISTS prescription_comments (
+    id              BIGSERIAL PRIMARY KEY,
+    prescription_id BIGINT NOT NULL REFERENCES prescriptions(id),
+    author_role     TEXT NOT NULL,
+    author_id       BIGINT NOT NULL,
+    body            TEXT NOT NULL,
+    mentions        JSONB NOT NULL DEFAULT '[]',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_prescription_comments_rx ON prescription_comments(prescription_id, created_at);
+
+-- Prescription lifecycle; admins cancel or expire prescriptions in bulk (see audit_log)
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CONSTRAINT prescriptions_status_check CHECK (status IN ('active','cancelled','expired'));
+CREATE INDEX IF NOT EXISTS idx_prescriptions_active_drug ON prescriptions(drug_id, prescribed_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_prescriptions_active_physician ON prescriptions(physician_id, prescribed_at) WHERE status = 'active';
+
+-- Nurses draft prescriptions for physicians who delegate to them; drafts await signature
+CREATE TABLE IF NOT EXISTS nurses (
+    id   BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS nurse_delegations (
+    physician_id BIGINT NOT NULL REFERENCES physicians(id),
+    nurse_id     BIGINT NOT NULL REFERENCES nurses(id),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (physician_id, nurse_id)
+);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS drafted_by BIGINT REFERENCES nurses(id);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS signed_at TIMESTAMPTZ;
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_status_check;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_status_check
+    CHECK (status IN ('pending_signature','active','cancelled','expired'));
+CREATE INDEX IF NOT EXISTS idx_prescriptions_drafted_by ON prescriptions(drafted_by, prescribed_at DESC) WHERE drafted_by IS NOT NULL;
+
+-- Patient demographics returned by GET /patients/{id}; nulled by anonymization
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS birth_date DATE;
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS sex TEXT CHECK (sex IN ('female','male','other','unknown'));
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS phone TEXT;
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS email TEXT;
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS address TEXT;
+
+-- Provenance of generated documents (exports); sha256 covers the content before the footer line
+CREATE TABLE IF NOT EXISTS document_provenance (
+    document_id TEXT PRIMARY KEY,
+    kind        TEXT NOT NULL,
+    format      TEXT NOT NULL,
+    request_id  TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    params      TEXT,
+    row_count   INT NOT NULL,
+    sha256      TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_document_provenance_sha256 ON document_provenance(sha256);
+
+-- Patient consent to physician access, per scope; revoked and expired rows are kept as history
+CREATE TABLE IF NOT EXISTS consents (
+    id           BIGSERIAL PRIMARY KEY,
+    patient_id   BIGINT NOT NULL REFERENCES patients(id),
+    physician_id BIGINT NOT NULL REFERENCES physicians(id),
+    scope        TEXT NOT NULL CHECK (scope IN ('prescriptions','allergies','analytics')),
+    granted_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at   TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_consents_active ON consents(patient_id, physician_id, scope) WHERE revoked_at IS NULL;
+-- Links granted full access before consents existed; carry that over once, when the table is new
+INSERT INTO consents (patient_id, physician_id, scope)
+SELECT pp.patient_id, pp.physician_id, s.scope
+FROM physician_patients pp CROSS JOIN (VALUES ('prescriptions'),('allergies'),('analytics')) AS s(scope)
+WHERE NOT EXISTS (SELECT 1 FROM consents);
+
+-- Organizations (clinics) sharing one deployment. Rows from before multi-tenancy belong to
+-- organization 1; only the drug catalog is shared across organizations.
+CREATE TABLE IF NOT EXISTS organizations (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO organizations (id, name) VALUES (1, 'Default clinic') ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), GREATEST((SELECT MAX(id) FROM organizations), 1));
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE physicians ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+-- A prescription's patient and physician must be in its organization
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_id_org ON patients(id, org_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_physicians_id_org ON physicians(id, org_id);
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_patient_org_fkey;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_patient_org_fkey
+    FOREIGN KEY (patient_id, org_id) REFERENCES patients(id, org_id);
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_physician_org_fkey;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_physician_org_fkey
+    FOREIGN KEY (physician_id, org_id) REFERENCES physicians(id, org_id);
+CREATE INDEX IF NOT EXISTS idx_patients_org ON patients(org_id);
+CREATE INDEX IF NOT EXISTS idx_physicians_org ON physicians(org_id);
+-- Natural keys for idempotent seeds, unique within an organization only: a name taken in
+-- another clinic must neither be rejected nor reveal that it exists there
+DROP INDEX IF EXISTS idx_patients_name;
+DROP INDEX IF EXISTS idx_physicians_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_org_name ON patients(org_id, name) WHERE mrn IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_physicians_org_name ON physicians(org_id, name);
+CREATE INDEX IF NOT EXISTS idx_prescriptions_org ON prescriptions(org_id, prescribed_at DESC);
+-- Every caller but a platform admin is scoped to the organization of their own row (see
+-- backend/permissions.go); org admins have rows of their own for that
+ALTER TABLE pharmacies ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE nurses ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations(id);
+CREATE TABLE IF NOT EXISTS org_admins (
+    id     BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL REFERENCES organizations(id),
+    name   TEXT NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pharmacies_id_org ON pharmacies(id, org_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_nurses_id_org ON nurses(id, org_id);
+-- Pharmacies and nurses were shared before, so existing prescriptions aren't re-checked
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_pharmacy_org_fkey;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_pharmacy_org_fkey
+    FOREIGN KEY (pharmacy_id, org_id) REFERENCES pharmacies(id, org_id) NOT VALID;
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_drafted_by_org_fkey;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_drafted_by_org_fkey
+    FOREIGN KEY (drafted_by, org_id) REFERENCES nurses(id, org_id) NOT VALID;
+CREATE INDEX IF NOT EXISTS idx_pharmacies_org ON pharmacies(org_id);
+
+-- HL7 v2 feeds identify patients by medical record number, unique within an organization;
+-- patients with an MRN may share a name, so the name index only covers those without one
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS mrn TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_org_mrn ON patients(org_id, mrn) WHERE mrn IS NOT NULL;
+-- Rejected HL7 messages kept for review; org_id is NULL for messages received unscoped
+CREATE TABLE IF NOT EXISTS hl7_quarantine (
+    id           BIGSERIAL PRIMARY KEY,
+    org_id       BIGINT REFERENCES organizations(id),
+    received_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    request_id   TEXT NOT NULL,
+    control_id   TEXT,
+    message_type TEXT,
+    reason       TEXT NOT NULL,
+    raw          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_hl7_quarantine_org ON hl7_quarantine(org_id, received_at DESC);
+
+-- Background job purges (see backend/jobs.go) delete audit entries past AUDIT_RETENTION_DAYS
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+
+-- ICD-10-CM diagnosis codes (e.g. E11.9) for prescription indications, which payers need
+-- for coverage review. db/seed.sql loads a starter set; production loads the CMS code file.
+CREATE TABLE IF NOT EXISTS icd_codes (
+    code        TEXT PRIMARY KEY,
+    description TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_icd_codes_description_trgm ON icd_codes USING gin (description gin_trgm_ops);
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS diagnosis_code TEXT REFERENCES icd_codes(code);
+
+-- HMAC of the prescription's canonical fields under its physician's key (see esign.go);
+-- NULL for drafts and for prescriptions written before signing was configured
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS signature TEXT;
+
+-- Channels a patient wants prescription notifications on (see backend/notify.go); patients
+-- without a row have every channel off
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    patient_id BIGINT PRIMARY KEY REFERENCES patients(id),
+    email      BOOLEAN NOT NULL DEFAULT FALSE,
+    sms        BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Files attached to prescriptions (lab results, images); the content lives in the blob
+-- store named by ATTACHMENT_STORE under storage_key (see backend/blobstore.go)
+CREATE TABLE IF NOT EXISTS prescription_attachments (
+    id               BIGSERIAL PRIMARY KEY,
+    prescription_id  BIGINT NOT NULL REFERENCES prescriptions(id),
+    kind             TEXT NOT NULL CHECK (kind IN ('lab_result','image','other')),
+    filename         TEXT NOT NULL,
+    content_type     TEXT NOT NULL,
+    size_bytes       BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256           TEXT NOT NULL,
+    storage_key      TEXT NOT NULL UNIQUE,
+    uploaded_by_role TEXT NOT NULL,
+    uploaded_by_id   BIGINT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_prescription_attachments_rx ON prescription_attachments(prescription_id, created_at);
+
+-- Quantity units and days supply on prescriptions, and the per-drug dispensing rules they
+-- are checked against (see backend/supply.go); units are UCUM codes
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS quantity_unit TEXT;
+ALTER TABLE prescriptions ADD COLUMN IF NOT EXISTS days_supply INT CHECK (days_supply BETWEEN 1 AND 365);
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS dispense_unit TEXT;
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS strength NUMERIC(12,4) CHECK (strength > 0);
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS strength_unit TEXT;
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS max_daily_dose NUMERIC(12,4) CHECK (max_daily_dose > 0);
+ALTER TABLE drugs ADD COLUMN IF NOT EXISTS max_daily_dose_unit TEXT;
+
+-- Prescriptions moved to a new physician by a patient transfer wait for that physician to
+-- sign them again (see backend/transfer.go)
+ALTER TABLE prescriptions DROP CONSTRAINT IF EXISTS prescriptions_status_check;
+ALTER TABLE prescriptions ADD CONSTRAINT prescriptions_status_check
+    CHECK (status IN ('pending_signature','pending_reauthorization','active','cancelled','expired'));
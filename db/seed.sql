@@ -1,7 +1,29 @@
 -- Seed data for quick local testing
 INSERT INTO patients (name) VALUES ('Alice'), ('Bob') ON CONFLICT DO NOTHING;
+UPDATE patients SET birth_date='1985-04-12', sex='female', phone='555-0101', email='alice@example.com', address='12 Oak Ave' WHERE name='Alice';
+UPDATE patients SET birth_date='1972-11-30', sex='male', phone='555-0102' WHERE name='Bob';
 INSERT INTO physicians (name) VALUES ('Dr. Smith'), ('Dr. Jones') ON CONFLICT DO NOTHING;
 INSERT INTO drugs (name) VALUES ('Amoxicillin'), ('Ibuprofen'), ('Metformin') ON CONFLICT DO NOTHING;
+INSERT INTO drugs (name, schedule) VALUES ('Oxycodone', 'CII') ON CONFLICT DO NOTHING;
+UPDATE drugs SET dispense_unit='{tablet}', strength=200, strength_unit='mg', max_daily_dose=3200, max_daily_dose_unit='mg' WHERE name='Ibuprofen';
+UPDATE drugs SET dispense_unit='{tablet}', strength=500, strength_unit='mg', max_daily_dose=2550, max_daily_dose_unit='mg' WHERE name='Metformin';
+INSERT INTO icd_codes (code, description) VALUES
+    ('E11.9', 'Type 2 diabetes mellitus without complications'),
+    ('E78.5', 'Hyperlipidemia, unspecified'),
+    ('F32.A', 'Depression, unspecified'),
+    ('F41.1', 'Generalized anxiety disorder'),
+    ('G89.29', 'Other chronic pain'),
+    ('H66.90', 'Otitis media, unspecified, unspecified ear'),
+    ('I10', 'Essential (primary) hypertension'),
+    ('J02.9', 'Acute pharyngitis, unspecified'),
+    ('J06.9', 'Acute upper respiratory infection, unspecified'),
+    ('J45.909', 'Unspecified asthma, uncomplicated'),
+    ('K21.9', 'Gastro-esophageal reflux disease without esophagitis'),
+    ('M54.50', 'Low back pain, unspecified'),
+    ('N39.0', 'Urinary tract infection, site not specified'),
+    ('R51.9', 'Headache, unspecified')
+ON CONFLICT DO NOTHING;
+INSERT INTO pharmacies (name, address) VALUES ('Main Street Pharmacy', '100 Main St') ON CONFLICT DO NOTHING;
 
 -- Link Dr. Smith to Alice and Bob; Dr. Jones to Bob only
 INSERT INTO physician_patients (physician_id, patient_id)
@@ -12,6 +34,21 @@ INSERT INTO physician_patients (physician_id, patient_id)
 SELECT p2.id, p1.id FROM physicians p2, patients p1 WHERE p2.name='Dr. Jones' AND p1.name IN ('Bob')
 ON CONFLICT DO NOTHING;
 
+-- The seeded patients consent to every scope for their linked physicians
+INSERT INTO consents (patient_id, physician_id, scope)
+SELECT pp.patient_id, pp.physician_id, s.scope
+FROM physician_patients pp CROSS JOIN (VALUES ('prescriptions'),('allergies'),('analytics')) AS s(scope)
+ON CONFLICT (patient_id, physician_id, scope) WHERE revoked_at IS NULL DO NOTHING;
+
+-- Dr. Smith delegates drafting to Nurse Taylor
+INSERT INTO nurses (name) VALUES ('Nurse Taylor') ON CONFLICT DO NOTHING;
+INSERT INTO nurse_delegations (physician_id, nurse_id)
+SELECT ph.id, n.id FROM physicians ph, nurses n WHERE ph.name='Dr. Smith' AND n.name='Nurse Taylor'
+ON CONFLICT DO NOTHING;
+
+-- The default clinic's administrator (X-Role: org_admin, X-User-ID: 1)
+INSERT INTO org_admins (org_id, name) SELECT 1, 'Clinic Admin' WHERE NOT EXISTS (SELECT 1 FROM org_admins);
+
 -- Some prescriptions
 WITH ids AS (
     SELECT
@@ -23,7 +60,7 @@ WITH ids AS (
         (SELECT id FROM drugs WHERE name='Ibuprofen') AS ibu,
         (SELECT id FROM drugs WHERE name='Metformin') AS met
 )
-INSERT INTO prescriptions (patient_id, physician_id, drug_id, quantity, sig, prescribed_at)
-SELECT alice, dr_smith, amox, 20, '1 tab BID', NOW() - INTERVAL '3 days' FROM ids UNION ALL
-SELECT alice, dr_smith, ibu, 30, 'PRN pain', NOW() - INTERVAL '2 days' FROM ids UNION ALL
-SELECT bob, dr_jones, met, 60, '500mg BID', NOW() - INTERVAL '1 days' FROM ids ON CONFLICT DO NOTHING;
+INSERT INTO prescriptions (patient_id, physician_id, drug_id, quantity, sig, prescribed_at, diagnosis_code)
+SELECT alice, dr_smith, amox, 20, '1 tab BID', NOW() - INTERVAL '3 days', 'J02.9' FROM ids UNION ALL
+SELECT alice, dr_smith, ibu, 30, 'PRN pain', NOW() - INTERVAL '2 days', NULL FROM ids UNION ALL
+SELECT bob, dr_jones, met, 60, '500mg BID', NOW() - INTERVAL '1 days', 'E11.9' FROM ids ON CONFLICT DO NOTHING;
@@ -1,6 +1,6 @@
 import React, { useEffect, useMemo, useRef, useState } from 'react'
 import { AuthProvider, useAuth } from './AuthContext.jsx'
-import { fetchTopDrugs, fetchPrescriptions, createPrescription, fetchPatientsForPhysician, fetchPhysiciansForPatient } from './dataService.js'
+import { fetchTopDrugs, fetchPrescriptions, createPrescription, fetchPatientsForPhysician, fetchPhysiciansForPatient, searchDrugs } from './dataService.js'
 
 function Login() {
   const { login, isAuthed } = useAuth()
@@ -310,11 +310,22 @@ function CreatePrescriptionForm({ onCreated }) {
   const [patients, setPatients] = useState([])
   const [pLoading, setPLoading] = useState(false)
   const [pError, setPError] = useState('')
+  const [drugOptions, setDrugOptions] = useState([])
 
   useEffect(() => {
     if (role === 'physician') setForm(f => ({ ...f, physician_id: userId }))
   }, [role, userId])
 
+  // Debounced drug catalog autocomplete
+  useEffect(() => {
+    const q = String(form.drug_name || '').trim()
+    if (role !== 'physician' || q.length < 2) { setDrugOptions([]); return }
+    const t = setTimeout(() => {
+      searchDrugs({ role, userId, q }).then(setDrugOptions).catch(() => setDrugOptions([]))
+    }, 250)
+    return () => clearTimeout(t)
+  }, [form.drug_name, role, userId])
+
   // Load linked patients when physician logs in or changes
   useEffect(() => {
     async function loadPatients() {
@@ -395,7 +406,10 @@ function CreatePrescriptionForm({ onCreated }) {
             <input type="number" required value={form.physician_id} onChange={e=>setForm({...form, physician_id: e.target.value})} disabled={true} />
           </label>
           <label>Drug Name
-            <input type="text" required value={form.drug_name} onChange={e=>setForm({...form, drug_name: e.target.value})} disabled={disabled} placeholder="e.g., Ibuprofen" />
+            <input type="text" required list="drug-options" value={form.drug_name} onChange={e=>setForm({...form, drug_name: e.target.value})} disabled={disabled} placeholder="e.g., Ibuprofen" />
+            <datalist id="drug-options">
+              {drugOptions.map(d => <option key={d.id} value={d.name} />)}
+            </datalist>
           </label>
           <label>Quantity
             <input type="number" min={1} required value={form.quantity} onChange={e=>setForm({...form, quantity: e.target.value})} disabled={disabled} />
@@ -1,8 +1,10 @@
 // Frontend always calls the real backend API
 const API_BASE = import.meta.env.VITE_API_BASE || 'http://localhost:8080'
+// All API calls go to the versioned surface; unprefixed paths are deprecated
+const API_V1 = `${API_BASE}/v1`
 
 export async function fetchTopDrugs({ from, to, limit = 10, role, userId }) {
-  const url = new URL(`${API_BASE}/analytics/top-drugs`)
+  const url = new URL(`${API_V1}/analytics/top-drugs`)
   // Use full-day RFC3339 bounds for backend
   const fromISO = new Date(from + 'T00:00:00Z').toISOString()
   const toISO = new Date(to + 'T23:59:59Z').toISOString()
@@ -21,7 +23,7 @@ export async function fetchTopDrugs({ from, to, limit = 10, role, userId }) {
   }
   if (!res.ok) {
     let msg = `Backend error: ${res.status}`
-    try { const j = await res.json(); if (j && j.error) msg = j.error } catch {}
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
     throw new Error(msg)
   }
   const body = await res.json()
@@ -29,7 +31,7 @@ export async function fetchTopDrugs({ from, to, limit = 10, role, userId }) {
 }
 
 export async function fetchPrescriptions({ role, userId, limit = 50, filters = {} }) {
-  const url = new URL(`${API_BASE}/prescriptions`)
+  const url = new URL(`${API_V1}/prescriptions`)
   url.searchParams.set('limit', String(limit))
   if (role === 'admin') {
     if (filters.patient_id) url.searchParams.set('patient_id', String(filters.patient_id))
@@ -41,20 +43,28 @@ export async function fetchPrescriptions({ role, userId, limit = 50, filters = {
   try { res = await fetch(url.toString(), { headers }) } catch (e) { throw new Error('Network error: unable to reach API') }
   if (!res.ok) {
     let msg = `Backend error: ${res.status}`
-    try { const j = await res.json(); if (j && j.error) msg = j.error } catch {}
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
     throw new Error(msg)
   }
   const body = await res.json()
   return body.items || []
 }
 
-export async function createPrescription({ role, userId, payload }) {
+export async function createPrescription({ role, userId, payload, idempotencyKey = crypto.randomUUID() }) {
   const headers = new Headers({ 'Content-Type': 'application/json', 'X-Role': role })
   if (role !== 'admin' && userId != null) headers.set('X-User-ID', String(userId))
-  const res = await fetch(`${API_BASE}/prescriptions`, { method: 'POST', headers, body: JSON.stringify(payload) })
+  // The same key is reused on retry so the backend replays instead of inserting twice
+  headers.set('Idempotency-Key', idempotencyKey)
+  const body = JSON.stringify(payload)
+  let res
+  for (let attempt = 0; ; attempt++) {
+    try { res = await fetch(`${API_V1}/prescriptions`, { method: 'POST', headers, body }); break } catch (e) {
+      if (attempt >= 2) throw new Error('Network error: unable to reach API')
+    }
+  }
   const text = await res.text()
   if (!res.ok) {
-    try { const j = JSON.parse(text); throw new Error(j.error || `Backend error: ${res.status}`) } catch { throw new Error(text || `Backend error: ${res.status}`) }
+    try { const j = JSON.parse(text); throw new Error(j.detail || j.error || `Backend error: ${res.status}`) } catch { throw new Error(text || `Backend error: ${res.status}`) }
   }
   return JSON.parse(text)
 }
@@ -66,13 +76,13 @@ export async function fetchPatientsForPhysician({ role, userId, physicianId }) {
   if (role !== 'admin' && userId != null) headers.set('X-User-ID', String(userId))
   let res
   try {
-    res = await fetch(`${API_BASE}/physicians/${id}/patients`, { headers })
+    res = await fetch(`${API_V1}/physicians/${id}/patients`, { headers })
   } catch (e) {
     throw new Error('Network error: unable to reach API')
   }
   if (!res.ok) {
     let msg = `Backend error: ${res.status}`
-    try { const j = await res.json(); if (j && j.error) msg = j.error } catch {}
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
     throw new Error(msg)
   }
   const body = await res.json()
@@ -86,13 +96,50 @@ export async function fetchPhysiciansForPatient({ role, userId, patientId }) {
   if (role !== 'admin' && userId != null) headers.set('X-User-ID', String(userId))
   let res
   try {
-    res = await fetch(`${API_BASE}/patients/${id}/physicians`, { headers })
+    res = await fetch(`${API_V1}/patients/${id}/physicians`, { headers })
   } catch (e) {
     throw new Error('Network error: unable to reach API')
   }
   if (!res.ok) {
     let msg = `Backend error: ${res.status}`
-    try { const j = await res.json(); if (j && j.error) msg = j.error } catch {}
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
+    throw new Error(msg)
+  }
+  const body = await res.json()
+  return body.items || []
+}
+
+// Search the drug catalog (for drug name autocomplete)
+export async function searchDrugs({ role, userId, q, limit = 10 }) {
+  const url = new URL(`${API_V1}/drugs`)
+  url.searchParams.set('q', q)
+  url.searchParams.set('limit', String(limit))
+  const headers = new Headers({ 'X-Role': role })
+  if (role !== 'admin' && userId != null) headers.set('X-User-ID', String(userId))
+  let res
+  try { res = await fetch(url.toString(), { headers }) } catch (e) { throw new Error('Network error: unable to reach API') }
+  if (!res.ok) {
+    let msg = `Backend error: ${res.status}`
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
+    throw new Error(msg)
+  }
+  const body = await res.json()
+  return body.items || []
+}
+
+// Omnibox search across patients, physicians, and drugs; items carry a "type"
+export async function search({ role, userId, q, limit = 5, types }) {
+  const url = new URL(`${API_V1}/search`)
+  url.searchParams.set('q', q)
+  url.searchParams.set('limit', String(limit))
+  if (types) url.searchParams.set('types', types.join(','))
+  const headers = new Headers({ 'X-Role': role })
+  if (role !== 'admin' && userId != null) headers.set('X-User-ID', String(userId))
+  let res
+  try { res = await fetch(url.toString(), { headers }) } catch (e) { throw new Error('Network error: unable to reach API') }
+  if (!res.ok) {
+    let msg = `Backend error: ${res.status}`
+    try { const j = await res.json(); if (j && (j.detail || j.error)) msg = j.detail || j.error } catch {}
     throw new Error(msg)
   }
   const body = await res.json()